@@ -0,0 +1,143 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MachineClientTokenType is the type of the access tokens of a machine client
+// +kubebuilder:validation:Enum=bearer;jwt
+type MachineClientTokenType string
+
+const (
+	// MachineClientTokenBearer is an opaque access token, the resource servers introspect it
+	MachineClientTokenBearer MachineClientTokenType = "bearer"
+	// MachineClientTokenJWT is a signed access token carrying the permissions of the client
+	MachineClientTokenJWT MachineClientTokenType = "jwt"
+)
+
+// MachineClientKey is a public key the client signs the assertions of the JWT profile grant with
+type MachineClientKey struct {
+	// KeyID is the kid of the assertions signed with the key
+	// +kubebuilder:validation:MinLength=1
+	KeyID string `json:"kid"`
+
+	// PublicKey is the PEM encoded public key
+	// +kubebuilder:validation:MinLength=1
+	PublicKey string `json:"publicKey"`
+
+	// ExpirationTime is the time the key expires at, it never expires if empty
+	// +optional
+	ExpirationTime *metav1.Time `json:"expirationTime,omitempty"`
+
+	// Revoked keys are rejected, the key is kept to tell a revoked key from an unknown one
+	// +optional
+	Revoked bool `json:"revoked,omitempty"`
+}
+
+// MachineClientSpec defines the desired state of MachineClient
+type MachineClientSpec struct {
+	// Desc describes the client
+	// +optional
+	Desc string `json:"desc,omitempty"`
+
+	// SecretName is the Secret in the namespace of the client holding the bcrypt hashes of its secrets. Every key
+	// of the Secret is a secret the client authenticates with, so a secret is rotated by adding the new one and
+	// removing the old one once the client switched over. A client without it only uses the JWT profile grant.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// Scopes the client may request, a request for any other scope is rejected
+	// +optional
+	Scopes []string `json:"scopes,omitempty"`
+
+	// Audiences of the access tokens of the client, its client_id if empty
+	// +optional
+	Audiences []string `json:"audiences,omitempty"`
+
+	// Policies in the namespace of the client bound to it, their rules are the permissions of its access tokens
+	// +optional
+	Policies []string `json:"policies,omitempty"`
+
+	// Keys the client signs the assertions of the JWT profile grant with
+	// +listType=map
+	// +listMapKey=kid
+	// +optional
+	Keys []MachineClientKey `json:"keys,omitempty"`
+
+	// JWKSURI is the url of a JWKS document with further keys of the client
+	// +kubebuilder:validation:Pattern=`^https://`
+	// +optional
+	JWKSURI string `json:"jwksURI,omitempty"`
+
+	// AccessTokenType is the type of the access tokens of the client
+	// +kubebuilder:default=bearer
+	// +optional
+	AccessTokenType MachineClientTokenType `json:"accessTokenType,omitempty"`
+
+	// Disabled clients can not get any token
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// MachineClientStatus defines the observed state of MachineClient.
+type MachineClientStatus struct {
+	// Conditions of the client
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Secret",type=string,JSONPath=`.spec.secretName`
+// +kubebuilder:printcolumn:name="Disabled",type=boolean,JSONPath=`.spec.disabled`
+
+// MachineClient is a client authenticating with the client credentials or the JWT profile grant on its own
+// behalf, its client_id is name/namespace or the bare name in the default namespace
+type MachineClient struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty,omitzero"`
+
+	// spec defines the desired state of MachineClient
+	// +required
+	Spec MachineClientSpec `json:"spec"`
+
+	// status defines the observed state of MachineClient
+	// +optional
+	Status MachineClientStatus `json:"status,omitempty,omitzero"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+
+// MachineClientList contains a list of MachineClient
+type MachineClientList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MachineClient `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MachineClient{}, &MachineClientList{})
+}
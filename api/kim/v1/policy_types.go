@@ -20,6 +20,20 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// EffectAllow allows the actions of a rule
+	EffectAllow = "Allow"
+	// EffectDeny denies the actions of a rule, even if another rule allows them
+	EffectDeny = "Deny"
+
+	// PolicyConditionReady is true while the rules of the policy are valid
+	PolicyConditionReady = "Ready"
+
+	// reasons of the Ready condition
+	PolicyReasonValid       = "Valid"
+	PolicyReasonInvalidSpec = "InvalidSpec"
+)
+
 // PolicySpec defines the desired state of Policy
 type PolicySpec struct {
 	// Description of the policy
@@ -32,11 +46,15 @@ type PolicySpec struct {
 
 // Rule defines a single policy rule
 type Rule struct {
-	// Resource type the rule applies to
+	// Resource type the rule applies to. An Allow rule only grants the resources of kim of the namespace
+	// of its Policy, e.g. user/team-a/*, unless the Policy is in the admin namespace of kim.
 	Resource string `json:"resource"`
 	// List of actions allowed by the rule
 	Actions []string `json:"actions"`
-	// Effect of the rule (Allow/Deny)
+	// Effect of the rule, Allow or Deny. It has no default: a rule whose effect was left out is rejected
+	// rather than allowing its actions, and the objects must not depend on the webhooks, which may be disabled,
+	// to be read the same way.
+	// +kubebuilder:validation:Enum=Allow;Deny
 	Effect string `json:"effect"`
 }
 
@@ -46,6 +64,8 @@ type PolicyStatus struct {
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 
@@ -0,0 +1,194 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// RealmConditionReady is true while the issuer of the realm is served
+	RealmConditionReady = "Ready"
+
+	// reasons of the Ready condition
+	RealmReasonServing            = "Serving"
+	RealmReasonInvalidSpec        = "InvalidSpec"
+	RealmReasonSecretNotFound     = "SecretNotFound"
+	RealmReasonInvalidSigningKey  = "InvalidSigningKey"
+	RealmReasonIssuerConflict     = "IssuerConflict"
+	RealmReasonServingUnavailable = "ServingUnavailable"
+
+	// RealmSigningKeyKey is the key of the PEM encoded RSA private key in the Secret referenced by
+	// RealmSpec.SigningKeySecretName
+	RealmSigningKeyKey = "tls.key"
+	// RealmClientSecretKey is the key of the client secret in the Secret referenced by RealmClient.SecretName
+	RealmClientSecretKey = "clientSecret"
+)
+
+// RealmClientType selects the flows a client of a realm may use
+// +kubebuilder:validation:Enum=web;native;device
+type RealmClientType string
+
+const (
+	// RealmClientWeb is a confidential client of the authorization code flow
+	RealmClientWeb RealmClientType = "web"
+	// RealmClientNative is a public client of the authorization code flow with PKCE
+	RealmClientNative RealmClientType = "native"
+	// RealmClientDevice is a public client of the device authorization grant
+	RealmClientDevice RealmClientType = "device"
+)
+
+// RealmClient is an OAuth client registered in the realm
+type RealmClient struct {
+	// ID is the client_id
+	// +kubebuilder:validation:MinLength=1
+	ID string `json:"id"`
+
+	// Type of the client
+	// +kubebuilder:default=web
+	Type RealmClientType `json:"type,omitempty"`
+
+	// SecretName is the Secret in the namespace of the realm holding the secret of web clients
+	// under the clientSecret key
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// RedirectURIs are the allowed redirect_uris
+	// +optional
+	RedirectURIs []string `json:"redirectURIs,omitempty"`
+
+	// PostLogoutRedirectURIs are the allowed post_logout_redirect_uris
+	// +optional
+	PostLogoutRedirectURIs []string `json:"postLogoutRedirectURIs,omitempty"`
+
+	// FrontChannelLogoutURI is loaded in an iframe of the logout page with the iss and sid query parameters,
+	// when the user signs out of a session the client was signed in to
+	// +kubebuilder:validation:Pattern=`^https?://`
+	// +optional
+	FrontChannelLogoutURI string `json:"frontChannelLogoutURI,omitempty"`
+
+	// BackChannelLogoutURI receives a logout token with the sid claim, when a session the client was signed in to ends
+	// +kubebuilder:validation:Pattern=`^https?://`
+	// +optional
+	BackChannelLogoutURI string `json:"backChannelLogoutURI,omitempty"`
+
+	// Theme of the login pages of the client, the theme of the realm if empty
+	// +optional
+	Theme string `json:"theme,omitempty"`
+
+	// SubjectType of the client, pairwise subjects keep the clients of different sectors from correlating the users
+	// +kubebuilder:validation:Enum=public;pairwise
+	// +kubebuilder:default=public
+	// +optional
+	SubjectType string `json:"subjectType,omitempty"`
+
+	// SectorIdentifierURI groups the clients of a sector, the document of the uri provided to the server must list
+	// the redirect uris of the client. Pairwise clients without it are grouped by the host of their redirect uris.
+	// +kubebuilder:validation:Pattern=`^https://`
+	// +optional
+	SectorIdentifierURI string `json:"sectorIdentifierURI,omitempty"`
+}
+
+// RealmBranding customizes the login pages of the realm
+type RealmBranding struct {
+	// Theme of the login pages of the clients without a theme of their own
+	// +optional
+	Theme string `json:"theme,omitempty"`
+}
+
+// RealmSpec defines the desired state of Realm
+type RealmSpec struct {
+	// Issuer is the issuer url of the realm, its host and path select the requests of the realm,
+	// e.g. https://login.example.com/ or https://kim.example.com/realms/example.
+	// On the host of the issuer of the server it must be below the /realms/ path of that issuer.
+	// +kubebuilder:validation:Pattern=`^https?://`
+	Issuer string `json:"issuer"`
+
+	// SigningKeySecretName is the Secret in the namespace of the realm holding the RSA key the tokens are signed with
+	// under the tls.key key. A random key is generated if empty, which differs between the replicas and restarts.
+	// +optional
+	SigningKeySecretName string `json:"signingKeySecretName,omitempty"`
+
+	// Namespaces of the Users belonging to the realm, the namespace of the realm if empty.
+	// Only the namespace of the realm is allowed, the Users of other namespaces are not signed in by the realm.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Clients registered in the realm
+	// +listType=map
+	// +listMapKey=id
+	// +optional
+	Clients []RealmClient `json:"clients,omitempty"`
+
+	// Branding of the login pages
+	// +optional
+	Branding RealmBranding `json:"branding,omitempty"`
+}
+
+// RealmStatus defines the observed state of Realm.
+type RealmStatus struct {
+	// ObservedGeneration is the generation of the spec the realm is served with
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Issuer is the issuer the realm is served at
+	// +optional
+	Issuer string `json:"issuer,omitempty"`
+
+	// Conditions of the realm, e.g. Ready
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Issuer",type=string,JSONPath=`.spec.issuer`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+
+// Realm is an issuer served by kim with its own signing key, clients and users
+type Realm struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty,omitzero"`
+
+	// spec defines the desired state of Realm
+	// +required
+	Spec RealmSpec `json:"spec"`
+
+	// status defines the observed state of Realm
+	// +optional
+	Status RealmStatus `json:"status,omitempty,omitzero"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+
+// RealmList contains a list of Realm
+type RealmList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Realm `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Realm{}, &RealmList{})
+}
@@ -20,11 +20,20 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// RoleConditionReady is true while all permissions of the role resolve to Policies
+	RoleConditionReady = "Ready"
+
+	// reasons of the Ready condition
+	RoleReasonResolved       = "Resolved"
+	RoleReasonPolicyNotFound = "PolicyNotFound"
+)
+
 // RoleSpec defines the desired state of Role
 type RoleSpec struct {
 	// Description of the role
 	Desc string `json:"desc"`
-	// List of permissions associated with the role
+	// Permissions are the Policies in the namespace of the role it grants
 	Permissions []string `json:"permissions"`
 }
 
@@ -34,6 +43,8 @@ type RoleStatus struct {
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 
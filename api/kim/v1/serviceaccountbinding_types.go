@@ -0,0 +1,80 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ServiceAccountBindingSpec defines the desired state of ServiceAccountBinding
+type ServiceAccountBindingSpec struct {
+	// ServiceAccountName is the ServiceAccount in the namespace of the binding whose tokens are exchanged
+	// +kubebuilder:validation:MinLength=1
+	ServiceAccountName string `json:"serviceAccountName"`
+
+	// MachineClientName is the MachineClient in the namespace of the binding the ServiceAccount acts as,
+	// the Policies of the client are the permissions of the exchanged tokens
+	// +kubebuilder:validation:MinLength=1
+	MachineClientName string `json:"machineClientName"`
+}
+
+// ServiceAccountBindingStatus defines the observed state of ServiceAccountBinding.
+type ServiceAccountBindingStatus struct {
+	// Conditions of the binding
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="ServiceAccount",type=string,JSONPath=`.spec.serviceAccountName`
+// +kubebuilder:printcolumn:name="MachineClient",type=string,JSONPath=`.spec.machineClientName`
+
+// ServiceAccountBinding lets a ServiceAccount exchange its tokens for the access tokens of a MachineClient,
+// so that the workloads running as the ServiceAccount need no client secret
+type ServiceAccountBinding struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty,omitzero"`
+
+	// spec defines the desired state of ServiceAccountBinding
+	// +required
+	Spec ServiceAccountBindingSpec `json:"spec"`
+
+	// status defines the observed state of ServiceAccountBinding
+	// +optional
+	Status ServiceAccountBindingStatus `json:"status,omitempty,omitzero"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+
+// ServiceAccountBindingList contains a list of ServiceAccountBinding
+type ServiceAccountBindingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ServiceAccountBinding `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ServiceAccountBinding{}, &ServiceAccountBindingList{})
+}
@@ -17,6 +17,9 @@ limitations under the License.
 package v1
 
 import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -46,10 +49,71 @@ type UserSpec struct {
 	Desc       string `json:"desc"`
 	SecretName string `json:"secretName"`
 	Claim      `json:",inline"`
+
+	// Policies in the namespace of the user bound to it, e.g. to impersonate other users
+	// +optional
+	Policies []string `json:"policies,omitempty"`
 }
 
+const (
+	// UserConditionLocked is true while the logins of the user are locked after too many failed attempts
+	UserConditionLocked = "Locked"
+
+	// UnlockAnnotation lets an admin lift the lockout of a user before it expires,
+	// it is removed once the user was unlocked
+	UnlockAnnotation = "kim.kim.io/unlock"
+
+	// SubjectAnnotation carries the subject (sub claim) of a user in the files of kim admin export,
+	// kim admin import keeps it in the status of the imported user. It is not accepted on the Users of the cluster,
+	// whose owners must not choose the subject of another user.
+	SubjectAnnotation = "kim.kim.io/subject"
+
+	// reasons of the Locked condition
+	UserReasonTooManyFailedLogins = "TooManyFailedLogins"
+	UserReasonLoginSucceeded      = "LoginSucceeded"
+	UserReasonLockExpired         = "LockExpired"
+	UserReasonUnlockedByAdmin     = "UnlockedByAdmin"
+)
+
 // UserStatus defines the observed state of User.
-type UserStatus struct{}
+type UserStatus struct {
+	// ObservedGeneration is the generation of the spec the last audit event
+	// of a change was recorded for
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Subject is the opaque subject (sub claim) of the user instead of its UID, e.g. the subject of a user
+	// imported from another cluster. It is written by kim admin import through the status subresource.
+	// +optional
+	Subject string `json:"subject,omitempty"`
+
+	// LockedUntil is the end of the current lockout of the user
+	// +optional
+	LockedUntil *metav1.Time `json:"lockedUntil,omitempty"`
+
+	// Conditions of the user, e.g. Locked
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// SetLocked sets the Locked condition of the user, a zero until unlocks the user
+func (s *UserStatus) SetLocked(until time.Time, reason string) {
+	condition := metav1.Condition{
+		Type:               UserConditionLocked,
+		Status:             metav1.ConditionFalse,
+		Reason:             reason,
+		ObservedGeneration: s.ObservedGeneration,
+	}
+	s.LockedUntil = nil
+	if !until.IsZero() {
+		condition.Status = metav1.ConditionTrue
+		condition.Message = "too many failed logins, locked until " + until.UTC().Format(time.RFC3339)
+		s.LockedUntil = &metav1.Time{Time: until}
+	}
+	meta.SetStatusCondition(&s.Conditions, condition)
+}
 
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -0,0 +1,150 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WorkloadTrustClaim is a condition on a claim of the trusted JWTs
+type WorkloadTrustClaim struct {
+	// Name of the claim, a string or a list of strings
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Value the claim must match, `*` matches any characters; a list matches if any of its values does
+	Value string `json:"value"`
+}
+
+// WorkloadTrustSpec defines the desired state of WorkloadTrust
+// +kubebuilder:validation:XValidation:rule="has(self.machineClientName) != has(self.policies)",message="exactly one of machineClientName and policies is required"
+// +kubebuilder:validation:XValidation:rule="(has(self.subject) && self.subject.matches('[^*]')) || (has(self.claims) && self.claims.exists(c, c.value.matches('[^*]')))",message="a subject or a claim condition not matching any value is required"
+// +kubebuilder:validation:XValidation:rule="has(self.jwks) || has(self.discoveryURL) || self.issuer.startsWith('https://')",message="the keys of the issuer are only discovered over https"
+type WorkloadTrustSpec struct {
+	// Desc describes the trust
+	// +optional
+	Desc string `json:"desc,omitempty"`
+
+	// Issuer is the iss claim of the trusted JWTs
+	// +kubebuilder:validation:MinLength=1
+	Issuer string `json:"issuer"`
+
+	// JWKS is the JWKS document with the keys of the issuer, the keys are discovered if empty
+	// +optional
+	JWKS string `json:"jwks,omitempty"`
+
+	// DiscoveryURL is the url of the discovery document naming the jwks_uri of the issuer,
+	// the well-known openid-configuration of the issuer if empty
+	// +kubebuilder:validation:Pattern=`^https://`
+	// +optional
+	DiscoveryURL string `json:"discoveryURL,omitempty"`
+
+	// Audiences of which the trusted JWTs must have one, so that the JWTs issued for other services are rejected
+	// +kubebuilder:validation:MinItems=1
+	Audiences []string `json:"audiences"`
+
+	// Subject the sub claim of the trusted JWTs must match, `*` matches any characters.
+	// The trust needs a subject or a claim condition, so that it does not trust every JWT of the issuer.
+	// +optional
+	Subject string `json:"subject,omitempty"`
+
+	// Claims are further conditions the trusted JWTs must all meet
+	// +optional
+	Claims []WorkloadTrustClaim `json:"claims,omitempty"`
+
+	// MachineClientName is the MachineClient in the namespace of the trust the workloads act as,
+	// the trusted JWTs are exchanged for its tokens
+	// +optional
+	MachineClientName string `json:"machineClientName,omitempty"`
+
+	// Policies in the namespace of the trust granted to the workloads by tokens with the trust as their subject
+	// +optional
+	Policies []string `json:"policies,omitempty"`
+
+	// Scopes the workloads may request with the Policies, the MachineClient allows its own scopes
+	// +optional
+	Scopes []string `json:"scopes,omitempty"`
+
+	// Disabled trusts do not match any JWT
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// Conditioned reports whether the subject or a claim condition of the trust matches less than any value,
+// a trust without such conditions would trust every JWT of its issuer
+func (s *WorkloadTrustSpec) Conditioned() bool {
+	if strings.Trim(s.Subject, "*") != "" {
+		return true
+	}
+	for _, claim := range s.Claims {
+		if strings.Trim(claim.Value, "*") != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// WorkloadTrustStatus defines the observed state of WorkloadTrust.
+type WorkloadTrustStatus struct {
+	// Conditions of the trust
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Issuer",type=string,JSONPath=`.spec.issuer`
+// +kubebuilder:printcolumn:name="Subject",type=string,JSONPath=`.spec.subject`
+// +kubebuilder:printcolumn:name="MachineClient",type=string,JSONPath=`.spec.machineClientName`
+// +kubebuilder:printcolumn:name="Disabled",type=boolean,JSONPath=`.spec.disabled`
+
+// WorkloadTrust trusts the JWTs of an external issuer, e.g. of a CI system or another cluster, so that the
+// workloads exchange them for short-lived tokens by the jwt-bearer grant or a token exchange
+type WorkloadTrust struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty,omitzero"`
+
+	// spec defines the desired state of WorkloadTrust
+	// +required
+	Spec WorkloadTrustSpec `json:"spec"`
+
+	// status defines the observed state of WorkloadTrust
+	// +optional
+	Status WorkloadTrustStatus `json:"status,omitempty,omitzero"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+
+// WorkloadTrustList contains a list of WorkloadTrust
+type WorkloadTrustList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WorkloadTrust `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WorkloadTrust{}, &WorkloadTrustList{})
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CryptoKeySecretKey is the key of the crypto key in its Secret
+const CryptoKeySecretKey = "key"
+
+// CryptoKey returns the secret the codes and tokens of the issuers are encrypted with. It is the crypto-key if set,
+// otherwise a random key is generated once and kept in the Secret of crypto-key-secret, so that all replicas
+// share it and the tokens survive restarts.
+func CryptoKey(ctx context.Context) ([]byte, error) {
+	if key := viper.GetString("crypto-key"); key != "" {
+		return []byte(key), nil
+	}
+	namespace, name, ok := strings.Cut(viper.GetString("crypto-key-secret"), "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("crypto-key-secret %q is no <namespace>/<name>", viper.GetString("crypto-key-secret"))
+	}
+	c, err := Client()
+	if err != nil {
+		return nil, err
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	err = c.Get(ctx, client.ObjectKeyFromObject(secret), secret)
+	if apierrors.IsNotFound(err) {
+		key := make([]byte, 32)
+		if _, err = rand.Read(key); err != nil {
+			return nil, err
+		}
+		secret.Data = map[string][]byte{CryptoKeySecretKey: key}
+		// another replica may have created it in the meantime, its key wins
+		if err = c.Create(ctx, secret); apierrors.IsAlreadyExists(err) {
+			err = c.Get(ctx, client.ObjectKeyFromObject(secret), secret)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	key := secret.Data[CryptoKeySecretKey]
+	if len(key) < 32 {
+		return nil, fmt.Errorf("the %s of the Secret %s/%s has less than 32 bytes", CryptoKeySecretKey, namespace, name)
+	}
+	return key, nil
+}
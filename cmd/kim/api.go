@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/admin"
+)
+
+// apiBackend calls the admin API of the manager
+type apiBackend struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func newAPIBackend(baseURL, token string) *apiBackend {
+	return &apiBackend{baseURL: baseURL, token: token, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// do sends in as the body of the request and decodes the response into out, the failures are returned as *admin.Error
+func (b *apiBackend) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, b.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if b.token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.token)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &admin.Error{}
+		if err = json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = resp.Status
+		}
+		apiErr.Status = resp.StatusCode
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// isStatus reports whether the admin API responded the status
+func isStatus(err error, status int) bool {
+	var apiErr *admin.Error
+	return errors.As(err, &apiErr) && apiErr.Status == status
+}
+
+// isNotFound reports whether the object does not exist, in the cluster or by the admin API
+func isNotFound(err error) bool {
+	return apierrors.IsNotFound(err) || isStatus(err, http.StatusNotFound)
+}
+
+func itemPath(k kind, namespace, name string) string {
+	return "/" + k.path + "/" + url.PathEscape(namespace) + "/" + url.PathEscape(name)
+}
+
+func (b *apiBackend) list(ctx context.Context, k kind, namespace string) ([]client.Object, error) {
+	path := "/" + k.path
+	if namespace != "" {
+		path += "?namespace=" + url.QueryEscape(namespace)
+	}
+	list := k.list()
+	if err := b.do(ctx, http.MethodGet, path, nil, list); err != nil {
+		return nil, err
+	}
+	return objects(list)
+}
+
+func (b *apiBackend) apply(ctx context.Context, obj client.Object) (bool, error) {
+	k, ok := kindOf(obj)
+	if !ok {
+		return false, fmt.Errorf("unsupported object %T", obj)
+	}
+	// an empty resourceVersion replaces the latest version
+	obj.SetResourceVersion("")
+	if user, ok := obj.(*kimv1.User); ok {
+		// the admin API does not set the subjects, the imported users get the subject of their UID
+		delete(user.Annotations, kimv1.SubjectAnnotation)
+	}
+	err := b.do(ctx, http.MethodPut, itemPath(k, obj.GetNamespace(), obj.GetName()), obj, nil)
+	if !isStatus(err, http.StatusNotFound) {
+		return false, err
+	}
+	return true, b.do(ctx, http.MethodPost, "/"+k.path, obj, nil)
+}
+
+func (b *apiBackend) getUser(ctx context.Context, key types.NamespacedName) (*kimv1.User, error) {
+	user := &kimv1.User{}
+	if err := b.do(ctx, http.MethodGet, itemPath(userKind, key.Namespace, key.Name), nil, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (b *apiBackend) setPassword(ctx context.Context, user *kimv1.User, password string) error {
+	path := itemPath(userKind, user.Namespace, user.Name) + "/password"
+	return b.do(ctx, http.MethodPut, path, &admin.PasswordRequest{Password: password}, nil)
+}
+
+func (b *apiBackend) rotateKey(ctx context.Context, realm types.NamespacedName) (string, error) {
+	if realm.Name != "" {
+		return "", errors.New("the admin API rotates the key of the default issuer, " +
+			"rotate the key of a realm in the cluster without --server")
+	}
+	resp := &admin.RotateKeyResponse{}
+	if err := b.do(ctx, http.MethodPost, "/keys/rotate", nil, resp); err != nil {
+		return "", err
+	}
+	return resp.KeyID, nil
+}
+
+func (b *apiBackend) revokeTokens(ctx context.Context, subject, clientID string) (int, error) {
+	resp := &admin.RevokeTokensResponse{}
+	req := &admin.RevokeTokensRequest{Subject: subject, ClientID: clientID}
+	if err := b.do(ctx, http.MethodPost, "/tokens/revoke", req, resp); err != nil {
+		return 0, err
+	}
+	return resp.Revoked, nil
+}
+
+// objects returns the items of the list
+func objects(list client.ObjectList) ([]client.Object, error) {
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	objs := make([]client.Object, 0, len(items))
+	for _, item := range items {
+		objs = append(objs, item.(client.Object))
+	}
+	return objs, nil
+}
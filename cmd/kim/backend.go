@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/cmd"
+	"github.com/crochee/kim/internal/admin"
+	"github.com/crochee/kim/pkg/client/clientset/versioned"
+)
+
+// fieldManager is the field manager of the changes of kim admin in the cluster
+const fieldManager = "kim-admin"
+
+// backend is how kim admin reaches kim, by the admin API of the manager or directly in the cluster
+type backend interface {
+	// list returns the objects of the kind in the namespace, in all namespaces if it is empty
+	list(ctx context.Context, k kind, namespace string) ([]client.Object, error)
+	// apply creates the object or replaces the existing one, created reports which
+	apply(ctx context.Context, obj client.Object) (created bool, err error)
+	getUser(ctx context.Context, key types.NamespacedName) (*kimv1.User, error)
+	// setPassword writes the bcrypt hash of the password to the Secret of the user
+	setPassword(ctx context.Context, user *kimv1.User, password string) error
+	// rotateKey replaces the signing key of the realm, of the default issuer if the realm is empty,
+	// and returns the kid of the new key
+	rotateKey(ctx context.Context, realm types.NamespacedName) (string, error)
+	// revokeTokens revokes the tokens of the subject, of the client or of both and returns their number
+	revokeTokens(ctx context.Context, subject, clientID string) (int, error)
+}
+
+// kind is a kind administered by kim admin
+type kind struct {
+	// name names the objects of the kind, e.g. user/team-a/alice, like the resources of the policies
+	name string
+	// path is the path of the collection in the admin API
+	path   string
+	kind   string
+	object func() client.Object
+	list   func() client.ObjectList
+}
+
+// kinds are ordered by their references, the objects referred to come first
+var kinds = []kind{
+	{
+		name:   "policy",
+		path:   "policies",
+		kind:   "Policy",
+		object: func() client.Object { return &kimv1.Policy{} },
+		list:   func() client.ObjectList { return &kimv1.PolicyList{} },
+	},
+	{
+		name:   "role",
+		path:   "roles",
+		kind:   "Role",
+		object: func() client.Object { return &kimv1.Role{} },
+		list:   func() client.ObjectList { return &kimv1.RoleList{} },
+	},
+	{
+		name:   "client",
+		path:   "clients",
+		kind:   "MachineClient",
+		object: func() client.Object { return &kimv1.MachineClient{} },
+		list:   func() client.ObjectList { return &kimv1.MachineClientList{} },
+	},
+	{
+		name:   "binding",
+		path:   "bindings",
+		kind:   "ServiceAccountBinding",
+		object: func() client.Object { return &kimv1.ServiceAccountBinding{} },
+		list:   func() client.ObjectList { return &kimv1.ServiceAccountBindingList{} },
+	},
+	{
+		name:   "user",
+		path:   "users",
+		kind:   "User",
+		object: func() client.Object { return &kimv1.User{} },
+		list:   func() client.ObjectList { return &kimv1.UserList{} },
+	},
+}
+
+var userKind, _ = kindByName("User")
+
+// kindOf returns the kind of the object by its Go type
+func kindOf(obj client.Object) (kind, bool) {
+	for _, k := range kinds {
+		if reflect.TypeOf(k.object()) == reflect.TypeOf(obj) {
+			return k, true
+		}
+	}
+	return kind{}, false
+}
+
+// kindByName returns the kind of the Kubernetes kind, e.g. User
+func kindByName(name string) (kind, bool) {
+	for _, k := range kinds {
+		if k.kind == name {
+			return k, true
+		}
+	}
+	return kind{}, false
+}
+
+// newBackend returns the admin API of the server flag, or else the cluster of the kubeconfig
+func newBackend() (backend, error) {
+	if server := viper.GetString("server"); server != "" {
+		return newAPIBackend(strings.TrimSuffix(server, "/")+admin.BasePath, viper.GetString("token")), nil
+	}
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	kim, err := versioned.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c, err := cmd.Client()
+	if err != nil {
+		return nil, err
+	}
+	return &clusterBackend{kim: kim, client: c}, nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/clientip"
+	"github.com/crochee/kim/internal/policy"
+	"github.com/crochee/kim/internal/ratelimit"
+	"github.com/crochee/kim/internal/storage"
+	"github.com/crochee/kim/internal/tracing"
+)
+
+// checkObjects returns the problems of the objects, the references are resolved among the objects
+func checkObjects(objs []client.Object) []string {
+	var problems []string
+	report := func(obj client.Object, format string, args ...any) {
+		problems = append(problems, objectName(obj)+": "+fmt.Sprintf(format, args...))
+	}
+	exists := map[string]bool{}
+	for _, obj := range objs {
+		exists[objectName(obj)] = true
+	}
+	checkPolicies := func(obj client.Object, policies []string) {
+		for _, name := range policies {
+			if !exists["policy/"+obj.GetNamespace()+"/"+name] {
+				report(obj, "the policy %s does not exist", name)
+			}
+		}
+	}
+	// the claims the users log in with must be unique among the users
+	logins := map[string]string{}
+	checkLogin := func(obj client.Object, claim string, value *string) {
+		if value == nil || *value == "" {
+			return
+		}
+		key := claim + "=" + strings.ToLower(*value)
+		if other, ok := logins[key]; ok {
+			report(obj, "the %s %s is also the %s of %s", claim, *value, claim, other)
+			return
+		}
+		logins[key] = objectName(obj)
+	}
+
+	for _, obj := range objs {
+		switch o := obj.(type) {
+		case *kimv1.User:
+			if o.Spec.SecretName == "" {
+				report(obj, "no secretName, the user can not log in by a password")
+			}
+			if o.Spec.Email != nil {
+				if _, err := mail.ParseAddress(*o.Spec.Email); err != nil {
+					report(obj, "invalid email %q", *o.Spec.Email)
+				}
+			}
+			checkLogin(obj, "email", o.Spec.Email)
+			checkLogin(obj, "preferredUsername", o.Spec.PreferredUsername)
+			checkPolicies(obj, o.Spec.Policies)
+		case *kimv1.MachineClient:
+			checkPolicies(obj, o.Spec.Policies)
+		case *kimv1.Policy:
+			for _, err := range policy.Validate(&o.Spec, field.NewPath("spec")) {
+				report(obj, "%s", err)
+			}
+		case *kimv1.Role:
+			checkPolicies(obj, o.Spec.Permissions)
+		case *kimv1.ServiceAccountBinding:
+			if !exists["client/"+obj.GetNamespace()+"/"+o.Spec.MachineClientName] {
+				report(obj, "the client %s does not exist", o.Spec.MachineClientName)
+			}
+		}
+	}
+	return problems
+}
+
+// checkConfig returns the problems of the manager configuration, the unset keys have valid defaults
+func checkConfig(v *viper.Viper) []string {
+	var problems []string
+	report := func(key string, err error) {
+		problems = append(problems, key+": "+err.Error())
+	}
+	oneOf := func(key string, values ...string) {
+		if value := v.GetString(key); v.IsSet(key) && !slices.Contains(values, value) {
+			report(key, fmt.Errorf("unknown value %q, expected one of %s", value, strings.Join(values, ", ")))
+		}
+	}
+	for _, s := range v.GetStringSlice("rate-limits") {
+		if _, err := ratelimit.ParseRule(s); err != nil {
+			report("rate-limits", err)
+		}
+	}
+	if _, err := clientip.ParsePrefixes(v.GetStringSlice("trusted-proxies")); err != nil {
+		report("trusted-proxies", err)
+	}
+	if v.IsSet("account-editable-fields") {
+		if err := storage.ValidateClaimFields(v.GetStringSlice("account-editable-fields")); err != nil {
+			report("account-editable-fields", err)
+		}
+	}
+	if v.IsSet("login-identifiers") {
+		if _, err := storage.ParseLoginIdentifiers(v.GetStringSlice("login-identifiers")); err != nil {
+			report("login-identifiers", err)
+		}
+	}
+	if len(v.GetStringMapString("pairwise-clients")) > 0 && v.GetString("pairwise-salt") == "" {
+		report("pairwise-salt", fmt.Errorf("required by the pairwise-clients"))
+	}
+	for _, sink := range v.GetStringSlice("audit-sinks") {
+		switch sink {
+		case "stdout", "file", "events":
+		case "webhook":
+			if v.GetString("audit-webhook-url") == "" {
+				report("audit-webhook-url", fmt.Errorf("required by the webhook audit sink"))
+			}
+		default:
+			report("audit-sinks", fmt.Errorf("unknown audit sink %q", sink))
+		}
+	}
+	oneOf("lockout-store", "memory", "kubernetes", "none")
+	oneOf("mailer", "smtp", "file", "none")
+	oneOf("theme-source", "none", "dir", "configmap")
+	oneOf("otel-protocol", tracing.ProtocolGRPC, tracing.ProtocolHTTP)
+	return problems
+}
+
+func newCheckCmd() *cobra.Command {
+	var (
+		managerConfig string
+		allNamespaces bool
+	)
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check the objects and the configuration of kim for errors",
+		Long: "Check the users, the clients, the policies, the roles and the bindings for invalid fields, duplicate logins and " +
+			"references to missing objects. In the cluster the Secrets of the users are checked for password hashes " +
+			"as well. With --manager-config the configuration file of the manager is checked.",
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			var problems []string
+			if managerConfig != "" {
+				v := viper.New()
+				v.SetConfigFile(managerConfig)
+				if err := v.ReadInConfig(); err != nil {
+					return err
+				}
+				problems = append(problems, checkConfig(v)...)
+			}
+			b, err := newBackend()
+			if err != nil {
+				return err
+			}
+			var objs []client.Object
+			for _, k := range kinds {
+				items, err := b.list(c.Context(), k, listNamespace(allNamespaces))
+				if err != nil {
+					return fmt.Errorf("unable to list the %s: %w", k.path, err)
+				}
+				objs = append(objs, items...)
+			}
+			problems = append(problems, checkObjects(objs)...)
+			// only the cluster has the Secrets, the admin API never returns the password hashes
+			if cluster, ok := b.(*clusterBackend); ok {
+				for _, obj := range objs {
+					user, ok := obj.(*kimv1.User)
+					if !ok || user.Spec.SecretName == "" {
+						continue
+					}
+					problem, err := cluster.passwordProblem(c.Context(), user)
+					if err != nil {
+						return err
+					}
+					if problem != "" {
+						problems = append(problems, objectName(user)+": "+problem)
+					}
+				}
+			}
+			for _, problem := range problems {
+				fmt.Fprintln(c.OutOrStdout(), problem)
+			}
+			if len(problems) > 0 {
+				return fmt.Errorf("%d problems found", len(problems))
+			}
+			fmt.Fprintln(c.ErrOrStderr(), "No problems found.")
+			return nil
+		},
+	}
+	f := cmd.Flags()
+	f.StringVar(&managerConfig, "manager-config", "", "The configuration file of the manager to check.")
+	f.BoolVarP(&allNamespaces, "all-namespaces", "A", false, "Check the objects of all namespaces.")
+	return cmd
+}
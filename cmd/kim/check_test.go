@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+func TestCheckObjects(t *testing.T) {
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Namespace: "team-a", Name: name}
+	}
+	objs := []client.Object{
+		&kimv1.Policy{ObjectMeta: meta("admin"), Spec: kimv1.PolicySpec{
+			Statement: "{",
+			Rules: []kimv1.Rule{
+				{Resource: "user/*", Actions: []string{"*"}, Effect: kimv1.EffectAllow},
+				{Resource: "user/*", Effect: "allow"},
+			},
+		}},
+		&kimv1.User{ObjectMeta: meta("alice"), Spec: kimv1.UserSpec{
+			SecretName: "alice-credentials",
+			Claim:      kimv1.Claim{Email: ptr.To("alice@example.com")},
+			Policies:   []string{"admin", "missing"},
+		}},
+		&kimv1.User{ObjectMeta: meta("bob"), Spec: kimv1.UserSpec{
+			Claim: kimv1.Claim{Email: ptr.To("Alice@example.com")},
+		}},
+		&kimv1.Role{ObjectMeta: meta("ops"), Spec: kimv1.RoleSpec{Permissions: []string{"admin", "viewer"}}},
+		&kimv1.ServiceAccountBinding{ObjectMeta: meta("ci"), Spec: kimv1.ServiceAccountBindingSpec{
+			ServiceAccountName: "ci", MachineClientName: "ci",
+		}},
+	}
+	want := []string{
+		"binding/team-a/ci: the client ci does not exist",
+		`policy/team-a/admin: spec.rules[1].actions: Required value: at least one action`,
+		`policy/team-a/admin: spec.rules[1].effect: Unsupported value: "allow": supported values: "Allow", "Deny"`,
+		`policy/team-a/admin: spec.statement: Invalid value: "{": must be JSON`,
+		"role/team-a/ops: the policy viewer does not exist",
+		"user/team-a/alice: the policy missing does not exist",
+		"user/team-a/bob: no secretName, the user can not log in by a password",
+		"user/team-a/bob: the email Alice@example.com is also the email of user/team-a/alice",
+	}
+	got := checkObjects(objs)
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("checkObjects() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader(`
+rate-limits: ["/oauth/token:ip=20/40", "/oauth/token:nobody=1/1"]
+trusted-proxies: ["10.0.0.0/8"]
+pairwise-clients:
+  web: ""
+audit-sinks: [stdout, syslog]
+mailer: smtp
+lockout-store: redis
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := checkConfig(v)
+	var keys []string
+	for _, problem := range got {
+		keys = append(keys, strings.SplitN(problem, ":", 2)[0])
+	}
+	want := []string{"rate-limits", "pairwise-salt", "audit-sinks", "lockout-store"}
+	if !slices.Equal(keys, want) {
+		t.Errorf("checkConfig() = %q, want problems of %v", got, want)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	user := &kimv1.User{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "team-a",
+			Name:            "alice",
+			UID:             types.UID("alice-uid"),
+			ResourceVersion: "42",
+			Annotations:     map[string]string{kimv1.UnlockAnnotation: "true"},
+		},
+		Spec:   kimv1.UserSpec{SecretName: "alice-credentials"},
+		Status: kimv1.UserStatus{ObservedGeneration: 3},
+	}
+	policy := &kimv1.Policy{ObjectMeta: metav1.ObjectMeta{Name: "admin"}}
+	buf := &bytes.Buffer{}
+	if err := writeObjects(buf, []client.Object{user, policy}); err != nil {
+		t.Fatal(err)
+	}
+	for _, unwanted := range []string{"uid", "resourceVersion", "status", kimv1.UnlockAnnotation} {
+		if strings.Contains(buf.String(), unwanted+":") {
+			t.Errorf("the export contains %s:\n%s", unwanted, buf)
+		}
+	}
+
+	objs, err := readObjects(buf, "team-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 {
+		t.Fatalf("readObjects() = %d objects, want 2", len(objs))
+	}
+	if name := objectName(objs[0]); name != "policy/team-b/admin" {
+		t.Errorf("first object = %s, want the policy in the default namespace", name)
+	}
+	imported, ok := objs[1].(*kimv1.User)
+	if !ok {
+		t.Fatalf("second object = %T, want the user", objs[1])
+	}
+	if imported.Namespace != "team-a" || imported.Spec.SecretName != "alice-credentials" {
+		t.Errorf("imported user = %s/%s %+v", imported.Namespace, imported.Name, imported.Spec)
+	}
+	if subject := imported.Annotations[kimv1.SubjectAnnotation]; subject != "alice-uid" {
+		t.Errorf("subject annotation = %q, want the UID of the exported user", subject)
+	}
+
+	if _, err = readObjects(strings.NewReader("apiVersion: v1\nkind: Secret\nmetadata:\n  name: x\n"), "team-a"); err == nil {
+		t.Error("readObjects() accepted a Secret")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/storage"
+	"github.com/crochee/kim/pkg/client/clientset/versioned"
+)
+
+// clusterBackend changes the objects in the cluster directly, the users by the generated clientset
+type clusterBackend struct {
+	kim    versioned.Interface
+	client client.Client
+}
+
+func (b *clusterBackend) list(ctx context.Context, k kind, namespace string) ([]client.Object, error) {
+	if k.kind == userKind.kind {
+		users, err := b.kim.KimV1().Users(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return objects(users)
+	}
+	list := k.list()
+	if err := b.client.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	return objects(list)
+}
+
+func (b *clusterBackend) apply(ctx context.Context, obj client.Object) (bool, error) {
+	if user, ok := obj.(*kimv1.User); ok {
+		return b.applyUser(ctx, user)
+	}
+	created := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current := obj.DeepCopyObject().(client.Object)
+		err := b.client.Get(ctx, client.ObjectKeyFromObject(obj), current)
+		if apierrors.IsNotFound(err) {
+			created = true
+			obj.SetResourceVersion("")
+			return b.client.Create(ctx, obj, client.FieldOwner(fieldManager))
+		}
+		if err != nil {
+			return err
+		}
+		obj.SetResourceVersion(current.GetResourceVersion())
+		return b.client.Update(ctx, obj, client.FieldOwner(fieldManager))
+	})
+	return created, err
+}
+
+func (b *clusterBackend) applyUser(ctx context.Context, user *kimv1.User) (bool, error) {
+	users := b.kim.KimV1().Users(user.Namespace)
+	// the subject of an exported user is kept in the status, the webhook rejects the annotation
+	subject := user.Annotations[kimv1.SubjectAnnotation]
+	delete(user.Annotations, kimv1.SubjectAnnotation)
+	created := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := users.Get(ctx, user.Name, metav1.GetOptions{})
+		var applied *kimv1.User
+		switch {
+		case apierrors.IsNotFound(err):
+			created = true
+			user.ResourceVersion = ""
+			applied, err = users.Create(ctx, user, metav1.CreateOptions{FieldManager: fieldManager})
+		case err == nil:
+			user.ResourceVersion = current.ResourceVersion
+			applied, err = users.Update(ctx, user, metav1.UpdateOptions{FieldManager: fieldManager})
+		}
+		if err != nil || subject == "" || storage.UserSubject(applied) == subject {
+			return err
+		}
+		applied.Status.Subject = subject
+		_, err = users.UpdateStatus(ctx, applied, metav1.UpdateOptions{FieldManager: fieldManager})
+		return err
+	})
+	return created, err
+}
+
+func (b *clusterBackend) getUser(ctx context.Context, key types.NamespacedName) (*kimv1.User, error) {
+	return b.kim.KimV1().Users(key.Namespace).Get(ctx, key.Name, metav1.GetOptions{})
+}
+
+// setPassword writes any Secret of the user, the kubeconfig grants the caller the Secrets anyway
+func (b *clusterBackend) setPassword(ctx context.Context, user *kimv1.User, password string) error {
+	return storage.WritePassword(ctx, b.client, user, password, false)
+}
+
+// rotateKey writes a new key to the signing key Secret of the realm, the realm controller reloads the realm with it.
+// The default issuer keeps its key in memory, so it is only rotated by the admin API.
+func (b *clusterBackend) rotateKey(ctx context.Context, realm types.NamespacedName) (string, error) {
+	if realm.Name == "" {
+		return "", errors.New("the key of the default issuer is rotated by the admin API, set --server or --realm")
+	}
+	obj := &kimv1.Realm{}
+	if err := b.client.Get(ctx, realm, obj); err != nil {
+		return "", err
+	}
+	if obj.Spec.SigningKeySecretName == "" {
+		return "", fmt.Errorf("the realm %s has no signingKeySecretName, its random key changes with every restart", realm)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret := &corev1.Secret{}
+		err := b.client.Get(ctx, types.NamespacedName{Namespace: realm.Namespace, Name: obj.Spec.SigningKeySecretName}, secret)
+		if apierrors.IsNotFound(err) {
+			secret.Namespace = realm.Namespace
+			secret.Name = obj.Spec.SigningKeySecretName
+			secret.Data = map[string][]byte{kimv1.RealmSigningKeyKey: data}
+			return b.client.Create(ctx, secret, client.FieldOwner(fieldManager))
+		}
+		if err != nil {
+			return err
+		}
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
+		secret.Data[kimv1.RealmSigningKeyKey] = data
+		return b.client.Update(ctx, secret, client.FieldOwner(fieldManager))
+	})
+	if err != nil {
+		return "", err
+	}
+	return keyID(key), nil
+}
+
+func (b *clusterBackend) revokeTokens(context.Context, string, string) (int, error) {
+	return 0, errors.New("the tokens are only held by the issuer, revoke them by the admin API with --server")
+}
+
+// passwordProblem returns why the user cannot log in by a password, an empty string if it can
+func (b *clusterBackend) passwordProblem(ctx context.Context, user *kimv1.User) (string, error) {
+	secret := &corev1.Secret{}
+	err := b.client.Get(ctx, types.NamespacedName{Namespace: user.Namespace, Name: user.Spec.SecretName}, secret)
+	if apierrors.IsNotFound(err) {
+		return fmt.Sprintf("the secret %s does not exist", user.Spec.SecretName), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	hash, ok := secret.Data[storage.PasswordKey]
+	if !ok {
+		return fmt.Sprintf("the secret %s has no %s key", user.Spec.SecretName, storage.PasswordKey), nil
+	}
+	if _, err = bcrypt.Cost(hash); err != nil {
+		return fmt.Sprintf("the %s of the secret %s is no bcrypt hash", storage.PasswordKey, user.Spec.SecretName), nil
+	}
+	return "", nil
+}
+
+// keyID derives the kid of the signing key like the realm controller, from its public key
+func keyID(key *rsa.PrivateKey) string {
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(&key.PublicKey))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
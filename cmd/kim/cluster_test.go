@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/pkg/client/clientset/versioned/fake"
+)
+
+func TestApplyUserSubject(t *testing.T) {
+	ctx := context.Background()
+	b := &clusterBackend{kim: fake.NewSimpleClientset()}
+	user := &kimv1.User{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "alice",
+		Annotations: map[string]string{kimv1.SubjectAnnotation: "alice-uid"}}}
+	created, err := b.applyUser(ctx, user)
+	if err != nil || !created {
+		t.Fatalf("applyUser() = %t, %v", created, err)
+	}
+	imported, err := b.kim.KimV1().Users("team-a").Get(ctx, "alice", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := imported.Annotations[kimv1.SubjectAnnotation]; ok {
+		t.Error("the subject annotation was imported")
+	}
+	if imported.Status.Subject != "alice-uid" {
+		t.Errorf("status.subject = %q, want the exported subject", imported.Status.Subject)
+	}
+}
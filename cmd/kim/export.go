@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/policy"
+	"github.com/crochee/kim/internal/storage"
+)
+
+// volatileMetadata are the fields of the metadata set by the cluster, which are not exported
+var volatileMetadata = []string{
+	"uid", "resourceVersion", "generation", "creationTimestamp", "deletionTimestamp",
+	"deletionGracePeriodSeconds", "managedFields", "selfLink", "ownerReferences",
+}
+
+// exportObject returns the object without its status and the metadata set by the cluster. The users keep
+// their subject by the subject annotation, which is their UID unless their status has another one, so that the
+// tokens and the pairwise subjects of the users stay valid once they are imported into another cluster.
+func exportObject(k kind, obj client.Object) (map[string]any, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	content["apiVersion"] = kimv1.GroupVersion.String()
+	content["kind"] = k.kind
+	delete(content, "status")
+	metadata, _ := content["metadata"].(map[string]any)
+	if metadata == nil {
+		return content, nil
+	}
+	for _, field := range volatileMetadata {
+		delete(metadata, field)
+	}
+	annotations, _ := metadata["annotations"].(map[string]any)
+	if annotations == nil {
+		annotations = map[string]any{}
+	}
+	delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+	delete(annotations, kimv1.UnlockAnnotation)
+	if user, ok := obj.(*kimv1.User); ok {
+		if subject := storage.UserSubject(user); subject != "" {
+			annotations[kimv1.SubjectAnnotation] = subject
+		}
+	}
+	if len(annotations) > 0 {
+		metadata["annotations"] = annotations
+	} else {
+		delete(metadata, "annotations")
+	}
+	return content, nil
+}
+
+// writeObjects writes the objects as a stream of YAML documents
+func writeObjects(w io.Writer, objs []client.Object) error {
+	for _, obj := range objs {
+		k, ok := kindOf(obj)
+		if !ok {
+			return fmt.Errorf("unsupported object %T", obj)
+		}
+		content, err := exportObject(k, obj)
+		if err != nil {
+			return err
+		}
+		data, err := yaml.Marshal(content)
+		if err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintf(w, "---\n%s", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readObjects decodes the stream of YAML documents, the objects without a namespace belong to the namespace.
+// The objects are ordered by their kind, so that the objects referred to are applied first.
+func readObjects(r io.Reader, namespace string) ([]client.Object, error) {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	var objs []client.Object
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		typeMeta := &metav1.TypeMeta{}
+		if err = yaml.Unmarshal(doc, typeMeta); err != nil {
+			return nil, err
+		}
+		if typeMeta.APIVersion == "" && typeMeta.Kind == "" {
+			// a document of comments only
+			continue
+		}
+		k, ok := kindByName(typeMeta.Kind)
+		if !ok || typeMeta.APIVersion != kimv1.GroupVersion.String() {
+			return nil, fmt.Errorf("unsupported object %s %s", typeMeta.APIVersion, typeMeta.Kind)
+		}
+		obj := k.object()
+		if err = yaml.UnmarshalStrict(doc, obj); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", k.kind, err)
+		}
+		if obj.GetName() == "" {
+			return nil, fmt.Errorf("a %s has no name", k.kind)
+		}
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(namespace)
+		}
+		objs = append(objs, obj)
+	}
+	slices.SortStableFunc(objs, func(a, b client.Object) int {
+		return kindIndex(a) - kindIndex(b)
+	})
+	return objs, nil
+}
+
+func kindIndex(obj client.Object) int {
+	k, _ := kindOf(obj)
+	return slices.IndexFunc(kinds, func(item kind) bool { return item.kind == k.kind })
+}
+
+// objectName names the object like the resources of the policies, e.g. user/team-a/alice
+func objectName(obj client.Object) string {
+	k, _ := kindOf(obj)
+	return policy.Resource(k.name, obj.GetNamespace(), obj.GetName())
+}
+
+// listNamespace returns the namespace the objects are listed in, all namespaces if allNamespaces
+func listNamespace(allNamespaces bool) string {
+	if allNamespaces {
+		return ""
+	}
+	return viper.GetString("namespace")
+}
+
+func newExportCmd() *cobra.Command {
+	var (
+		output        string
+		allNamespaces bool
+	)
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the users, the clients, the policies, the roles and the bindings as YAML",
+		Long: "Export the objects of kim without their status and the metadata of the cluster, so that they can be " +
+			"imported into another cluster by kim admin import. The Secrets of the passwords and the client secrets " +
+			"are not exported, copy them separately.",
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			b, err := newBackend()
+			if err != nil {
+				return err
+			}
+			var objs []client.Object
+			for _, k := range kinds {
+				items, err := b.list(c.Context(), k, listNamespace(allNamespaces))
+				if err != nil {
+					return fmt.Errorf("unable to list the %s: %w", k.path, err)
+				}
+				objs = append(objs, items...)
+			}
+			w := c.OutOrStdout()
+			if output != "" {
+				f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+			return writeObjects(w, objs)
+		},
+	}
+	f := cmd.Flags()
+	f.StringVarP(&output, "output", "o", "", "The file the objects are written to, stdout if empty.")
+	f.BoolVarP(&allNamespaces, "all-namespaces", "A", false, "Export the objects of all namespaces.")
+	return cmd
+}
+
+func newImportCmd() *cobra.Command {
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "import [FILE]",
+		Short: "Create or replace the objects of an export",
+		Long: "Create the objects of the YAML documents of the file, or of the standard input if it is - or omitted, " +
+			"and replace the existing ones. The objects without a namespace are imported into the namespace. " +
+			"The users keep their subject if they are imported into the cluster, which needs the permission " +
+			"to update users/status; the admin API imports them with the subject of their new UID.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			var r io.Reader = c.InOrStdin()
+			if len(args) == 1 && args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				r = f
+			}
+			objs, err := readObjects(r, viper.GetString("namespace"))
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				for _, obj := range objs {
+					fmt.Fprintf(c.OutOrStdout(), "%s (dry run)\n", objectName(obj))
+				}
+				return nil
+			}
+			b, err := newBackend()
+			if err != nil {
+				return err
+			}
+			for _, obj := range objs {
+				name := objectName(obj)
+				created, err := b.apply(c.Context(), obj)
+				if err != nil {
+					return fmt.Errorf("unable to import %s: %w", name, err)
+				}
+				if created {
+					fmt.Fprintf(c.OutOrStdout(), "%s created\n", name)
+				} else {
+					fmt.Fprintf(c.OutOrStdout(), "%s configured\n", name)
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only print the objects which would be imported.")
+	return cmd
+}
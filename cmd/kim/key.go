@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/crochee/kim/internal/storage"
+)
+
+func newRotateKeyCmd() *cobra.Command {
+	var realm string
+	cmd := &cobra.Command{
+		Use:   "rotate-key",
+		Short: "Sign the new tokens by a new key",
+		Long: "Rotate the signing key of the default issuer by the admin API, its previous public key stays published " +
+			"until the tokens signed by it expired. With --realm a new key is written to the signing key Secret " +
+			"of the realm in the cluster instead, the tokens signed by the previous key of the realm become invalid.",
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			b, err := newBackend()
+			if err != nil {
+				return err
+			}
+			var key types.NamespacedName
+			if realm != "" {
+				key = types.NamespacedName{Namespace: viper.GetString("namespace"), Name: realm}
+			}
+			kid, err := b.rotateKey(c.Context(), key)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(c.OutOrStdout(), kid)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&realm, "realm", "", "The Realm in the namespace whose key is rotated, the default issuer if empty.")
+	return cmd
+}
+
+func newRevokeCmd() *cobra.Command {
+	var (
+		user     string
+		subject  string
+		clientID string
+	)
+	cmd := &cobra.Command{
+		Use:   "revoke",
+		Short: "Revoke all tokens of a user, of a client or of a user at a client",
+		Long: "Revoke the access and refresh tokens issued to the user (--user in the namespace or --subject) " +
+			"and/or to the client (--client). The tokens are held by the issuer, so they are revoked by the admin API.",
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			if user != "" && subject != "" {
+				return errors.New("--user and --subject are mutually exclusive")
+			}
+			b, err := newBackend()
+			if err != nil {
+				return err
+			}
+			if user != "" {
+				obj, err := b.getUser(c.Context(), types.NamespacedName{Namespace: viper.GetString("namespace"), Name: user})
+				if err != nil {
+					return err
+				}
+				subject = storage.UserSubject(obj)
+			}
+			if subject == "" && clientID == "" {
+				return errors.New("one of --user, --subject or --client is required")
+			}
+			revoked, err := b.revokeTokens(c.Context(), subject, clientID)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(c.ErrOrStderr(), "%d tokens revoked.\n", revoked)
+			return nil
+		},
+	}
+	f := cmd.Flags()
+	f.StringVar(&user, "user", "", "The User in the namespace whose tokens are revoked.")
+	f.StringVar(&subject, "subject", "", "The subject whose tokens are revoked, e.g. of a deleted user.")
+	f.StringVar(&clientID, "client", "", "The client_id whose tokens are revoked.")
+	return cmd
+}
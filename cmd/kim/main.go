@@ -0,0 +1,110 @@
+// Command kim administers kim, by the admin API of the manager or directly in the cluster.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func main() {
+	ctx := ctrl.SetupSignalHandler()
+	rootCmd, err := root()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err = rootCmd.ExecuteContext(ctx); err != nil {
+		os.Exit(1)
+	}
+}
+
+func initConfig(cmd *cobra.Command, _ []string) error {
+	cfg, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return err
+	}
+	if cfg != "" {
+		viper.SetConfigFile(cfg)
+	} else {
+		var home string
+		if home, err = homedir.Dir(); err != nil {
+			return err
+		}
+		viper.AddConfigPath(home)
+		viper.SetConfigName(".kim")
+	}
+	// KIM_SERVER sets the server flag and so on
+	viper.SetEnvPrefix("kim")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	viper.AutomaticEnv()
+
+	// a missing config file is fine, the flags and the environment configure kim as well
+	if err = viper.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if cfg == "" && errors.As(err, &notFound) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func root() (*cobra.Command, error) {
+	cmd := &cobra.Command{
+		Use:          "kim",
+		Short:        "Administer kim",
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return initConfig(cmd, args)
+		},
+	}
+	pf := cmd.PersistentFlags()
+	pf.StringP("config", "c", "", "config file (default is $HOME/.kim.yaml)")
+	admin, err := newAdminCmd()
+	if err != nil {
+		return nil, err
+	}
+	cmd.AddCommand(admin)
+	return cmd, nil
+}
+
+func newAdminCmd() (*cobra.Command, error) {
+	cmd := &cobra.Command{
+		Use:   "admin",
+		Short: "Manage the users, the keys, the tokens and the state of kim",
+		Long: "The admin commands talk to the admin API of the manager if --server is set, authenticated by the " +
+			"access token of --token, e.g. $(kimctl token). Otherwise they change the objects in the cluster of the " +
+			"kubeconfig directly. The tokens are only held by the issuer, so they are revoked by the admin API.",
+	}
+	pf := cmd.PersistentFlags()
+	pf.StringP("server", "", "", "The issuer serving the admin API, e.g. https://kim.example.com/, the manager "+
+		"serves it if started with --admin-api. "+
+		"The cluster of the kubeconfig is changed directly if empty.")
+	if err := viper.BindPFlag("server", pf.Lookup("server")); err != nil {
+		return nil, err
+	}
+	pf.StringP("token", "", "", "The access token the admin API is called with.")
+	if err := viper.BindPFlag("token", pf.Lookup("token")); err != nil {
+		return nil, err
+	}
+	pf.StringP("namespace", "n", "default", "The namespace of the objects.")
+	if err := viper.BindPFlag("namespace", pf.Lookup("namespace")); err != nil {
+		return nil, err
+	}
+	cmd.AddCommand(
+		newUserCmd(),
+		newRotateKeyCmd(),
+		newRevokeCmd(),
+		newExportCmd(),
+		newImportCmd(),
+		newCheckCmd(),
+	)
+	return cmd, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+// readPassword reads the password from the standard input, prompted twice on a terminal
+func readPassword(c *cobra.Command, fromStdin bool) (string, error) {
+	if fromStdin {
+		line, err := bufio.NewReader(c.InOrStdin()).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		password := strings.TrimRight(line, "\r\n")
+		if password == "" {
+			return "", errors.New("the standard input has no password")
+		}
+		return password, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("no terminal to prompt for the password, pass it by --password-stdin")
+	}
+	fmt.Fprint(c.ErrOrStderr(), "Password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(c.ErrOrStderr())
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(c.ErrOrStderr(), "Repeat the password: ")
+	repeated, err := term.ReadPassword(fd)
+	fmt.Fprintln(c.ErrOrStderr())
+	if err != nil {
+		return "", err
+	}
+	if len(password) == 0 {
+		return "", errors.New("the password is empty")
+	}
+	if string(password) != string(repeated) {
+		return "", errors.New("the passwords do not match")
+	}
+	return string(password), nil
+}
+
+func newUserCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "user",
+		Short: "Create users and set their passwords",
+	}
+	cmd.AddCommand(newUserCreateCmd(), newUserSetPasswordCmd())
+	return cmd
+}
+
+func newUserCreateCmd() *cobra.Command {
+	var (
+		secretName    string
+		email         string
+		emailVerified bool
+		givenName     string
+		familyName    string
+		desc          string
+		policies      []string
+		passwordStdin bool
+	)
+	cmd := &cobra.Command{
+		Use:   "create NAME",
+		Short: "Create a user and write the bcrypt hash of its password to its Secret",
+		Long: "Create a user in the namespace and write the bcrypt hash of its password to the Secret of the user, " +
+			"which is created if it does not exist. The password is prompted for, or read from the standard input " +
+			"with --password-stdin.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			b, err := newBackend()
+			if err != nil {
+				return err
+			}
+			key := types.NamespacedName{Namespace: viper.GetString("namespace"), Name: args[0]}
+			_, err = b.getUser(c.Context(), key)
+			if err == nil {
+				return fmt.Errorf("the user %s already exists, set its password by kim admin user set-password", key)
+			}
+			if !isNotFound(err) {
+				return err
+			}
+			password, err := readPassword(c, passwordStdin)
+			if err != nil {
+				return err
+			}
+			if secretName == "" {
+				secretName = key.Name + "-credentials"
+			}
+			user := &kimv1.User{
+				TypeMeta:   metav1.TypeMeta{APIVersion: kimv1.GroupVersion.String(), Kind: userKind.kind},
+				ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+				Spec: kimv1.UserSpec{
+					Desc:       desc,
+					SecretName: secretName,
+					Policies:   policies,
+				},
+			}
+			if email != "" {
+				user.Spec.Email = ptr.To(email)
+				user.Spec.EmailVerified = ptr.To(emailVerified)
+			}
+			if givenName != "" {
+				user.Spec.GivenName = ptr.To(givenName)
+			}
+			if familyName != "" {
+				user.Spec.FamilyName = ptr.To(familyName)
+			}
+			if _, err = b.apply(c.Context(), user); err != nil {
+				return err
+			}
+			// the admin API writes the password of an existing user only
+			if err = b.setPassword(c.Context(), user, password); err != nil {
+				return fmt.Errorf("user %s created, but its password was not written to the secret %s: %w", key, secretName, err)
+			}
+			fmt.Fprintf(c.ErrOrStderr(), "User %s created, its password is in the secret %s.\n", key, secretName)
+			return nil
+		},
+	}
+	f := cmd.Flags()
+	f.StringVar(&secretName, "secret-name", "", "The Secret of the password hash, NAME-credentials if empty.")
+	f.StringVar(&email, "email", "", "The email address of the user.")
+	f.BoolVar(&emailVerified, "email-verified", false, "Whether the email address is verified.")
+	f.StringVar(&givenName, "given-name", "", "The given name of the user.")
+	f.StringVar(&familyName, "family-name", "", "The family name of the user.")
+	f.StringVar(&desc, "desc", "", "The description of the user.")
+	f.StringSliceVar(&policies, "policies", nil, "The Policies in the namespace bound to the user.")
+	f.BoolVar(&passwordStdin, "password-stdin", false, "Read the password from the first line of the standard input.")
+	return cmd
+}
+
+func newUserSetPasswordCmd() *cobra.Command {
+	var passwordStdin bool
+	cmd := &cobra.Command{
+		Use:   "set-password NAME",
+		Short: "Write the bcrypt hash of a new password to the Secret of the user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			b, err := newBackend()
+			if err != nil {
+				return err
+			}
+			key := types.NamespacedName{Namespace: viper.GetString("namespace"), Name: args[0]}
+			user, err := b.getUser(c.Context(), key)
+			if err != nil {
+				return err
+			}
+			password, err := readPassword(c, passwordStdin)
+			if err != nil {
+				return err
+			}
+			if err = b.setPassword(c.Context(), user, password); err != nil {
+				return err
+			}
+			fmt.Fprintf(c.ErrOrStderr(), "Password of the user %s set.\n", key)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&passwordStdin, "password-stdin", false, "Read the password from the first line of the standard input.")
+	return cmd
+}
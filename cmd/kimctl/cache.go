@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+)
+
+// expiryLeeway renews the tokens this long before they expire, so that they do not expire in flight
+const expiryLeeway = 30 * time.Second
+
+// tokenCache is the file of the tokens of an issuer, a client and its scopes
+type tokenCache struct {
+	path string
+}
+
+// cachedTokens are the tokens of a login, their expiry is the expiry of the access token
+type cachedTokens struct {
+	Issuer       string    `json:"issuer"`
+	ClientID     string    `json:"clientId"`
+	AccessToken  string    `json:"accessToken"`
+	TokenType    string    `json:"tokenType,omitempty"`
+	RefreshToken string    `json:"refreshToken,omitempty"`
+	IDToken      string    `json:"idToken,omitempty"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// newTokenCache returns the cache of the tokens of the issuer, the client and the scopes in the directory
+func newTokenCache(dir, issuer, clientID string, scopes []string) *tokenCache {
+	key := sha256.Sum256([]byte(strings.Join([]string{strings.TrimSuffix(issuer, "/"), clientID, strings.Join(scopes, " ")}, "\n")))
+	return &tokenCache{path: filepath.Join(dir, hex.EncodeToString(key[:12])+".json")}
+}
+
+// load returns the cached tokens, nil if there are none
+func (c *tokenCache) load() (*cachedTokens, error) {
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	tokens := &cachedTokens{}
+	if err = json.Unmarshal(data, tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// save replaces the cached tokens, the file is only readable by the user and replaced atomically
+func (c *tokenCache) save(tokens *cachedTokens) error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(c.path), ".tokens-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), c.path)
+}
+
+// remove deletes the cached tokens
+func (c *tokenCache) remove() error {
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// valid reports whether the access token is still valid at the time
+func (t *cachedTokens) valid(now time.Time) bool {
+	return t != nil && t.AccessToken != "" && now.Add(expiryLeeway).Before(t.Expiry)
+}
+
+// idTokenExpiry returns the exp claim of the ID token, which was verified when it was cached
+func (t *cachedTokens) idTokenExpiry() (time.Time, bool) {
+	if t.IDToken == "" {
+		return time.Time{}, false
+	}
+	claims := new(oidc.IDTokenClaims)
+	if _, err := oidc.ParseToken(t.IDToken, claims); err != nil {
+		return time.Time{}, false
+	}
+	return claims.GetExpiration(), true
+}
+
+// idTokenValid reports whether the ID token is still valid at the time
+func (t *cachedTokens) idTokenValid(now time.Time) bool {
+	if t == nil {
+		return false
+	}
+	expiry, ok := t.idTokenExpiry()
+	return ok && now.Add(expiryLeeway).Before(expiry)
+}
+
+// subject returns the sub claim of the ID token
+func (t *cachedTokens) subject() string {
+	claims := new(oidc.IDTokenClaims)
+	if _, err := oidc.ParseToken(t.IDToken, claims); err != nil {
+		return ""
+	}
+	return claims.Subject
+}
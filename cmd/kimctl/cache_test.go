@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestTokenCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := newTokenCache(dir, "https://kim.example.com/", "native", []string{"openid"})
+	if other := newTokenCache(dir, "https://kim.example.com", "native", []string{"openid", "offline_access"}); other.path == cache.path {
+		t.Error("the tokens of other scopes share the cache")
+	}
+	if tokens, err := cache.load(); err != nil || tokens != nil {
+		t.Fatalf("load() of an empty cache = %v, %v", tokens, err)
+	}
+	now := time.Now()
+	if err := cache.save(&cachedTokens{AccessToken: "access", RefreshToken: "refresh", Expiry: now.Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(matches) != 1 {
+		t.Errorf("the cache left the files %v", matches)
+	}
+	tokens, err := cache.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tokens.valid(now) || tokens.valid(now.Add(45*time.Second)) {
+		t.Errorf("valid() does not renew the access token %s before it expires", expiryLeeway)
+	}
+	if tokens.idTokenValid(now) {
+		t.Error("idTokenValid() without an ID token = true")
+	}
+	if err = cache.remove(); err != nil {
+		t.Fatal(err)
+	}
+	if tokens, _ = cache.load(); tokens != nil {
+		t.Error("remove() kept the tokens")
+	}
+}
+
+func TestKubeconfigApply(t *testing.T) {
+	config := api.NewConfig()
+	config.Clusters["prod"] = api.NewCluster()
+	s := &session{issuer: "https://kim.example.com", clientID: "native", scopes: []string{"openid", "offline_access"}}
+	o := &kubeconfigOptions{user: "kim", cluster: "prod", command: "kimctl", tokenType: tokenTypeID, useContext: true}
+	if err := o.apply(config, s); err != nil {
+		t.Fatal(err)
+	}
+	exec := config.AuthInfos["kim"].Exec
+	if exec == nil || exec.APIVersion != "client.authentication.k8s.io/v1" || exec.Args[0] != "credential" {
+		t.Errorf("apply() added the credential plugin %+v", exec)
+	}
+	if config.CurrentContext != "kim@prod" || config.Contexts["kim@prod"].Cluster != "prod" {
+		t.Errorf("apply() set the context %q: %+v", config.CurrentContext, config.Contexts)
+	}
+	o.cluster = "staging"
+	if err := o.apply(config, s); err == nil {
+		t.Error("apply() of an unknown cluster succeeded")
+	}
+}
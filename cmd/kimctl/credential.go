@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientauthenticationv1 "k8s.io/client-go/pkg/apis/clientauthentication/v1"
+)
+
+const (
+	// execInfoEnv is the variable client-go passes the ExecCredential of the request in
+	execInfoEnv = "KUBERNETES_EXEC_INFO"
+
+	tokenTypeID     = "id"
+	tokenTypeAccess = "access"
+)
+
+// execInteractive reports whether client-go passed the standard input to the plugin, so that the user can sign in
+func execInteractive() (bool, error) {
+	info := os.Getenv(execInfoEnv)
+	if info == "" {
+		return false, nil
+	}
+	credential := &clientauthenticationv1.ExecCredential{}
+	if err := json.Unmarshal([]byte(info), credential); err != nil {
+		return false, fmt.Errorf("invalid %s: %w", execInfoEnv, err)
+	}
+	return credential.Spec.Interactive, nil
+}
+
+// execCredential returns the ExecCredential of the token, which client-go caches until the expiration
+func execCredential(token string, expiration time.Time) *clientauthenticationv1.ExecCredential {
+	return &clientauthenticationv1.ExecCredential{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: clientauthenticationv1.SchemeGroupVersion.String(),
+			Kind:       "ExecCredential",
+		},
+		Status: &clientauthenticationv1.ExecCredentialStatus{
+			Token:               token,
+			ExpirationTimestamp: &metav1.Time{Time: expiration},
+		},
+	}
+}
+
+func newCredentialCmd() *cobra.Command {
+	var tokenType string
+	cmd := &cobra.Command{
+		Use:   "credential",
+		Short: "Print an ExecCredential of the cached tokens for kubectl",
+		Long: "Print a client.authentication.k8s.io/v1 ExecCredential, the credential plugin of the kubeconfig written " +
+			"by kimctl kubeconfig. The cached tokens are refreshed silently and the user signs in if kubectl " +
+			"passes the terminal to the plugin.",
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			if tokenType != tokenTypeID && tokenType != tokenTypeAccess {
+				return fmt.Errorf("unknown token type %q, expected %s or %s", tokenType, tokenTypeID, tokenTypeAccess)
+			}
+			interactive, err := execInteractive()
+			if err != nil {
+				return err
+			}
+			s, err := newSession()
+			if err != nil {
+				return err
+			}
+			// the prompts go to the standard error, the standard output is read by client-go
+			tokens, err := s.tokens(c.Context(), tokenType == tokenTypeID, interactive, c.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+			token, expiration := tokens.AccessToken, tokens.Expiry
+			if tokenType == tokenTypeID {
+				var ok bool
+				if expiration, ok = tokens.idTokenExpiry(); !ok {
+					return errors.New("no ID token was issued, request the openid scope")
+				}
+				token = tokens.IDToken
+			}
+			return json.NewEncoder(c.OutOrStdout()).Encode(execCredential(token, expiration))
+		},
+	}
+	cmd.Flags().StringVar(&tokenType, "token-type", tokenTypeID, "The token passed to the apiserver, "+
+		"id for the OIDC authenticator of the apiserver or access for a webhook token authenticator.")
+	return cmd
+}
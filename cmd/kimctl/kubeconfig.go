@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	clientauthenticationv1 "k8s.io/client-go/pkg/apis/clientauthentication/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// kubeconfigOptions are the flags of the kubeconfig command
+type kubeconfigOptions struct {
+	kubeconfig string
+	user       string
+	cluster    string
+	context    string
+	command    string
+	tokenType  string
+	useContext bool
+}
+
+// execConfig returns the credential plugin of the user, it runs kimctl with the flags of the session
+func (o *kubeconfigOptions) execConfig(s *session) *clientcmdapi.ExecConfig {
+	args := []string{
+		"credential",
+		"--issuer=" + s.issuer,
+		"--client-id=" + s.clientID,
+		"--scopes=" + strings.Join(s.scopes, ","),
+		"--flow=" + viper.GetString("flow"),
+		"--token-type=" + o.tokenType,
+	}
+	if s.clientSecret != "" {
+		args = append(args, "--client-secret="+s.clientSecret)
+	}
+	return &clientcmdapi.ExecConfig{
+		APIVersion:      clientauthenticationv1.SchemeGroupVersion.String(),
+		Command:         o.command,
+		Args:            args,
+		InstallHint:     "kimctl signs in to kim, install it and run kimctl login",
+		InteractiveMode: clientcmdapi.IfAvailableExecInteractiveMode,
+	}
+}
+
+// apply adds the user to the config, and the context of the user and the cluster if a cluster is given
+func (o *kubeconfigOptions) apply(config *clientcmdapi.Config, s *session) error {
+	authInfo := clientcmdapi.NewAuthInfo()
+	authInfo.Exec = o.execConfig(s)
+	config.AuthInfos[o.user] = authInfo
+	if o.cluster == "" {
+		if o.useContext {
+			return errors.New("--use-context requires --cluster")
+		}
+		return nil
+	}
+	if _, ok := config.Clusters[o.cluster]; !ok {
+		return fmt.Errorf("cluster %q not found in the kubeconfig", o.cluster)
+	}
+	name := o.context
+	if name == "" {
+		name = o.user + "@" + o.cluster
+	}
+	kubeContext := clientcmdapi.NewContext()
+	if existing, ok := config.Contexts[name]; ok {
+		kubeContext = existing
+	}
+	kubeContext.Cluster = o.cluster
+	kubeContext.AuthInfo = o.user
+	config.Contexts[name] = kubeContext
+	if o.useContext {
+		config.CurrentContext = name
+	}
+	return nil
+}
+
+func newKubeconfigCmd() *cobra.Command {
+	o := &kubeconfigOptions{}
+	cmd := &cobra.Command{
+		Use:   "kubeconfig",
+		Short: "Add a user authenticated by kimctl to the kubeconfig",
+		Long: "Add a user whose credential plugin is kimctl credential to the kubeconfig, so that kubectl authenticates " +
+			"by the tokens of kim. With --cluster the context of the user and the cluster is added as well.",
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			s, err := newSession()
+			if err != nil {
+				return err
+			}
+			options := clientcmd.NewDefaultPathOptions()
+			options.LoadingRules.ExplicitPath = o.kubeconfig
+			config, err := options.GetStartingConfig()
+			if err != nil {
+				return err
+			}
+			if err = o.apply(config, s); err != nil {
+				return err
+			}
+			if err = clientcmd.ModifyConfig(options, *config, true); err != nil {
+				return err
+			}
+			fmt.Fprintf(c.ErrOrStderr(), "User %q added to the kubeconfig.\n", o.user)
+			return nil
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&o.kubeconfig, "kubeconfig", "", "The kubeconfig file, the default of kubectl if empty.")
+	flags.StringVar(&o.user, "user", "kim", "The name of the user in the kubeconfig.")
+	flags.StringVar(&o.cluster, "cluster", "", "The cluster of the context of the user, no context is added if empty.")
+	flags.StringVar(&o.context, "context", "", "The name of the context, user@cluster if empty.")
+	flags.BoolVar(&o.useContext, "use-context", false, "Make the context the current context.")
+	flags.StringVar(&o.command, "command", "kimctl", "The command of the credential plugin, kimctl on the PATH by default.")
+	flags.StringVar(&o.tokenType, "token-type", tokenTypeID, "The token passed to the apiserver, id or access.")
+	return cmd
+}
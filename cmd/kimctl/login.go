@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zitadel/oidc/v3/pkg/client/rp"
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+)
+
+const (
+	flowPKCE   = "pkce"
+	flowDevice = "device"
+)
+
+var errLoginRequired = errors.New("not logged in, run kimctl login")
+
+// session is the relying party of kimctl at the issuer and the cache of its tokens
+type session struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	cache        *tokenCache
+}
+
+// newSession returns the session of the issuer, the client and the scopes of the flags
+func newSession() (*session, error) {
+	issuer := viper.GetString("issuer")
+	if issuer == "" {
+		return nil, errors.New("the issuer is required")
+	}
+	s := &session{
+		issuer:       issuer,
+		clientID:     viper.GetString("client-id"),
+		clientSecret: viper.GetString("client-secret"),
+		scopes:       viper.GetStringSlice("scopes"),
+	}
+	s.cache = newTokenCache(viper.GetString("cache-dir"), s.issuer, s.clientID, s.scopes)
+	return s, nil
+}
+
+// relyingParty discovers the issuer, the redirect uri is only used by the pkce flow
+func (s *session) relyingParty(ctx context.Context, redirectURI string) (rp.RelyingParty, error) {
+	return rp.NewRelyingPartyOIDC(ctx, s.issuer, s.clientID, s.clientSecret, redirectURI, s.scopes)
+}
+
+// login signs in interactively by the flow and caches the tokens, the prompts are written to out
+func (s *session) login(ctx context.Context, flow string, out io.Writer) (*cachedTokens, error) {
+	var (
+		tokens *cachedTokens
+		err    error
+	)
+	switch flow {
+	case flowPKCE:
+		tokens, err = s.loginPKCE(ctx, out)
+	case flowDevice:
+		tokens, err = s.loginDevice(ctx, out)
+	default:
+		return nil, fmt.Errorf("unknown flow %q, expected %s or %s", flow, flowPKCE, flowDevice)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tokens, s.cache.save(tokens)
+}
+
+// loginPKCE receives the authorization code at a loopback address, the browser is opened if possible
+func (s *session) loginPKCE(ctx context.Context, out io.Writer) (*cachedTokens, error) {
+	listener, err := net.Listen("tcp", viper.GetString("listen-address"))
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+	redirectURI := "http://" + listener.Addr().String() + viper.GetString("callback-path")
+	party, err := s.relyingParty(ctx, redirectURI)
+	if err != nil {
+		return nil, err
+	}
+	verifier, state := randomString(), randomString()
+	authURL := rp.AuthURL(state, party, rp.WithCodeChallenge(oidc.NewSHACodeChallenge(verifier)))
+
+	type result struct {
+		code string
+		err  error
+	}
+	results := make(chan result, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(viper.GetString("callback-path"), func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var res result
+		switch {
+		case query.Get("state") != state:
+			res.err = errors.New("the state of the redirect does not match")
+		case query.Get("error") != "":
+			res.err = fmt.Errorf("%s: %s", query.Get("error"), query.Get("error_description"))
+		default:
+			res.code = query.Get("code")
+		}
+		if res.err != nil {
+			http.Error(w, "Login failed: "+res.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Login succeeded, you may close this window.")
+		}
+		select {
+		case results <- res:
+		default:
+		}
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	fmt.Fprintf(out, "Opening the browser to sign in, or open this URL:\n\n    %s\n\n", authURL)
+	_ = openBrowser(authURL)
+	var res result
+	select {
+	case res = <-results:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+	tokens, err := rp.CodeExchange[*oidc.IDTokenClaims](ctx, res.code, party, rp.WithCodeVerifier(verifier))
+	if err != nil {
+		return nil, err
+	}
+	return &cachedTokens{
+		Issuer:       s.issuer,
+		ClientID:     s.clientID,
+		AccessToken:  tokens.AccessToken,
+		TokenType:    tokens.TokenType,
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+		Expiry:       tokens.Expiry,
+	}, nil
+}
+
+// loginDevice prints the user code and polls the token endpoint until the user approved or denied it
+func (s *session) loginDevice(ctx context.Context, out io.Writer) (*cachedTokens, error) {
+	party, err := s.relyingParty(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	authorization, err := rp.DeviceAuthorization(ctx, s.scopes, party, nil)
+	if err != nil {
+		return nil, err
+	}
+	if authorization.VerificationURIComplete != "" {
+		fmt.Fprintf(out, "Open this URL on any device to sign in:\n\n    %s\n\n", authorization.VerificationURIComplete)
+	} else {
+		fmt.Fprintf(out, "Open %s on any device and enter the code %s to sign in.\n\n",
+			authorization.VerificationURI, authorization.UserCode)
+	}
+	interval := time.Duration(authorization.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	if authorization.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(authorization.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+	resp, err := rp.DeviceAccessToken(ctx, authorization.DeviceCode, interval, party)
+	if err != nil {
+		return nil, err
+	}
+	if resp.IDToken != "" {
+		if _, err = rp.VerifyIDToken[*oidc.IDTokenClaims](ctx, resp.IDToken, party.IDTokenVerifier()); err != nil {
+			return nil, err
+		}
+	}
+	return &cachedTokens{
+		Issuer:       s.issuer,
+		ClientID:     s.clientID,
+		AccessToken:  resp.AccessToken,
+		TokenType:    resp.TokenType,
+		RefreshToken: resp.RefreshToken,
+		IDToken:      resp.IDToken,
+		Expiry:       time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// refresh renews the tokens silently by the refresh token and caches them
+func (s *session) refresh(ctx context.Context, cached *cachedTokens) (*cachedTokens, error) {
+	party, err := s.relyingParty(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := rp.RefreshTokens[*oidc.IDTokenClaims](ctx, party, cached.RefreshToken, "", "")
+	if err != nil {
+		return nil, err
+	}
+	refreshed := &cachedTokens{
+		Issuer:       s.issuer,
+		ClientID:     s.clientID,
+		AccessToken:  tokens.AccessToken,
+		TokenType:    tokens.TokenType,
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+		Expiry:       tokens.Expiry,
+	}
+	// the refresh response may omit the tokens which did not change
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = cached.RefreshToken
+	}
+	if refreshed.IDToken == "" {
+		refreshed.IDToken = cached.IDToken
+	}
+	return refreshed, s.cache.save(refreshed)
+}
+
+// tokens returns the cached tokens, refreshed silently if the access token or, with idToken, the ID token expired.
+// Without a refresh token an interactive login is started if interactive, else errLoginRequired is returned.
+func (s *session) tokens(ctx context.Context, idToken, interactive bool, out io.Writer) (*cachedTokens, error) {
+	cached, err := s.cache.load()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if cached.valid(now) && (!idToken || cached.idTokenValid(now)) {
+		return cached, nil
+	}
+	if cached != nil && cached.RefreshToken != "" {
+		refreshed, err := s.refresh(ctx, cached)
+		if err == nil {
+			return refreshed, nil
+		}
+		if !interactive {
+			return nil, fmt.Errorf("%w: %w", errLoginRequired, err)
+		}
+	}
+	if !interactive {
+		return nil, errLoginRequired
+	}
+	return s.login(ctx, viper.GetString("flow"), out)
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// openBrowser opens the url in the browser of the desktop, if there is one
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
+
+func newLoginCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "login",
+		Short: "Sign in to the issuer and cache the tokens",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			s, err := newSession()
+			if err != nil {
+				return err
+			}
+			tokens, err := s.login(c.Context(), viper.GetString("flow"), c.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+			if tokens.RefreshToken == "" {
+				fmt.Fprintln(c.ErrOrStderr(), "No refresh token was issued, the tokens can not be refreshed silently.")
+			}
+			fmt.Fprintf(c.ErrOrStderr(), "Logged in to %s, the access token expires at %s.\n", s.issuer,
+				tokens.Expiry.Local().Format(time.RFC3339))
+			return nil
+		},
+	}
+}
@@ -0,0 +1,125 @@
+// Command kimctl signs in to a kim issuer from the command line and hands its tokens to kubectl.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func main() {
+	ctx := ctrl.SetupSignalHandler()
+	rootCmd, err := root()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err = rootCmd.ExecuteContext(ctx); err != nil {
+		os.Exit(1)
+	}
+}
+
+func initConfig(cmd *cobra.Command, _ []string) error {
+	cfg, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return err
+	}
+	if cfg != "" {
+		viper.SetConfigFile(cfg)
+	} else {
+		var home string
+		if home, err = homedir.Dir(); err != nil {
+			return err
+		}
+		viper.AddConfigPath(home)
+		viper.SetConfigName(".kimctl")
+	}
+	// KIMCTL_ISSUER sets the issuer flag and so on
+	viper.SetEnvPrefix("kimctl")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	viper.AutomaticEnv()
+
+	// a missing config file is fine, the flags and the environment configure kimctl as well
+	if err = viper.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if cfg == "" && errors.As(err, &notFound) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func root() (*cobra.Command, error) {
+	cmd := &cobra.Command{
+		Use:   "kimctl",
+		Short: "Sign in to kim from the command line",
+		Long: "kimctl signs in to a kim issuer by the device authorization grant or by the authorization code flow " +
+			"with PKCE on a loopback address, caches the tokens and refreshes them silently. " +
+			"As a client-go credential plugin it lets kubectl authenticate by the tokens of kim.",
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return initConfig(cmd, args)
+		},
+	}
+	defaultCacheDir := filepath.Join("~", ".kube", "cache", "kimctl")
+	if home, err := homedir.Dir(); err == nil {
+		defaultCacheDir = filepath.Join(home, ".kube", "cache", "kimctl")
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.StringP("config", "c", "", "config file (default is $HOME/.kimctl.yaml)")
+	pf.StringP("issuer", "", "", "The issuer of kim, e.g. https://kim.example.com/.")
+	if err := viper.BindPFlag("issuer", pf.Lookup("issuer")); err != nil {
+		return nil, err
+	}
+	pf.StringP("client-id", "", "native", "The client kimctl signs in as, a native client for the PKCE flow "+
+		"or a device client for the device flow.")
+	if err := viper.BindPFlag("client-id", pf.Lookup("client-id")); err != nil {
+		return nil, err
+	}
+	pf.StringP("client-secret", "", "", "The secret of the client, if it is a confidential client.")
+	if err := viper.BindPFlag("client-secret", pf.Lookup("client-secret")); err != nil {
+		return nil, err
+	}
+	pf.StringSliceP("scopes", "", []string{"openid", "profile", "email", "offline_access"},
+		"The scopes requested, offline_access lets kimctl refresh the tokens silently.")
+	if err := viper.BindPFlag("scopes", pf.Lookup("scopes")); err != nil {
+		return nil, err
+	}
+	pf.StringP("cache-dir", "", defaultCacheDir, "The directory of the cached tokens.")
+	if err := viper.BindPFlag("cache-dir", pf.Lookup("cache-dir")); err != nil {
+		return nil, err
+	}
+	pf.StringP("flow", "", flowPKCE, "The flow of the interactive logins, pkce opens the browser on this machine "+
+		"and device prints a code to enter on any other device.")
+	if err := viper.BindPFlag("flow", pf.Lookup("flow")); err != nil {
+		return nil, err
+	}
+	pf.StringP("listen-address", "", "127.0.0.1:0", "The loopback address the redirect of the pkce flow is received at.")
+	if err := viper.BindPFlag("listen-address", pf.Lookup("listen-address")); err != nil {
+		return nil, err
+	}
+	pf.StringP("callback-path", "", "/auth/callback", "The path of the redirect uri of the pkce flow, "+
+		"registered for the client on any loopback port.")
+	if err := viper.BindPFlag("callback-path", pf.Lookup("callback-path")); err != nil {
+		return nil, err
+	}
+
+	cmd.AddCommand(
+		newLoginCmd(),
+		newTokenCmd(),
+		newWhoamiCmd(),
+		newLogoutCmd(),
+		newCredentialCmd(),
+		newKubeconfigCmd(),
+	)
+	return cmd, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/zitadel/oidc/v3/pkg/client/rp"
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+)
+
+func newTokenCmd() *cobra.Command {
+	var (
+		idToken     bool
+		interactive bool
+	)
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Print the access token, refreshed silently if it expired",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			s, err := newSession()
+			if err != nil {
+				return err
+			}
+			tokens, err := s.tokens(c.Context(), idToken, interactive, c.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+			if idToken {
+				if tokens.IDToken == "" {
+					return errors.New("no ID token was issued, request the openid scope")
+				}
+				fmt.Fprintln(c.OutOrStdout(), tokens.IDToken)
+				return nil
+			}
+			fmt.Fprintln(c.OutOrStdout(), tokens.AccessToken)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&idToken, "id-token", false, "Print the ID token instead of the access token.")
+	cmd.Flags().BoolVar(&interactive, "interactive", false, "Sign in if the tokens can not be refreshed.")
+	return cmd
+}
+
+func newWhoamiCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "whoami",
+		Short: "Print the claims of the signed-in user by the userinfo endpoint",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			s, err := newSession()
+			if err != nil {
+				return err
+			}
+			tokens, err := s.tokens(c.Context(), false, false, c.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+			party, err := s.relyingParty(c.Context(), "")
+			if err != nil {
+				return err
+			}
+			tokenType := tokens.TokenType
+			if tokenType == "" {
+				tokenType = oidc.BearerToken
+			}
+			info, err := rp.Userinfo[*oidc.UserInfo](c.Context(), tokens.AccessToken, tokenType, tokens.subject(), party)
+			if err != nil {
+				return err
+			}
+			encoder := json.NewEncoder(c.OutOrStdout())
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(info)
+		},
+	}
+}
+
+func newLogoutCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "logout",
+		Short: "Revoke the refresh token and remove the cached tokens",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			s, err := newSession()
+			if err != nil {
+				return err
+			}
+			tokens, err := s.cache.load()
+			if err != nil {
+				return err
+			}
+			if tokens == nil {
+				fmt.Fprintln(c.ErrOrStderr(), "Not logged in.")
+				return nil
+			}
+			// the tokens are removed even if the issuer can not be reached, the refresh token expires eventually
+			if party, err := s.relyingParty(c.Context(), ""); err != nil {
+				fmt.Fprintf(c.ErrOrStderr(), "Cannot revoke the tokens: %v\n", err)
+			} else {
+				if tokens.RefreshToken != "" {
+					if err = rp.RevokeToken(c.Context(), party, tokens.RefreshToken, "refresh_token"); err != nil {
+						fmt.Fprintf(c.ErrOrStderr(), "Cannot revoke the refresh token: %v\n", err)
+					}
+				}
+				if err = rp.RevokeToken(c.Context(), party, tokens.AccessToken, "access_token"); err != nil {
+					fmt.Fprintf(c.ErrOrStderr(), "Cannot revoke the access token: %v\n", err)
+				}
+			}
+			if err = s.cache.remove(); err != nil {
+				return err
+			}
+			fmt.Fprintf(c.ErrOrStderr(), "Logged out of %s.\n", s.issuer)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/spf13/viper"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crochee/kim/internal/lockout"
+)
+
+// lockoutStore is shared by the server and the operator, so that an unlock by the operator
+// also lifts the lockout of the in-memory store
+var lockoutStore = sync.OnceValues(func() (lockout.Store, error) {
+	switch store := viper.GetString("lockout-store"); store {
+	case "none":
+		return nil, nil
+	case "memory":
+		return lockout.NewMemoryStore(), nil
+	case "kubernetes":
+		cfg, err := ctrl.GetConfig()
+		if err != nil {
+			return nil, err
+		}
+		// the states are read right before they are updated, a cache would only cause conflicts
+		c, err := client.New(cfg, client.Options{Scheme: scheme})
+		if err != nil {
+			return nil, err
+		}
+		return lockout.NewConfigMapStore(c, viper.GetString("lockout-namespace")), nil
+	default:
+		return nil, fmt.Errorf("unknown lockout store %q", store)
+	}
+})
+
+// LockoutGuards returns the guards of the failed logins per user, per source address and per device user code,
+// they are nil if the lockout is disabled
+func LockoutGuards() (users, ips, userCodes *lockout.Guard, err error) {
+	store, err := lockoutStore()
+	if err != nil || store == nil {
+		return nil, nil, nil, err
+	}
+	policy := lockout.Policy{
+		MaxFailures: viper.GetInt("lockout-user-max-failures"),
+		BaseDelay:   viper.GetDuration("lockout-base-delay"),
+		MaxDelay:    viper.GetDuration("lockout-max-delay"),
+		ResetAfter:  viper.GetDuration("lockout-reset-after"),
+	}
+	users = lockout.NewGuard(store, policy)
+	policy.MaxFailures = viper.GetInt("lockout-ip-max-failures")
+	ips = lockout.NewGuard(store, policy)
+	// a user code is not locked but denied, so only the number of attempts matters
+	userCodes = lockout.NewGuard(store, lockout.Policy{
+		MaxFailures: viper.GetInt("lockout-user-code-max-attempts"),
+	})
+	return users, ips, userCodes, nil
+}
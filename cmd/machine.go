@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"github.com/spf13/viper"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crochee/kim/internal/storage"
+)
+
+// Client returns a client of the cluster reading without a cache
+func Client() (client.Client, error) {
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return client.New(cfg, client.Options{Scheme: scheme})
+}
+
+// MachineClientStore returns the store of the MachineClients of the default issuer, the client_ids without a
+// namespace belong to the default namespace of the users
+func MachineClientStore() (*storage.MachineClientStore, error) {
+	// the server starts before the cache of the operator, the clients and their secrets are read directly
+	c, err := Client()
+	if err != nil {
+		return nil, err
+	}
+	return storage.NewMachineClientStore(c, viper.GetString("default-namespace")), nil
+}
+
+// ServiceAccountStore returns the store of the ServiceAccounts of the default issuer, which verifies their tokens
+// by TokenReviews and reads their bindings directly
+func ServiceAccountStore() (*storage.ServiceAccountStore, error) {
+	c, err := Client()
+	if err != nil {
+		return nil, err
+	}
+	return storage.NewServiceAccountStore(c, viper.GetStringSlice("serviceaccount-audiences")), nil
+}
+
+// WorkloadTrustStore returns the store of the WorkloadTrusts of the default issuer, which reads them directly
+func WorkloadTrustStore() (*storage.WorkloadTrustStore, error) {
+	c, err := Client()
+	if err != nil {
+		return nil, err
+	}
+	return storage.NewWorkloadTrustStore(c), nil
+}
@@ -20,7 +20,9 @@ package cmd
 import (
 	"context"
 	"crypto/tls"
+	"os"
 	"path/filepath"
+	"slices"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -38,7 +40,11 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/audit"
 	kimcontroller "github.com/crochee/kim/internal/controller/kim"
+	"github.com/crochee/kim/internal/lockout"
+	"github.com/crochee/kim/internal/storage"
+	webhookkimv1 "github.com/crochee/kim/internal/webhook/v1"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -54,7 +60,8 @@ func init() {
 	// +kubebuilder:scaffold:scheme
 }
 
-func Operator(ctx context.Context) error {
+// Operator runs the controllers, the realms are served by realms if it is not nil
+func Operator(ctx context.Context, realms kimcontroller.RealmServer) error {
 	metricsCertPath := viper.GetString("metrics-cert-path")
 	metricsCertName := viper.GetString("metrics-cert-name")
 	metricsCertKey := viper.GetString("metrics-cert-key")
@@ -176,15 +183,88 @@ func Operator(ctx context.Context) error {
 		return err
 	}
 
+	userLockout, _, _, err := LockoutGuards()
+	if err != nil {
+		setupLog.Error(err, "unable to create lockout store")
+		return err
+	}
+	if store, _ := lockoutStore(); store != nil {
+		if prunable, ok := store.(lockout.Prunable); ok && viper.GetDuration("lockout-reset-after") > 0 {
+			if err := mgr.Add(prunable.Pruner(viper.GetDuration("lockout-reset-after"))); err != nil {
+				setupLog.Error(err, "unable to add lockout pruner to manager")
+				return err
+			}
+		}
+	}
+
+	// the users log in with their claims by the field indexes of the cache
+	if err := storage.IndexUsers(ctx, mgr.GetFieldIndexer()); err != nil {
+		setupLog.Error(err, "unable to index users")
+		return err
+	}
+	userLookup, err := UserLookup()
+	if err != nil {
+		setupLog.Error(err, "invalid login-identifiers")
+		return err
+	}
+
 	if err := (&kimcontroller.UserReconciler{
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Lockout: userLockout,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "User")
+		return err
+	}
+	if err := (&kimcontroller.PolicyReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "User")
+		setupLog.Error(err, "unable to create controller", "controller", "Policy")
+		return err
+	}
+	if err := (&kimcontroller.RoleReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Role")
 		return err
 	}
+	if realms != nil {
+		if err := (&kimcontroller.RealmReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+			Server: realms,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Realm")
+			return err
+		}
+	}
+	// nolint:goconst
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err := webhookkimv1.SetupUserWebhookWithManager(mgr, userLookup); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "User")
+			return err
+		}
+		if err := webhookkimv1.SetupPolicyWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Policy")
+			return err
+		}
+		if err := webhookkimv1.SetupRoleWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Role")
+			return err
+		}
+		if err := webhookkimv1.SetupWorkloadTrustWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "WorkloadTrust")
+			return err
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
+	if slices.Contains(viper.GetStringSlice("audit-sinks"), "events") {
+		audit.AddSink(audit.NewEventSink(mgr.GetEventRecorderFor("kim-audit")))
+	}
+
 	if metricsCertWatcher != nil {
 		setupLog.Info("Adding metrics certificate watcher to manager")
 		if err := mgr.Add(metricsCertWatcher); err != nil {
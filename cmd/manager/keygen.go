@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	jose "github.com/go-jose/go-jose/v4"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zitadel/oidc/v3/pkg/client"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/cmd"
+	"github.com/crochee/kim/internal/storage"
+)
+
+// newKeygenCmd returns the command generating a key pair of a MachineClient for the JWT profile grant
+func newKeygenCmd() *cobra.Command {
+	var (
+		output    string
+		expiresIn time.Duration
+		bits      int
+	)
+	keygen := &cobra.Command{
+		Use:   "keygen CLIENT_ID",
+		Short: "Generate a key of a MachineClient for the JWT profile grant",
+		Long: "Generate an RSA key pair, register its public key in the MachineClient and write the key file " +
+			"with the private key, which is not stored anywhere else.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			key, ok := storage.ParseMachineClientID(args[0], viper.GetString("default-namespace"))
+			if !ok {
+				return fmt.Errorf("invalid client id %q, expected name/namespace", args[0])
+			}
+			privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+			if err != nil {
+				return err
+			}
+			keyID, err := thumbprint(&privateKey.PublicKey)
+			if err != nil {
+				return err
+			}
+			public, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+			if err != nil {
+				return err
+			}
+			entry := kimv1.MachineClientKey{
+				KeyID:     keyID,
+				PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public})),
+			}
+			if expiresIn > 0 {
+				entry.ExpirationTime = &metav1.Time{Time: time.Now().Add(expiresIn).Truncate(time.Second)}
+			}
+
+			// the key file is created first, the private key must not get lost once the key is registered
+			var w io.Writer = c.OutOrStdout()
+			if output != "" {
+				f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+			kube, err := cmd.Client()
+			if err != nil {
+				return err
+			}
+			ctx := c.Context()
+			obj := &kimv1.MachineClient{}
+			err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+				if err := kube.Get(ctx, key, obj); err != nil {
+					return err
+				}
+				obj.Spec.Keys = append(obj.Spec.Keys, entry)
+				return kube.Update(ctx, obj)
+			})
+			if err != nil {
+				return fmt.Errorf("unable to register the key in the MachineClient %s: %w", key, err)
+			}
+
+			// the key file has the format of the key files of the zitadel clients
+			data, err := json.Marshal(&client.KeyFile{
+				Type:   "serviceaccount",
+				KeyID:  keyID,
+				Key:    string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})),
+				UserID: storage.MachineClientID(obj),
+			})
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintln(w, string(data))
+			return err
+		},
+	}
+	f := keygen.Flags()
+	f.StringVarP(&output, "output", "o", "", "The file the key file is written to, stdout if empty")
+	f.DurationVarP(&expiresIn, "expires-in", "", 0, "The lifetime of the key, it never expires if 0")
+	f.IntVarP(&bits, "bits", "", 2048, "The size of the RSA key")
+	return keygen
+}
+
+// thumbprint returns the JWK thumbprint of the public key (RFC 7638), its kid
+func thumbprint(key *rsa.PublicKey) (string, error) {
+	sum, err := (&jose.JSONWebKey{Key: key}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(sum), nil
+}
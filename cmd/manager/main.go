@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"time"
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
@@ -10,6 +11,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	"github.com/crochee/kim/internal/logx"
+	"github.com/crochee/kim/internal/storage"
 )
 
 var mainLog = ctrl.Log.WithName("main")
@@ -131,6 +133,253 @@ func root() (*cobra.Command, error) {
 	if err := viper.BindPFlag("otel-endpoint", pf.Lookup("otel-endpoint")); err != nil {
 		return nil, err
 	}
+	pf.StringP("otel-protocol", "", "grpc", "The OTLP protocol of the OpenTelemetry collector (one of 'grpc' or 'http/protobuf'). "+
+		"The scheme of the otel-endpoint selects the transport security, use https:// for TLS.")
+	if err := viper.BindPFlag("otel-protocol", pf.Lookup("otel-protocol")); err != nil {
+		return nil, err
+	}
+	pf.StringToStringP("otel-headers", "", nil, "The headers sent with every export to the OpenTelemetry collector, e.g. authorization=Bearer <token>.")
+	if err := viper.BindPFlag("otel-headers", pf.Lookup("otel-headers")); err != nil {
+		return nil, err
+	}
+	pf.StringP("otel-service-name", "", "kim", "The service name of the exported spans.")
+	if err := viper.BindPFlag("otel-service-name", pf.Lookup("otel-service-name")); err != nil {
+		return nil, err
+	}
+	pf.Float64P("otel-sample-ratio", "", 0.1, "The ratio of the traces to sample, child spans follow the decision of their parent.")
+	if err := viper.BindPFlag("otel-sample-ratio", pf.Lookup("otel-sample-ratio")); err != nil {
+		return nil, err
+	}
+	pf.StringP("session-key", "", "", "The secret used to sign and encrypt the single sign-on session cookie. "+
+		"If not set, a random key is generated and sessions do not survive restarts. The sessions are kept in the "+
+		"memory of each replica, so single sign-on across replicas needs sticky sessions besides a shared key.")
+	if err := viper.BindPFlag("session-key", pf.Lookup("session-key")); err != nil {
+		return nil, err
+	}
+	pf.StringP("crypto-key", "", "", "The secret the authorization codes and the tokens of the issuers are encrypted with, "+
+		"the keys of the issuers are derived from it. If not set, a random key is generated and kept in the Secret of "+
+		"crypto-key-secret. All replicas must share it.")
+	if err := viper.BindPFlag("crypto-key", pf.Lookup("crypto-key")); err != nil {
+		return nil, err
+	}
+	pf.StringP("crypto-key-secret", "", "kim-system/kim-crypto-key", "The <namespace>/<name> of the Secret keeping "+
+		"the generated crypto key if crypto-key is not set.")
+	if err := viper.BindPFlag("crypto-key-secret", pf.Lookup("crypto-key-secret")); err != nil {
+		return nil, err
+	}
+	pf.StringSliceP("audit-sinks", "", nil, "The sinks of the security audit log, any of 'stdout', 'file', 'webhook' "+
+		"and 'events' (Kubernetes Events on the User or Policy). If not set, no audit events are recorded.")
+	if err := viper.BindPFlag("audit-sinks", pf.Lookup("audit-sinks")); err != nil {
+		return nil, err
+	}
+	pf.StringP("audit-file", "", "/var/log/kim/audit.log", "The file of the 'file' audit sink.")
+	if err := viper.BindPFlag("audit-file", pf.Lookup("audit-file")); err != nil {
+		return nil, err
+	}
+	pf.IntP("audit-file-max-size", "", 100, "The size in megabytes at which the audit file is rotated.")
+	if err := viper.BindPFlag("audit-file-max-size", pf.Lookup("audit-file-max-size")); err != nil {
+		return nil, err
+	}
+	pf.IntP("audit-file-max-backups", "", 10, "The number of rotated audit files to keep, 0 keeps all of them.")
+	if err := viper.BindPFlag("audit-file-max-backups", pf.Lookup("audit-file-max-backups")); err != nil {
+		return nil, err
+	}
+	pf.StringP("audit-webhook-url", "", "", "The url the 'webhook' audit sink posts the events to.")
+	if err := viper.BindPFlag("audit-webhook-url", pf.Lookup("audit-webhook-url")); err != nil {
+		return nil, err
+	}
+	pf.DurationP("audit-webhook-timeout", "", 5*time.Second, "The timeout of a single delivery of the 'webhook' audit sink.")
+	if err := viper.BindPFlag("audit-webhook-timeout", pf.Lookup("audit-webhook-timeout")); err != nil {
+		return nil, err
+	}
+	pf.StringP("lockout-store", "", "memory", "The store of the failed logins, one of 'memory' (single replica), "+
+		"'kubernetes' (ConfigMaps shared by all replicas) or 'none' to disable the lockout.")
+	if err := viper.BindPFlag("lockout-store", pf.Lookup("lockout-store")); err != nil {
+		return nil, err
+	}
+	pf.StringP("lockout-namespace", "", "kim-system", "The namespace of the ConfigMaps of the 'kubernetes' lockout store.")
+	if err := viper.BindPFlag("lockout-namespace", pf.Lookup("lockout-namespace")); err != nil {
+		return nil, err
+	}
+	pf.IntP("lockout-user-max-failures", "", 5, "The number of consecutive failed logins locking a user.")
+	if err := viper.BindPFlag("lockout-user-max-failures", pf.Lookup("lockout-user-max-failures")); err != nil {
+		return nil, err
+	}
+	pf.IntP("lockout-ip-max-failures", "", 50, "The number of consecutive failed logins locking a source address.")
+	if err := viper.BindPFlag("lockout-ip-max-failures", pf.Lookup("lockout-ip-max-failures")); err != nil {
+		return nil, err
+	}
+	pf.DurationP("lockout-base-delay", "", time.Minute, "The first lockout duration, it doubles with every further failed login.")
+	if err := viper.BindPFlag("lockout-base-delay", pf.Lookup("lockout-base-delay")); err != nil {
+		return nil, err
+	}
+	pf.DurationP("lockout-max-delay", "", time.Hour, "The maximum lockout duration.")
+	if err := viper.BindPFlag("lockout-max-delay", pf.Lookup("lockout-max-delay")); err != nil {
+		return nil, err
+	}
+	pf.DurationP("lockout-reset-after", "", 15*time.Minute, "The period without failed logins after which the failures are forgotten.")
+	if err := viper.BindPFlag("lockout-reset-after", pf.Lookup("lockout-reset-after")); err != nil {
+		return nil, err
+	}
+	pf.IntP("lockout-user-code-max-attempts", "", 5, "The number of failed logins after which a device authorization is denied.")
+	if err := viper.BindPFlag("lockout-user-code-max-attempts", pf.Lookup("lockout-user-code-max-attempts")); err != nil {
+		return nil, err
+	}
+	pf.StringSliceP("trusted-proxies", "", nil, "The addresses or networks of the proxies whose X-Forwarded-For and X-Real-IP "+
+		"headers name the caller, the headers of other peers are ignored.")
+	if err := viper.BindPFlag("trusted-proxies", pf.Lookup("trusted-proxies")); err != nil {
+		return nil, err
+	}
+	pf.StringSliceP("rate-limits", "", []string{
+		"/oauth/token:ip=20/40",
+		"/oauth/token:client=50/100",
+		"/oauth/token:device_code=0.25/2",
+		"/oauth/introspect:client=100/200",
+		"/revoke:client=20/40",
+		"/device_authorization:ip=1/5",
+		"/login/username:ip=5/10",
+		"/device/login:ip=5/10",
+		"/recovery/*:ip=0.5/10",
+	}, "The token bucket rate limits of the endpoints in the form <path>:<kind>[:<client_id>]=<rate>/<burst>, "+
+		"the path is relative to the issuer and matches the paths below it if it ends with /*, "+
+		"the kind is one of 'ip', 'client' or 'device_code' and the rate is in requests per second. "+
+		"The requests not authenticating their client by its secret are limited per client and source address.")
+	if err := viper.BindPFlag("rate-limits", pf.Lookup("rate-limits")); err != nil {
+		return nil, err
+	}
+	pf.StringP("mailer", "", "none", "The mailer of the password reset and email verification links, one of 'smtp', "+
+		"'file' (appends the messages to mail-file, for development) or 'none' to disable the self-service recovery.")
+	if err := viper.BindPFlag("mailer", pf.Lookup("mailer")); err != nil {
+		return nil, err
+	}
+	pf.StringP("smtp-addr", "", "localhost:25", "The host:port of the SMTP server of the 'smtp' mailer.")
+	if err := viper.BindPFlag("smtp-addr", pf.Lookup("smtp-addr")); err != nil {
+		return nil, err
+	}
+	pf.StringP("smtp-username", "", "", "The username of the SMTP server, no authentication if not set.")
+	if err := viper.BindPFlag("smtp-username", pf.Lookup("smtp-username")); err != nil {
+		return nil, err
+	}
+	pf.StringP("smtp-password", "", "", "The password of the SMTP server.")
+	if err := viper.BindPFlag("smtp-password", pf.Lookup("smtp-password")); err != nil {
+		return nil, err
+	}
+	pf.StringP("mail-from", "", "kim@localhost", "The sender address of the messages.")
+	if err := viper.BindPFlag("mail-from", pf.Lookup("mail-from")); err != nil {
+		return nil, err
+	}
+	pf.StringP("mail-file", "", "/var/log/kim/mail.log", "The file of the 'file' mailer.")
+	if err := viper.BindPFlag("mail-file", pf.Lookup("mail-file")); err != nil {
+		return nil, err
+	}
+	pf.StringP("recovery-key", "", "", "The secret the self-service links are signed with, the session-key if not set. "+
+		"All replicas must share it.")
+	if err := viper.BindPFlag("recovery-key", pf.Lookup("recovery-key")); err != nil {
+		return nil, err
+	}
+	pf.StringP("issuer", "", "", "The external URL of the issuer of the server, e.g. https://id.example.com/. "+
+		"The self-service links point to it, so it is required by the mailer, and the Realms of its host are served below "+
+		"its /realms/ path; the links of the Realms point to their issuer.")
+	if err := viper.BindPFlag("issuer", pf.Lookup("issuer")); err != nil {
+		return nil, err
+	}
+	pf.DurationP("recovery-link-ttl", "", time.Hour, "The lifetime of the password reset and email verification links.")
+	if err := viper.BindPFlag("recovery-link-ttl", pf.Lookup("recovery-link-ttl")); err != nil {
+		return nil, err
+	}
+	pf.StringSliceP("account-editable-fields", "", []string{"givenName", "familyName", "middleName", "nickName", "picture", "zoneinfo", "locale"},
+		"The claim fields of the User the users may edit in the account portal.")
+	if err := viper.BindPFlag("account-editable-fields", pf.Lookup("account-editable-fields")); err != nil {
+		return nil, err
+	}
+	pf.StringP("theme-source", "", "none", "The source of the themes overriding the login pages and static assets: "+
+		"none, dir (a subdirectory per theme) or configmap (ConfigMaps labeled kim.kim.io/theme=<theme>).")
+	if err := viper.BindPFlag("theme-source", pf.Lookup("theme-source")); err != nil {
+		return nil, err
+	}
+	pf.StringP("theme-dir", "", "/etc/kim/themes", "The directory of the themes of the dir theme source.")
+	if err := viper.BindPFlag("theme-dir", pf.Lookup("theme-dir")); err != nil {
+		return nil, err
+	}
+	pf.StringP("theme-namespace", "", "kim-system", "The namespace of the ConfigMaps of the configmap theme source.")
+	if err := viper.BindPFlag("theme-namespace", pf.Lookup("theme-namespace")); err != nil {
+		return nil, err
+	}
+	pf.DurationP("theme-reload-interval", "", 10*time.Second, "The interval the theme source is checked for changes.")
+	if err := viper.BindPFlag("theme-reload-interval", pf.Lookup("theme-reload-interval")); err != nil {
+		return nil, err
+	}
+	pf.StringToStringP("client-themes", "", nil, "The themes of the login pages by client id, e.g. web=dark.")
+	if err := viper.BindPFlag("client-themes", pf.Lookup("client-themes")); err != nil {
+		return nil, err
+	}
+	pf.StringToStringP("frontchannel-logout-uris", "", nil, "The front-channel logout uris of the clients by client id, "+
+		"e.g. web=https://app.example.com/logout; they are loaded in iframes of the logout page of an ended session.")
+	if err := viper.BindPFlag("frontchannel-logout-uris", pf.Lookup("frontchannel-logout-uris")); err != nil {
+		return nil, err
+	}
+	pf.StringToStringP("backchannel-logout-uris", "", nil, "The back-channel logout uris of the clients by client id, "+
+		"e.g. web=https://app.example.com/backchannel-logout; they receive a logout token when a session ends.")
+	if err := viper.BindPFlag("backchannel-logout-uris", pf.Lookup("backchannel-logout-uris")); err != nil {
+		return nil, err
+	}
+	pf.StringSliceP("login-identifiers", "", []string{"name"}, "The fields of the User the login name is matched with, "+
+		"tried in order: 'name' (name/namespace), 'email' and 'preferredUsername'. The webhook keeps the claims unique.")
+	if err := viper.BindPFlag("login-identifiers", pf.Lookup("login-identifiers")); err != nil {
+		return nil, err
+	}
+	pf.StringP("default-namespace", "", "", "The namespace of the login names without a namespace, "+
+		"realms default to their first namespace.")
+	if err := viper.BindPFlag("default-namespace", pf.Lookup("default-namespace")); err != nil {
+		return nil, err
+	}
+	pf.BoolP("accept-legacy-subjects", "", false, "Accept the hex encoded name/namespace subjects of the tokens "+
+		"issued before the subjects were derived from the User UID. Enable it while such tokens are still valid.")
+	if err := viper.BindPFlag("accept-legacy-subjects", pf.Lookup("accept-legacy-subjects")); err != nil {
+		return nil, err
+	}
+	pf.StringToStringP("pairwise-clients", "", nil, "The clients with pairwise subjects and their sector_identifier_uri, "+
+		"e.g. web=https://partner.example.com/sector.json; an empty uri groups the client by the host of its redirect uris.")
+	if err := viper.BindPFlag("pairwise-clients", pf.Lookup("pairwise-clients")); err != nil {
+		return nil, err
+	}
+	pf.StringP("pairwise-salt", "", "", "The secret the pairwise subjects are derived from. "+
+		"It must never change and all replicas must share it, or the pairwise subjects change.")
+	if err := viper.BindPFlag("pairwise-salt", pf.Lookup("pairwise-salt")); err != nil {
+		return nil, err
+	}
+	pf.StringP("sector-identifier-documents", "", "", "The JSON file mapping the sector_identifier_uris of the pairwise "+
+		"clients to the redirect uris listed by their documents.")
+	if err := viper.BindPFlag("sector-identifier-documents", pf.Lookup("sector-identifier-documents")); err != nil {
+		return nil, err
+	}
+	pf.IntP("max-delegation-depth", "", storage.DefaultMaxDelegationDepth, "The maximum number of actors in the act "+
+		"claim of a token exchanged by delegation or impersonation.")
+	if err := viper.BindPFlag("max-delegation-depth", pf.Lookup("max-delegation-depth")); err != nil {
+		return nil, err
+	}
+	pf.StringP("admin-namespace", "", "kim-system", "The namespace of the Policies granting the resources of all "+
+		"namespaces, e.g. the signing key; the Policies of the other namespaces only grant the resources of their own.")
+	if err := viper.BindPFlag("admin-namespace", pf.Lookup("admin-namespace")); err != nil {
+		return nil, err
+	}
+	pf.StringSliceP("serviceaccount-audiences", "", []string{"kim"}, "The audiences of the ServiceAccount tokens "+
+		"exchanged for the tokens of the bound MachineClients, the audiences of the apiserver if empty.")
+	if err := viper.BindPFlag("serviceaccount-audiences", pf.Lookup("serviceaccount-audiences")); err != nil {
+		return nil, err
+	}
+	pf.BoolP("admin-api", "", false, "Serve the admin API at /admin/v1 of the default issuer, "+
+		"the callers are authorized by the Policies bound to them. It is served next to the public endpoints of "+
+		"the issuer, so it is only enabled on request.")
+	if err := viper.BindPFlag("admin-api", pf.Lookup("admin-api")); err != nil {
+		return nil, err
+	}
+	pf.StringSliceP("admin-audiences", "", []string{"kimctl", "kim-admin"}, "The client_ids or the audiences of "+
+		"the access tokens the admin API accepts, e.g. the client of kimctl or an audience of the machine clients.")
+	if err := viper.BindPFlag("admin-audiences", pf.Lookup("admin-audiences")); err != nil {
+		return nil, err
+	}
 	logx.BindFlags(&opts, pf)
+	cmd.AddCommand(newKeygenCmd())
 	return cmd, nil
 }
@@ -6,24 +6,45 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"os"
 
 	"github.com/sourcegraph/conc/pool"
 	"github.com/spf13/viper"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/crochee/kim/cmd"
+	"github.com/crochee/kim/internal/audit"
 	"github.com/crochee/kim/internal/tracing"
 )
 
 func runRoot(ctx context.Context) error {
+	if err := setupAudit(ctx); err != nil {
+		return err
+	}
 	issuer := fmt.Sprintf("http://localhost:%s/", "89000")
-	r, err := SetupServer(issuer, "", []string{"http://localhost:3000/"})
+	r, realms, err := SetupServer(ctx, issuer, []string{"http://localhost:3000/"})
 	if err != nil {
 		return err
 	}
+	// the themes are loaded before serving, so that a broken theme fails the start instead of being skipped
+	watcher, err := newThemeWatcher()
+	if err != nil {
+		return err
+	}
+	if watcher != nil {
+		if err = watcher.Reload(logf.IntoContext(ctx, mainLog)); err != nil {
+			mainLog.Error(err, "Failed to load themes")
+			return err
+		}
+	}
 	g := pool.New().WithContext(ctx).WithCancelOnError()
+	if watcher != nil {
+		g.Go(func(ctx context.Context) error {
+			return watcher.Run(logf.IntoContext(ctx, mainLog))
+		})
+	}
 	g.Go(func(ctx context.Context) error {
-		return cmd.Operator(ctx)
+		return cmd.Operator(ctx, realms)
 	})
 	g.Go(func(ctx context.Context) error {
 		return trace(ctx)
@@ -53,7 +74,13 @@ func trace(ctx context.Context) error {
 		return nil
 	}
 	mainLog.Info("Initializing OpenTelemetry tracer provider", "otel-endpoint", otelEndponint)
-	tp, err := tracing.InitTracer(ctx, otelEndponint)
+	tp, err := tracing.InitTracer(ctx, tracing.Config{
+		Endpoint:    otelEndponint,
+		Protocol:    viper.GetString("otel-protocol"),
+		Headers:     viper.GetStringMapString("otel-headers"),
+		ServiceName: viper.GetString("otel-service-name"),
+		SampleRatio: viper.GetFloat64("otel-sample-ratio"),
+	})
 	if err != nil {
 		mainLog.Error(err, "Failed to initialize tracer")
 		return err
@@ -66,3 +93,36 @@ func trace(ctx context.Context) error {
 	}(ctx)
 	return nil
 }
+
+// setupAudit registers the audit sinks of the server, the 'events' sink is registered by the operator
+// as it needs the event recorder of the manager
+func setupAudit(ctx context.Context) error {
+	for _, sink := range viper.GetStringSlice("audit-sinks") {
+		switch sink {
+		case "stdout":
+			audit.AddSink(audit.NewWriterSink(sink, os.Stdout))
+		case "file":
+			fileSink, err := audit.NewFileSink(viper.GetString("audit-file"),
+				int64(viper.GetInt("audit-file-max-size"))<<20, viper.GetInt("audit-file-max-backups"))
+			if err != nil {
+				mainLog.Error(err, "Failed to open audit file")
+				return err
+			}
+			go func() {
+				<-ctx.Done()
+				_ = fileSink.Close()
+			}()
+			audit.AddSink(fileSink)
+		case "webhook":
+			url := viper.GetString("audit-webhook-url")
+			if url == "" {
+				return errors.New("audit-webhook-url is required by the webhook audit sink")
+			}
+			audit.AddSink(audit.NewWebhookSink(logf.IntoContext(ctx, mainLog), url, viper.GetDuration("audit-webhook-timeout")))
+		case "events":
+		default:
+			return fmt.Errorf("unknown audit sink %q", sink)
+		}
+	}
+	return nil
+}
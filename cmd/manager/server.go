@@ -1,19 +1,40 @@
 package main
 
 import (
+	"context"
+	"crypto/hmac"
 	"crypto/sha256"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/spf13/viper"
 	"github.com/zitadel/logging"
+	"github.com/zitadel/oidc/v3/pkg/oidc"
 	"github.com/zitadel/oidc/v3/pkg/op"
-	"golang.org/x/text/language"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/cmd"
+	"github.com/crochee/kim/internal/admin"
+	"github.com/crochee/kim/internal/audit"
+	"github.com/crochee/kim/internal/clientip"
 	"github.com/crochee/kim/internal/handle"
+	"github.com/crochee/kim/internal/i18n"
+	"github.com/crochee/kim/internal/mail"
+	"github.com/crochee/kim/internal/metrics"
+	"github.com/crochee/kim/internal/ratelimit"
+	"github.com/crochee/kim/internal/realm"
 	"github.com/crochee/kim/internal/storage"
+	"github.com/crochee/kim/internal/theme"
+	"github.com/crochee/kim/internal/tracing"
 )
 
 const (
@@ -24,19 +45,44 @@ type Storage interface {
 	op.Storage
 	handle.Authenticate
 	handle.DeviceAuthenticate
+	handle.Logout
+	handle.Recovery
+	handle.Account
 }
 
-func getUserStore(issuer, usersFile string) (storage.UserStore, error) {
-	if usersFile == "" {
-		return storage.NewUserStore(issuer), nil
+// newMailer returns the mailer of the self-service links selected by the mailer flag, or nil if it is disabled
+func newMailer() (mail.Mailer, error) {
+	switch mailer := viper.GetString("mailer"); mailer {
+	case "none":
+		return nil, nil
+	case "smtp":
+		return mail.NewSMTPMailer(mail.SMTPConfig{
+			Addr:     viper.GetString("smtp-addr"),
+			Username: viper.GetString("smtp-username"),
+			Password: viper.GetString("smtp-password"),
+			From:     viper.GetString("mail-from"),
+		}), nil
+	case "file":
+		return mail.NewFileMailer(viper.GetString("mail-file"), viper.GetString("mail-from")), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", mailer)
 	}
-	return storage.StoreFromFile(usersFile)
+}
+
+// newThemeWatcher returns the watcher reloading the themes of the login pages, or nil if the embedded pages are used
+func newThemeWatcher() (*theme.Watcher, error) {
+	source, err := cmd.ThemeSource()
+	if err != nil || source == nil {
+		return nil, err
+	}
+	return theme.NewWatcher(source, viper.GetDuration("theme-reload-interval"), handle.LoadThemes), nil
 }
 
 // SetupServer creates an OIDC server with Issuer=http://localhost:<port>
 //
 // Use one of the pre-made clients in storage/clients.go or register a new one.
-func SetupServer(issuer, usersFile string, redirectURI []string) (chi.Router, error) {
+// The returned registry serves the Realms next to the issuer of the server, it is driven by the Realm controller.
+func SetupServer(ctx context.Context, issuer string, redirectURI []string) (chi.Router, *realm.Registry, error) {
 	logger := slog.New(
 		slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
 			AddSource: true,
@@ -44,74 +90,401 @@ func SetupServer(issuer, usersFile string, redirectURI []string) (chi.Router, er
 		}),
 	)
 
-	storage.RegisterClients(
+	frontChannelLogoutURIs := viper.GetStringMapString("frontchannel-logout-uris")
+	backChannelLogoutURIs := viper.GetStringMapString("backchannel-logout-uris")
+	clients := []*storage.Client{
 		storage.NativeClient("native", redirectURI...),
-		storage.WebClient("web", "secret", redirectURI...),
-		storage.WebClient("api", "secret", redirectURI...),
-	)
+		storage.WebClient("web", "secret", redirectURI...).
+			WithLogout(redirectURI, frontChannelLogoutURIs["web"], backChannelLogoutURIs["web"]),
+		storage.WebClient("api", "secret", redirectURI...).
+			WithLogout(redirectURI, frontChannelLogoutURIs["api"], backChannelLogoutURIs["api"]),
+		// the account portal signs in the users by the OP itself
+		storage.AccountClient(strings.TrimSuffix(issuer, "/") + "/account/callback"),
+	}
+	clientThemes := viper.GetStringMapString("client-themes")
+	for _, client := range clients {
+		if name, ok := clientThemes[client.GetID()]; ok {
+			client.WithTheme(name)
+		}
+	}
+	// the clients opting in to pairwise subjects can not correlate their users with the clients of other sectors
+	sectorDocuments, err := newSectorDocuments()
+	if err != nil {
+		mainLog.Error(err, "cannot load sector identifier documents")
+		return nil, nil, err
+	}
+	pairwiseClients := viper.GetStringMapString("pairwise-clients")
+	for _, client := range clients {
+		if sectorIdentifierURI, ok := pairwiseClients[client.GetID()]; ok {
+			if err = client.WithPairwiseSubject(sectorIdentifierURI, sectorDocuments); err != nil {
+				mainLog.Error(err, "invalid pairwise client")
+				return nil, nil, err
+			}
+		}
+	}
+	pairwiseSalt := []byte(viper.GetString("pairwise-salt"))
+	if len(pairwiseClients) > 0 && len(pairwiseSalt) == 0 {
+		err = errors.New("pairwise-salt is required by the pairwise-clients")
+		mainLog.Error(err, "invalid pairwise subjects")
+		return nil, nil, err
+	}
+	storage.RegisterClients(clients...)
+	userLookup, err := cmd.UserLookup()
+	if err != nil {
+		mainLog.Error(err, "invalid login-identifiers")
+		return nil, nil, err
+	}
+	accountFields := viper.GetStringSlice("account-editable-fields")
+	if err := storage.ValidateClaimFields(accountFields); err != nil {
+		mainLog.Error(err, "invalid account-editable-fields")
+		return nil, nil, err
+	}
 
-	// the OpenIDProvider interface needs a Storage interface handling various checks and state manipulations
-	// this might be the layer for accessing your database
-	// in this example it will be handled in-memory
-	store, err := getUserStore(issuer, usersFile)
+	// the OpenIDProvider interface needs a Storage interface handling various checks and state manipulations,
+	// the users are read from the cluster
+	store, err := cmd.UserStore(ctx)
 	if err != nil {
 		mainLog.Error(err, "cannot create UserStore")
-		return nil, err
+		return nil, nil, err
+	}
+	// the single sign-on session cookie lets already authenticated users skip the login form
+	sessions := handle.NewSessionCookie([]byte(viper.GetString("session-key")), storage.SessionLifetime)
+	// failed logins are counted per user, source address and device user code to slow down brute-force attacks
+	users, ips, userCodes, err := cmd.LockoutGuards()
+	if err != nil {
+		mainLog.Error(err, "cannot create lockout store")
+		return nil, nil, err
+	}
+	mailer, err := newMailer()
+	if err != nil {
+		mainLog.Error(err, "cannot create mailer")
+		return nil, nil, err
+	}
+	serverIssuer := viper.GetString("issuer")
+	recoveryKey := viper.GetString("recovery-key")
+	if recoveryKey == "" {
+		recoveryKey = viper.GetString("session-key")
+	}
+	authStorage := storage.NewStorage(store).WithLockout(users, ips, userCodes).
+		WithMaxDelegationDepth(viper.GetInt("max-delegation-depth")).
+		WithAdminNamespace(viper.GetString("admin-namespace"))
+	if len(pairwiseSalt) > 0 {
+		authStorage.WithPairwiseSubjects(pairwiseSalt)
+	}
+	if mailer != nil {
+		// the host of the requests is chosen by the requester, the links must not point to it
+		if serverIssuer == "" {
+			err = errors.New("issuer is required by the mailer")
+			mainLog.Error(err, "cannot enable the self-service recovery")
+			return nil, nil, err
+		}
+		authStorage.WithRecovery(mailer, serverIssuer, []byte(recoveryKey), viper.GetDuration("recovery-link-ttl"))
+	}
+	// the machine clients are read from the cluster just as the users
+	machineClients, err := cmd.MachineClientStore()
+	if err != nil {
+		mainLog.Error(err, "cannot create MachineClient store")
+		return nil, nil, err
+	}
+	serviceAccounts, err := cmd.ServiceAccountStore()
+	if err != nil {
+		mainLog.Error(err, "cannot create ServiceAccount store")
+		return nil, nil, err
+	}
+	workloadTrusts, err := cmd.WorkloadTrustStore()
+	if err != nil {
+		mainLog.Error(err, "cannot create WorkloadTrust store")
+		return nil, nil, err
+	}
+	authStorage.WithMachineClients(machineClients).WithServiceAccounts(serviceAccounts).WithWorkloadTrusts(workloadTrusts)
+	var adminClient client.Client
+	if viper.GetBool("admin-api") {
+		if adminClient, err = cmd.Client(); err != nil {
+			mainLog.Error(err, "cannot create admin API client")
+			return nil, nil, err
+		}
+	}
+
+	// the forwarded headers of the trusted proxies name the caller, which is the key of the lockout and the rate limits
+	trustedProxies, err := clientip.ParsePrefixes(viper.GetStringSlice("trusted-proxies"))
+	if err != nil {
+		mainLog.Error(err, "invalid trusted proxies")
+		return nil, nil, err
+	}
+	rules := make([]ratelimit.Rule, 0, len(viper.GetStringSlice("rate-limits")))
+	for _, value := range viper.GetStringSlice("rate-limits") {
+		rule, err := ratelimit.ParseRule(value)
+		if err != nil {
+			mainLog.Error(err, "invalid rate limit")
+			return nil, nil, err
+		}
+		rules = append(rules, rule)
+	}
+	limiter := ratelimit.New(rules)
+
+	// the OpenID Provider requires a 32-byte key for (token) encryption, every issuer derives one of its own
+	cryptoKey, err := cmd.CryptoKey(ctx)
+	if err != nil {
+		mainLog.Error(err, "cannot load crypto key")
+		return nil, nil, err
+	}
+	// the host of the requests is chosen by the requester, only a trusted proxy may forward another one
+	defaultIssuerOf := issuerFromTrustedHost(trustedProxies)
+	if serverIssuer != "" {
+		defaultIssuerOf = op.StaticIssuer(serverIssuer)
+	}
+	defaultIssuer, err := newIssuerRouter(issuerConfig{
+		storage:       authStorage,
+		issuer:        defaultIssuerOf,
+		cryptoKey:     issuerKey(cryptoKey, ""),
+		sessions:      sessions,
+		accountFields: accountFields,
+		pairwise:      len(pairwiseSalt) > 0,
+		admin:         adminClient,
+		limits:        limiter.Scope("", authStorage),
+		logger:        logger,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// every realm is served by an OpenID Provider of its own, so that the realms share nothing but the process
+	realms := realm.NewRegistry(func(ctx context.Context, config *realm.Config) (http.Handler, error) {
+		// the names without a namespace are users of the realm
+		lookup := userLookup
+		if !slices.Contains(config.Namespaces, lookup.DefaultNamespace) {
+			lookup.DefaultNamespace = config.Namespaces[0]
+		}
+		clients, err := realmClients(config, sectorDocuments)
+		if err != nil {
+			return nil, err
+		}
+		realmStorage := storage.NewStorageWithClients(
+			storage.NewNamespacedUserStore(storage.UserStoreFromClient(config.Client, lookup), config.Namespaces),
+			clients,
+		).WithLockout(users, ips, userCodes).
+			WithMachineClients(storage.NewMachineClientStore(config.Client, lookup.DefaultNamespace, config.Namespaces...)).
+			WithServiceAccounts(storage.NewServiceAccountStore(config.Client, viper.GetStringSlice("serviceaccount-audiences"),
+				config.Namespaces...)).
+			WithWorkloadTrusts(storage.NewWorkloadTrustStore(config.Client, config.Namespaces...)).
+			WithMaxDelegationDepth(viper.GetInt("max-delegation-depth")).
+			WithAdminNamespace(viper.GetString("admin-namespace"))
+		pairwise := slices.ContainsFunc(config.Clients, func(c realm.Client) bool {
+			return c.SubjectType == storage.SubjectTypePairwise
+		})
+		if pairwise {
+			if len(pairwiseSalt) == 0 {
+				return nil, errors.New("pairwise-salt is required by the pairwise clients")
+			}
+			realmStorage.WithPairwiseSubjects(pairwiseSalt)
+		}
+		if config.SigningKey != nil {
+			realmStorage.WithSigningKey(config.SigningKeyID, config.SigningKey)
+		}
+		if mailer != nil {
+			realmStorage.WithRecovery(mailer, config.Issuer, []byte(recoveryKey), viper.GetDuration("recovery-link-ttl"))
+		}
+		base := config.BasePath()
+		return newIssuerRouter(issuerConfig{
+			storage: realmStorage,
+			issuer:  op.StaticIssuer(config.Issuer),
+			base:    base,
+			// the tokens of a realm can not be decrypted by another realm
+			cryptoKey:     issuerKey(cryptoKey, config.Issuer),
+			sessions:      sessions.WithScope(config.Key.Namespace+"_"+config.Key.Name, base+"/"),
+			accountFields: accountFields,
+			pairwise:      pairwise,
+			// the realms are limited by the paths below their issuer and do not share the buckets
+			limits: limiter.Scope(config.Key.String()+":", realmStorage),
+			logger: logger.With("realm", config.Key.String()),
+		})
+	}, defaultIssuer).WithTrustedProxies(trustedProxies)
+	if serverIssuer != "" {
+		if realms, err = realms.WithServerIssuer(serverIssuer); err != nil {
+			mainLog.Error(err, "invalid issuer")
+			return nil, nil, err
+		}
 	}
-	storage := storage.NewStorage(store)
-	// the OpenID Provider requires a 32-byte key for (token) encryption
-	// be sure to create a proper crypto random key and manage it securely!
 
 	router := chi.NewRouter()
 	router.Use(logging.Middleware(
 		logging.WithLogger(logger),
 	))
+	router.Use(tracing.Middleware)
+	router.Use(metrics.Middleware)
+	router.Use(clientip.NewMiddleware(trustedProxies))
+	router.Use(audit.Middleware)
+	router.Mount("/", realms)
 
-	// for simplicity, we provide a very small default page for users who have signed out
-	router.HandleFunc(pathLoggedOut, func(w http.ResponseWriter, req *http.Request) {
-		w.Write([]byte("signed out successfully"))
-		// no need to check/log error, this will be handled by the middleware.
-	})
+	return router, realms, nil
+}
+
+// issuerKey derives the key of the codes and tokens of the issuer from the crypto key
+func issuerKey(cryptoKey []byte, issuer string) [32]byte {
+	mac := hmac.New(sha256.New, cryptoKey)
+	mac.Write([]byte("kim-crypto:" + issuer))
+	return [32]byte(mac.Sum(nil))
+}
+
+// issuerFromTrustedHost returns the issuer of the host of the request, the Forwarded header only names the host
+// if the request was sent by a trusted proxy
+func issuerFromTrustedHost(trusted []netip.Prefix) func(bool) (op.IssuerFromRequest, error) {
+	return func(insecure bool) (op.IssuerFromRequest, error) {
+		forwarded, err := op.IssuerFromForwardedOrHost("")(insecure)
+		if err != nil {
+			return nil, err
+		}
+		host, err := op.IssuerFromHost("")(insecure)
+		if err != nil {
+			return nil, err
+		}
+		return func(r *http.Request) string {
+			if clientip.IsTrusted(trusted, clientip.FromRequest(r)) {
+				return forwarded(r)
+			}
+			return host(r)
+		}, nil
+	}
+}
+
+// realmClients returns the clients of the realm, their login pages are served below the path of the issuer
+func realmClients(config *realm.Config, documents storage.SectorDocuments) (map[string]*storage.Client, error) {
+	base := config.BasePath()
+	clients := map[string]*storage.Client{}
+	for _, c := range config.Clients {
+		var client *storage.Client
+		switch c.Type {
+		case kimv1.RealmClientNative:
+			client = storage.NativeClient(c.ID, c.RedirectURIs...)
+		case kimv1.RealmClientDevice:
+			client = storage.DeviceClient(c.ID, c.Secret)
+		default:
+			client = storage.WebClient(c.ID, c.Secret, c.RedirectURIs...)
+		}
+		client.WithLogout(c.PostLogoutRedirectURIs, c.FrontChannelLogoutURI, c.BackChannelLogoutURI)
+		theme := c.Theme
+		if theme == "" {
+			theme = config.Theme
+		}
+		if c.SubjectType == storage.SubjectTypePairwise {
+			if err := client.WithPairwiseSubject(c.SectorIdentifierURI, documents); err != nil {
+				return nil, err
+			}
+		}
+		clients[c.ID] = client.WithBasePath(base).WithTheme(theme)
+	}
+	account := storage.AccountClient(strings.TrimSuffix(config.Issuer, "/") + "/account/callback").WithBasePath(base)
+	clients[account.GetID()] = account.WithTheme(config.Theme)
+	return clients, nil
+}
+
+// newSectorDocuments returns the local copies of the documents of the sector_identifier_uris, if any
+func newSectorDocuments() (storage.SectorDocuments, error) {
+	path := viper.GetString("sector-identifier-documents")
+	if path == "" {
+		return storage.SectorDocuments{}, nil
+	}
+	return storage.LoadSectorDocuments(path)
+}
+
+// issuerConfig is the configuration of an issuer served by an OpenID Provider of its own
+type issuerConfig struct {
+	storage *storage.Storage
+	issuer  func(insecure bool) (op.IssuerFromRequest, error)
+	// base is the path of the issuer without the trailing slash, the prefix of the paths the pages link to
+	base          string
+	cryptoKey     [32]byte
+	sessions      *handle.SessionCookie
+	accountFields []string
+	// pairwise announces the pairwise subjects of the clients opting in
+	pairwise bool
+	// admin is the client of the objects administered by the admin API, which is not served if nil
+	admin client.Client
+	// limits rate limits the requests by their path relative to the issuer
+	limits func(http.Handler) http.Handler
+	logger *slog.Logger
+}
+
+// newIssuerRouter returns the OpenID Provider of the issuer with its login, logout, account, recovery and device pages
+func newIssuerRouter(config issuerConfig) (chi.Router, error) {
+	authStorage := config.storage
+	sessions := config.sessions
 
 	// creation of the OpenIDProvider with the just created in-memory Storage
-	provider, err := newOP(storage, issuer, logger)
+	provider, err := newOP(authStorage, config.issuer, config.base, config.cryptoKey, config.logger)
 	if err != nil {
 		return nil, err
 	}
 
+	router := chi.NewRouter()
+	router.Use(config.limits)
+	// the pages link to the paths below the issuer of the request
+	router.Use(op.NewIssuerInterceptor(provider.IssuerFromRequest).Handler)
+	// the end_session endpoint finds the single sign-on session of the browser by the session cookie
+	router.Use(sessions.Middleware(storage.ContextWithSessionID))
+
+	// the end_session endpoint redirects to the logout page, which signs the user out of the other clients
+	// of the session (front-channel logout) and is also the default page for users who have signed out
+	router.Handle(pathLoggedOut, handle.NewLogout(authStorage, sessions, op.NewIssuerInterceptor(provider.IssuerFromRequest)))
+
 	// the provider will only take care of the OpenID Protocol, so there must be some sort of UI for the login process
 	// for the simplicity of the example this means a simple page with username and password field
 	// be sure to provide an IssuerInterceptor with the IssuerFromRequest from the OP so the login can select / and pass it to the storage
-	l := handle.NewLogin(storage, op.AuthCallbackURL(provider), op.NewIssuerInterceptor(provider.IssuerFromRequest))
+	l := handle.NewLogin(authStorage, provider, sessions, op.AuthCallbackURL(provider), op.NewIssuerInterceptor(provider.IssuerFromRequest))
 
 	// regardless of how many pages / steps there are in the process, the UI must be registered in the router,
 	// so we will direct all calls to /login to the login UI
 	router.Mount("/login/", http.StripPrefix("/login", l))
 
+	// the account portal lets the signed-in users manage their profile, password, second factor, sessions and clients
+	authorize := func(ctx context.Context) string {
+		return provider.AuthorizationEndpoint().Absolute(op.IssuerFromContext(ctx))
+	}
+	router.Mount("/account/", http.StripPrefix("/account", handle.NewAccount(authStorage, sessions, authorize, config.accountFields,
+		op.NewIssuerInterceptor(provider.IssuerFromRequest))))
+
+	// the self-service pages to reset a forgotten password and to verify the email address by links sent by mail
+	router.Mount("/recovery/", http.StripPrefix("/recovery", handle.NewRecovery(authStorage)))
+
+	// the static assets of the themes, which the pages refer to by the static template function
+	router.Mount("/static/", http.StripPrefix("/static", handle.StaticHandler()))
+
 	router.Route("/device", func(r chi.Router) {
-		handle.RegisterDeviceAuth(storage, r)
+		handle.RegisterDeviceAuth(authStorage, r)
 	})
 
-	handler := http.Handler(provider)
+	// the admin API authorizes the access tokens of the issuer by the Policies bound to their subjects
+	if config.admin != nil {
+		router.Mount(admin.BasePath, admin.New(authStorage, config.admin, provider, viper.GetStringSlice("admin-audiences")))
+	}
+
+	// the ServiceAccount tokens and the JWTs of the trusted issuers are exchanged at the token endpoint
+	// next to the grants of the OP
+	handler := handle.TokenExchange(provider, authStorage, provider)
+	if config.pairwise {
+		router.Handle(oidc.DiscoveryEndpoint, handle.SubjectTypes(handler, storage.SubjectTypePublic, storage.SubjectTypePairwise))
+	}
 	// we register the http handler of the OP on the root, so that the discovery endpoint (/.well-known/openid-configuration)
 	// is served on the correct path
 	//
 	// if your issuer ends with a path (e.g. http://localhost:9998/custom/path/),
-	// then you would have to set the path prefix (/custom/path/)
+	// then the path prefix (/custom/path/) is stripped before, as the realms do
 	router.Mount("/", handler)
 
 	return router, nil
 }
 
-// newOP will create an OpenID Provider for localhost on a specified port with a given encryption key
-// and a predefined default logout uri
+// newOP will create an OpenID Provider for the issuer with a given encryption key
+// and a predefined default logout uri below the base path of the issuer
 // it will enable all options (see descriptions)
-func newOP(storage op.Storage, issuer string, logger *slog.Logger, extraOptions ...op.Option) (op.OpenIDProvider, error) {
+func newOP(storage op.Storage, issuer func(bool) (op.IssuerFromRequest, error), base string, cryptoKey [32]byte,
+	logger *slog.Logger, extraOptions ...op.Option,
+) (op.OpenIDProvider, error) {
 	config := &op.Config{
-		CryptoKey: sha256.Sum256([]byte("test")),
+		CryptoKey: cryptoKey,
 
 		// will be used if the end_session endpoint is called without a post_logout_redirect_uri
-		DefaultLogoutRedirectURI: pathLoggedOut,
+		DefaultLogoutRedirectURI: base + pathLoggedOut,
 
 		// enables code_challenge_method S256 for PKCE (and therefore PKCE in general)
 		CodeMethodS256: true,
@@ -128,23 +501,29 @@ func newOP(storage op.Storage, issuer string, logger *slog.Logger, extraOptions
 		// enables use of the `request` Object parameter
 		RequestObjectSupported: true,
 
-		// this example has only static texts (in English), so we'll set the here accordingly
-		SupportedUILocales: []language.Tag{language.English},
+		// the pages are translated to the locales of the bundled message catalogs
+		SupportedUILocales: i18n.Supported,
 
 		DeviceAuthorization: op.DeviceAuthorizationConfig{
 			Lifetime:     5 * time.Minute,
 			PollInterval: 5 * time.Second,
-			UserFormPath: "/device",
+			UserFormPath: base + "/device",
 			UserCode:     op.UserCodeBase20,
 		},
+
+		// logout tokens are sent to the back-channel logout uri of the clients and carry the sid claim
+		BackChannelLogoutSupported:        true,
+		BackChannelLogoutSessionSupported: true,
 	}
 	return op.NewProvider(config, storage,
-		op.IssuerFromForwardedOrHost("https://localhost:9998"),
-		// we must explicitly allow the use of the http issuer
-		op.WithAllowInsecure(),
-		// as an example on how to customize an endpoint this will change the authorization_endpoint from /authorize to /auth
-		op.WithCustomAuthEndpoint(op.NewEndpoint("auth")),
-		// Pass our logger to the OP
-		op.WithLogger(logger.WithGroup("op")),
+		issuer,
+		append([]op.Option{
+			// we must explicitly allow the use of the http issuer
+			op.WithAllowInsecure(),
+			// as an example on how to customize an endpoint this will change the authorization_endpoint from /authorize to /auth
+			op.WithCustomAuthEndpoint(op.NewEndpoint("auth")),
+			// Pass our logger to the OP
+			op.WithLogger(logger.WithGroup("op")),
+		}, extraOptions...)...,
 	)
 }
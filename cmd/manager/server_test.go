@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIssuerFromTrustedHost(t *testing.T) {
+	issuerOf, err := issuerFromTrustedHost([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for peer, want := range map[string]string{
+		"10.1.2.3:4711":  "https://proxied.example.com",
+		"192.0.2.1:4711": "https://kim.example.com",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "https://kim.example.com/.well-known/openid-configuration", nil)
+		r.RemoteAddr = peer
+		r.Header.Set("Forwarded", "host=proxied.example.com;proto=https")
+		if got := issuerOf(r); got != want {
+			t.Errorf("issuer of %s = %q, want %q", peer, got, want)
+		}
+	}
+}
+
+func TestIssuerKey(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	a, b := issuerKey(key, "https://a.example.com/"), issuerKey(key, "https://b.example.com/")
+	if a == b {
+		t.Error("the issuers share a key")
+	}
+	if a != issuerKey(key, "https://a.example.com/") {
+		t.Error("the key of the issuer is not stable")
+	}
+	if a == issuerKey([]byte("fedcba9876543210fedcba9876543210"), "https://a.example.com/") {
+		t.Error("the key of the issuer does not depend on the crypto key")
+	}
+}
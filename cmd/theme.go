@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crochee/kim/internal/theme"
+)
+
+// ThemeSource returns the source of the themes of the login pages, it is nil if only the embedded pages are used
+func ThemeSource() (theme.Source, error) {
+	switch source := viper.GetString("theme-source"); source {
+	case "none":
+		return nil, nil
+	case "dir":
+		return theme.NewDirSource(viper.GetString("theme-dir")), nil
+	case "configmap":
+		cfg, err := ctrl.GetConfig()
+		if err != nil {
+			return nil, err
+		}
+		// the ConfigMaps are polled, a cache would watch all ConfigMaps of the namespace
+		c, err := client.New(cfg, client.Options{Scheme: scheme})
+		if err != nil {
+			return nil, err
+		}
+		return theme.NewConfigMapSource(c, viper.GetString("theme-namespace")), nil
+	default:
+		return nil, fmt.Errorf("unknown theme source %q", source)
+	}
+}
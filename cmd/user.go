@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crochee/kim/internal/storage"
+)
+
+// UserLookup returns how the login names are resolved to the Users
+func UserLookup() (storage.UserLookup, error) {
+	identifiers, err := storage.ParseLoginIdentifiers(viper.GetStringSlice("login-identifiers"))
+	if err != nil {
+		return storage.UserLookup{}, err
+	}
+	return storage.UserLookup{
+		Identifiers:      identifiers,
+		DefaultNamespace: viper.GetString("default-namespace"),
+		LegacySubjects:   viper.GetBool("accept-legacy-subjects"),
+	}, nil
+}
+
+// UserStore returns the store of the users of the default issuer. The server starts before the cache of the
+// operator, so the users are looked up by the field indexes of a cache of their own, which runs until ctx is done.
+// The Secrets of the passwords are read directly and never cached.
+func UserStore(ctx context.Context) (storage.UserStore, error) {
+	lookup, err := UserLookup()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	users, err := cache.New(cfg, cache.Options{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+	if err = storage.IndexUsers(ctx, users); err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := users.Start(ctx); err != nil {
+			setupLog.Error(err, "user cache stopped")
+		}
+	}()
+	c, err := client.New(cfg, client.Options{
+		Scheme: scheme,
+		Cache:  &client.CacheOptions{Reader: users, DisableFor: []client.Object{&corev1.Secret{}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return storage.UserStoreFromClient(c, lookup), nil
+}
@@ -0,0 +1,219 @@
+// Package admin serves the /admin/v1 API of the manager. It manages the users, the machine clients, the
+// policies, the roles and the ServiceAccount bindings in the cluster, lists and revokes the sessions and
+// the tokens of the issuer, rotates its signing key and unlocks the users.
+//
+// The callers authenticate by an access token of the issuer issued to one of the admin audiences, e.g. to kimctl,
+// so that the tokens the other clients hold do not act on the API. The actions they may perform are granted by
+// the Policies bound to their user or machine client, see package policy for the resources and actions.
+//
+// The sessions, the tokens and the signing key are held in the memory of the replica serving the request: the
+// lists show, the revocations end and the rotation replaces only those of that replica.
+// The OpenAPI 3 document of the API is generated from its routes and served at /admin/v1/openapi.json.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+	"github.com/zitadel/oidc/v3/pkg/op"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crochee/kim/internal/audit"
+	"github.com/crochee/kim/internal/policy"
+	"github.com/crochee/kim/internal/storage"
+)
+
+// BasePath is the path the API is served at below the issuer
+const BasePath = "/admin/v1"
+
+// Storage is the state of the issuer administered by the API
+type Storage interface {
+	// TokenPrincipal returns the principal of the active access token of the id and the subject
+	TokenPrincipal(ctx context.Context, tokenID, subject string) (*storage.Principal, error)
+	SubjectResource(ctx context.Context, subject string) (string, error)
+
+	Sessions(ctx context.Context) []storage.Session
+	FindSession(ctx context.Context, sessionID string) (storage.Session, error)
+	RevokeSession(ctx context.Context, sessionID, clientID string) error
+
+	Tokens(ctx context.Context) []storage.TokenInfo
+	FindToken(ctx context.Context, tokenID string) (storage.TokenInfo, error)
+	RevokeTokenByID(ctx context.Context, tokenID string) error
+	RevokeTokens(ctx context.Context, subject, clientID string) int
+
+	RotateSigningKey(ctx context.Context) (string, error)
+}
+
+// Verifier verifies the access tokens of the issuer, it is implemented by op.OpenIDProvider
+type Verifier interface {
+	Crypto() op.Crypto
+	AccessTokenVerifier(ctx context.Context) *op.AccessTokenVerifier
+}
+
+// Error is the body of the responses of the failed requests
+type Error struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(status int, message string) *Error {
+	return &Error{Status: status, Message: message}
+}
+
+var (
+	errUnauthorized = newError(http.StatusUnauthorized, "a valid bearer token is required")
+	errForbidden    = newError(http.StatusForbidden, "the action is not allowed by the policies of the caller")
+	errInternal     = newError(http.StatusInternalServerError, "internal error, see the log of the server")
+)
+
+type api struct {
+	storage  Storage
+	client   client.Client
+	verifier Verifier
+	// audiences are the client_ids or the audiences of the access tokens accepted
+	audiences []string
+	routes    []route
+}
+
+type principalKey struct{}
+
+// New returns the handler of the API, which is mounted at BasePath of the issuer.
+// The objects are read from and written to the cluster by the client, the access tokens must be issued to
+// a client or for an audience of the audiences.
+func New(storage Storage, c client.Client, verifier Verifier, audiences []string) http.Handler {
+	a := &api{
+		storage:   storage,
+		client:    c,
+		verifier:  verifier,
+		audiences: audiences,
+	}
+	a.routes = append(a.objectRoutes(), a.issuerRoutes()...)
+
+	r := chi.NewRouter()
+	r.Get("/openapi.json", a.openAPIHandler)
+	r.Group(func(r chi.Router) {
+		r.Use(a.authenticated)
+		for _, route := range a.routes {
+			r.Method(route.method, route.pattern, route.handler)
+		}
+	})
+	r.NotFound(func(w http.ResponseWriter, _ *http.Request) {
+		writeError(w, newError(http.StatusNotFound, "no such route"))
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, _ *http.Request) {
+		writeError(w, newError(http.StatusMethodNotAllowed, "method not allowed"))
+	})
+	return r
+}
+
+// authenticated lets only the callers with an active access token of the issuer in
+func (a *api) authenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), oidc.PrefixBearer)
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, errUnauthorized)
+			return
+		}
+		tokenID, subject, ok := a.tokenIDAndSubject(r.Context(), token)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeError(w, errUnauthorized)
+			return
+		}
+		principal, err := a.storage.TokenPrincipal(r.Context(), tokenID, subject)
+		if err == nil && !slices.ContainsFunc(a.audiences, func(audience string) bool {
+			return audience == principal.ClientID || slices.Contains(principal.Audience, audience)
+		}) {
+			err = errUnauthorized
+		}
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeError(w, errUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	})
+}
+
+// tokenIDAndSubject returns the id and the subject of the opaque token or of the JWT access token
+func (a *api) tokenIDAndSubject(ctx context.Context, token string) (string, string, bool) {
+	if value, err := a.verifier.Crypto().Decrypt(token); err == nil {
+		tokenID, subject, ok := strings.Cut(value, ":")
+		return tokenID, subject, ok
+	}
+	claims, err := op.VerifyAccessToken[*oidc.AccessTokenClaims](ctx, token, a.verifier.AccessTokenVerifier(ctx))
+	if err != nil {
+		return "", "", false
+	}
+	return claims.JWTID, claims.Subject, true
+}
+
+func principalFromRequest(r *http.Request) *storage.Principal {
+	return r.Context().Value(principalKey{}).(*storage.Principal)
+}
+
+// principalActor returns the audit actor of the caller
+func principalActor(r *http.Request) audit.Actor {
+	principal := principalFromRequest(r)
+	return audit.Actor{Subject: principal.Subject, ClientID: principal.ClientID}
+}
+
+// allowed reports whether the Policies of the caller allow the action on the resource
+func allowed(r *http.Request, resource, action string) bool {
+	return policy.Allowed(principalFromRequest(r).Rules, resource, action)
+}
+
+// authorize returns errForbidden unless the Policies of the caller allow the action on the resource
+func authorize(r *http.Request, resource, action string) error {
+	if !allowed(r, resource, action) {
+		return errForbidden
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError responds the status of the error, the errors of the apiserver keep their status; the internal errors
+// are logged and answered by a generic message, so that they do not reveal the internals of the server
+func writeError(w http.ResponseWriter, err error) {
+	var (
+		apiErr *Error
+		status apierrors.APIStatus
+	)
+	switch {
+	case errors.As(err, &apiErr):
+	case errors.As(err, &status) && status.Status().Code > 0 && status.Status().Code < http.StatusInternalServerError:
+		apiErr = newError(int(status.Status().Code), status.Status().Message)
+	default:
+		slog.Error("admin API request failed", "error", err)
+		apiErr = errInternal
+	}
+	writeJSON(w, apiErr.Status, apiErr)
+}
+
+// readJSON decodes the body of the request into v
+func readJSON(r *http.Request, v any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return newError(http.StatusBadRequest, "invalid body: "+err.Error())
+	}
+	return nil
+}
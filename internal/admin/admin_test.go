@@ -0,0 +1,249 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zitadel/oidc/v3/pkg/op"
+	"golang.org/x/crypto/bcrypt"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/policy"
+	"github.com/crochee/kim/internal/storage"
+)
+
+// testStorage knows a single token, whose value is its id
+type testStorage struct {
+	Storage
+	principal *storage.Principal
+}
+
+func (s *testStorage) TokenPrincipal(_ context.Context, tokenID, subject string) (*storage.Principal, error) {
+	if tokenID != "token" || subject != s.principal.Subject {
+		return nil, errors.New("token not found")
+	}
+	return s.principal, nil
+}
+
+// testCrypto "encrypts" the tokens as tokenID:subject
+type testCrypto struct{}
+
+func (testCrypto) Encrypt(value string) (string, error) { return value, nil }
+
+func (testCrypto) Decrypt(value string) (string, error) {
+	if !strings.Contains(value, ":") {
+		return "", errors.New("invalid token")
+	}
+	return value, nil
+}
+
+type testVerifier struct{}
+
+func (testVerifier) Crypto() op.Crypto { return testCrypto{} }
+
+func (testVerifier) AccessTokenVerifier(context.Context) *op.AccessTokenVerifier {
+	return op.NewAccessTokenVerifier("https://kim.test", nil)
+}
+
+func TestAPI(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := kimv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&kimv1.User{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "alice"},
+			Spec: kimv1.UserSpec{SecretName: "alice-credentials"}},
+		&kimv1.User{ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "bob"}},
+		// the secretName of dave points at a Secret kim did not create for the user
+		&kimv1.User{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "dave", UID: "dave-uid"},
+			Spec: kimv1.UserSpec{SecretName: "webhook-tls"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "webhook-tls"}},
+		&kimv1.Policy{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "wide"},
+			Spec: kimv1.PolicySpec{Rules: []kimv1.Rule{
+				{Resource: "user/*", Actions: []string{policy.ActionGet}, Effect: kimv1.EffectAllow},
+			}}},
+	).Build()
+	principal := &storage.Principal{
+		Subject:  "admin-uid",
+		ClientID: "kimctl",
+		Resource: "user/ops/admin",
+		Rules: []kimv1.Rule{
+			{Resource: "user/team-a/*", Actions: []string{"*"}, Effect: kimv1.EffectAllow},
+			{Resource: "user/team-a/*", Actions: []string{policy.ActionDelete}, Effect: kimv1.EffectDeny},
+			{Resource: "policy/team-a/*", Actions: []string{"*"}, Effect: kimv1.EffectAllow},
+		},
+	}
+	handler := New(&testStorage{principal: principal}, c, testVerifier{}, []string{"kimctl"})
+	request := func(method, path, token string, content ...string) *httptest.ResponseRecorder {
+		var body io.Reader
+		if strings.HasSuffix(path, "/password") {
+			body = strings.NewReader(`{"password":"s3cret"}`)
+		}
+		if len(content) > 0 {
+			body = strings.NewReader(content[0])
+		}
+		r := httptest.NewRequest(method, path, body)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	for name, tt := range map[string]struct {
+		method, path, token string
+		want                int
+	}{
+		"no token":       {http.MethodGet, "/users", "", http.StatusUnauthorized},
+		"invalid token":  {http.MethodGet, "/users", "invalid", http.StatusUnauthorized},
+		"other subject":  {http.MethodGet, "/users", "token:other", http.StatusUnauthorized},
+		"allowed":        {http.MethodGet, "/users/team-a/alice", "token:admin-uid", http.StatusOK},
+		"not allowed":    {http.MethodGet, "/users/team-b/bob", "token:admin-uid", http.StatusForbidden},
+		"denied":         {http.MethodDelete, "/users/team-a/alice", "token:admin-uid", http.StatusForbidden},
+		"not found":      {http.MethodGet, "/users/team-a/carol", "token:admin-uid", http.StatusNotFound},
+		"unlock":         {http.MethodPost, "/users/team-a/alice/unlock", "token:admin-uid", http.StatusAccepted},
+		"password":       {http.MethodPut, "/users/team-a/alice/password", "token:admin-uid", http.StatusNoContent},
+		"foreign secret": {http.MethodPut, "/users/team-a/dave/password", "token:admin-uid", http.StatusConflict},
+	} {
+		if w := request(tt.method, tt.path, tt.token); w.Code != tt.want {
+			t.Errorf("%s: %s %s = %d, want %d: %s", name, tt.method, tt.path, w.Code, tt.want, w.Body)
+		}
+	}
+
+	users := &kimv1.UserList{}
+	if err := json.NewDecoder(request(http.MethodGet, "/users", "token:admin-uid").Body).Decode(users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users.Items) != 2 || users.Items[0].Name != "alice" || users.Items[1].Name != "dave" {
+		t.Errorf("GET /users = %v, want only the users of team-a", users.Items)
+	}
+	alice := &kimv1.User{}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "team-a", Name: "alice"}, alice); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := alice.Annotations[kimv1.UnlockAnnotation]; !ok {
+		t.Errorf("unlock did not annotate the user: %v", alice.Annotations)
+	}
+	secret := &corev1.Secret{}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "team-a", Name: "alice-credentials"}, secret); err != nil {
+		t.Fatal(err)
+	}
+	if bcrypt.CompareHashAndPassword(secret.Data[storage.PasswordKey], []byte("s3cret")) != nil {
+		t.Error("the password was not hashed into the secret of the user")
+	}
+	if len(secret.OwnerReferences) != 1 || secret.OwnerReferences[0].Name != "alice" {
+		t.Errorf("the secret of the user is owned by %v, want alice", secret.OwnerReferences)
+	}
+
+	// the caller can only grant the permissions it holds itself
+	for name, tt := range map[string]struct {
+		method, path, body string
+		want               int
+	}{
+		"held rule": {http.MethodPost, "/policies",
+			`{"metadata":{"namespace":"team-a","name":"viewer"},"spec":{"rules":[` +
+				`{"resource":"user/team-a/*","actions":["get"],"effect":"Allow"}]}}`, http.StatusCreated},
+		"denied rule": {http.MethodPost, "/policies",
+			`{"metadata":{"namespace":"team-a","name":"deleter"},"spec":{"rules":[` +
+				`{"resource":"user/team-a/*","actions":["delete"],"effect":"Allow"}]}}`, http.StatusForbidden},
+		"rule of another namespace": {http.MethodPost, "/policies",
+			`{"metadata":{"namespace":"team-a","name":"other"},"spec":{"rules":[` +
+				`{"resource":"user/team-b/*","actions":["get"],"effect":"Allow"}]}}`, http.StatusForbidden},
+		"binding a wider policy": {http.MethodPut, "/users/team-a/alice",
+			`{"spec":{"desc":"","secretName":"alice-credentials","policies":["wide"]}}`, http.StatusForbidden},
+		"binding a held policy": {http.MethodPut, "/users/team-a/alice",
+			`{"spec":{"desc":"","secretName":"alice-credentials","policies":["viewer"]}}`, http.StatusOK},
+	} {
+		if w := request(tt.method, tt.path, "token:admin-uid", tt.body); w.Code != tt.want {
+			t.Errorf("%s: %s %s = %d, want %d: %s", name, tt.method, tt.path, w.Code, tt.want, w.Body)
+		}
+	}
+
+	// the tokens of other clients do not act on the API
+	other := New(&testStorage{principal: principal}, c, testVerifier{}, []string{"kim-admin"})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/users/team-a/alice", nil)
+	r.Header.Set("Authorization", "Bearer token:admin-uid")
+	if other.ServeHTTP(w, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("GET with the token of another client = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	a := &api{}
+	a.routes = append(a.objectRoutes(), a.issuerRoutes()...)
+	document := openAPI(a.routes, "https://kim.test/admin/v1")
+	data, err := json.Marshal(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	operations := 0
+	for _, item := range decoded.Paths {
+		operations += len(item)
+	}
+	if operations != len(a.routes) {
+		t.Errorf("the document describes %d operations, want %d", operations, len(a.routes))
+	}
+	for _, name := range []string{"User", "UserList", "Policy", "Rule", "ObjectMeta", "TokenList", "Error"} {
+		if _, ok := decoded.Components.Schemas[name]; !ok {
+			t.Errorf("the document misses the schema %s", name)
+		}
+	}
+	if _, ok := decoded.Paths["/users/{namespace}/{name}"]["put"]; !ok {
+		t.Error("the document misses PUT /users/{namespace}/{name}")
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		err     error
+		status  int
+		message string
+	}{
+		{"api error", errForbidden, http.StatusForbidden, errForbidden.Message},
+		{"apiserver error", apierrors.NewNotFound(kimv1.Resource("users"), "alice"), http.StatusNotFound,
+			`users.kim.kim.io "alice" not found`},
+		{"apiserver failure", apierrors.NewInternalError(errors.New("etcd unavailable")), http.StatusInternalServerError,
+			errInternal.Message},
+		{"internal error", errors.New("dial tcp 10.0.0.1:443: connection refused"), http.StatusInternalServerError,
+			errInternal.Message},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeError(w, tc.err)
+			var body Error
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tc.status || body.Message != tc.message {
+				t.Errorf("writeError() = %d %q, want %d %q", w.Code, body.Message, tc.status, tc.message)
+			}
+		})
+	}
+}
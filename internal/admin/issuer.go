@@ -0,0 +1,221 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/crochee/kim/internal/audit"
+	"github.com/crochee/kim/internal/policy"
+	"github.com/crochee/kim/internal/storage"
+)
+
+// SessionList is the body of the list of the sessions
+type SessionList struct {
+	Items []storage.Session `json:"items"`
+}
+
+// TokenList is the body of the list of the tokens
+type TokenList struct {
+	Items []storage.TokenInfo `json:"items"`
+}
+
+// RevokeTokensRequest selects the tokens to revoke by their subject, their client or both
+type RevokeTokensRequest struct {
+	Subject  string `json:"subject,omitempty"`
+	ClientID string `json:"clientId,omitempty"`
+}
+
+// RevokeTokensResponse is the number of the access tokens revoked
+type RevokeTokensResponse struct {
+	Revoked int `json:"revoked"`
+}
+
+// RotateKeyResponse is the id of the new signing key
+type RotateKeyResponse struct {
+	KeyID string `json:"kid"`
+}
+
+// issuerRoutes returns the routes of the sessions, the tokens and the signing key of the issuer
+func (a *api) issuerRoutes() []route {
+	return []route{
+		{
+			method: http.MethodGet, pattern: "/sessions", action: policy.ActionList,
+			summary:  "List the single sign-on sessions of the replica serving the request the caller may list",
+			query:    []parameter{{"subject", "only the sessions of the subject"}},
+			response: &SessionList{}, status: http.StatusOK,
+			handler: a.listSessionsHandler,
+		},
+		{
+			method: http.MethodDelete, pattern: "/sessions/{id}", action: policy.ActionRevoke,
+			summary: "End the session and revoke its tokens, the clients are notified by back-channel logout",
+			status:  http.StatusNoContent,
+			handler: a.revokeSessionHandler,
+		},
+		{
+			method: http.MethodGet, pattern: "/tokens", action: policy.ActionList,
+			summary:  "List the active access tokens of the replica serving the request the caller may list",
+			query:    []parameter{{"subject", "only the tokens of the subject"}, {"client_id", "only the tokens of the client"}},
+			response: &TokenList{}, status: http.StatusOK,
+			handler: a.listTokensHandler,
+		},
+		{
+			method: http.MethodDelete, pattern: "/tokens/{id}", action: policy.ActionRevoke,
+			summary: "Revoke the access token and its refresh token",
+			status:  http.StatusNoContent,
+			handler: a.revokeTokenHandler,
+		},
+		{
+			method: http.MethodPost, pattern: "/tokens/revoke", action: policy.ActionRevoke,
+			summary: "Revoke the access and refresh tokens of the subject, of the client or of both, " +
+				"revoking the tokens of all subjects of a client needs the action on token/*",
+			request: &RevokeTokensRequest{}, response: &RevokeTokensResponse{}, status: http.StatusOK,
+			handler: a.revokeTokensHandler,
+		},
+		{
+			method: http.MethodPost, pattern: "/keys/rotate", action: policy.ActionRotate,
+			summary: "Sign the new tokens by a new key, the previous public key stays published until its tokens expired. " +
+				"The key is held by the replica serving the request, the other replicas keep signing by their own keys",
+			response: &RotateKeyResponse{}, status: http.StatusOK,
+			handler: a.rotateKeyHandler,
+		},
+	}
+}
+
+// subjectResources resolves the resources of the subjects, the resources of the deleted users and clients
+// are unknown and only the callers allowed on the resources of any subject may see them
+type subjectResources struct {
+	storage   Storage
+	resources map[string]string
+}
+
+func (a *api) subjectResources() *subjectResources {
+	return &subjectResources{storage: a.storage, resources: map[string]string{}}
+}
+
+func (s *subjectResources) get(ctx context.Context, subject string) string {
+	resource, ok := s.resources[subject]
+	if !ok {
+		var err error
+		if resource, err = s.storage.SubjectResource(ctx, subject); err != nil {
+			resource = "*"
+		}
+		s.resources[subject] = resource
+	}
+	return resource
+}
+
+func (a *api) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	subject := r.URL.Query().Get("subject")
+	resources := a.subjectResources()
+	list := &SessionList{Items: make([]storage.Session, 0)}
+	for _, session := range a.storage.Sessions(r.Context()) {
+		if subject != "" && session.UserID != subject {
+			continue
+		}
+		if allowed(r, policy.SessionResource(resources.get(r.Context(), session.UserID)), policy.ActionList) {
+			list.Items = append(list.Items, session)
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (a *api) revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := a.storage.FindSession(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, newError(http.StatusNotFound, err.Error()))
+		return
+	}
+	if err = authorize(r, policy.SessionResource(a.subjectResources().get(r.Context(), session.UserID)), policy.ActionRevoke); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err = a.storage.RevokeSession(r.Context(), session.ID, principalFromRequest(r).ClientID); err != nil {
+		writeError(w, newError(http.StatusNotFound, err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) listTokensHandler(w http.ResponseWriter, r *http.Request) {
+	subject, clientID := r.URL.Query().Get("subject"), r.URL.Query().Get("client_id")
+	resources := a.subjectResources()
+	list := &TokenList{Items: make([]storage.TokenInfo, 0)}
+	for _, token := range a.storage.Tokens(r.Context()) {
+		if (subject != "" && token.Subject != subject) || (clientID != "" && token.ClientID != clientID) {
+			continue
+		}
+		if allowed(r, policy.TokenResource(resources.get(r.Context(), token.Subject)), policy.ActionList) {
+			list.Items = append(list.Items, token)
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (a *api) revokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := a.storage.FindToken(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, newError(http.StatusNotFound, err.Error()))
+		return
+	}
+	if err = authorize(r, policy.TokenResource(a.subjectResources().get(r.Context(), token.Subject)), policy.ActionRevoke); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err = a.storage.RevokeTokenByID(r.Context(), token.ID); err != nil {
+		writeError(w, newError(http.StatusNotFound, err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) revokeTokensHandler(w http.ResponseWriter, r *http.Request) {
+	req := &RevokeTokensRequest{}
+	if err := readJSON(r, req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if req.Subject == "" && req.ClientID == "" {
+		writeError(w, newError(http.StatusBadRequest, "subject or clientId is required"))
+		return
+	}
+	// without a subject the tokens of any subject are revoked
+	resource := "*"
+	if req.Subject != "" {
+		resource = a.subjectResources().get(r.Context(), req.Subject)
+	}
+	if err := authorize(r, policy.TokenResource(resource), policy.ActionRevoke); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &RevokeTokensResponse{Revoked: a.storage.RevokeTokens(r.Context(), req.Subject, req.ClientID)})
+}
+
+func (a *api) rotateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var (
+		id  string
+		err error
+	)
+	defer func() {
+		event := audit.Event{
+			Type:    audit.KeyRotated,
+			Outcome: audit.OutcomeOf(err),
+			Actor:   principalActor(r),
+			Details: map[string]string{"kid": id},
+		}
+		if err != nil {
+			event.Reason = err.Error()
+		}
+		audit.Record(r.Context(), event)
+	}()
+	if err = authorize(r, policy.SigningKeyResource, policy.ActionRotate); err != nil {
+		writeError(w, err)
+		return
+	}
+	if id, err = a.storage.RotateSigningKey(r.Context()); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &RotateKeyResponse{KeyID: id})
+}
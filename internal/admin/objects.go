@@ -0,0 +1,464 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/audit"
+	"github.com/crochee/kim/internal/policy"
+	"github.com/crochee/kim/internal/storage"
+)
+
+// +kubebuilder:rbac:groups=kim.kim.io,resources=users;machineclients;policies;roles;serviceaccountbindings,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;create;update
+
+// fieldManagerPrefix prefixes the resource of the caller to name the field manager of its changes,
+// which the audit events of the controllers report as the actor
+const fieldManagerPrefix = "kim-admin:"
+
+// PasswordRequest is the new password of a user
+type PasswordRequest struct {
+	Password string `json:"password"`
+}
+
+// objectKind is a kind of the cluster administered by the API
+type objectKind struct {
+	// path is the path of the collection, e.g. users
+	path string
+	// kind names the objects in the resources of the policies, e.g. user/team-a/alice
+	kind string
+	// apiKind is the kind of the objects in the cluster, e.g. User
+	apiKind string
+	object  func() client.Object
+	list    func() client.ObjectList
+	summary string
+}
+
+var objectKinds = []objectKind{
+	{
+		path:    "users",
+		apiKind: "User",
+		kind:    "user",
+		object:  func() client.Object { return &kimv1.User{} },
+		list:    func() client.ObjectList { return &kimv1.UserList{} },
+		summary: "users",
+	},
+	{
+		path:    "clients",
+		apiKind: "MachineClient",
+		kind:    "client",
+		object:  func() client.Object { return &kimv1.MachineClient{} },
+		list:    func() client.ObjectList { return &kimv1.MachineClientList{} },
+		summary: "machine clients",
+	},
+	{
+		path:    "policies",
+		apiKind: "Policy",
+		kind:    "policy",
+		object:  func() client.Object { return &kimv1.Policy{} },
+		list:    func() client.ObjectList { return &kimv1.PolicyList{} },
+		summary: "policies",
+	},
+	{
+		path:    "roles",
+		apiKind: "Role",
+		kind:    "role",
+		object:  func() client.Object { return &kimv1.Role{} },
+		list:    func() client.ObjectList { return &kimv1.RoleList{} },
+		summary: "roles",
+	},
+	{
+		path:    "bindings",
+		apiKind: "ServiceAccountBinding",
+		kind:    "binding",
+		object:  func() client.Object { return &kimv1.ServiceAccountBinding{} },
+		list:    func() client.ObjectList { return &kimv1.ServiceAccountBindingList{} },
+		summary: "ServiceAccount bindings",
+	},
+}
+
+// objectRoutes returns the routes creating, reading, updating and deleting the objects of the kinds
+func (a *api) objectRoutes() []route {
+	var routes []route
+	for _, k := range objectKinds {
+		collection := "/" + k.path
+		item := collection + "/{namespace}/{name}"
+		routes = append(routes,
+			route{
+				method: http.MethodGet, pattern: collection, action: policy.ActionList,
+				summary:  "List the " + k.summary + " the caller may list",
+				query:    []parameter{{"namespace", "only the objects of the namespace"}},
+				response: k.list(), status: http.StatusOK,
+				handler: a.listHandler(k),
+			},
+			route{
+				method: http.MethodPost, pattern: collection, action: policy.ActionCreate,
+				summary: "Create one of the " + k.summary + " in the namespace of its metadata",
+				request: k.object(), response: k.object(), status: http.StatusCreated,
+				handler: a.createHandler(k),
+			},
+			route{
+				method: http.MethodGet, pattern: item, action: policy.ActionGet,
+				summary:  "Read one of the " + k.summary,
+				response: k.object(), status: http.StatusOK,
+				handler: a.getHandler(k),
+			},
+			route{
+				method: http.MethodPut, pattern: item, action: policy.ActionUpdate,
+				summary: "Replace the spec of one of the " + k.summary + ", the latest version if the resourceVersion is empty",
+				request: k.object(), response: k.object(), status: http.StatusOK,
+				handler: a.updateHandler(k),
+			},
+			route{
+				method: http.MethodDelete, pattern: item, action: policy.ActionDelete,
+				summary: "Delete one of the " + k.summary,
+				status:  http.StatusNoContent,
+				handler: a.deleteHandler(k),
+			},
+		)
+	}
+	return append(routes,
+		route{
+			method: http.MethodPost, pattern: "/users/{namespace}/{name}/unlock", action: policy.ActionUnlock,
+			summary: "Lift the lockout of the user after too many failed logins",
+			status:  http.StatusAccepted,
+			handler: a.unlockHandler,
+		},
+		route{
+			method: http.MethodPut, pattern: "/users/{namespace}/{name}/password", action: policy.ActionUpdate,
+			summary: "Set the password of the user, its bcrypt hash is written to the Secret of the user",
+			request: &PasswordRequest{}, status: http.StatusNoContent,
+			handler: a.passwordHandler,
+		},
+	)
+}
+
+// objectKey returns the namespace and the name of the path of the request
+func objectKey(r *http.Request) types.NamespacedName {
+	return types.NamespacedName{Namespace: chi.URLParam(r, "namespace"), Name: chi.URLParam(r, "name")}
+}
+
+// fieldOwner names the caller as the manager of the fields it changes
+func fieldOwner(r *http.Request) client.FieldOwner {
+	return client.FieldOwner(fieldManagerPrefix + principalFromRequest(r).Resource)
+}
+
+func (a *api) listHandler(k objectKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list := k.list()
+		var opts []client.ListOption
+		if namespace := r.URL.Query().Get("namespace"); namespace != "" {
+			opts = append(opts, client.InNamespace(namespace))
+		}
+		if err := a.client.List(r.Context(), list, opts...); err != nil {
+			writeError(w, err)
+			return
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		visible := make([]runtime.Object, 0, len(items))
+		for _, item := range items {
+			obj := item.(client.Object)
+			if allowed(r, policy.Resource(k.kind, obj.GetNamespace(), obj.GetName()), policy.ActionList) {
+				visible = append(visible, item)
+			}
+		}
+		if err = meta.SetList(list, visible); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	}
+}
+
+func (a *api) createHandler(k objectKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		obj := k.object()
+		var err error
+		defer func() {
+			auditObject(r, audit.ObjectCreated, k, client.ObjectKeyFromObject(obj), err)
+		}()
+		if err = readJSON(r, obj); err != nil {
+			writeError(w, err)
+			return
+		}
+		if obj.GetNamespace() == "" || obj.GetName() == "" {
+			err = newError(http.StatusBadRequest, "metadata.namespace and metadata.name are required")
+			writeError(w, err)
+			return
+		}
+		if err = authorize(r, policy.Resource(k.kind, obj.GetNamespace(), obj.GetName()), policy.ActionCreate); err != nil {
+			writeError(w, err)
+			return
+		}
+		if err = a.authorizeGrants(r, k, obj, nil); err != nil {
+			writeError(w, err)
+			return
+		}
+		obj.SetResourceVersion("")
+		if err = a.client.Create(r.Context(), obj, fieldOwner(r)); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, obj)
+	}
+}
+
+func (a *api) getHandler(k objectKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := objectKey(r)
+		if err := authorize(r, policy.Resource(k.kind, key.Namespace, key.Name), policy.ActionGet); err != nil {
+			writeError(w, err)
+			return
+		}
+		obj := k.object()
+		if err := a.client.Get(r.Context(), key, obj); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, obj)
+	}
+}
+
+func (a *api) updateHandler(k objectKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := objectKey(r)
+		var err error
+		defer func() {
+			auditObject(r, audit.ObjectUpdated, k, key, err)
+		}()
+		if err = authorize(r, policy.Resource(k.kind, key.Namespace, key.Name), policy.ActionUpdate); err != nil {
+			writeError(w, err)
+			return
+		}
+		obj := k.object()
+		if err = readJSON(r, obj); err != nil {
+			writeError(w, err)
+			return
+		}
+		if (obj.GetNamespace() != "" && obj.GetNamespace() != key.Namespace) || (obj.GetName() != "" && obj.GetName() != key.Name) {
+			err = newError(http.StatusBadRequest, "the metadata does not match the path")
+			writeError(w, err)
+			return
+		}
+		obj.SetNamespace(key.Namespace)
+		obj.SetName(key.Name)
+		current := k.object()
+		if err = a.client.Get(r.Context(), key, current); err != nil {
+			writeError(w, err)
+			return
+		}
+		if obj.GetResourceVersion() == "" {
+			obj.SetResourceVersion(current.GetResourceVersion())
+		}
+		if err = a.authorizeGrants(r, k, obj, current); err != nil {
+			writeError(w, err)
+			return
+		}
+		if err = a.client.Update(r.Context(), obj, fieldOwner(r)); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, obj)
+	}
+}
+
+func (a *api) deleteHandler(k objectKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := objectKey(r)
+		var err error
+		defer func() {
+			auditObject(r, audit.ObjectDeleted, k, key, err)
+		}()
+		if err = authorize(r, policy.Resource(k.kind, key.Namespace, key.Name), policy.ActionDelete); err != nil {
+			writeError(w, err)
+			return
+		}
+		obj := k.object()
+		obj.SetNamespace(key.Namespace)
+		obj.SetName(key.Name)
+		if err = a.client.Delete(r.Context(), obj); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// authorizeGrants returns an error unless the caller holds every rule the object grants on top of the current
+// object, so that whoever may write the object can not grant more than their own permissions: the rules of a
+// Policy, the rules of the Policies bound to a user, a machine client or a role, and the rules of the machine
+// client a ServiceAccount is bound to
+func (a *api) authorizeGrants(r *http.Request, k objectKind, obj, current client.Object) error {
+	rules, err := a.grantedRules(r.Context(), obj)
+	if err != nil {
+		return err
+	}
+	var known []kimv1.Rule
+	if current != nil {
+		if known, err = a.grantedRules(r.Context(), current); err != nil {
+			return err
+		}
+	}
+	held := principalFromRequest(r).Rules
+	for _, rule := range rules {
+		if slices.ContainsFunc(known, func(k kimv1.Rule) bool {
+			return k.Resource == rule.Resource && k.Effect == rule.Effect && slices.Equal(k.Actions, rule.Actions)
+		}) {
+			continue
+		}
+		if !policy.Grants(held, rule) {
+			return newError(http.StatusForbidden, fmt.Sprintf("the %s grants %s on %s, which the policies of the "+
+				"caller do not", k.kind, strings.Join(rule.Actions, ", "), rule.Resource))
+		}
+	}
+	return nil
+}
+
+// grantedRules returns the rules the object grants, see authorizeGrants
+func (a *api) grantedRules(ctx context.Context, obj client.Object) ([]kimv1.Rule, error) {
+	switch o := obj.(type) {
+	case *kimv1.Policy:
+		return o.Spec.Rules, nil
+	case *kimv1.User:
+		return a.policyRules(ctx, o.Namespace, o.Spec.Policies)
+	case *kimv1.MachineClient:
+		return a.policyRules(ctx, o.Namespace, o.Spec.Policies)
+	case *kimv1.Role:
+		return a.policyRules(ctx, o.Namespace, o.Spec.Permissions)
+	case *kimv1.ServiceAccountBinding:
+		machineClient := &kimv1.MachineClient{}
+		err := a.client.Get(ctx, types.NamespacedName{Namespace: o.Namespace, Name: o.Spec.MachineClientName}, machineClient)
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return a.policyRules(ctx, machineClient.Namespace, machineClient.Spec.Policies)
+	}
+	return nil, nil
+}
+
+// policyRules returns the rules of the Policies of the namespace, a missing Policy grants nothing
+func (a *api) policyRules(ctx context.Context, namespace string, names []string) ([]kimv1.Rule, error) {
+	var rules []kimv1.Rule
+	for _, name := range names {
+		obj := &kimv1.Policy{}
+		if err := a.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, obj); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		rules = append(rules, obj.Spec.Rules...)
+	}
+	return rules, nil
+}
+
+// auditObject records the change of the object of the key by the caller
+func auditObject(r *http.Request, eventType audit.Type, k objectKind, key types.NamespacedName, err error) {
+	event := audit.Event{
+		Type:    eventType,
+		Outcome: audit.OutcomeOf(err),
+		Actor:   principalActor(r),
+	}
+	if key.Name != "" {
+		event.Target = &audit.Target{Kind: k.apiKind, Namespace: key.Namespace, Name: key.Name}
+	}
+	if err != nil {
+		event.Reason = err.Error()
+	}
+	audit.Record(r.Context(), event)
+}
+
+// unlockHandler annotates the user, the User controller lifts the lockout and removes the annotation
+func (a *api) unlockHandler(w http.ResponseWriter, r *http.Request) {
+	key := objectKey(r)
+	if err := authorize(r, policy.Resource("user", key.Namespace, key.Name), policy.ActionUnlock); err != nil {
+		writeError(w, err)
+		return
+	}
+	user := &kimv1.User{}
+	if err := a.client.Get(r.Context(), key, user); err != nil {
+		writeError(w, err)
+		return
+	}
+	patch := client.MergeFrom(user.DeepCopy())
+	if user.Annotations == nil {
+		user.Annotations = map[string]string{}
+	}
+	user.Annotations[kimv1.UnlockAnnotation] = "true"
+	if err := a.client.Patch(r.Context(), user, patch, fieldOwner(r)); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// passwordHandler hashes the password into the credential Secret of the user, which is created owned by the user
+// if it is missing; a Secret kim did not create for the user is not overwritten
+func (a *api) passwordHandler(w http.ResponseWriter, r *http.Request) {
+	key := objectKey(r)
+	var err error
+	defer func() {
+		event := audit.Event{
+			Type:    audit.PasswordChanged,
+			Outcome: audit.OutcomeOf(err),
+			Actor:   principalActor(r),
+			Target:  &audit.Target{Kind: "User", Namespace: key.Namespace, Name: key.Name},
+		}
+		if err != nil {
+			event.Reason = err.Error()
+		}
+		audit.Record(r.Context(), event)
+	}()
+	if err = authorize(r, policy.Resource("user", key.Namespace, key.Name), policy.ActionUpdate); err != nil {
+		writeError(w, err)
+		return
+	}
+	req := &PasswordRequest{}
+	if err = readJSON(r, req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if req.Password == "" {
+		err = newError(http.StatusBadRequest, "the password is required")
+		writeError(w, err)
+		return
+	}
+	user := &kimv1.User{}
+	if err = a.client.Get(r.Context(), key, user); err != nil {
+		writeError(w, err)
+		return
+	}
+	if user.Spec.SecretName == "" {
+		err = newError(http.StatusConflict, "the user has no secretName")
+		writeError(w, err)
+		return
+	}
+	err = storage.WritePassword(r.Context(), a.client, user, req.Password, true)
+	if errors.Is(err, storage.ErrSecretNotOwned) {
+		err = newError(http.StatusConflict, "the secret "+user.Spec.SecretName+" was not created by kim for the user")
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
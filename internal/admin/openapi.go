@@ -0,0 +1,243 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zitadel/oidc/v3/pkg/op"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// route is an operation of the API, its handler serves it and the OpenAPI document describes it
+type route struct {
+	method string
+	// pattern is the chi pattern of the path, whose {parameters} are the path parameters of the document
+	pattern string
+	summary string
+	// action is the policy action the handler authorizes on the resources of the request
+	action string
+	query  []parameter
+	// request and response are values of the types of the JSON bodies, nil without a body
+	request, response any
+	// status is the status of the successful responses
+	status  int
+	handler http.HandlerFunc
+}
+
+// parameter is a query parameter of a route
+type parameter struct {
+	name, description string
+}
+
+var pathParameter = regexp.MustCompile(`{(\w+)}`)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	metaTimeType   = reflect.TypeOf(metav1.Time{})
+	jsonMarshaler  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	errorSchemaRef = map[string]any{"$ref": "#/components/schemas/Error"}
+)
+
+// openAPIHandler serves the OpenAPI 3 document of the API below the issuer of the request
+func (a *api) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, openAPI(a.routes, strings.TrimSuffix(op.IssuerFromContext(r.Context()), "/")+BasePath))
+}
+
+// openAPI returns the OpenAPI 3 document of the routes served at the url
+func openAPI(routes []route, url string) map[string]any {
+	schemas := newSchemas()
+	schemas.ref(reflect.TypeOf(Error{}))
+	paths := map[string]any{}
+	for _, route := range routes {
+		operation := map[string]any{
+			"summary":     route.summary,
+			"description": "Requires the " + route.action + " action on the resources of the request.",
+			"operationId": operationID(route),
+			"tags":        []string{strings.Split(strings.TrimPrefix(route.pattern, "/"), "/")[0]},
+		}
+		var parameters []any
+		for _, match := range pathParameter.FindAllStringSubmatch(route.pattern, -1) {
+			parameters = append(parameters, map[string]any{
+				"name": match[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+			})
+		}
+		for _, query := range route.query {
+			parameters = append(parameters, map[string]any{
+				"name": query.name, "in": "query", "description": query.description, "schema": map[string]any{"type": "string"},
+			})
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+		if route.request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": schemas.ref(reflect.TypeOf(route.request))}},
+			}
+		}
+		success := map[string]any{"description": http.StatusText(route.status)}
+		if route.response != nil {
+			success["content"] = map[string]any{"application/json": map[string]any{"schema": schemas.ref(reflect.TypeOf(route.response))}}
+		}
+		operation["responses"] = map[string]any{
+			strconv.Itoa(route.status): success,
+			"default": map[string]any{
+				"description": "Error",
+				"content":     map[string]any{"application/json": map[string]any{"schema": errorSchemaRef}},
+			},
+		}
+		item, ok := paths[route.pattern].(map[string]any)
+		if !ok {
+			item = map[string]any{}
+			paths[route.pattern] = item
+		}
+		item[strings.ToLower(route.method)] = operation
+	}
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "kim admin API",
+			"version":     "v1",
+			"description": "Administration of the users, clients, policies, roles, bindings, sessions, tokens and keys of kim.",
+		},
+		"servers":  []any{map[string]any{"url": url}},
+		"paths":    paths,
+		"security": []any{map[string]any{"bearer": []string{}}},
+		"components": map[string]any{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer", "description": "An access token of the issuer"},
+			},
+		},
+	}
+}
+
+// operationID names the operation by its method and the static segments of its path, e.g. getUsers
+func operationID(route route) string {
+	id := strings.ToLower(route.method)
+	for _, segment := range strings.Split(route.pattern, "/") {
+		if segment == "" || strings.HasPrefix(segment, "{") {
+			continue
+		}
+		id += strings.ToUpper(segment[:1]) + segment[1:]
+	}
+	if strings.HasSuffix(route.pattern, "}") {
+		id += "Item"
+	}
+	return id
+}
+
+// schemas collects the schemas of the named struct types as components referred to by the operations
+type schemas struct {
+	components map[string]any
+	names      map[reflect.Type]string
+}
+
+func newSchemas() *schemas {
+	return &schemas{components: map[string]any{}, names: map[reflect.Type]string{}}
+}
+
+// ref returns the schema of the type, a reference to the component of a named struct type
+func (s *schemas) ref(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType || t == metaTimeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Implements(jsonMarshaler) || reflect.PointerTo(t).Implements(jsonMarshaler):
+		// the custom encodings, e.g. of the managed fields, are not described
+		return map[string]any{}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": s.ref(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.ref(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name, ok := s.names[t]
+		if !ok {
+			name = s.name(t)
+			s.names[t] = name
+			// the name is taken before the fields are described, so that recursive types refer to it
+			s.components[name] = nil
+			s.components[name] = s.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]any{}
+	}
+}
+
+// name returns the name of the component of the type, the types of the same name of different packages
+// are prefixed by their package
+func (s *schemas) name(t reflect.Type) string {
+	name := t.Name()
+	if _, taken := s.components[name]; taken {
+		pkg := t.PkgPath()
+		name = pkg[strings.LastIndex(pkg, "/")+1:] + name
+	}
+	return name
+}
+
+// object returns the schema of the JSON object of the struct type, the inlined fields are merged
+func (s *schemas) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	var inline func(t reflect.Type)
+	inline = func(t reflect.Type) {
+		for i := range t.NumField() {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if !field.IsExported() || tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+			if field.Anonymous && (name == "" || strings.Contains(options, "inline")) {
+				ft := field.Type
+				for ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					inline(ft)
+					continue
+				}
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = s.ref(field.Type)
+			if !strings.Contains(options, "omitempty") && !strings.Contains(options, "omitzero") &&
+				field.Type.Kind() != reflect.Pointer && field.Type.Kind() != reflect.Struct {
+				required = append(required, name)
+			}
+		}
+	}
+	inline(t)
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -0,0 +1,199 @@
+// Package audit records the security relevant actions of kim (logins, token issuance, device approvals,
+// changes of users, ...) as a stream of events with a stable JSON schema.
+// The events are written to all registered sinks, e.g. stdout, a rotated file, an HTTP webhook
+// and Kubernetes Events on the affected User or Policy. The sinks write in the background, so that
+// recording an event never blocks the audited action, which may hold locks of its own.
+package audit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/crochee/kim/internal/clientip"
+	"github.com/crochee/kim/internal/tracing"
+)
+
+// SchemaVersion identifies the JSON schema of Event, it changes only with incompatible changes of the schema
+const SchemaVersion = "audit.kim.io/v1"
+
+// Type is the kind of action of an audit event
+type Type string
+
+const (
+	LoginSucceeded Type = "login.succeeded"
+	LoginFailed    Type = "login.failed"
+	SessionResumed Type = "session.resumed"
+	SessionEnded   Type = "session.ended"
+	TokenIssued    Type = "token.issued"
+	TokenRefreshed Type = "token.refreshed"
+	TokenRevoked   Type = "token.revoked"
+	TokenExchanged Type = "token.exchanged"
+	DeviceApproved Type = "device.approved"
+	DeviceDenied   Type = "device.denied"
+	UserChanged    Type = "user.changed"
+	UserDeleted    Type = "user.deleted"
+	UserLocked     Type = "user.locked"
+	UserUnlocked   Type = "user.unlocked"
+	PolicyChanged  Type = "policy.changed"
+	PolicyDeleted  Type = "policy.deleted"
+	ConsentGranted Type = "consent.granted"
+	KeyRotated     Type = "key.rotated"
+
+	// the changes of the objects by the admin API, the controllers record the changes of the users and the policies
+	// by whoever made them as well
+	ObjectCreated Type = "object.created"
+	ObjectUpdated Type = "object.updated"
+	ObjectDeleted Type = "object.deleted"
+
+	PasswordResetRequested     Type = "password.reset_requested"
+	PasswordReset              Type = "password.reset"
+	EmailVerificationRequested Type = "email.verification_requested"
+	EmailVerified              Type = "email.verified"
+	PasswordChanged            Type = "password.changed"
+	MFAEnrolled                Type = "mfa.enrolled"
+	MFARemoved                 Type = "mfa.removed"
+)
+
+// Outcome is the result of the audited action
+type Outcome string
+
+const (
+	Success Outcome = "success"
+	Failure Outcome = "failure"
+)
+
+// Actor is who performed the action
+type Actor struct {
+	// Subject is the sub claim of the user, if known
+	Subject string `json:"subject,omitempty"`
+	// Username is the login name the user entered or the manager of a change of a resource
+	Username  string `json:"username,omitempty"`
+	ClientID  string `json:"clientId,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+// Target is the Kubernetes object the action was performed on
+type Target struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// Event is a single audit record
+type Event struct {
+	SchemaVersion string    `json:"schemaVersion"`
+	ID            string    `json:"id"`
+	Time          time.Time `json:"time"`
+	Type          Type      `json:"type"`
+	Outcome       Outcome   `json:"outcome"`
+	// Reason is a machine readable cause of a failure, e.g. invalid_password
+	Reason string `json:"reason,omitempty"`
+	// CorrelationID is shared by all events of the same http request or reconciliation
+	CorrelationID string            `json:"correlationId,omitempty"`
+	TraceID       string            `json:"traceId,omitempty"`
+	SpanID        string            `json:"spanId,omitempty"`
+	Actor         Actor             `json:"actor"`
+	Target        *Target           `json:"target,omitempty"`
+	Details       map[string]string `json:"details,omitempty"`
+}
+
+// Sink receives the audit events
+type Sink interface {
+	// Name identifies the sink in the logs
+	Name() string
+	Write(ctx context.Context, event *Event) error
+}
+
+// queueSize is the number of events buffered for the sinks, while it is full the events are dropped
+const queueSize = 4096
+
+// pending is a recorded event waiting for the sinks
+type pending struct {
+	ctx   context.Context
+	event Event
+}
+
+var (
+	lock  sync.RWMutex
+	sinks []Sink
+	queue = make(chan pending, queueSize)
+	start sync.Once
+)
+
+// AddSink registers a sink, all events recorded afterwards are written to it
+func AddSink(sink Sink) {
+	lock.Lock()
+	defer lock.Unlock()
+	sinks = append(sinks, sink)
+	start.Do(func() {
+		go dispatch()
+	})
+}
+
+// registered returns the sinks registered so far
+func registered() []Sink {
+	lock.RLock()
+	defer lock.RUnlock()
+	return sinks
+}
+
+// Record completes the event by its id, time, correlation and trace ids and the request information
+// of the context and queues it for the sinks; failing sinks and a full queue are logged but do not fail
+// the audited action
+func Record(ctx context.Context, event Event) {
+	if len(registered()) == 0 {
+		return
+	}
+
+	event.SchemaVersion = SchemaVersion
+	event.ID = uuid.NewString()
+	event.Time = time.Now().UTC()
+	if event.CorrelationID == "" {
+		event.CorrelationID = CorrelationIDFromContext(ctx)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		event.TraceID = sc.TraceID().String()
+		event.SpanID = sc.SpanID().String()
+	}
+	if event.Actor.IP == "" {
+		event.Actor.IP = clientip.FromContext(ctx)
+	}
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok && event.Actor.UserAgent == "" {
+		event.Actor.UserAgent = info.userAgent
+	}
+
+	// the sinks write after the audited request finished, its cancellation must not drop the event
+	select {
+	case queue <- pending{ctx: context.WithoutCancel(ctx), event: event}:
+	default:
+		logf.FromContext(tracing.LogWithTrace(ctx)).Error(errors.New("audit queue is full"),
+			"dropping audit event", "id", event.ID, "type", event.Type)
+	}
+}
+
+// dispatch writes the queued events to the sinks one after another, so that they keep their order
+func dispatch() {
+	for p := range queue {
+		log := logf.FromContext(tracing.LogWithTrace(p.ctx))
+		for _, sink := range registered() {
+			if err := sink.Write(p.ctx, &p.event); err != nil {
+				log.Error(err, "could not write audit event", "sink", sink.Name(), "id", p.event.ID, "type", p.event.Type)
+			}
+		}
+	}
+}
+
+// OutcomeOf returns the outcome of an action by its error
+func OutcomeOf(err error) Outcome {
+	if err != nil {
+		return Failure
+	}
+	return Success
+}
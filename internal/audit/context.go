@@ -0,0 +1,56 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// CorrelationIDHeader is read from the incoming requests and set on the responses,
+// so that the audit events can be matched with the logs of the callers
+const CorrelationIDHeader = "X-Correlation-ID"
+
+type contextKey int
+
+const (
+	correlationIDKey contextKey = iota
+	requestInfoKey
+)
+
+// requestInfo is the information about the user agent of the http request
+type requestInfo struct {
+	userAgent string
+}
+
+// ContextWithCorrelationID returns a context carrying the correlation id of the events recorded with it
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey, id)
+}
+
+// CorrelationIDFromContext returns the correlation id of the context or an empty string
+func CorrelationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey).(string)
+	return id
+}
+
+// Middleware assigns each request a correlation id, taken from the X-Correlation-ID or X-Request-ID header
+// if present, and passes it together with the user agent of the caller to the audit events
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(CorrelationIDHeader)
+		if id == "" {
+			id = r.Header.Get("X-Request-ID")
+		}
+		if id == "" {
+			id = uuid.NewString()
+		}
+		w.Header().Set(CorrelationIDHeader, id)
+
+		ctx := ContextWithCorrelationID(r.Context(), id)
+		ctx = context.WithValue(ctx, requestInfoKey, &requestInfo{
+			userAgent: r.UserAgent(),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
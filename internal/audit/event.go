@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+// eventReasons are the reasons of the Kubernetes Events by the type of the audit event
+var eventReasons = map[Type]string{
+	LoginSucceeded: "LoginSucceeded",
+	LoginFailed:    "LoginFailed",
+	SessionResumed: "SessionResumed",
+	SessionEnded:   "SessionEnded",
+	TokenIssued:    "TokenIssued",
+	TokenRefreshed: "TokenRefreshed",
+	TokenRevoked:   "TokenRevoked",
+	DeviceApproved: "DeviceApproved",
+	DeviceDenied:   "DeviceDenied",
+	UserChanged:    "UserChanged",
+	UserLocked:     "UserLocked",
+	UserUnlocked:   "UserUnlocked",
+	PolicyChanged:  "PolicyChanged",
+	ConsentGranted: "ConsentGranted",
+	ObjectCreated:  "ObjectCreated",
+	ObjectUpdated:  "ObjectUpdated",
+
+	PasswordResetRequested:     "PasswordResetRequested",
+	PasswordReset:              "PasswordReset",
+	EmailVerificationRequested: "EmailVerificationRequested",
+	EmailVerified:              "EmailVerified",
+	PasswordChanged:            "PasswordChanged",
+	MFAEnrolled:                "MFAEnrolled",
+	MFARemoved:                 "MFARemoved",
+}
+
+// eventSink records the audit events targeting a User or a Policy as Kubernetes Events of the object,
+// so that they show up in `kubectl describe user` and `kubectl describe policy`
+type eventSink struct {
+	recorder record.EventRecorder
+}
+
+// NewEventSink returns a sink recording Kubernetes Events by the recorder, e.g. of the manager
+func NewEventSink(recorder record.EventRecorder) Sink {
+	return &eventSink{recorder: recorder}
+}
+
+func (s *eventSink) Name() string {
+	return "events"
+}
+
+func (s *eventSink) Write(_ context.Context, event *Event) error {
+	if event.Target == nil {
+		return nil
+	}
+	reason, ok := eventReasons[event.Type]
+	if !ok {
+		// there is no object left to record events on (user.deleted, policy.deleted, object.deleted)
+		return nil
+	}
+	eventType := corev1.EventTypeNormal
+	if event.Outcome == Failure {
+		eventType = corev1.EventTypeWarning
+	}
+	// the recorder resolves the kind of the object by its scheme
+	objectMeta := metav1.ObjectMeta{
+		Name:      event.Target.Name,
+		Namespace: event.Target.Namespace,
+	}
+	var obj runtime.Object
+	switch event.Target.Kind {
+	case "User":
+		obj = &kimv1.User{ObjectMeta: objectMeta}
+	case "Policy":
+		obj = &kimv1.Policy{ObjectMeta: objectMeta}
+	default:
+		return nil
+	}
+	s.recorder.AnnotatedEventf(obj, map[string]string{
+		"audit.kim.io/id":             event.ID,
+		"audit.kim.io/correlation-id": event.CorrelationID,
+	}, eventType, reason, "%s", eventMessage(event))
+	return nil
+}
+
+func eventMessage(event *Event) string {
+	parts := []string{fmt.Sprintf("%s %s", event.Type, event.Outcome)}
+	if event.Reason != "" {
+		parts = append(parts, "reason: "+event.Reason)
+	}
+	if event.Actor.ClientID != "" {
+		parts = append(parts, "client: "+event.Actor.ClientID)
+	}
+	if event.Actor.IP != "" {
+		parts = append(parts, "ip: "+event.Actor.IP)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// writerSink writes the events as JSON lines
+type writerSink struct {
+	name string
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// NewWriterSink returns a sink writing one JSON document per line to w, e.g. os.Stdout
+func NewWriterSink(name string, w io.Writer) Sink {
+	return &writerSink{name: name, w: w}
+}
+
+func (s *writerSink) Name() string {
+	return s.name
+}
+
+func (s *writerSink) Write(_ context.Context, event *Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// FileSink writes the events as JSON lines to a file, which is rotated once it exceeds the maximum size;
+// the rotated files get the time of the rotation as suffix and only the newest backups are kept
+type FileSink struct {
+	lock       sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewFileSink opens or creates the file at path, maxSize is in bytes and maxBackups <= 0 keeps all rotated files
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, err
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) Name() string {
+	return "file"
+}
+
+func (s *FileSink) Write(_ context.Context, event *Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.maxSize > 0 && s.size+int64(len(line)) > s.maxSize && s.size > 0 {
+		if err = s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// Close closes the current file
+func (s *FileSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.file.Close()
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// rotate renames the current file and opens a new one, the caller must hold the lock
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	ext := filepath.Ext(s.path)
+	backup := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(s.path, ext), time.Now().UTC().Format("20060102T150405.000"), ext)
+	if err := os.Rename(s.path, backup); err != nil {
+		return err
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+	return s.removeBackups(ext)
+}
+
+// removeBackups deletes the oldest rotated files exceeding maxBackups
+func (s *FileSink) removeBackups(ext string) error {
+	if s.maxBackups <= 0 {
+		return nil
+	}
+	backups, err := filepath.Glob(strings.TrimSuffix(s.path, ext) + "-*" + ext)
+	if err != nil {
+		return err
+	}
+	if len(backups) <= s.maxBackups {
+		return nil
+	}
+	// the timestamp suffix sorts in chronological order
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-s.maxBackups] {
+		if err = os.Remove(backup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
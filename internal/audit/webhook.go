@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// webhookQueueSize is the number of events buffered while the webhook is slow or unreachable
+	webhookQueueSize = 1024
+	// webhookAttempts is the number of deliveries of an event before it is dropped
+	webhookAttempts = 3
+)
+
+// WebhookSink posts every event as JSON document to an HTTP endpoint.
+// The events are delivered in the background, so a slow endpoint does not delay the audited requests;
+// if the queue is full, events are dropped and reported as write error.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+	queue  chan []byte
+}
+
+// NewWebhookSink returns a sink posting to url, it delivers the events until ctx is done
+func NewWebhookSink(ctx context.Context, url string, timeout time.Duration) *WebhookSink {
+	s := &WebhookSink{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+		queue:  make(chan []byte, webhookQueueSize),
+	}
+	go s.run(ctx)
+	return s
+}
+
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (s *WebhookSink) Write(_ context.Context, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	select {
+	case s.queue <- body:
+		return nil
+	default:
+		return errors.New("webhook queue is full, dropping event")
+	}
+}
+
+func (s *WebhookSink) run(ctx context.Context) {
+	log := logf.FromContext(ctx).WithName("audit").WithValues("url", s.url)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case body := <-s.queue:
+			if err := s.deliver(ctx, body); err != nil {
+				log.Error(err, "giving up audit event delivery")
+			}
+		}
+	}
+}
+
+// deliver posts the event, failed deliveries are retried with an exponential backoff
+func (s *WebhookSink) deliver(ctx context.Context, body []byte) error {
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		err := s.post(ctx, body)
+		if err == nil || attempt == webhookAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (s *WebhookSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
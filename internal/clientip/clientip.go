@@ -0,0 +1,116 @@
+// Package clientip resolves the address of the caller of an http request,
+// which is the key of the failed login tracking and the rate limits and shows up in the audit events.
+package clientip
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type contextKey struct{}
+
+// Middleware passes the address of the direct peer to the request context, forwarded headers are ignored
+func Middleware(next http.Handler) http.Handler {
+	return NewMiddleware(nil)(next)
+}
+
+// NewMiddleware passes the address of the caller to the request context, the forwarded headers
+// are only honored for requests of the trusted proxies, otherwise anyone could choose their address
+func NewMiddleware(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := FromRequest(r)
+			if IsTrusted(trusted, ip) {
+				ip = forwardedFor(r, trusted, ip)
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), ip)))
+		})
+	}
+}
+
+// ParsePrefixes parses the addresses (e.g. 10.0.0.1) and networks (e.g. 10.0.0.0/8) of the trusted proxies
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// FromRequest returns the address of the direct peer of the request
+func FromRequest(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// forwardedFor returns the first untrusted address of the X-Forwarded-For chain from the right,
+// as only the entries appended by the trusted proxies are reliable, or the X-Real-IP header
+func forwardedFor(r *http.Request, trusted []netip.Prefix, peer string) string {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			// a malformed entry ends the trusted part of the chain
+			break
+		}
+		if !IsTrusted(trusted, hop) {
+			return hop
+		}
+		peer = hop
+	}
+	if len(hops) == 0 {
+		if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+			if _, err := netip.ParseAddr(realIP); err == nil {
+				return realIP
+			}
+		}
+	}
+	return peer
+}
+
+// IsTrusted reports whether the address is one of the trusted proxies
+func IsTrusted(trusted []netip.Prefix, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewContext returns a context carrying the address of the caller
+func NewContext(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, contextKey{}, ip)
+}
+
+// FromContext returns the address of the caller or an empty string outside of http requests
+func FromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(contextKey{}).(string)
+	return ip
+}
@@ -18,13 +18,22 @@ package kim
 
 import (
 	"context"
+	"strconv"
+	"strings"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 
-	iamv1 "kim/api/kim/v1"
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/audit"
+	"github.com/crochee/kim/internal/policy"
+	"github.com/crochee/kim/internal/tracing"
 )
 
 // PolicyReconciler reconciles a Policy object
@@ -33,30 +42,56 @@ type PolicyReconciler struct {
 	Scheme *runtime.Scheme
 }
 
-//+kubebuilder:rbac:groups=iam.kim.io,resources=policies,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=iam.kim.io,resources=policies/status,verbs=get;update;patch
-//+kubebuilder:rbac:groups=iam.kim.io,resources=policies/finalizers,verbs=update
+// +kubebuilder:rbac:groups=kim.kim.io,resources=policies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=kim.kim.io,resources=policies/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=kim.kim.io,resources=policies/finalizers,verbs=update
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
+// Reconcile reports whether the rules of the policy are valid by its Ready condition. The rules are read
+// by the issuers whenever they authorize, an invalid rule never allows anything.
+// Every change of the rules is recorded in the audit log, as it changes what the users are allowed to do.
 func (r *PolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
-
-	var policy iamv1.Policy
-	if err := r.Get(ctx, req.NamespacedName, &policy); err != nil {
+	// all audit events of a reconciliation share its id
+	ctx = audit.ContextWithCorrelationID(ctx, string(controller.ReconcileIDFromContext(ctx)))
+	target := &audit.Target{Kind: "Policy", Namespace: req.Namespace, Name: req.Name}
+	obj := &kimv1.Policy{}
+	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			audit.Record(ctx, audit.Event{Type: audit.PolicyDeleted, Outcome: audit.Success, Target: target})
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
-
-	// Sync policy rules to OIDC
-	if err := r.syncPolicyToOIDC(ctx, &policy); err != nil {
-		return ctrl.Result{}, err
+	// the Ready condition observes every generation of the policy once
+	if ready := meta.FindStatusCondition(obj.Status.Conditions, kimv1.PolicyConditionReady); ready == nil ||
+		ready.ObservedGeneration != obj.Generation {
+		audit.Record(ctx, audit.Event{
+			Type:    audit.PolicyChanged,
+			Outcome: audit.Success,
+			Actor:   audit.Actor{Username: lastManager(obj)},
+			Target:  target,
+			Details: map[string]string{"generation": strconv.FormatInt(obj.Generation, 10)},
+		})
+	}
+	condition := metav1.Condition{
+		Type:               kimv1.PolicyConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             kimv1.PolicyReasonValid,
+		Message:            "the rules are valid",
+		ObservedGeneration: obj.Generation,
+	}
+	if errs := policy.Validate(&obj.Spec, field.NewPath("spec")); len(errs) > 0 {
+		condition.Status, condition.Reason = metav1.ConditionFalse, kimv1.PolicyReasonInvalidSpec
+		condition.Message = strings.ReplaceAll(errs.ToAggregate().Error(), "\n", " ")
+	}
+	if !meta.SetStatusCondition(&obj.Status.Conditions, condition) {
+		return ctrl.Result{}, nil
 	}
-	return ctrl.Result{}, nil
+	return ctrl.Result{}, r.Status().Update(ctx, obj)
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *PolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&iamv1.Policy{}).
-		Complete(r)
+		For(&kimv1.Policy{}).
+		Named("kim-policy").
+		Complete(tracing.Reconciler("kim-policy", r))
 }
@@ -0,0 +1,75 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kim
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+var _ = Describe("Policy Controller", func() {
+	Context("When reconciling a resource", func() {
+		ctx := context.Background()
+
+		reconcilePolicy := func(policy *kimv1.Policy) *metav1.Condition {
+			Expect(k8sClient.Create(ctx, policy)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, policy)).To(Succeed())
+			})
+			key := types.NamespacedName{Namespace: policy.Namespace, Name: policy.Name}
+			controllerReconciler := &PolicyReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, key, policy)).To(Succeed())
+			return meta.FindStatusCondition(policy.Status.Conditions, kimv1.PolicyConditionReady)
+		}
+
+		It("should report valid rules as ready", func() {
+			condition := reconcilePolicy(&kimv1.Policy{
+				ObjectMeta: metav1.ObjectMeta{Name: "valid-policy", Namespace: "default"},
+				Spec: kimv1.PolicySpec{Rules: []kimv1.Rule{
+					{Resource: "user/default/*", Actions: []string{"get"}, Effect: kimv1.EffectAllow},
+				}},
+			})
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should report an invalid effect", func() {
+			condition := reconcilePolicy(&kimv1.Policy{
+				ObjectMeta: metav1.ObjectMeta{Name: "invalid-policy", Namespace: "default"},
+				Spec: kimv1.PolicySpec{Rules: []kimv1.Rule{
+					{Resource: "user/default/*", Actions: []string{"get"}, Effect: "allow"},
+				}},
+			})
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(kimv1.PolicyReasonInvalidSpec))
+		})
+	})
+})
@@ -0,0 +1,281 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kim
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/realm"
+	"github.com/crochee/kim/internal/tracing"
+)
+
+// RealmServer serves the issuers of the realms
+type RealmServer interface {
+	// Serve starts serving the realm or applies its changed configuration
+	Serve(ctx context.Context, config *realm.Config) error
+	// Stop stops serving the realm
+	Stop(ctx context.Context, key types.NamespacedName)
+}
+
+// RealmReconciler reconciles a Realm object
+type RealmReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Server serves the issuers of the realms
+	Server RealmServer
+}
+
+// realmError is an error of the realm itself, which is reported by the Ready condition instead of being retried
+type realmError struct {
+	reason string
+	err    error
+}
+
+func (e *realmError) Error() string {
+	return e.err.Error()
+}
+
+func (e *realmError) Unwrap() error {
+	return e.err
+}
+
+// +kubebuilder:rbac:groups=kim.kim.io,resources=realms,verbs=get;list;watch
+// +kubebuilder:rbac:groups=kim.kim.io,resources=realms/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=kim.kim.io,resources=realms/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+
+// Reconcile serves the issuer of the realm with its current signing key and clients,
+// and stops serving it once the realm is deleted.
+func (r *RealmReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := logf.FromContext(ctx)
+	obj := &kimv1.Realm{}
+	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Server.Stop(ctx, req.NamespacedName)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !obj.DeletionTimestamp.IsZero() {
+		r.Server.Stop(ctx, req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+
+	config, err := r.config(ctx, obj)
+	if err == nil {
+		err = r.Server.Serve(ctx, config)
+	}
+	condition := metav1.Condition{
+		Type:               kimv1.RealmConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             kimv1.RealmReasonServing,
+		Message:            "the issuer is served",
+		ObservedGeneration: obj.Generation,
+	}
+	var (
+		invalid  *realmError
+		conflict *realm.ConflictError
+	)
+	switch {
+	case err == nil:
+		obj.Status.Issuer = obj.Spec.Issuer
+	case errors.As(err, &invalid):
+		condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, invalid.reason, err.Error()
+	case errors.As(err, &conflict):
+		condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, kimv1.RealmReasonIssuerConflict, err.Error()
+	default:
+		// the realm keeps being served with its former configuration, if any
+		log.Error(err, "unable to serve realm")
+		condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, kimv1.RealmReasonServingUnavailable, err.Error()
+	}
+	if invalid != nil || conflict != nil {
+		// a realm not served as specified must not keep serving an outdated configuration
+		r.Server.Stop(ctx, req.NamespacedName)
+		obj.Status.Issuer = ""
+	}
+	obj.Status.ObservedGeneration = obj.Generation
+	meta.SetStatusCondition(&obj.Status.Conditions, condition)
+	if updateErr := r.Status().Update(ctx, obj); updateErr != nil {
+		return ctrl.Result{}, updateErr
+	}
+	if invalid != nil || conflict != nil {
+		// the realm is reconciled again once it or its Secrets change
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, err
+}
+
+// config resolves the Secrets of the realm
+func (r *RealmReconciler) config(ctx context.Context, obj *kimv1.Realm) (*realm.Config, error) {
+	config := &realm.Config{
+		Key:        client.ObjectKeyFromObject(obj),
+		Issuer:     obj.Spec.Issuer,
+		Namespaces: obj.Spec.Namespaces,
+		Theme:      obj.Spec.Branding.Theme,
+		Client:     r.Client,
+	}
+	if len(config.Namespaces) == 0 {
+		config.Namespaces = []string{obj.Namespace}
+	}
+	for _, namespace := range config.Namespaces {
+		// whoever may create a Realm in a namespace must not sign in the users of other namespaces
+		if namespace != obj.Namespace {
+			return nil, &realmError{reason: kimv1.RealmReasonInvalidSpec,
+				err: fmt.Errorf("namespace %s: the users of a realm must be in the namespace of the realm", namespace)}
+		}
+	}
+	if name := obj.Spec.SigningKeySecretName; name != "" {
+		data, err := r.secretValue(ctx, obj.Namespace, name, kimv1.RealmSigningKeyKey)
+		if err != nil {
+			return nil, err
+		}
+		key, err := parseRSAKey(data)
+		if err != nil {
+			return nil, &realmError{reason: kimv1.RealmReasonInvalidSigningKey,
+				err: fmt.Errorf("secret %s: %w", name, err)}
+		}
+		config.SigningKey, config.SigningKeyID = key, keyID(key)
+	}
+	for _, c := range obj.Spec.Clients {
+		client := realm.Client{RealmClient: c}
+		if client.Type == "" {
+			client.Type = kimv1.RealmClientWeb
+		}
+		switch {
+		case client.Type != kimv1.RealmClientNative && client.SecretName == "":
+			return nil, &realmError{reason: kimv1.RealmReasonInvalidSpec,
+				err: fmt.Errorf("client %s of type %s needs a secretName", client.ID, client.Type)}
+		case client.Type != kimv1.RealmClientDevice && len(client.RedirectURIs) == 0:
+			return nil, &realmError{reason: kimv1.RealmReasonInvalidSpec,
+				err: fmt.Errorf("client %s of type %s needs redirectURIs", client.ID, client.Type)}
+		}
+		if client.SecretName != "" {
+			secret, err := r.secretValue(ctx, obj.Namespace, client.SecretName, kimv1.RealmClientSecretKey)
+			if err != nil {
+				return nil, err
+			}
+			client.Secret = string(secret)
+		}
+		config.Clients = append(config.Clients, client)
+	}
+	return config, nil
+}
+
+// secretValue returns the value of the key of the Secret, a missing Secret or key is an error of the realm
+func (r *RealmReconciler) secretValue(ctx context.Context, namespace, name, key string) ([]byte, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, &realmError{reason: kimv1.RealmReasonSecretNotFound, err: err}
+		}
+		return nil, err
+	}
+	value, ok := secret.Data[key]
+	if !ok {
+		return nil, &realmError{reason: kimv1.RealmReasonSecretNotFound,
+			err: fmt.Errorf("secret %s has no %s key", name, key)}
+	}
+	return value, nil
+}
+
+// parseRSAKey parses a PEM encoded PKCS#1 or PKCS#8 RSA private key
+func parseRSAKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM encoded key found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%T is no RSA key", key)
+	}
+	return rsaKey, nil
+}
+
+// keyID derives the kid of the signing key from its public key, so that all replicas announce the same kid
+func keyID(key *rsa.PrivateKey) string {
+	der := x509.MarshalPKCS1PublicKey(&key.PublicKey)
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// realmsOfSecret maps a Secret to the realms referring to it
+func (r *RealmReconciler) realmsOfSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	realms := &kimv1.RealmList{}
+	if err := r.List(ctx, realms, client.InNamespace(obj.GetNamespace())); err != nil {
+		logf.FromContext(ctx).Error(err, "unable to list realms")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, item := range realms.Items {
+		if refersTo(&item, obj.GetName()) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+		}
+	}
+	return requests
+}
+
+// refersTo reports whether the realm refers to the Secret
+func refersTo(obj *kimv1.Realm, secret string) bool {
+	if obj.Spec.SigningKeySecretName == secret {
+		return true
+	}
+	for _, c := range obj.Spec.Clients {
+		if c.SecretName == secret {
+			return true
+		}
+	}
+	return false
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *RealmReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&kimv1.Realm{}).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.realmsOfSecret)).
+		// every replica serves the realms, not only the leader
+		WithOptions(controller.Options{NeedLeaderElection: ptr.To(false)}).
+		Named("kim-realm").
+		Complete(tracing.Reconciler("kim-realm", r))
+}
@@ -18,13 +18,23 @@ package kim
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"strings"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
-	iamv1 "kim/api/kim/v1"
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/tracing"
 )
 
 // RoleReconciler reconciles a Role object
@@ -33,30 +43,67 @@ type RoleReconciler struct {
 	Scheme *runtime.Scheme
 }
 
-//+kubebuilder:rbac:groups=iam.kim.io,resources=roles,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=iam.kim.io,resources=roles/status,verbs=get;update;patch
-//+kubebuilder:rbac:groups=iam.kim.io,resources=roles/finalizers,verbs=update
+// +kubebuilder:rbac:groups=kim.kim.io,resources=roles,verbs=get;list;watch
+// +kubebuilder:rbac:groups=kim.kim.io,resources=roles/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=kim.kim.io,resources=roles/finalizers,verbs=update
+// +kubebuilder:rbac:groups=kim.kim.io,resources=policies,verbs=get;list;watch
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
+// Reconcile reports whether all permissions of the role resolve to Policies in its namespace by its Ready
+// condition, the role is reconciled again once one of its Policies is created or deleted
 func (r *RoleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
-
-	var role iamv1.Role
-	if err := r.Get(ctx, req.NamespacedName, &role); err != nil {
+	obj := &kimv1.Role{}
+	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	var missing []string
+	for _, name := range obj.Spec.Permissions {
+		err := r.Get(ctx, types.NamespacedName{Namespace: obj.Namespace, Name: name}, &kimv1.Policy{})
+		if apierrors.IsNotFound(err) {
+			missing = append(missing, name)
+			continue
+		}
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	condition := metav1.Condition{
+		Type:               kimv1.RoleConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             kimv1.RoleReasonResolved,
+		Message:            "all permissions resolve to policies",
+		ObservedGeneration: obj.Generation,
+	}
+	if len(missing) > 0 {
+		condition.Status, condition.Reason = metav1.ConditionFalse, kimv1.RoleReasonPolicyNotFound
+		condition.Message = fmt.Sprintf("the policies %s do not exist", strings.Join(missing, ", "))
+	}
+	if !meta.SetStatusCondition(&obj.Status.Conditions, condition) {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, r.Status().Update(ctx, obj)
+}
 
-	// Sync role permissions to OIDC
-	if err := r.syncRoleToOIDC(ctx, &role); err != nil {
-		return ctrl.Result{}, err
+// rolesOfPolicy maps a Policy to the roles granting it
+func (r *RoleReconciler) rolesOfPolicy(ctx context.Context, obj client.Object) []reconcile.Request {
+	roles := &kimv1.RoleList{}
+	if err := r.List(ctx, roles, client.InNamespace(obj.GetNamespace())); err != nil {
+		logf.FromContext(ctx).Error(err, "unable to list roles")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, item := range roles.Items {
+		if slices.Contains(item.Spec.Permissions, obj.GetName()) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+		}
 	}
-	return ctrl.Result{}, nil
+	return requests
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *RoleReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&iamv1.Role{}).
-		Complete(r)
+		For(&kimv1.Role{}).
+		Watches(&kimv1.Policy{}, handler.EnqueueRequestsFromMapFunc(r.rolesOfPolicy)).
+		Named("kim-role").
+		Complete(tracing.Reconciler("kim-role", r))
 }
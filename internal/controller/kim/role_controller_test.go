@@ -0,0 +1,78 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kim
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+var _ = Describe("Role Controller", func() {
+	Context("When reconciling a resource", func() {
+		ctx := context.Background()
+		key := types.NamespacedName{Name: "test-role", Namespace: "default"}
+
+		BeforeEach(func() {
+			By("creating a role granting a missing policy")
+			role := &kimv1.Role{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+				Spec:       kimv1.RoleSpec{Permissions: []string{"role-policy"}},
+			}
+			Expect(k8sClient.Create(ctx, role)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			role := &kimv1.Role{}
+			Expect(k8sClient.Get(ctx, key, role)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, role)).To(Succeed())
+		})
+
+		It("should resolve the permissions once the policy exists", func() {
+			controllerReconciler := &RoleReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			ready := func() *metav1.Condition {
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+				Expect(err).NotTo(HaveOccurred())
+				role := &kimv1.Role{}
+				Expect(k8sClient.Get(ctx, key, role)).To(Succeed())
+				return meta.FindStatusCondition(role.Status.Conditions, kimv1.RoleConditionReady)
+			}
+			Expect(ready().Reason).To(Equal(kimv1.RoleReasonPolicyNotFound))
+
+			By("creating the policy")
+			policy := &kimv1.Policy{
+				ObjectMeta: metav1.ObjectMeta{Name: "role-policy", Namespace: key.Namespace},
+				Spec:       kimv1.PolicySpec{Rules: []kimv1.Rule{}},
+			}
+			Expect(k8sClient.Create(ctx, policy)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, policy)).To(Succeed())
+			})
+			Expect(ready().Status).To(Equal(metav1.ConditionTrue))
+		})
+	})
+})
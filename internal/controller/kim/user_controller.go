@@ -18,24 +18,38 @@ package kim
 
 import (
 	"context"
+	"strconv"
+	"time"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 
 	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/audit"
+	"github.com/crochee/kim/internal/lockout"
+	"github.com/crochee/kim/internal/tracing"
 )
 
 // UserReconciler reconciles a User object
 type UserReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// Lockout tracks the failed logins of the users, an unlock by an admin forgets them
+	Lockout *lockout.Guard
 }
 
 // +kubebuilder:rbac:groups=kim.kim.io,resources=users,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=kim.kim.io,resources=users/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=kim.kim.io,resources=users/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -48,19 +62,101 @@ type UserReconciler struct {
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.21.0/pkg/reconcile
 func (r *UserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	_ = logf.FromContext(ctx)
+	// all audit events of a reconciliation share its id
+	ctx = audit.ContextWithCorrelationID(ctx, string(controller.ReconcileIDFromContext(ctx)))
 	user := &kimv1.User{}
 	if err := r.Get(ctx, req.NamespacedName, user); err != nil {
+		if apierrors.IsNotFound(err) {
+			audit.Record(ctx, audit.Event{
+				Type:    audit.UserDeleted,
+				Outcome: audit.Success,
+				Target: &audit.Target{
+					Kind:      "User",
+					Namespace: req.Namespace,
+					Name:      req.Name,
+				},
+			})
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
-	// TODO(user): your logic here
+
+	if user.Status.ObservedGeneration != user.Generation {
+		audit.Record(ctx, audit.Event{
+			Type:    audit.UserChanged,
+			Outcome: audit.Success,
+			Actor:   audit.Actor{Username: lastManager(user)},
+			Target: &audit.Target{
+				Kind:      "User",
+				Namespace: user.Namespace,
+				Name:      user.Name,
+			},
+			Details: map[string]string{"generation": strconv.FormatInt(user.Generation, 10)},
+		})
+		user.Status.ObservedGeneration = user.Generation
+		if err := r.Status().Update(ctx, user); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if _, ok := user.Annotations[kimv1.UnlockAnnotation]; ok {
+		return ctrl.Result{}, r.unlock(ctx, user)
+	}
+	if meta.IsStatusConditionTrue(user.Status.Conditions, kimv1.UserConditionLocked) {
+		if until := user.Status.LockedUntil; until != nil && time.Now().Before(until.Time) {
+			return ctrl.Result{RequeueAfter: time.Until(until.Time)}, nil
+		}
+		user.Status.SetLocked(time.Time{}, kimv1.UserReasonLockExpired)
+		return ctrl.Result{}, r.Status().Update(ctx, user)
+	}
 
 	return ctrl.Result{}, nil
 }
 
+// unlock lifts the lockout of the user on behalf of the admin who annotated it, and removes the annotation
+func (r *UserReconciler) unlock(ctx context.Context, user *kimv1.User) error {
+	if err := r.Lockout.Reset(ctx, lockout.UserKey(user.Namespace, user.Name)); err != nil {
+		return err
+	}
+	if meta.IsStatusConditionTrue(user.Status.Conditions, kimv1.UserConditionLocked) {
+		user.Status.SetLocked(time.Time{}, kimv1.UserReasonUnlockedByAdmin)
+		if err := r.Status().Update(ctx, user); err != nil {
+			return err
+		}
+	}
+	audit.Record(ctx, audit.Event{
+		Type:    audit.UserUnlocked,
+		Outcome: audit.Success,
+		Actor:   audit.Actor{Username: lastManager(user)},
+		Target: &audit.Target{
+			Kind:      "User",
+			Namespace: user.Namespace,
+			Name:      user.Name,
+		},
+	})
+	patch := client.MergeFrom(user.DeepCopy())
+	delete(user.Annotations, kimv1.UnlockAnnotation)
+	return r.Patch(ctx, user, patch)
+}
+
+// lastManager returns the field manager of the latest change of the object,
+// the closest thing to the actor of the change the object itself knows about
+func lastManager(obj metav1.Object) string {
+	var latest metav1.ManagedFieldsEntry
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Subresource != "" || entry.Time == nil {
+			continue
+		}
+		if latest.Time == nil || latest.Time.Before(entry.Time) {
+			latest = entry
+		}
+	}
+	return latest.Manager
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *UserReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kimv1.User{}).
 		Named("kim-user").
-		Complete(r)
+		Complete(tracing.Reconciler("kim-user", r))
 }
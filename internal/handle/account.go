@@ -0,0 +1,309 @@
+package handle
+
+import (
+	"context"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/securecookie"
+	"github.com/zitadel/oidc/v3/pkg/op"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/storage"
+)
+
+const accountStateCookieName = "kim_account_state"
+
+type Account interface {
+	// AccountLogin consumes the authorization code of the portal and returns the single sign-on session it was issued for
+	AccountLogin(ctx context.Context, code string) (string, error)
+	// AccountUser returns the user of the single sign-on session
+	AccountUser(ctx context.Context, sessionID string) (*kimv1.User, error)
+
+	UpdateProfile(ctx context.Context, user *kimv1.User, values map[string]string) error
+	// ChangePassword ends the other sessions of the user besides the one of sessionID
+	ChangePassword(ctx context.Context, user *kimv1.User, sessionID, current, password string) error
+
+	TOTPEnrolled(ctx context.Context, user *kimv1.User) (bool, error)
+	EnrollTOTP(ctx context.Context, user *kimv1.User, secret, code string) error
+	RemoveTOTP(ctx context.Context, user *kimv1.User, password string) error
+
+	UserSessions(ctx context.Context, user *kimv1.User) []storage.Session
+	RevokeUserSession(ctx context.Context, user *kimv1.User, sessionID string) error
+	AuthorizedClients(ctx context.Context, user *kimv1.User) []string
+	RevokeUserClient(ctx context.Context, user *kimv1.User, clientID string) error
+}
+
+type account struct {
+	storage  Account
+	sessions *SessionCookie
+	// authorize returns the authorization endpoint of the issuer of the request
+	authorize func(context.Context) string
+	// fields are the Claim fields the users may edit
+	fields []string
+}
+
+type accountKey struct{}
+
+// accountUser is the signed-in user of an account portal request
+type accountUser struct {
+	user      *kimv1.User
+	sessionID string
+}
+
+// NewAccount returns the account portal, where the users manage their profile, password, second factor,
+// sessions and authorized clients. The users sign in to the portal like to any other client of the OP,
+// which is the single sign-on session the portal is bound to.
+func NewAccount(storage Account, sessions *SessionCookie, authorize func(context.Context) string, fields []string,
+	issuerInterceptor *op.IssuerInterceptor,
+) chi.Router {
+	a := &account{
+		storage:   storage,
+		sessions:  sessions,
+		authorize: authorize,
+		fields:    fields,
+	}
+	r := chi.NewRouter()
+	r.Use(issuerInterceptor.Handler)
+	r.Get("/login", a.loginHandler)
+	r.Get("/callback", a.callbackHandler)
+	r.Group(func(r chi.Router) {
+		r.Use(a.authenticated)
+		r.Get("/", a.accountHandler)
+		r.Post("/profile", a.profileHandler)
+		r.Post("/password", a.passwordHandler)
+		r.Get("/totp", a.totpHandler)
+		r.Post("/totp", a.enrollTOTPHandler)
+		r.Post("/totp/remove", a.removeTOTPHandler)
+		r.Post("/sessions/revoke", a.revokeSessionHandler)
+		r.Post("/clients/revoke", a.revokeClientHandler)
+	})
+	return r
+}
+
+// authenticated lets only signed-in users in and protects the forms against cross-site requests
+func (a *account) authenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionID := a.sessions.Get(r)
+		user, err := a.storage.AccountUser(r.Context(), sessionID)
+		if err != nil {
+			http.Redirect(w, r, basePath(r)+"/account/login", http.StatusFound)
+			return
+		}
+		if r.Method == http.MethodPost && !a.sessions.ValidCSRF(r, sessionID) {
+			http.Error(w, accountPage(r, user).T("invalid csrf token"), http.StatusForbidden)
+			return
+		}
+		ctx := context.WithValue(r.Context(), accountKey{}, &accountUser{user: user, sessionID: sessionID})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func accountFromRequest(r *http.Request) *accountUser {
+	return r.Context().Value(accountKey{}).(*accountUser)
+}
+
+// accountPage returns the page of the portal, which prefers the locale of the user
+func accountPage(r *http.Request, user *kimv1.User) page {
+	return pageOf(r, "", nil, storage.ClaimValue(user, "locale"))
+}
+
+func callbackURI(ctx context.Context) string {
+	return strings.TrimSuffix(op.IssuerFromContext(ctx), "/") + "/account/callback"
+}
+
+// loginHandler starts an authorization code flow of the portal, the state protects the callback against login CSRF
+func (a *account) loginHandler(w http.ResponseWriter, r *http.Request) {
+	state := base64.RawURLEncoding.EncodeToString(securecookie.GenerateRandomKey(16))
+	http.SetCookie(w, &http.Cookie{
+		Name:     accountStateCookieName,
+		Value:    state,
+		Path:     basePath(r) + "/account",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	values := url.Values{}
+	values.Set("client_id", storage.AccountClientID)
+	values.Set("redirect_uri", callbackURI(r.Context()))
+	values.Set("response_type", "code")
+	values.Set("scope", "openid")
+	values.Set("state", state)
+	http.Redirect(w, r, a.authorize(r.Context())+"?"+values.Encode(), http.StatusFound)
+}
+
+func (a *account) callbackHandler(w http.ResponseWriter, r *http.Request) {
+	p := pageOf(r, "", nil, "")
+	cookie, err := r.Cookie(accountStateCookieName)
+	if err != nil || cookie.Value == "" || cookie.Value != r.URL.Query().Get("state") {
+		http.Error(w, p.T("invalid state"), http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: accountStateCookieName, Path: basePath(r) + "/account", MaxAge: -1})
+	if errMessage := r.URL.Query().Get("error"); errMessage != "" {
+		renderRecoveryMessage(w, p, errMessage)
+		return
+	}
+	sessionID, err := a.storage.AccountLogin(r.Context(), r.URL.Query().Get("code"))
+	if err != nil || sessionID != a.sessions.Get(r) {
+		http.Error(w, p.T("sign in failed"), http.StatusUnauthorized)
+		return
+	}
+	http.Redirect(w, r, basePath(r)+"/account/", http.StatusFound)
+}
+
+type accountField struct {
+	Name  string
+	Value string
+}
+
+// render shows the account page with the error or the message, the message is translated with the args
+// in the language of the user, which may have just been changed
+func (a *account) render(w http.ResponseWriter, r *http.Request, err error, message string, args ...any) {
+	current := accountFromRequest(r)
+	// the user is read again, so that the page shows the changes just made
+	user, uerr := a.storage.AccountUser(r.Context(), current.sessionID)
+	if uerr != nil {
+		http.Redirect(w, r, basePath(r)+"/account/login", http.StatusFound)
+		return
+	}
+	fields := make([]accountField, 0, len(a.fields))
+	for _, field := range a.fields {
+		fields = append(fields, accountField{Name: field, Value: storage.ClaimValue(user, field)})
+	}
+	p := accountPage(r, user)
+	if message != "" {
+		message = p.T(message, args...)
+	}
+	totp, terr := a.storage.TOTPEnrolled(r.Context(), user)
+	if err == nil {
+		err = terr
+	}
+	data := &struct {
+		User           *kimv1.User
+		Fields         []accountField
+		TOTP           bool
+		Sessions       []storage.Session
+		CurrentSession string
+		Clients        []string
+		CSRF           string
+		Message        string
+		Error          string
+	}{
+		User:           user,
+		Fields:         fields,
+		TOTP:           totp,
+		Sessions:       a.storage.UserSessions(r.Context(), user),
+		CurrentSession: current.sessionID,
+		Clients:        a.storage.AuthorizedClients(r.Context(), user),
+		CSRF:           a.sessions.CSRFToken(current.sessionID),
+		Message:        message,
+		Error:          errMsg(p, err),
+	}
+	if err = render(w, p, "account", data); err != nil {
+		slog.Error("could not account render template", "error", err)
+	}
+}
+
+func (a *account) accountHandler(w http.ResponseWriter, r *http.Request) {
+	a.render(w, r, nil, "")
+}
+
+func (a *account) profileHandler(w http.ResponseWriter, r *http.Request) {
+	// only the fields the users may edit are taken from the form
+	values := make(map[string]string, len(a.fields))
+	for _, field := range a.fields {
+		values[field] = strings.TrimSpace(r.PostFormValue(field))
+	}
+	if err := a.storage.UpdateProfile(r.Context(), accountFromRequest(r).user, values); err != nil {
+		a.render(w, r, err, "")
+		return
+	}
+	a.render(w, r, nil, "account.profile_saved")
+}
+
+func (a *account) passwordHandler(w http.ResponseWriter, r *http.Request) {
+	password := r.PostFormValue("password")
+	if password != r.PostFormValue("confirm") {
+		a.render(w, r, errPasswordMismatch, "")
+		return
+	}
+	current := accountFromRequest(r)
+	if err := a.storage.ChangePassword(r.Context(), current.user, current.sessionID, r.PostFormValue("current"), password); err != nil {
+		a.render(w, r, err, "")
+		return
+	}
+	a.render(w, r, nil, "account.password_changed")
+}
+
+func renderTOTP(w http.ResponseWriter, r *http.Request, csrf, secret string, err error) {
+	user := accountFromRequest(r).user
+	p := accountPage(r, user)
+	data := &struct {
+		Secret string
+		URI    string
+		CSRF   string
+		Error  string
+	}{
+		Secret: secret,
+		URI:    storage.TOTPURI(op.IssuerFromContext(r.Context()), user.Name, secret),
+		CSRF:   csrf,
+		Error:  errMsg(p, err),
+	}
+	if err = render(w, p, "account_totp", data); err != nil {
+		slog.Error("could not account_totp render template", "error", err)
+	}
+}
+
+func (a *account) totpHandler(w http.ResponseWriter, r *http.Request) {
+	renderTOTP(w, r, a.sessions.CSRFToken(accountFromRequest(r).sessionID), storage.NewTOTPSecret(), nil)
+}
+
+func (a *account) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	current := accountFromRequest(r)
+	secret := r.PostFormValue("secret")
+	if err := a.storage.EnrollTOTP(r.Context(), current.user, secret, r.PostFormValue("otp")); err != nil {
+		renderTOTP(w, r, a.sessions.CSRFToken(current.sessionID), secret, err)
+		return
+	}
+	a.render(w, r, nil, "account.mfa_added")
+}
+
+func (a *account) removeTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	if err := a.storage.RemoveTOTP(r.Context(), accountFromRequest(r).user, r.PostFormValue("password")); err != nil {
+		a.render(w, r, err, "")
+		return
+	}
+	a.render(w, r, nil, "account.mfa_removed")
+}
+
+func (a *account) revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	current := accountFromRequest(r)
+	sessionID := r.PostFormValue("session")
+	if err := a.storage.RevokeUserSession(r.Context(), current.user, sessionID); err != nil {
+		a.render(w, r, err, "")
+		return
+	}
+	if sessionID == current.sessionID {
+		// the portal itself was signed out
+		a.sessions.Clear(w, r)
+		http.Redirect(w, r, basePath(r)+"/logout", http.StatusFound)
+		return
+	}
+	a.render(w, r, nil, "account.session_ended")
+}
+
+func (a *account) revokeClientHandler(w http.ResponseWriter, r *http.Request) {
+	clientID := r.PostFormValue("client_id")
+	if err := a.storage.RevokeUserClient(r.Context(), accountFromRequest(r).user, clientID); err != nil {
+		a.render(w, r, err, "")
+		return
+	}
+	a.render(w, r, nil, "account.client_revoked", clientID)
+}
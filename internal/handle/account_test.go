@@ -0,0 +1,134 @@
+package handle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zitadel/oidc/v3/pkg/op"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/storage"
+)
+
+// accountStub signs in alice by the session sid and records the codes and revoked clients
+type accountStub struct {
+	Account
+	codes   []string
+	revoked []string
+}
+
+func (a *accountStub) AccountLogin(_ context.Context, code string) (string, error) {
+	a.codes = append(a.codes, code)
+	return "sid", nil
+}
+
+func (a *accountStub) AccountUser(_ context.Context, sessionID string) (*kimv1.User, error) {
+	if sessionID != "sid" {
+		return nil, errors.New("not signed in")
+	}
+	return &kimv1.User{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "alice"}}, nil
+}
+
+func (a *accountStub) TOTPEnrolled(context.Context, *kimv1.User) (bool, error) {
+	return false, nil
+}
+
+func (a *accountStub) UserSessions(context.Context, *kimv1.User) []storage.Session {
+	return nil
+}
+
+func (a *accountStub) AuthorizedClients(context.Context, *kimv1.User) []string {
+	return nil
+}
+
+func (a *accountStub) RevokeUserClient(_ context.Context, _ *kimv1.User, clientID string) error {
+	a.revoked = append(a.revoked, clientID)
+	return nil
+}
+
+func newTestAccount(stub Account, sessions *SessionCookie) http.Handler {
+	return NewAccount(stub, sessions, func(context.Context) string { return "https://kim.test/authorize" }, nil,
+		op.NewIssuerInterceptor(func(*http.Request) string { return "https://kim.test/" }))
+}
+
+// sessionCookie returns the session cookie of the session id
+func sessionCookie(t *testing.T, sessions *SessionCookie, sessionID string) *http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := sessions.Set(w, httptest.NewRequest(http.MethodGet, "/", nil), sessionID); err != nil {
+		t.Fatal(err)
+	}
+	return w.Result().Cookies()[0]
+}
+
+func TestAccountCSRF(t *testing.T) {
+	stub := &accountStub{}
+	sessions := NewSessionCookie([]byte("secret"), time.Hour)
+	handler := newTestAccount(stub, sessions)
+	cookie := sessionCookie(t, sessions, "sid")
+	for _, tc := range []struct {
+		name string
+		csrf string
+		want int
+	}{
+		{name: "missing", want: http.StatusForbidden},
+		{name: "of another session", csrf: sessions.CSRFToken("other"), want: http.StatusForbidden},
+		{name: "valid", csrf: sessions.CSRFToken("sid"), want: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			form := url.Values{"client_id": {"web"}, "csrf": {tc.csrf}}
+			r := httptest.NewRequest(http.MethodPost, "/clients/revoke", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.AddCookie(cookie)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tc.want {
+				t.Fatalf("status = %d, want %d", w.Code, tc.want)
+			}
+		})
+	}
+	if len(stub.revoked) != 1 {
+		t.Fatalf("revoked = %v, only the request with the token may revoke the client", stub.revoked)
+	}
+}
+
+func TestAccountCallbackState(t *testing.T) {
+	sessions := NewSessionCookie([]byte("secret"), time.Hour)
+	for _, tc := range []struct {
+		name    string
+		state   string
+		cookie  string
+		session string
+		want    int
+	}{
+		{name: "missing state cookie", state: "state", session: "sid", want: http.StatusBadRequest},
+		{name: "state mismatch", state: "state", cookie: "other", session: "sid", want: http.StatusBadRequest},
+		{name: "session of another browser", state: "state", cookie: "state", session: "other", want: http.StatusUnauthorized},
+		{name: "valid", state: "state", cookie: "state", session: "sid", want: http.StatusFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stub := &accountStub{}
+			r := httptest.NewRequest(http.MethodGet, "/callback?code=code&state="+tc.state, nil)
+			if tc.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: accountStateCookieName, Value: tc.cookie})
+			}
+			r.AddCookie(sessionCookie(t, sessions, tc.session))
+			w := httptest.NewRecorder()
+			newTestAccount(stub, sessions).ServeHTTP(w, r)
+			if w.Code != tc.want {
+				t.Fatalf("status = %d, want %d", w.Code, tc.want)
+			}
+			// the code must not be consumed by a forged callback
+			if consumed := len(stub.codes) > 0; consumed != (tc.want != http.StatusBadRequest) {
+				t.Fatalf("codes = %v", stub.codes)
+			}
+		})
+	}
+}
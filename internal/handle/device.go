@@ -15,7 +15,10 @@ import (
 )
 
 type DeviceAuthenticate interface {
-	CheckUsernamePasswordSimple(username, password string) error
+	// CheckDeviceCredentials checks the credentials (password and the one-time code of users with a second factor)
+	// of the user for the device authorization of the user code and returns its state,
+	// the authorization is denied after too many failed attempts
+	CheckDeviceCredentials(ctx context.Context, userCode, username, password, otp string) (*op.DeviceAuthorizationState, error)
 	op.DeviceAuthorizationStorage
 
 	// GetDeviceAuthorizationByUserCode resturns the current state of the device authorization flow,
@@ -29,6 +32,9 @@ type DeviceAuthenticate interface {
 
 	// DenyDeviceAuthorization marks a device authorization entry as Denied.
 	DenyDeviceAuthorization(ctx context.Context, userCode string) error
+
+	// GetClientByClientID returns the client of the device, which selects the theme of the confirm page.
+	GetClientByClientID(ctx context.Context, clientID string) (op.Client, error)
 }
 
 type deviceLogin struct {
@@ -47,32 +53,32 @@ func RegisterDeviceAuth(storage DeviceAuthenticate, router chi.Router) {
 	router.HandleFunc("/confirm", l.confirmHandler)
 }
 
-func renderUserCode(w io.Writer, err error) {
+func renderUserCode(w io.Writer, p page, err error) {
 	data := struct {
 		Error string
 	}{
-		Error: errMsg(err),
+		Error: errMsg(p, err),
 	}
 
-	if err := templates.ExecuteTemplate(w, "usercode", data); err != nil {
+	if err := render(w, p, "usercode", data); err != nil {
 		slog.Error("could not usercode render template", "error", err)
 	}
 }
 
-func renderDeviceLogin(w http.ResponseWriter, userCode string, err error) {
+func renderDeviceLogin(w http.ResponseWriter, p page, userCode string, err error) {
 	data := &struct {
 		UserCode string
 		Error    string
 	}{
 		UserCode: userCode,
-		Error:    errMsg(err),
+		Error:    errMsg(p, err),
 	}
-	if err = templates.ExecuteTemplate(w, "device_login", data); err != nil {
+	if err = render(w, p, "device_login", data); err != nil {
 		slog.Error("could not device_login render template", "error", err)
 	}
 }
 
-func renderConfirmPage(w http.ResponseWriter, username, clientID string, scopes []string) {
+func renderConfirmPage(w http.ResponseWriter, p page, username, clientID string, scopes []string) {
 	data := &struct {
 		Username string
 		ClientID string
@@ -82,16 +88,17 @@ func renderConfirmPage(w http.ResponseWriter, username, clientID string, scopes
 		ClientID: clientID,
 		Scopes:   scopes,
 	}
-	if err := templates.ExecuteTemplate(w, "confirm_device", data); err != nil {
+	if err := render(w, p, "confirm_device", data); err != nil {
 		slog.Error("could not confirm_device render template", "error", err)
 	}
 }
 
 func (d *deviceLogin) userCodeHandler(w http.ResponseWriter, r *http.Request) {
+	p := pageOf(r, "", nil, "")
 	err := r.ParseForm()
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		renderUserCode(w, err)
+		renderUserCode(w, p, err)
 		return
 	}
 	userCode := r.Form.Get("user_code")
@@ -99,19 +106,20 @@ func (d *deviceLogin) userCodeHandler(w http.ResponseWriter, r *http.Request) {
 		if prompt, _ := url.QueryUnescape(r.Form.Get("prompt")); prompt != "" {
 			err = errors.New(prompt)
 		}
-		renderUserCode(w, err)
+		renderUserCode(w, p, err)
 		return
 	}
 
-	renderDeviceLogin(w, userCode, nil)
+	renderDeviceLogin(w, p, userCode, nil)
 }
 
-func redirectBack(w http.ResponseWriter, r *http.Request, prompt string) {
+// redirectBack shows the error on the user code page, it is translated here as the page only gets its text
+func redirectBack(w http.ResponseWriter, r *http.Request, err error) {
 	values := make(url.Values)
-	values.Set("prompt", url.QueryEscape(prompt))
+	values.Set("prompt", url.QueryEscape(pageOf(r, "", nil, "").Error(err)))
 
 	url := url.URL{
-		Path:     "/device",
+		Path:     basePath(r) + "/device",
 		RawQuery: values.Encode(),
 	}
 	http.Redirect(w, r, url.String(), http.StatusSeeOther)
@@ -126,33 +134,29 @@ type userCodeCookie struct {
 
 func (d *deviceLogin) loginHandler(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
-		redirectBack(w, r, err.Error())
+		redirectBack(w, r, err)
 		return
 	}
 
 	userCode := r.PostForm.Get("user_code")
 	if userCode == "" {
-		redirectBack(w, r, "missing user_code in request")
+		redirectBack(w, r, errors.New("missing user_code in request"))
 		return
 	}
 	username := r.PostForm.Get("username")
 	if username == "" {
-		redirectBack(w, r, "missing username in request")
+		redirectBack(w, r, errors.New("missing username in request"))
 		return
 	}
 	password := r.PostForm.Get("password")
 	if password == "" {
-		redirectBack(w, r, "missing password in request")
+		redirectBack(w, r, errors.New("missing password in request"))
 		return
 	}
 
-	if err := d.storage.CheckUsernamePasswordSimple(username, password); err != nil {
-		redirectBack(w, r, err.Error())
-		return
-	}
-	state, err := d.storage.GetDeviceAuthorizationByUserCode(r.Context(), userCode)
+	state, err := d.storage.CheckDeviceCredentials(r.Context(), userCode, username, password, r.PostForm.Get("otp"))
 	if err != nil {
-		redirectBack(w, r, err.Error())
+		redirectBack(w, r, err)
 		return
 	}
 
@@ -167,22 +171,26 @@ func (d *deviceLogin) loginHandler(w http.ResponseWriter, r *http.Request) {
 		Path:  "/",
 	}
 	http.SetCookie(w, cookie)
-	renderConfirmPage(w, username, state.ClientID, state.Scopes)
+	var theme string
+	if client, err := d.storage.GetClientByClientID(r.Context(), state.ClientID); err == nil {
+		theme = clientTheme(client)
+	}
+	renderConfirmPage(w, pageOf(r, theme, nil, ""), username, state.ClientID, state.Scopes)
 }
 
 func (d *deviceLogin) confirmHandler(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie(userCodeCookieName)
 	if err != nil {
-		redirectBack(w, r, err.Error())
+		redirectBack(w, r, err)
 		return
 	}
 	data := new(userCodeCookie)
 	if err = d.cookie.Decode(userCodeCookieName, cookie.Value, &data); err != nil {
-		redirectBack(w, r, err.Error())
+		redirectBack(w, r, err)
 		return
 	}
 	if err = r.ParseForm(); err != nil {
-		redirectBack(w, r, err.Error())
+		redirectBack(w, r, err)
 		return
 	}
 
@@ -196,9 +204,9 @@ func (d *deviceLogin) confirmHandler(w http.ResponseWriter, r *http.Request) {
 		err = errors.New("action must be one of \"allow\" or \"deny\"")
 	}
 	if err != nil {
-		redirectBack(w, r, err.Error())
+		redirectBack(w, r, err)
 		return
 	}
 
-	fmt.Fprintf(w, "Device authorization %s. You can now return to the device", action)
+	fmt.Fprint(w, pageOf(r, "", nil, "").T("device."+action))
 }
@@ -0,0 +1,52 @@
+package handle
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// SubjectTypes announces the subject types in the discovery document served by next,
+// the OP itself only announces the public subjects
+func SubjectTypes(next http.Handler, subjectTypes ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		body := rec.body.Bytes()
+		if rec.status == http.StatusOK {
+			var document map[string]any
+			if err := json.Unmarshal(body, &document); err == nil {
+				document["subject_types_supported"] = subjectTypes
+				if patched, err := json.Marshal(document); err == nil {
+					body = patched
+					rec.header.Set("Content-Length", strconv.Itoa(len(body)))
+				}
+			}
+		}
+		for key, values := range rec.header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(rec.status)
+		_, _ = w.Write(body)
+	})
+}
+
+// bufferedResponse keeps the response of a handler to be changed before it is sent
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
@@ -0,0 +1,123 @@
+package handle
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	httphelper "github.com/zitadel/oidc/v3/pkg/http"
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+	"github.com/zitadel/oidc/v3/pkg/op"
+)
+
+// JWTExchange verifies the JWTs which are not issued by the OP, the subject tokens of the token exchanges
+// and the assertions of the jwt-bearer grants of the trusted external issuers
+type JWTExchange interface {
+	JWTExchangeTokenRequest(ctx context.Context, token string, scopes []string) (op.TokenRequest, op.AccessTokenClient, op.AccessTokenType, error)
+	JWTBearerTokenRequest(ctx context.Context, assertion string, scopes []string) (op.TokenRequest, op.AccessTokenClient, op.AccessTokenType, error)
+	// TrustedIssuer reports whether the assertions of the issuer are verified by the storage rather than by the
+	// JWT profile grant of the OP
+	TrustedIssuer(ctx context.Context, issuer string) (bool, error)
+}
+
+// TokenExchange serves the token exchanges of JWT subject tokens, e.g. of ServiceAccounts, and the jwt-bearer grants
+// of the trusted external issuers at the token endpoint of the provider and passes any other request to next, the OP
+// only exchanges the tokens it issued itself. They need no client authentication, the JWT is the credential.
+func TokenExchange(next http.Handler, storage JWTExchange, provider op.OpenIDProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != provider.TokenEndpoint().Relative() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// the parsed form is left to the OP, which does not parse it again
+		if err := r.ParseForm(); err != nil {
+			op.RequestError(w, r, oidc.ErrInvalidRequest().WithDescription("error parsing form").WithParent(err), provider.Logger())
+			return
+		}
+		var (
+			resp any
+			err  error
+		)
+		switch grantType := r.PostForm.Get("grant_type"); {
+		case grantType == string(oidc.GrantTypeTokenExchange) && r.PostForm.Get("subject_token_type") == string(oidc.JWTTokenType):
+			resp, err = exchangeJWT(r, storage, provider)
+		case grantType == string(oidc.GrantTypeBearer):
+			// the assertions of the MachineClients are left to the JWT profile grant of the OP
+			var trusted bool
+			trusted, err = storage.TrustedIssuer(r.Context(), assertionIssuer(r.PostForm.Get("assertion")))
+			if err == nil && !trusted {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err == nil {
+				resp, err = bearerJWT(r, storage, provider)
+			}
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			op.RequestError(w, r, err, provider.Logger())
+			return
+		}
+		httphelper.MarshalJSON(w, resp)
+	})
+}
+
+// assertionIssuer returns the unverified iss claim of the assertion, it is verified by the storage of the issuer
+func assertionIssuer(assertion string) string {
+	claims := new(oidc.TokenClaims)
+	if _, err := oidc.ParseToken(assertion, claims); err != nil {
+		return ""
+	}
+	return claims.Issuer
+}
+
+// bearerJWT issues the access token of the assertion of a trusted external issuer
+func bearerJWT(r *http.Request, storage JWTExchange, provider op.OpenIDProvider) (*oidc.AccessTokenResponse, error) {
+	request, client, tokenType, err := storage.JWTBearerTokenRequest(r.Context(), r.PostForm.Get("assertion"),
+		strings.Fields(r.PostForm.Get("scope")))
+	if err != nil {
+		return nil, err
+	}
+	accessToken, _, validity, err := op.CreateAccessToken(r.Context(), request, tokenType, provider, client, "")
+	if err != nil {
+		return nil, err
+	}
+	return &oidc.AccessTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   oidc.BearerToken,
+		ExpiresIn:   uint64(validity.Seconds()),
+		Scope:       request.GetScopes(),
+	}, nil
+}
+
+// exchangeJWT issues the access token of the JWT subject token, which can not be delegated to an actor
+func exchangeJWT(r *http.Request, storage JWTExchange, provider op.OpenIDProvider) (*oidc.TokenExchangeResponse, error) {
+	subjectToken := r.PostForm.Get("subject_token")
+	if subjectToken == "" {
+		return nil, oidc.ErrInvalidRequest().WithDescription("subject_token missing")
+	}
+	if r.PostForm.Get("actor_token") != "" {
+		return nil, oidc.ErrInvalidRequest().WithDescription("actor_token is not supported for jwt subject tokens")
+	}
+	if requested := r.PostForm.Get("requested_token_type"); requested != "" && requested != string(oidc.AccessTokenType) {
+		return nil, oidc.ErrInvalidRequest().WithDescription("only access tokens are issued for jwt subject tokens")
+	}
+	request, client, tokenType, err := storage.JWTExchangeTokenRequest(r.Context(), subjectToken,
+		strings.Fields(r.PostForm.Get("scope")))
+	if err != nil {
+		return nil, err
+	}
+	accessToken, _, validity, err := op.CreateAccessToken(r.Context(), request, tokenType, provider, client, "")
+	if err != nil {
+		return nil, err
+	}
+	return &oidc.TokenExchangeResponse{
+		AccessToken:     accessToken,
+		IssuedTokenType: oidc.AccessTokenType,
+		TokenType:       oidc.BearerToken,
+		ExpiresIn:       uint64(validity.Seconds()),
+		Scopes:          request.GetScopes(),
+	}, nil
+}
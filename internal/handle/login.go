@@ -10,25 +10,43 @@ import (
 )
 
 type Authenticate interface {
-	CheckUsernamePassword(username, password, id string) error
+	AuthRequestByID(ctx context.Context, id string) (op.AuthRequest, error)
+	CheckUsernamePassword(ctx context.Context, username, password, id string) error
+
+	// CheckOTP checks the one-time code of a user with a second factor, after CheckUsernamePassword
+	// left the auth request identified by id pending.
+	CheckOTP(ctx context.Context, code, id string) error
+
+	// ResumeSession tries to complete the auth request identified by id from the single sign-on session
+	// and reports whether it is done. An oidc error is returned if the request can't be fulfilled
+	// without user interaction (prompt=none).
+	ResumeSession(ctx context.Context, sessionID, id string) (bool, error)
+
+	// BindSession attaches the authenticated auth request to the single sign-on session
+	// and returns the id of the session to remember in the browser.
+	BindSession(ctx context.Context, sessionID, id string) (string, error)
 }
 
 type login struct {
 	authenticate Authenticate
-	router       chi.Router
+	authorizer   op.Authorizer
+	sessions     *SessionCookie
 	callback     func(context.Context, string) string
 }
 
-func NewLogin(authenticate Authenticate,
+func NewLogin(authenticate Authenticate, authorizer op.Authorizer, sessions *SessionCookie,
 	callback func(context.Context, string) string, issuerInterceptor *op.IssuerInterceptor,
 ) chi.Router {
 	l := &login{
 		authenticate: authenticate,
+		authorizer:   authorizer,
+		sessions:     sessions,
 		callback:     callback,
 	}
 	r := chi.NewRouter()
-	r.Get("/username", l.loginHandler)
+	r.Get("/username", issuerInterceptor.HandlerFunc(l.loginHandler))
 	r.Post("/username", issuerInterceptor.HandlerFunc(l.checkLoginHandler))
+	r.Post("/otp", issuerInterceptor.HandlerFunc(l.checkOTPHandler))
 	return r
 }
 
@@ -40,18 +58,61 @@ func (l *login) loginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	// the oidc package will pass the id of the auth request as query parameter
 	// we will use this id through the login process and therefore pass it to the login page
-	renderLogin(w, r.FormValue(queryAuthRequestID), nil)
+	id := r.FormValue(queryAuthRequestID)
+	authReq, err := l.authenticate.AuthRequestByID(r.Context(), id)
+	if err != nil {
+		renderLogin(w, pageOf(r, "", nil, ""), id, "", err)
+		return
+	}
+	// an already signed-in user skips the login form, unless the client asked for a fresh authentication
+	done, err := l.authenticate.ResumeSession(r.Context(), l.sessions.Get(r), id)
+	if err != nil {
+		op.AuthRequestError(w, r, authReq, err, l.authorizer)
+		return
+	}
+	if done {
+		http.Redirect(w, r, l.callback(r.Context(), id), http.StatusFound)
+		return
+	}
+	renderLogin(w, l.authRequestPage(r, authReq), id, loginHint(authReq), nil)
+}
+
+func loginHint(authReq op.AuthRequest) string {
+	if hinter, ok := authReq.(interface{ GetLoginHint() string }); ok {
+		return hinter.GetLoginHint()
+	}
+	return ""
 }
 
-func renderLogin(w http.ResponseWriter, id string, err error) {
+// page returns the login page of the auth request identified by id
+func (l *login) page(r *http.Request, id string) page {
+	authReq, err := l.authenticate.AuthRequestByID(r.Context(), id)
+	if err != nil {
+		return pageOf(r, "", nil, "")
+	}
+	return l.authRequestPage(r, authReq)
+}
+
+// authRequestPage returns the login page in the theme of the client and the ui_locales of the auth request
+func (l *login) authRequestPage(r *http.Request, authReq op.AuthRequest) page {
+	var theme string
+	if client, err := l.authorizer.Storage().GetClientByClientID(r.Context(), authReq.GetClientID()); err == nil {
+		theme = clientTheme(client)
+	}
+	return pageOf(r, theme, uiLocales(authReq), "")
+}
+
+func renderLogin(w http.ResponseWriter, p page, id, username string, err error) {
 	data := &struct {
-		ID    string
-		Error string
+		ID       string
+		Username string
+		Error    string
 	}{
-		ID:    id,
-		Error: errMsg(err),
+		ID:       id,
+		Username: username,
+		Error:    errMsg(p, err),
 	}
-	err = templates.ExecuteTemplate(w, "login", data)
+	err = render(w, p, "login", data)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
@@ -66,10 +127,61 @@ func (l *login) checkLoginHandler(w http.ResponseWriter, r *http.Request) {
 	username := r.FormValue("username")
 	password := r.FormValue("password")
 	id := r.FormValue("id")
-	err = l.authenticate.CheckUsernamePassword(username, password, id)
+	p := l.page(r, id)
+	err = l.authenticate.CheckUsernamePassword(r.Context(), username, password, id)
 	if err != nil {
-		renderLogin(w, id, err)
+		renderLogin(w, p, id, username, err)
+		return
+	}
+	// users with a second factor enter their one-time code next
+	if authReq, err := l.authenticate.AuthRequestByID(r.Context(), id); err == nil && !authReq.Done() {
+		renderOTP(w, p, id, nil)
 		return
 	}
+	if err = l.completeLogin(w, r, id); err != nil {
+		renderLogin(w, p, id, username, err)
+	}
+}
+
+func renderOTP(w http.ResponseWriter, p page, id string, err error) {
+	data := &struct {
+		ID    string
+		Error string
+	}{
+		ID:    id,
+		Error: errMsg(p, err),
+	}
+	if err = render(w, p, "otp", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (l *login) checkOTPHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("cannot parse form:%s", err), http.StatusInternalServerError)
+		return
+	}
+	id := r.FormValue("id")
+	p := l.page(r, id)
+	if err := l.authenticate.CheckOTP(r.Context(), r.FormValue("otp"), id); err != nil {
+		renderOTP(w, p, id, err)
+		return
+	}
+	if err := l.completeLogin(w, r, id); err != nil {
+		renderOTP(w, p, id, err)
+	}
+}
+
+// completeLogin binds the authenticated auth request to the single sign-on session and
+// redirects to the callback of the OP
+func (l *login) completeLogin(w http.ResponseWriter, r *http.Request, id string) error {
+	sessionID, err := l.authenticate.BindSession(r.Context(), l.sessions.Get(r), id)
+	if err != nil {
+		return err
+	}
+	if err = l.sessions.Set(w, r, sessionID); err != nil {
+		return err
+	}
 	http.Redirect(w, r, l.callback(r.Context(), id), http.StatusFound)
+	return nil
 }
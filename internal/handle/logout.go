@@ -0,0 +1,61 @@
+package handle
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/zitadel/oidc/v3/pkg/op"
+)
+
+type Logout interface {
+	// FrontChannelLogout returns the front-channel logout uris of the clients of an ended session
+	// and the uri to redirect to once they are loaded.
+	FrontChannelLogout(ctx context.Context, id string) ([]string, string, error)
+}
+
+type logout struct {
+	storage  Logout
+	sessions *SessionCookie
+}
+
+// NewLogout returns the page the end_session endpoint redirects to after the session was ended.
+// It clears the session cookie and signs the user out of the clients by loading their
+// front-channel logout uris in iframes before redirecting to the post_logout_redirect_uri.
+func NewLogout(storage Logout, sessions *SessionCookie, issuerInterceptor *op.IssuerInterceptor) http.Handler {
+	l := &logout{
+		storage:  storage,
+		sessions: sessions,
+	}
+	return issuerInterceptor.HandlerFunc(l.logoutHandler)
+}
+
+func (l *logout) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	l.sessions.Clear(w, r)
+
+	var (
+		frames      []string
+		redirectURI string
+	)
+	if id := r.URL.Query().Get("logoutID"); id != "" {
+		var err error
+		frames, redirectURI, err = l.storage.FrontChannelLogout(r.Context(), id)
+		if err != nil {
+			slog.Error("could not load front-channel logout", "error", err)
+		}
+	}
+	// the default post logout redirect uri points to this page, there is no need to reload it
+	if redirectURI == basePath(r)+r.URL.Path {
+		redirectURI = ""
+	}
+	data := &struct {
+		Frames      []string
+		RedirectURI string
+	}{
+		Frames:      frames,
+		RedirectURI: redirectURI,
+	}
+	if err := render(w, pageOf(r, "", nil, ""), "logout", data); err != nil {
+		slog.Error("could not logout render template", "error", err)
+	}
+}
@@ -0,0 +1,77 @@
+package handle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zitadel/oidc/v3/pkg/op"
+)
+
+type logoutStub map[string][]string
+
+func (s logoutStub) FrontChannelLogout(_ context.Context, id string) ([]string, string, error) {
+	frames, ok := s[id]
+	if !ok {
+		return nil, "", errors.New("logout not found")
+	}
+	return frames, "https://web.test/bye", nil
+}
+
+func TestLogoutHandler(t *testing.T) {
+	l := &logout{
+		storage: logoutStub{
+			"id": {"https://web.test/logout?iss=https%3A%2F%2Fkim.test%2Frealm&sid=sid"},
+		},
+		sessions: NewSessionCookie([]byte("secret"), time.Hour),
+	}
+	for _, tc := range []struct {
+		name     string
+		query    string
+		contains []string
+		excludes []string
+	}{
+		{
+			name:  "frames",
+			query: "?logoutID=id",
+			contains: []string{
+				`<iframe src="https://web.test/logout?iss=https%3A%2F%2Fkim.test%2Frealm&amp;sid=sid"`,
+				`window.location.replace("https://web.test/bye")`,
+			},
+		},
+		{
+			name:     "unknown",
+			query:    "?logoutID=other",
+			excludes: []string{"<iframe", "window.location.replace"},
+		},
+		{
+			name:     "none",
+			excludes: []string{"<iframe", "window.location.replace"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/logout"+tc.query, nil)
+			r = r.WithContext(op.ContextWithIssuer(r.Context(), "https://kim.test/realm"))
+			w := httptest.NewRecorder()
+			l.logoutHandler(w, r)
+			body := w.Body.String()
+			for _, s := range tc.contains {
+				if !strings.Contains(body, s) {
+					t.Errorf("page does not contain %s:\n%s", s, body)
+				}
+			}
+			for _, s := range tc.excludes {
+				if strings.Contains(body, s) {
+					t.Errorf("page contains %s:\n%s", s, body)
+				}
+			}
+			if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+				t.Errorf("session cookie not cleared: %v", cookies)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package handle
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var errPasswordMismatch = errors.New("the passwords do not match")
+
+type Recovery interface {
+	// RequestPasswordReset sends a password reset link to the email address of the user
+	RequestPasswordReset(ctx context.Context, username string) error
+	// ResetPassword sets the password of the user of the reset link token
+	ResetPassword(ctx context.Context, token, password string) error
+	// RequestEmailVerification sends a verification link to the email address of the user
+	RequestEmailVerification(ctx context.Context, username string) error
+	// VerifyEmail marks the email address of the user of the verification link token as verified
+	VerifyEmail(ctx context.Context, token string) error
+}
+
+type recovery struct {
+	storage Recovery
+}
+
+// NewRecovery returns the self-service pages to reset a forgotten password and to verify the email address,
+// the links sent to the users point to the issuer configured by the storage, never to the host of the request
+func NewRecovery(storage Recovery) chi.Router {
+	rc := &recovery{storage: storage}
+	r := chi.NewRouter()
+	r.Get("/password", rc.passwordHandler)
+	r.Post("/password", rc.requestPasswordHandler)
+	r.Get("/password/reset", rc.resetHandler)
+	r.Post("/password/reset", rc.checkResetHandler)
+	r.Get("/email", rc.emailHandler)
+	r.Post("/email", rc.requestEmailHandler)
+	r.Get("/email/verify", rc.verifyHandler)
+	return r
+}
+
+// the request pages share a template, the action is the path the form is posted to
+func renderRecoveryRequest(w http.ResponseWriter, p page, title, action string, err error) {
+	data := &struct {
+		Title  string
+		Action string
+		Error  string
+	}{
+		Title:  p.T(title),
+		Action: action,
+		Error:  errMsg(p, err),
+	}
+	if err = render(w, p, "recovery_request", data); err != nil {
+		slog.Error("could not recovery_request render template", "error", err)
+	}
+}
+
+func renderResetPassword(w http.ResponseWriter, p page, token string, err error) {
+	data := &struct {
+		Token string
+		Error string
+	}{
+		Token: token,
+		Error: errMsg(p, err),
+	}
+	if err = render(w, p, "reset_password", data); err != nil {
+		slog.Error("could not reset_password render template", "error", err)
+	}
+}
+
+func renderRecoveryMessage(w http.ResponseWriter, p page, message string) {
+	data := &struct {
+		Message string
+	}{
+		Message: message,
+	}
+	if err := render(w, p, "recovery_message", data); err != nil {
+		slog.Error("could not recovery_message render template", "error", err)
+	}
+}
+
+func (rc *recovery) passwordHandler(w http.ResponseWriter, r *http.Request) {
+	renderRecoveryRequest(w, pageOf(r, "", nil, ""), "recovery.password_title", "/recovery/password", nil)
+}
+
+func (rc *recovery) requestPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	p := pageOf(r, "", nil, "")
+	if err := rc.storage.RequestPasswordReset(r.Context(), r.FormValue("username")); err != nil {
+		renderRecoveryRequest(w, p, "recovery.password_title", "/recovery/password", err)
+		return
+	}
+	// the same answer for unknown users, so that the page can not be used to probe for users
+	renderRecoveryMessage(w, p, p.T("recovery.password_sent"))
+}
+
+func (rc *recovery) resetHandler(w http.ResponseWriter, r *http.Request) {
+	renderResetPassword(w, pageOf(r, "", nil, ""), r.URL.Query().Get("token"), nil)
+}
+
+func (rc *recovery) checkResetHandler(w http.ResponseWriter, r *http.Request) {
+	p := pageOf(r, "", nil, "")
+	token := r.FormValue("token")
+	password := r.FormValue("password")
+	if password != r.FormValue("confirm") {
+		renderResetPassword(w, p, token, errPasswordMismatch)
+		return
+	}
+	if err := rc.storage.ResetPassword(r.Context(), token, password); err != nil {
+		renderResetPassword(w, p, token, err)
+		return
+	}
+	renderRecoveryMessage(w, p, p.T("recovery.password_changed"))
+}
+
+func (rc *recovery) emailHandler(w http.ResponseWriter, r *http.Request) {
+	renderRecoveryRequest(w, pageOf(r, "", nil, ""), "recovery.email_title", "/recovery/email", nil)
+}
+
+func (rc *recovery) requestEmailHandler(w http.ResponseWriter, r *http.Request) {
+	p := pageOf(r, "", nil, "")
+	if err := rc.storage.RequestEmailVerification(r.Context(), r.FormValue("username")); err != nil {
+		renderRecoveryRequest(w, p, "recovery.email_title", "/recovery/email", err)
+		return
+	}
+	renderRecoveryMessage(w, p, p.T("recovery.email_sent"))
+}
+
+func (rc *recovery) verifyHandler(w http.ResponseWriter, r *http.Request) {
+	p := pageOf(r, "", nil, "")
+	if err := rc.storage.VerifyEmail(r.Context(), r.URL.Query().Get("token")); err != nil {
+		renderRecoveryMessage(w, p, errMsg(p, err))
+		return
+	}
+	renderRecoveryMessage(w, p, p.T("recovery.email_verified"))
+}
@@ -0,0 +1,120 @@
+package handle
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+const sessionCookieName = "kim_session"
+
+// SessionCookie keeps the id of the single sign-on session in a signed and encrypted browser cookie
+type SessionCookie struct {
+	codec   *securecookie.SecureCookie
+	maxAge  time.Duration
+	csrfKey []byte
+	name    string
+	path    string
+}
+
+// NewSessionCookie derives the cookie keys from secret. If secret is empty a random key is used, which invalidates
+// the sessions on every restart. The sessions the cookie refers to are kept in the memory of the replica that
+// created them, so a shared secret alone does not make single sign-on work across replicas: it needs a single
+// replica or sticky sessions.
+func NewSessionCookie(secret []byte, maxAge time.Duration) *SessionCookie {
+	if len(secret) == 0 {
+		secret = securecookie.GenerateRandomKey(64)
+	}
+	keys := sha512.Sum512(secret)
+	codec := securecookie.New(keys[:32], keys[32:])
+	codec.MaxAge(int(maxAge.Seconds()))
+	csrfKey := sha256.Sum256(append([]byte("kim-csrf:"), secret...))
+	return &SessionCookie{
+		codec:   codec,
+		maxAge:  maxAge,
+		csrfKey: csrfKey[:],
+		name:    sessionCookieName,
+		path:    "/",
+	}
+}
+
+// WithScope returns the cookie of an issuer sharing the host with other issuers, the cookie name
+// keeps the sessions of the issuers apart and the path limits the cookie to the issuer
+func (c *SessionCookie) WithScope(name, path string) *SessionCookie {
+	scoped := *c
+	scoped.name = sessionCookieName + "_" + name
+	scoped.path = path
+	return &scoped
+}
+
+// Get returns the session id of the request or an empty string if there is no valid session cookie
+func (c *SessionCookie) Get(r *http.Request) string {
+	cookie, err := r.Cookie(c.name)
+	if err != nil {
+		return ""
+	}
+	var sessionID string
+	if err = c.codec.Decode(c.name, cookie.Value, &sessionID); err != nil {
+		return ""
+	}
+	return sessionID
+}
+
+// Set stores the session id in the cookie
+func (c *SessionCookie) Set(w http.ResponseWriter, r *http.Request, sessionID string) error {
+	encoded, err := c.codec.Encode(c.name, sessionID)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, c.cookie(r, encoded, int(c.maxAge.Seconds())))
+	return nil
+}
+
+// cookie returns the session cookie, the attributes of setting and clearing it must match
+func (c *SessionCookie) cookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     c.name,
+		Value:    value,
+		Path:     c.path,
+		MaxAge:   maxAge,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// CSRFToken returns the token the forms of the session must post, so that other sites can not submit them
+func (c *SessionCookie) CSRFToken(sessionID string) string {
+	mac := hmac.New(sha256.New, c.csrfKey)
+	mac.Write([]byte(sessionID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ValidCSRF reports whether the request posted the token of the session
+func (c *SessionCookie) ValidCSRF(r *http.Request, sessionID string) bool {
+	return hmac.Equal([]byte(r.PostFormValue("csrf")), []byte(c.CSRFToken(sessionID)))
+}
+
+// Clear removes the session cookie
+func (c *SessionCookie) Clear(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, c.cookie(r, "", -1))
+}
+
+// Middleware passes the session id of the cookie to the request context by the withSession function,
+// so that endpoints of the OP (e.g. end_session) can find the single sign-on session of the browser
+func (c *SessionCookie) Middleware(withSession func(context.Context, string) context.Context) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if sessionID := c.Get(r); sessionID != "" {
+				r = r.WithContext(withSession(r.Context(), sessionID))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
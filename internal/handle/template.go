@@ -3,24 +3,110 @@ package handle
 import (
 	"embed"
 	"html/template"
+	"io"
 	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/zitadel/oidc/v3/pkg/op"
+	"golang.org/x/text/language"
+
+	"github.com/crochee/kim/internal/i18n"
+	"github.com/crochee/kim/internal/theme"
 )
 
 var (
-	//go:embed ./templates
+	//go:embed templates
 	templateFS embed.FS
-	templates  = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+	// the functions are replaced by the ones of the page of the request, see render
+	templates = template.Must(template.New("").Funcs(template.FuncMap{
+		"t":      (*i18n.Localizer)(nil).T,
+		"lang":   (*i18n.Localizer)(nil).Tag().String,
+		"static": page{}.static,
+		"base":   page{}.basePath,
+	}).ParseFS(templateFS, "templates/*.html"))
 )
 
 const (
 	queryAuthRequestID = "authRequestID"
 )
 
-func errMsg(err error) string {
+// page is the language and the theme a page is rendered in, base is the path of the issuer the links
+// of the page are relative to
+type page struct {
+	*i18n.Localizer
+	theme string
+	base  string
+}
+
+// static returns the url of the static asset of the theme
+func (p page) static(file string) string {
+	name := p.theme
+	if name == "" {
+		name = theme.Default
+	}
+	return p.base + "/static/" + name + "/" + file
+}
+
+func (p page) basePath() string {
+	return p.base
+}
+
+// render executes the template of the theme of the page in its language
+func render(w io.Writer, p page, name string, data any) error {
+	t, err := themes.templates(p.theme).Clone()
+	if err != nil {
+		return err
+	}
+	return t.Funcs(template.FuncMap{
+		"t":      p.T,
+		"lang":   p.Tag().String,
+		"static": p.static,
+		"base":   p.basePath,
+	}).ExecuteTemplate(w, name, data)
+}
+
+// pageOf returns the page of the request in the theme, the ui_locales of the auth request take precedence over
+// the locale of the user, which takes precedence over the Accept-Language header
+func pageOf(r *http.Request, theme string, uiLocales []language.Tag, userLocale string) page {
+	return page{
+		Localizer: i18n.Match(uiLocales, userLocale, r.Header.Get("Accept-Language")),
+		theme:     theme,
+		base:      basePath(r),
+	}
+}
+
+// basePath returns the path of the issuer of the request without the trailing slash, the issuers of realms
+// sharing a host are told apart by it
+func basePath(r *http.Request) string {
+	issuer, err := url.Parse(op.IssuerFromContext(r.Context()))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(issuer.Path, "/")
+}
+
+// uiLocales returns the ui_locales parameter of the auth request
+func uiLocales(authReq op.AuthRequest) []language.Tag {
+	if locales, ok := authReq.(interface{ GetUILocales() []language.Tag }); ok {
+		return locales.GetUILocales()
+	}
+	return nil
+}
+
+// clientTheme returns the theme of the client, clients without a theme use the default one
+func clientTheme(client op.Client) string {
+	if themed, ok := client.(interface{ Theme() string }); ok {
+		return themed.Theme()
+	}
+	return ""
+}
+
+func errMsg(p page, err error) string {
 	if err == nil {
 		return ""
 	}
-	errMsg := err.Error()
-	slog.Error(errMsg)
-	return errMsg
+	slog.Error(err.Error())
+	return p.Error(err)
 }
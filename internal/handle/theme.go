@@ -0,0 +1,138 @@
+package handle
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crochee/kim/internal/theme"
+)
+
+var (
+	//go:embed static
+	staticFS embed.FS
+	// started is the modification time of the embedded assets
+	started = time.Now()
+
+	// themes are the page templates and static assets of the loaded themes
+	themes = &themeSet{}
+)
+
+type parsedTheme struct {
+	templates *template.Template
+	static    map[string][]byte
+}
+
+type themeSet struct {
+	mu       sync.RWMutex
+	themes   map[string]*parsedTheme
+	modified time.Time
+}
+
+// LoadThemes replaces the themes of the pages. The templates of the default theme redefine the embedded pages,
+// the templates of the other themes redefine the ones of the default theme. Nothing is replaced if a template
+// does not parse, so a broken change keeps the pages working.
+func LoadThemes(files map[string]*theme.Files) error {
+	parsed := make(map[string]*parsedTheme, len(files))
+	base := &parsedTheme{templates: templates}
+	if defaults, ok := files[theme.Default]; ok {
+		var err error
+		if base, err = parseTheme(templates, theme.Default, defaults); err != nil {
+			return err
+		}
+	}
+	parsed[theme.Default] = base
+	for name, themeFiles := range files {
+		if name == theme.Default {
+			continue
+		}
+		p, err := parseTheme(base.templates, name, themeFiles)
+		if err != nil {
+			return err
+		}
+		parsed[name] = p
+	}
+	themes.mu.Lock()
+	defer themes.mu.Unlock()
+	themes.themes = parsed
+	themes.modified = time.Now()
+	return nil
+}
+
+func parseTheme(base *template.Template, name string, files *theme.Files) (*parsedTheme, error) {
+	t, err := base.Clone()
+	if err != nil {
+		return nil, err
+	}
+	for file, text := range files.Templates {
+		if _, err = t.New(file).Parse(text); err != nil {
+			return nil, fmt.Errorf("theme %s: %w", name, err)
+		}
+	}
+	return &parsedTheme{templates: t, static: files.Static}, nil
+}
+
+// get returns the theme of the name, unknown themes fall back to the default theme
+func (s *themeSet) get(name string) *parsedTheme {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if p, ok := s.themes[name]; ok {
+		return p
+	}
+	return s.themes[theme.Default]
+}
+
+// templates returns the templates of the theme, the embedded ones if no themes are loaded
+func (s *themeSet) templates(name string) *template.Template {
+	if p := s.get(name); p != nil {
+		return p.templates
+	}
+	return templates
+}
+
+// asset returns the static asset of the theme, assets missing in a theme are taken from the default theme
+// and then from the embedded assets
+func (s *themeSet) asset(name, file string) ([]byte, time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, candidate := range []string{name, theme.Default} {
+		if p, ok := s.themes[candidate]; ok {
+			if data, ok := p.static[file]; ok {
+				return data, s.modified, true
+			}
+		}
+	}
+	data, err := fs.ReadFile(staticFS, path.Join("static", file))
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	return data, started, true
+}
+
+// StaticHandler serves the static assets of the themes at /<theme>/<file>
+func StaticHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, file, ok := strings.Cut(strings.TrimPrefix(path.Clean(r.URL.Path), "/"), "/")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		data, modified, ok := themes.asset(name, file)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if contentType := mime.TypeByExtension(path.Ext(file)); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		http.ServeContent(w, r, file, modified, bytes.NewReader(data))
+	})
+}
@@ -0,0 +1,131 @@
+// Package i18n translates the pages and mails of the OP.
+//
+// The catalogs are embedded json files mapping the message keys to their translation. The texts of the pages have
+// stable keys (e.g. "login.username"), the errors shown to the users are looked up by their English text, so that
+// the storage keeps returning plain errors. Missing translations fall back to English and then to the key itself.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+var (
+	//go:embed locales/*.json
+	localeFS embed.FS
+
+	// Supported are the languages of the catalogs, the first one is the default
+	Supported = []language.Tag{language.English, language.Chinese}
+
+	catalogs = mustLoad()
+	matcher  = language.NewMatcher(Supported)
+)
+
+// Message is implemented by errors with parameters, the format is the key of the catalogs
+type Message interface {
+	Message() (format string, args []any)
+}
+
+type catalog map[string]string
+
+func mustLoad() map[language.Tag]catalog {
+	loaded := make(map[language.Tag]catalog, len(Supported))
+	for _, tag := range Supported {
+		data, err := localeFS.ReadFile(path.Join("locales", tag.String()+".json"))
+		if err != nil {
+			panic(err)
+		}
+		messages := catalog{}
+		if err = json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Errorf("locale %s: %w", tag, err))
+		}
+		loaded[tag] = messages
+	}
+	return loaded
+}
+
+// Localizer translates the messages to a supported language
+type Localizer struct {
+	tag language.Tag
+}
+
+// New returns the localizer of the supported language closest to the tag
+func New(tag language.Tag) *Localizer {
+	_, index, _ := matcher.Match(tag)
+	return &Localizer{tag: Supported[index]}
+}
+
+// Match returns the localizer of the first source naming a supported language, the sources are tried in order:
+// the ui_locales of the authorization request, the locale claim of the user and the Accept-Language header.
+// The default language is used if none of them matches.
+func Match(uiLocales []language.Tag, userLocale, acceptLanguage string) *Localizer {
+	if tag, ok := match(uiLocales...); ok {
+		return &Localizer{tag: tag}
+	}
+	// the locale claim is a BCP47 tag, though some use the underscore form of POSIX (e.g. zh_CN)
+	if userLocale != "" {
+		if parsed, err := language.Parse(strings.ReplaceAll(userLocale, "_", "-")); err == nil {
+			if tag, ok := match(parsed); ok {
+				return &Localizer{tag: tag}
+			}
+		}
+	}
+	if tags, _, err := language.ParseAcceptLanguage(acceptLanguage); err == nil {
+		if tag, ok := match(tags...); ok {
+			return &Localizer{tag: tag}
+		}
+	}
+	return &Localizer{tag: Supported[0]}
+}
+
+func match(tags ...language.Tag) (language.Tag, bool) {
+	if len(tags) == 0 {
+		return language.Und, false
+	}
+	_, index, confidence := matcher.Match(tags...)
+	if confidence == language.No {
+		return language.Und, false
+	}
+	return Supported[index], true
+}
+
+// Tag returns the language of the localizer, a nil Localizer uses the default language
+func (l *Localizer) Tag() language.Tag {
+	if l == nil {
+		return Supported[0]
+	}
+	return l.tag
+}
+
+// T returns the translation of the key formatted with the args
+func (l *Localizer) T(key string, args ...any) string {
+	format, ok := catalogs[l.Tag()][key]
+	if !ok {
+		if format, ok = catalogs[Supported[0]][key]; !ok {
+			format = key
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Error returns the translation of the error, errors without translation keep their text
+func (l *Localizer) Error(err error) string {
+	if err == nil {
+		return ""
+	}
+	var message Message
+	if errors.As(err, &message) {
+		format, args := message.Message()
+		return l.T(format, args...)
+	}
+	return l.T(err.Error())
+}
@@ -0,0 +1,71 @@
+package i18n
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		uiLocales      []language.Tag
+		userLocale     string
+		acceptLanguage string
+		want           language.Tag
+	}{
+		{name: "default", want: language.English},
+		{name: "ui_locales", uiLocales: []language.Tag{language.SimplifiedChinese}, userLocale: "en", want: language.Chinese},
+		{name: "unsupported ui_locales", uiLocales: []language.Tag{language.German}, userLocale: "zh_CN", want: language.Chinese},
+		{name: "user locale", userLocale: "zh-TW", acceptLanguage: "en", want: language.Chinese},
+		{name: "accept language", acceptLanguage: "fr;q=0.9, zh-CN;q=0.8", want: language.Chinese},
+		{name: "invalid accept language", acceptLanguage: ";;", want: language.English},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Match(tt.uiLocales, tt.userLocale, tt.acceptLanguage).Tag(); got != tt.want {
+				t.Errorf("Match() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+type lockedError struct{}
+
+func (lockedError) Error() string { return "too many failed attempts, try again in 1m0s" }
+
+func (lockedError) Message() (string, []any) {
+	return "too many failed attempts, try again in %s", []any{time.Minute}
+}
+
+func TestLocalizer(t *testing.T) {
+	zh := New(language.Chinese)
+	if got := zh.T("device.welcome", "alice"); got != "欢迎回来，alice！" {
+		t.Errorf("T() = %q", got)
+	}
+	if got := zh.Error(errors.New("username or password wrong")); got != "用户名或密码错误" {
+		t.Errorf("Error() = %q", got)
+	}
+	if got := zh.Error(lockedError{}); got != "失败次数过多，请在 1m0s 后重试" {
+		t.Errorf("Error() = %q", got)
+	}
+	if got := zh.Error(errors.New("untranslated")); got != "untranslated" {
+		t.Errorf("Error() = %q", got)
+	}
+	if got := (*Localizer)(nil).T("login.submit"); got != "Login" {
+		t.Errorf("T() = %q", got)
+	}
+}
+
+func TestCatalogs(t *testing.T) {
+	// every page text has a translation in every language
+	for key := range catalogs[Supported[0]] {
+		for _, tag := range Supported[1:] {
+			if _, ok := catalogs[tag][key]; !ok {
+				t.Errorf("%s: missing %q", tag, key)
+			}
+		}
+	}
+}
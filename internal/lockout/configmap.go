@@ -0,0 +1,209 @@
+package lockout
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const (
+	// StoreLabel marks the ConfigMaps keeping the lockout states
+	StoreLabel = "kim.kim.io/lockout"
+
+	// shards is the number of ConfigMaps the states are spread over
+	shards = 16
+	// maxShardEntries bounds the states of a ConfigMap far below the size limit of the objects, so that failed
+	// logins with made up login names and source addresses can not grow the store without limit
+	maxShardEntries = 2048
+)
+
+// ConfigMapStore keeps the states in a fixed number of ConfigMaps of the namespace, so that all replicas of the
+// server share them; concurrent updates are resolved by the optimistic concurrency of the api server.
+// Once a ConfigMap is full, the states which are not locked are evicted first, the oldest failures first.
+type ConfigMapStore struct {
+	client    client.Client
+	namespace string
+}
+
+// NewConfigMapStore returns a store in the namespace, the client should not be cached
+// as the states are read right before they are updated
+func NewConfigMapStore(c client.Client, namespace string) *ConfigMapStore {
+	return &ConfigMapStore{client: c, namespace: namespace}
+}
+
+func (s *ConfigMapStore) Get(ctx context.Context, key string) (State, error) {
+	var state State
+	name, entry := s.location(key)
+	cm := &corev1.ConfigMap{}
+	if err := s.client.Get(ctx, name, cm); err != nil {
+		return state, client.IgnoreNotFound(err)
+	}
+	raw, ok := cm.Data[entry]
+	if !ok {
+		return state, nil
+	}
+	err := json.Unmarshal([]byte(raw), &state)
+	return state, err
+}
+
+func (s *ConfigMapStore) Update(ctx context.Context, key string, fn func(*State)) (State, error) {
+	var state State
+	name, entry := s.location(key)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		state = State{}
+		cm := &corev1.ConfigMap{}
+		err := s.client.Get(ctx, name, cm)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		exists := err == nil
+		if raw, ok := cm.Data[entry]; ok {
+			if err = json.Unmarshal([]byte(raw), &state); err != nil {
+				return err
+			}
+		}
+		fn(&state)
+		data, err := json.Marshal(&state)
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[entry] = string(data)
+		evict(cm.Data, entry, time.Now())
+		if exists {
+			return s.client.Update(ctx, cm)
+		}
+		cm.ObjectMeta = metav1.ObjectMeta{
+			Name:      name.Name,
+			Namespace: name.Namespace,
+			Labels:    map[string]string{StoreLabel: "true"},
+		}
+		err = s.client.Create(ctx, cm)
+		if apierrors.IsAlreadyExists(err) {
+			// another replica created it in the meantime, read it again
+			return apierrors.NewConflict(corev1.Resource("configmaps"), cm.Name, err)
+		}
+		return err
+	})
+	return state, err
+}
+
+func (s *ConfigMapStore) Delete(ctx context.Context, key string) error {
+	name, entry := s.location(key)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm := &corev1.ConfigMap{}
+		if err := s.client.Get(ctx, name, cm); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if _, ok := cm.Data[entry]; !ok {
+			return nil
+		}
+		delete(cm.Data, entry)
+		return s.client.Update(ctx, cm)
+	})
+}
+
+// Pruner implements Prunable
+func (s *ConfigMapStore) Pruner(retention time.Duration) manager.RunnableFunc {
+	return pruner(retention, s.prune)
+}
+
+func (s *ConfigMapStore) prune(ctx context.Context, retention time.Duration) error {
+	list := &corev1.ConfigMapList{}
+	if err := s.client.List(ctx, list, client.InNamespace(s.namespace), client.MatchingLabels{StoreLabel: "true"}); err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range list.Items {
+		cm := &list.Items[i]
+		if !isShard(cm.Name) {
+			// a ConfigMap of a single key of former versions
+			if err := client.IgnoreNotFound(s.client.Delete(ctx, cm)); err != nil {
+				return err
+			}
+			continue
+		}
+		pruned := false
+		for entry, raw := range cm.Data {
+			var state State
+			if err := json.Unmarshal([]byte(raw), &state); err == nil && !state.outdated(now, retention) {
+				continue
+			}
+			delete(cm.Data, entry)
+			pruned = true
+		}
+		if !pruned {
+			continue
+		}
+		// a conflicting update of a login is more recent, the states are pruned at the next tick
+		if err := s.client.Update(ctx, cm); err != nil && !apierrors.IsConflict(err) && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// location returns the ConfigMap and the entry of the state of the key, the key is hashed
+// as source addresses and login names are no valid object names or data keys
+func (s *ConfigMapStore) location(key string) (types.NamespacedName, string) {
+	sum := sha256.Sum256([]byte(key))
+	return types.NamespacedName{
+		Namespace: s.namespace,
+		Name:      shardName(int(sum[0]) % shards),
+	}, hex.EncodeToString(sum[:16])
+}
+
+func shardName(shard int) string {
+	return fmt.Sprintf("kim-lockout-%02x", shard)
+}
+
+func isShard(name string) bool {
+	for shard := range shards {
+		if name == shardName(shard) {
+			return true
+		}
+	}
+	return false
+}
+
+// evict removes states from the data until at most maxShardEntries are left; the states which are not locked
+// are removed before the locked ones, the oldest failures first, and the entry of the updated state is kept
+func evict(data map[string]string, keep string, now time.Time) {
+	if len(data) <= maxShardEntries {
+		return
+	}
+	type candidate struct {
+		entry string
+		state State
+	}
+	candidates := make([]candidate, 0, len(data))
+	for entry, raw := range data {
+		if entry == keep {
+			continue
+		}
+		var state State
+		// unreadable states are evicted first
+		_ = json.Unmarshal([]byte(raw), &state)
+		candidates = append(candidates, candidate{entry: entry, state: state})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return evictFirst(candidates[i].state, candidates[j].state, now)
+	})
+	for _, c := range candidates[:len(data)-maxShardEntries] {
+		delete(data, c.entry)
+	}
+}
@@ -0,0 +1,82 @@
+package lockout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestConfigMapStore(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	s := NewConfigMapStore(c, "kim-system")
+	ctx := context.Background()
+
+	// made up login names do not create an object each
+	for i := range 100 {
+		if _, err := s.Update(ctx, UsernameKey(fmt.Sprintf("nobody-%d", i)), func(state *State) {
+			state.Failures++
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := &corev1.ConfigMapList{}
+	if err := c.List(ctx, list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) > shards {
+		t.Errorf("the store has %d ConfigMaps, want at most %d", len(list.Items), shards)
+	}
+
+	key := UserKey("default", "alice")
+	for range 2 {
+		if _, err := s.Update(ctx, key, func(state *State) { state.Failures++ }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if state, err := s.Get(ctx, key); err != nil || state.Failures != 2 {
+		t.Errorf("Get() = %+v, %v, want 2 failures", state, err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := s.Get(ctx, key); err != nil || state.Failures != 0 {
+		t.Errorf("Get() after Delete() = %+v, %v", state, err)
+	}
+}
+
+func TestEvict(t *testing.T) {
+	now := time.Now()
+	data := map[string]string{}
+	set := func(entry string, state State) {
+		raw, _ := json.Marshal(&state)
+		data[entry] = string(raw)
+	}
+	set("locked", State{Failures: 5, LastFailure: now.Add(-time.Hour), LockedUntil: now.Add(time.Hour)})
+	set("updated", State{Failures: 1, LastFailure: now.Add(-2 * time.Hour)})
+	for i := range maxShardEntries {
+		set(fmt.Sprintf("entry-%d", i), State{Failures: 1, LastFailure: now.Add(-time.Duration(i) * time.Second)})
+	}
+
+	evict(data, "updated", now)
+	if len(data) != maxShardEntries {
+		t.Errorf("evict() left %d entries, want %d", len(data), maxShardEntries)
+	}
+	for _, entry := range []string{"locked", "updated", "entry-0"} {
+		if _, ok := data[entry]; !ok {
+			t.Errorf("evict() removed %s", entry)
+		}
+	}
+	if _, ok := data[fmt.Sprintf("entry-%d", maxShardEntries-1)]; ok {
+		t.Error("evict() kept the oldest failure")
+	}
+}
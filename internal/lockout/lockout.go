@@ -0,0 +1,267 @@
+// Package lockout protects the password and user code entry against brute-force attacks.
+// Failed attempts are counted per key (user, source address, device user code); once a key
+// exceeds the allowed failures it is locked with an exponentially growing delay.
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// pendingTimeout forgets the reserved attempts of a key after the period, e.g. of a replica which crashed
+// while verifying them
+const pendingTimeout = time.Minute
+
+// State is the failure tracking of a key
+type State struct {
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure"`
+	LockedUntil time.Time `json:"lockedUntil,omitempty"`
+	// Pending is the number of reserved attempts which are still verified
+	Pending int `json:"pending,omitempty"`
+	// LastAttempt is the time of the latest reserved attempt
+	LastAttempt time.Time `json:"lastAttempt,omitempty"`
+}
+
+// Locked reports whether the key is locked at the time
+func (s *State) Locked(now time.Time) bool {
+	return now.Before(s.LockedUntil)
+}
+
+// pending returns the reserved attempts which did not time out
+func (s *State) pending(now time.Time) int {
+	if now.Sub(s.LastAttempt) > pendingTimeout {
+		return 0
+	}
+	return s.Pending
+}
+
+// outdated reports whether the state can be forgotten, it is neither locked nor has attempts in progress or
+// a failure within the retention
+func (s *State) outdated(now time.Time, retention time.Duration) bool {
+	return !s.Locked(now) && s.pending(now) == 0 && now.Sub(s.LastFailure) >= retention
+}
+
+// evictFirst reports whether the state a is evicted before the state b once a store is full,
+// the states which are not locked before the locked ones, the oldest failures first
+func evictFirst(a, b State, now time.Time) bool {
+	if a.Locked(now) != b.Locked(now) {
+		return !a.Locked(now)
+	}
+	return a.LastFailure.Before(b.LastFailure)
+}
+
+// Store keeps the states of the keys, it must be shared by all replicas of the server
+type Store interface {
+	Get(ctx context.Context, key string) (State, error)
+	// Update applies fn to the state of the key atomically and returns the new state
+	Update(ctx context.Context, key string, fn func(*State)) (State, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Prunable is implemented by the stores which forget the outdated states periodically
+type Prunable interface {
+	// Pruner returns a runnable of the manager, which periodically removes the states
+	// that are neither locked nor had a failure within the retention
+	Pruner(retention time.Duration) manager.RunnableFunc
+}
+
+// pruner returns a runnable calling prune at every period of the retention
+func pruner(retention time.Duration, prune func(ctx context.Context, retention time.Duration) error) manager.RunnableFunc {
+	return func(ctx context.Context) error {
+		log := logf.FromContext(ctx).WithName("lockout")
+		ticker := time.NewTicker(retention)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				if err := prune(ctx, retention); err != nil {
+					log.Error(err, "could not prune lockout states")
+				}
+			}
+		}
+	}
+}
+
+// Policy configures when and how long a key is locked
+type Policy struct {
+	// MaxFailures is the number of consecutive failures locking the key
+	MaxFailures int
+	// BaseDelay is the lock duration after MaxFailures failures, it doubles with every further failure
+	BaseDelay time.Duration
+	// MaxDelay caps the lock duration
+	MaxDelay time.Duration
+	// ResetAfter forgets the failures of a key after the period without failures
+	ResetAfter time.Duration
+}
+
+// delay returns the lock duration after the number of consecutive failures
+func (p *Policy) delay(failures int) time.Duration {
+	exceeded := failures - p.MaxFailures + 1
+	if exceeded <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 1; i < exceeded && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// LockedError is returned for attempts on a locked key
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	format, args := e.Message()
+	return fmt.Sprintf(format, args...)
+}
+
+// Message returns the format and arguments of the error, so that the pages can translate it
+func (e *LockedError) Message() (string, []any) {
+	return "too many failed attempts, try again in %s", []any{time.Until(e.Until).Round(time.Second)}
+}
+
+// Guard tracks the failures of keys by a policy
+// all methods of a nil Guard are no-ops, so the protection can be disabled
+type Guard struct {
+	store  Store
+	policy Policy
+}
+
+func NewGuard(store Store, policy Policy) *Guard {
+	return &Guard{store: store, policy: policy}
+}
+
+// Check returns a *LockedError if any of the keys is locked, empty keys are ignored
+func (g *Guard) Check(ctx context.Context, keys ...string) error {
+	if g == nil {
+		return nil
+	}
+	now := time.Now()
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		state, err := g.store.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		if state.Locked(now) {
+			return &LockedError{Until: state.LockedUntil}
+		}
+	}
+	return nil
+}
+
+// Reserve checks the key like Check and reserves an attempt of it atomically, so that parallel attempts can not
+// exceed the policy before their failures are recorded; the attempts in progress count as failures until they
+// end by Fail, Release or Reset. Empty keys are ignored.
+func (g *Guard) Reserve(ctx context.Context, key string) error {
+	if g == nil || key == "" {
+		return nil
+	}
+	now := time.Now()
+	var locked *LockedError
+	_, err := g.store.Update(ctx, key, func(state *State) {
+		locked = nil
+		g.expire(state, now)
+		switch {
+		case state.Locked(now):
+			locked = &LockedError{Until: state.LockedUntil}
+		case state.Pending > 0 && state.Failures+state.Pending >= g.policy.MaxFailures:
+			// the attempts in progress may already exceed the policy, the next attempt waits for them
+			locked = &LockedError{Until: now.Add(time.Second)}
+		default:
+			state.Pending++
+			state.LastAttempt = now
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if locked != nil {
+		return locked
+	}
+	return nil
+}
+
+// Release ends a reserved attempt of the key which neither failed nor succeeded, e.g. as the user could not be
+// looked up, empty keys are ignored
+func (g *Guard) Release(ctx context.Context, key string) error {
+	if g == nil || key == "" {
+		return nil
+	}
+	now := time.Now()
+	_, err := g.store.Update(ctx, key, func(state *State) {
+		state.Pending = max(state.pending(now)-1, 0)
+	})
+	return err
+}
+
+// Fail records a failed attempt of the key and locks it if the policy is exceeded, it ends a reserved attempt
+// of the key; empty keys are ignored
+func (g *Guard) Fail(ctx context.Context, key string) (State, error) {
+	if g == nil || key == "" {
+		return State{}, nil
+	}
+	now := time.Now()
+	return g.store.Update(ctx, key, func(state *State) {
+		g.expire(state, now)
+		state.Pending = max(state.Pending-1, 0)
+		state.Failures++
+		state.LastFailure = now
+		if delay := g.policy.delay(state.Failures); delay > 0 {
+			state.LockedUntil = now.Add(delay)
+		}
+	})
+}
+
+// expire forgets the failures after the ResetAfter period of the policy and the reserved attempts which timed out
+func (g *Guard) expire(state *State, now time.Time) {
+	if g.policy.ResetAfter > 0 && now.Sub(state.LastFailure) > g.policy.ResetAfter && !state.Locked(now) {
+		state.Failures = 0
+	}
+	state.Pending = state.pending(now)
+}
+
+// Reset forgets the failures and the reserved attempts of the key, e.g. after a successful attempt or an unlock
+// by an admin
+func (g *Guard) Reset(ctx context.Context, key string) error {
+	if g == nil {
+		return nil
+	}
+	return g.store.Delete(ctx, key)
+}
+
+// Exceeded reports whether the state reached the maximum failures of the policy
+func (g *Guard) Exceeded(state State) bool {
+	return g != nil && state.Failures >= g.policy.MaxFailures
+}
+
+// UserKey is the key of a known user
+func UserKey(namespace, name string) string {
+	return "user:" + namespace + "/" + name
+}
+
+// UsernameKey is the key of a login name no user was found for
+func UsernameKey(username string) string {
+	return "username:" + username
+}
+
+// IPKey is the key of the source address of the attempts
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// UserCodeKey is the key of a device authorization user code
+func UserCodeKey(userCode string) string {
+	return "usercode:" + userCode
+}
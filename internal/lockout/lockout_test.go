@@ -0,0 +1,121 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	p := Policy{MaxFailures: 3, BaseDelay: time.Minute, MaxDelay: 5 * time.Minute}
+	for failures, want := range map[int]time.Duration{
+		1: 0,
+		2: 0,
+		3: time.Minute,
+		4: 2 * time.Minute,
+		5: 4 * time.Minute,
+		6: 5 * time.Minute,
+		9: 5 * time.Minute,
+	} {
+		if got := p.delay(failures); got != want {
+			t.Errorf("delay(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
+
+func TestGuard(t *testing.T) {
+	ctx := context.Background()
+	g := NewGuard(NewMemoryStore(), Policy{MaxFailures: 2, BaseDelay: time.Minute, MaxDelay: time.Hour})
+	key := UserKey("default", "alice")
+
+	if _, err := g.Fail(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Check(ctx, key); err != nil {
+		t.Fatalf("locked after a single failure: %v", err)
+	}
+	state, err := g.Fail(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !g.Exceeded(state) || !state.Locked(time.Now()) {
+		t.Fatalf("not locked after the maximum failures: %+v", state)
+	}
+	var locked *LockedError
+	if err = g.Check(ctx, "", IPKey("127.0.0.1"), key); !errors.As(err, &locked) {
+		t.Fatalf("Check() = %v, want a LockedError", err)
+	}
+	if err = g.Reset(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if err = g.Check(ctx, key); err != nil {
+		t.Fatalf("locked after reset: %v", err)
+	}
+
+	var disabled *Guard
+	if _, err = disabled.Fail(ctx, key); err != nil || disabled.Check(ctx, key) != nil {
+		t.Fatal("a nil guard must not lock")
+	}
+}
+
+func TestGuardReserve(t *testing.T) {
+	ctx := context.Background()
+	g := NewGuard(NewMemoryStore(), Policy{MaxFailures: 3, BaseDelay: time.Minute, MaxDelay: time.Hour})
+	key := UserKey("default", "alice")
+
+	// parallel attempts are admitted only as long as their failures could not exceed the policy
+	var (
+		wg       sync.WaitGroup
+		admitted atomic.Int32
+	)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if g.Reserve(ctx, key) == nil {
+				admitted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if admitted.Load() != 3 {
+		t.Fatalf("Reserve() admitted %d parallel attempts, want 3", admitted.Load())
+	}
+
+	if err := g.Release(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Reserve(ctx, key); err != nil {
+		t.Fatalf("Reserve() after Release() = %v", err)
+	}
+	for range 3 {
+		if _, err := g.Fail(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var locked *LockedError
+	if err := g.Reserve(ctx, key); !errors.As(err, &locked) || locked.Until.Before(time.Now().Add(time.Minute/2)) {
+		t.Fatalf("Reserve() after the maximum failures = %v, want the lockout", err)
+	}
+	if err := g.Reset(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Reserve(ctx, key); err != nil {
+		t.Fatalf("Reserve() after Reset() = %v", err)
+	}
+
+	// the attempts of a crashed replica time out
+	store := NewMemoryStore()
+	g = NewGuard(store, Policy{MaxFailures: 1, BaseDelay: time.Minute, MaxDelay: time.Hour})
+	if _, err := store.Update(ctx, key, func(state *State) {
+		state.Pending, state.LastAttempt = 1, time.Now().Add(-2*pendingTimeout)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Reserve(ctx, key); err != nil {
+		t.Fatalf("Reserve() with a timed out attempt = %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package lockout
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// maxMemoryEntries bounds the states of the memory store, so that failed logins with made up login names and
+// source addresses can not grow it without limit
+const maxMemoryEntries = 1 << 16
+
+// memoryStore keeps the states in the memory of a single replica, e.g. for development.
+// Once it is full, an eighth of the states is evicted in the order of the ConfigMapStore.
+type memoryStore struct {
+	lock   sync.Mutex
+	states map[string]State
+	limit  int
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{states: make(map[string]State), limit: maxMemoryEntries}
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) (State, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.states[key], nil
+}
+
+func (s *memoryStore) Update(_ context.Context, key string, fn func(*State)) (State, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	state := s.states[key]
+	fn(&state)
+	s.states[key] = state
+	if len(s.states) > s.limit {
+		s.evict(key, time.Now())
+	}
+	return state, nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.states, key)
+	return nil
+}
+
+// Pruner implements Prunable
+func (s *memoryStore) Pruner(retention time.Duration) manager.RunnableFunc {
+	return pruner(retention, s.prune)
+}
+
+func (s *memoryStore) prune(_ context.Context, retention time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	for key, state := range s.states {
+		if state.outdated(now, retention) {
+			delete(s.states, key)
+		}
+	}
+	return nil
+}
+
+// evict removes an eighth of the states, so that the states are not sorted for every new key of a full store;
+// the state of the key is kept
+// the caller must hold the lock
+func (s *memoryStore) evict(keep string, now time.Time) {
+	keys := make([]string, 0, len(s.states))
+	for key := range s.states {
+		if key != keep {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return evictFirst(s.states[keys[i]], s.states[keys[j]], now)
+	})
+	for _, key := range keys[:len(s.states)-s.limit+s.limit/8] {
+		delete(s.states, key)
+	}
+}
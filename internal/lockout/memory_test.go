@@ -0,0 +1,49 @@
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := &memoryStore{states: make(map[string]State), limit: 64}
+	now := time.Now()
+
+	locked := UserKey("default", "alice")
+	if _, err := s.Update(ctx, locked, func(state *State) {
+		state.Failures, state.LastFailure, state.LockedUntil = 5, now.Add(-time.Hour), now.Add(time.Hour)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// made up login names do not grow the store without limit
+	for i := range 1000 {
+		if _, err := s.Update(ctx, UsernameKey(fmt.Sprintf("nobody-%d", i)), func(state *State) {
+			state.Failures++
+			state.LastFailure = now.Add(-time.Hour + time.Duration(i)*time.Millisecond)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.states) > s.limit {
+		t.Errorf("the store has %d states, want at most %d", len(s.states), s.limit)
+	}
+	for _, key := range []string{locked, UsernameKey("nobody-999")} {
+		if _, ok := s.states[key]; !ok {
+			t.Errorf("the store evicted %s", key)
+		}
+	}
+	if _, ok := s.states[UsernameKey("nobody-0")]; ok {
+		t.Error("the store kept the oldest failure")
+	}
+
+	if err := s.prune(ctx, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.states) != 1 {
+		t.Errorf("prune() left %d states, want the locked one", len(s.states))
+	}
+	var _ Prunable = s
+}
@@ -0,0 +1,61 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"sync"
+)
+
+// MemoryMailer keeps the messages in memory, e.g. for tests
+type MemoryMailer struct {
+	lock     sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(_ context.Context, msg *Message) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.messages = append(m.messages, *msg)
+	return nil
+}
+
+// Messages returns the sent messages
+func (m *MemoryMailer) Messages() []Message {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// fileMailer appends the messages to a file instead of delivering them, e.g. for development
+type fileMailer struct {
+	lock sync.Mutex
+	path string
+	from string
+}
+
+func NewFileMailer(path, from string) Mailer {
+	return &fileMailer{path: path, from: from}
+}
+
+func (m *fileMailer) Send(_ context.Context, msg *Message) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err = msg.writeTo(f, m.from); err != nil {
+		_ = f.Close()
+		return err
+	}
+	// separate the messages like an mbox
+	if _, err = f.WriteString("\r\n"); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
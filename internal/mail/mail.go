@@ -0,0 +1,39 @@
+// Package mail sends the messages of the self-service flows, e.g. the password reset and email verification links.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers the messages
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// writeTo writes the message in the internet message format (RFC 5322)
+func (m *Message) writeTo(w io.Writer, from string) error {
+	header := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n",
+		headerValue(from), headerValue(m.To), headerValue(m.Subject), time.Now().Format(time.RFC1123Z))
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	// lines of the body end with CRLF
+	_, err := io.WriteString(w, strings.ReplaceAll(strings.ReplaceAll(m.Body, "\r\n", "\n"), "\n", "\r\n")+"\r\n")
+	return err
+}
+
+// headerValue removes line breaks, which would inject further headers
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
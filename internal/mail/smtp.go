@@ -0,0 +1,53 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/smtp"
+)
+
+// SMTPConfig is the server the messages are sent by
+type SMTPConfig struct {
+	// Addr is the host:port of the server, STARTTLS is used if the server supports it
+	Addr string
+	// Username and Password authenticate by PLAIN auth, which requires TLS or localhost
+	Username string
+	Password string
+	// From is the sender of the messages
+	From string
+}
+
+type smtpMailer struct {
+	config SMTPConfig
+}
+
+func NewSMTPMailer(config SMTPConfig) Mailer {
+	return &smtpMailer{config: config}
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg *Message) error {
+	var buf bytes.Buffer
+	if err := msg.writeTo(&buf, m.config.From); err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		host, _, err := net.SplitHostPort(m.config.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, host)
+	}
+	// net/smtp does not take a context, the delivery is abandoned once the request is canceled
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(m.config.Addr, auth, m.config.From, []string{msg.To}, buf.Bytes())
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
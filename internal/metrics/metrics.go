@@ -0,0 +1,138 @@
+// Package metrics defines the Prometheus metrics of the OIDC server.
+// They are registered on the controller-runtime registry, so they are served by the
+// metrics endpoint of the manager together with the controller metrics.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	namespace = "kim"
+	subsystem = "oidc"
+
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+
+	RateLimitAllowed = "allowed"
+	RateLimitLimited = "limited"
+
+	// JWTGrantClient is the client_id of the tokens of the JWT profile and of the exchanged external JWTs, their
+	// subjects are chosen by the issuers of the JWTs and would make the cardinality of the label unbounded
+	JWTGrantClient = "jwt"
+)
+
+var (
+	// Logins counts the username / password logins by flow (browser, device), result and failure reason.
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "logins_total",
+		Help:      "Number of password logins by flow, result and failure reason.",
+	}, []string{"flow", "result", "reason"})
+
+	// TokensIssued counts the issued access tokens by grant type and client.
+	TokensIssued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "tokens_issued_total",
+		Help:      "Number of issued access tokens by grant type and client.",
+	}, []string{"grant_type", "client_id"})
+
+	// RefreshTokenRotations counts the refresh tokens exchanged for a new one.
+	RefreshTokenRotations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "refresh_token_rotations_total",
+		Help:      "Number of refresh token rotations by client and result.",
+	}, []string{"client_id", "result"})
+
+	// Revocations counts the token revocation requests by client and token type.
+	Revocations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "token_revocations_total",
+		Help:      "Number of revoked tokens by client and token type.",
+	}, []string{"client_id", "token_type"})
+
+	// DeviceAuthorizations counts the state transitions of the device authorization flow.
+	DeviceAuthorizations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "device_authorizations_total",
+		Help:      "Number of device authorization state transitions (started, approved, denied).",
+	}, []string{"state"})
+
+	// Introspections counts the token introspection calls by the calling client and whether the token was active.
+	Introspections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "introspections_total",
+		Help:      "Number of token introspections by client and token activity.",
+	}, []string{"client_id", "active"})
+
+	// RequestDuration observes the latency of the http endpoints.
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "request_duration_seconds",
+		Help:      "Latency of the OIDC server endpoints.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "code"})
+
+	// RateLimitDecisions counts the decisions of the rate limiter by path and kind of the rule (ip, client, device_code).
+	RateLimitDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "rate_limit_decisions_total",
+		Help:      "Number of rate limiter decisions by path, rule kind and decision (allowed, limited).",
+	}, []string{"path", "kind", "decision"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		Logins,
+		TokensIssued,
+		RefreshTokenRotations,
+		Revocations,
+		DeviceAuthorizations,
+		Introspections,
+		RequestDuration,
+		RateLimitDecisions,
+	)
+}
+
+// Result returns the result label of an operation
+func Result(err error) string {
+	if err != nil {
+		return ResultFailure
+	}
+	return ResultSuccess
+}
+
+// Middleware observes the latency of every request by its chi route pattern,
+// so that path parameters do not blow up the cardinality of the histogram
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unknown"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		RequestDuration.WithLabelValues(r.Method, route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/users/{name}", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	before := testutil.CollectAndCount(RequestDuration)
+	for _, name := range []string{"alice", "bob"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/"+name, nil))
+	}
+	// the path parameters do not create a series each
+	if got := testutil.CollectAndCount(RequestDuration) - before; got != 1 {
+		t.Errorf("the requests added %d series, want 1", got)
+	}
+}
+
+func TestResult(t *testing.T) {
+	if Result(nil) != ResultSuccess || Result(errors.New("failed")) != ResultFailure {
+		t.Error("Result() does not map the errors to their result")
+	}
+}
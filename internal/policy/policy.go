@@ -0,0 +1,204 @@
+// Package policy evaluates the rules of the Policies bound to the users and the machine clients.
+// A rule allows or denies actions on resources named like user/<namespace>/<name>, its resource
+// may use * as a wildcard matching any characters, e.g. user/* or user/team-a/*. The sessions and
+// the tokens of a user or a client are named by its resource, e.g. token/user/team-a/alice.
+//
+// The Allow rules of a Policy only grant the resources of its namespace, see Confine, except for the Policies
+// of the admin namespace, which grant the permissions across the namespaces, e.g. on the signing key.
+package policy
+
+import (
+	"slices"
+	"strings"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+const (
+	// ActionImpersonate allows to exchange a token for a token of the user or the client of the resource
+	ActionImpersonate = "impersonate"
+	// ActionDelegate allows to act on behalf of the user or the client of the resource
+	ActionDelegate = "delegate"
+
+	// the actions of the admin API
+	ActionGet    = "get"
+	ActionList   = "list"
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	// ActionRevoke allows to end the sessions and to revoke the tokens of the resource
+	ActionRevoke = "revoke"
+	// ActionUnlock allows to lift the lockout of the user of the resource
+	ActionUnlock = "unlock"
+	// ActionRotate allows to rotate the signing key of the resource
+	ActionRotate = "rotate"
+)
+
+// SigningKeyResource is the resource of the signing key of the issuer
+const SigningKeyResource = "key/signing"
+
+// Resource returns the resource of the object of the kind, e.g. user/team-a/alice
+func Resource(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// UserResource returns the resource of a User
+func UserResource(user *kimv1.User) string {
+	return Resource("user", user.Namespace, user.Name)
+}
+
+// MachineClientResource returns the resource of a MachineClient
+func MachineClientResource(client *kimv1.MachineClient) string {
+	return Resource("client", client.Namespace, client.Name)
+}
+
+// SessionResource returns the resource of the sessions of the user or the client of the subject resource,
+// e.g. session/user/team-a/alice
+func SessionResource(subject string) string {
+	return "session/" + subject
+}
+
+// TokenResource returns the resource of the tokens of the user or the client of the subject resource,
+// e.g. token/client/jobs/reporter
+func TokenResource(subject string) string {
+	return "token/" + subject
+}
+
+// Allowed reports whether the rules allow the action on the resource. A matching Deny rule wins over
+// the Allow rules and nothing is allowed without a matching Allow rule.
+func Allowed(rules []kimv1.Rule, resource, action string) bool {
+	allowed := false
+	for _, rule := range rules {
+		if !Match(rule.Resource, resource) || !slices.ContainsFunc(rule.Actions, func(a string) bool {
+			return a == "*" || a == action
+		}) {
+			continue
+		}
+		switch rule.Effect {
+		case kimv1.EffectDeny:
+			return false
+		case kimv1.EffectAllow:
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+// Grants reports whether the rules allow the actions of the rule on every resource it matches, so that whoever
+// holds the rules may bind a Policy with the rule without escalating their permissions. It is conservative: an
+// Allow rule only covers the resources of the rule if its resource is a prefix ending in *, e.g. user/team-a/*,
+// and a Deny rule which may match any of them takes the action away.
+func Grants(rules []kimv1.Rule, rule kimv1.Rule) bool {
+	if rule.Effect != kimv1.EffectAllow {
+		return true
+	}
+	for _, action := range rule.Actions {
+		if !grants(rules, rule.Resource, action) {
+			return false
+		}
+	}
+	return true
+}
+
+func grants(rules []kimv1.Rule, pattern, action string) bool {
+	granted := false
+	for _, rule := range rules {
+		switch rule.Effect {
+		case kimv1.EffectDeny:
+			if (action == "*" || slices.Contains(rule.Actions, "*") || slices.Contains(rule.Actions, action)) &&
+				overlaps(rule.Resource, pattern) {
+				return false
+			}
+		case kimv1.EffectAllow:
+			if (slices.Contains(rule.Actions, "*") || action != "*" && slices.Contains(rule.Actions, action)) &&
+				covers(rule.Resource, pattern) {
+				granted = true
+			}
+		}
+	}
+	return granted
+}
+
+// covers reports whether the pattern matches every resource the other pattern matches
+func covers(pattern, other string) bool {
+	if !strings.Contains(other, "*") {
+		return Match(pattern, other)
+	}
+	prefix, wildcard := strings.CutSuffix(pattern, "*")
+	return wildcard && !strings.Contains(prefix, "*") && strings.HasPrefix(other, prefix)
+}
+
+// overlaps reports whether the patterns may match the same resource, i.e. their parts before the first *
+// are prefixes of one another
+func overlaps(pattern, other string) bool {
+	a, _, wildcardA := strings.Cut(pattern, "*")
+	b, _, wildcardB := strings.Cut(other, "*")
+	switch {
+	case !wildcardA:
+		return Match(other, pattern)
+	case !wildcardB:
+		return Match(pattern, other)
+	}
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+// kinds are the kinds of the resources of kim, see Resource
+var kinds = []string{"user", "client", "policy", "role", "binding", "key"}
+
+// Confine limits the rules of a Policy of the namespace to the resources of the namespace, so that whoever may
+// write the Policies of a namespace can not grant the resources of the others. The Allow rules which may match
+// the resources of kim in another namespace, e.g. user/* instead of user/team-a/*, are dropped; the Deny rules
+// only take permissions away and are kept. The rules of the Policies of the admin namespace are not confined.
+func Confine(rules []kimv1.Rule, namespace, adminNamespace string) []kimv1.Rule {
+	if adminNamespace != "" && namespace == adminNamespace {
+		return rules
+	}
+	confined := make([]kimv1.Rule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Effect == kimv1.EffectAllow && !Confined(rule.Resource, namespace) {
+			continue
+		}
+		confined = append(confined, rule)
+	}
+	return confined
+}
+
+// Confined reports whether the pattern only matches the resources of kim of the namespace, i.e. it names the
+// kind and the namespace without a wildcard, e.g. user/team-a/* or token/client/team-a/*. The resources of the
+// applications, e.g. reports/*, are not the resources of kim and are confined by their kind.
+func Confined(pattern, namespace string) bool {
+	for _, prefix := range []string{"session/", "token/"} {
+		if rest, ok := strings.CutPrefix(pattern, prefix); ok {
+			pattern = rest
+			break
+		}
+	}
+	kind, rest, _ := strings.Cut(pattern, "/")
+	if strings.Contains(kind, "*") {
+		return false
+	}
+	if !slices.Contains(kinds, kind) {
+		return true
+	}
+	ns, _, ok := strings.Cut(rest, "/")
+	return ok && ns == namespace
+}
+
+// Match reports whether the resource matches the pattern, whose * matches any characters
+func Match(pattern, resource string) bool {
+	prefix, rest, wildcard := strings.Cut(pattern, "*")
+	if !wildcard {
+		return pattern == resource
+	}
+	if !strings.HasPrefix(resource, prefix) {
+		return false
+	}
+	resource = resource[len(prefix):]
+	// the rest is matched at every position the wildcard may end at
+	for i := 0; i <= len(resource); i++ {
+		if Match(rest, resource[i:]) {
+			return true
+		}
+	}
+	return false
+}
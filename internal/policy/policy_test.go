@@ -0,0 +1,132 @@
+package policy
+
+import (
+	"slices"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+func TestMatch(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, resource string
+		want              bool
+	}{
+		{"user/*", "user/team-a/alice", true},
+		{"user/team-a/*", "user/team-a/alice", true},
+		{"user/team-a/*", "user/team-b/alice", false},
+		{"user/*/alice", "user/team-b/alice", true},
+		{"user/*/alice", "user/team-b/bob", false},
+		{"user/team-a/alice", "user/team-a/alice", true},
+		{"user/team-a/alice", "user/team-a/alice2", false},
+		{"*", "client/jobs/reporter", true},
+		{"user/*", "client/jobs/reporter", false},
+	} {
+		if got := Match(tt.pattern, tt.resource); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.resource, got, tt.want)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	rules := []kimv1.Rule{
+		{Resource: "user/*", Actions: []string{ActionImpersonate}, Effect: kimv1.EffectAllow},
+		{Resource: "user/admins/*", Actions: []string{"*"}, Effect: kimv1.EffectDeny},
+		{Resource: "client/*", Actions: []string{"*"}, Effect: kimv1.EffectAllow},
+	}
+	for _, tt := range []struct {
+		resource, action string
+		want             bool
+	}{
+		{"user/team-a/alice", ActionImpersonate, true},
+		{"user/team-a/alice", ActionDelegate, false},
+		{"user/admins/root", ActionImpersonate, false},
+		{"client/jobs/reporter", ActionDelegate, true},
+	} {
+		if got := Allowed(rules, tt.resource, tt.action); got != tt.want {
+			t.Errorf("Allowed(%s, %s) = %v, want %v", tt.resource, tt.action, got, tt.want)
+		}
+	}
+	if Allowed(nil, "user/team-a/alice", ActionImpersonate) {
+		t.Error("Allowed() without rules = true")
+	}
+}
+
+func TestConfine(t *testing.T) {
+	rules := []kimv1.Rule{
+		{Resource: "user/team-a/*", Actions: []string{ActionGet}, Effect: kimv1.EffectAllow},
+		{Resource: "token/client/team-a/*", Actions: []string{ActionRevoke}, Effect: kimv1.EffectAllow},
+		{Resource: "reports/*", Actions: []string{ActionGet}, Effect: kimv1.EffectAllow},
+		{Resource: "user/*", Actions: []string{ActionImpersonate}, Effect: kimv1.EffectAllow},
+		{Resource: "user/team-b/*", Actions: []string{ActionGet}, Effect: kimv1.EffectAllow},
+		{Resource: "session/*", Actions: []string{ActionRevoke}, Effect: kimv1.EffectAllow},
+		{Resource: "*", Actions: []string{"*"}, Effect: kimv1.EffectAllow},
+		{Resource: SigningKeyResource, Actions: []string{ActionRotate}, Effect: kimv1.EffectAllow},
+		{Resource: "user/*", Actions: []string{ActionDelete}, Effect: kimv1.EffectDeny},
+	}
+	got := Confine(rules, "team-a", "kim-system")
+	want := []kimv1.Rule{rules[0], rules[1], rules[2], rules[8]}
+	if !slices.EqualFunc(got, want, func(a, b kimv1.Rule) bool { return a.Resource == b.Resource && a.Effect == b.Effect }) {
+		t.Errorf("Confine() = %v, want %v", got, want)
+	}
+	if got := Confine(rules, "kim-system", "kim-system"); len(got) != len(rules) {
+		t.Errorf("Confine() of the admin namespace = %v, want all the rules", got)
+	}
+	if Allowed(Confine(rules, "team-a", "kim-system"), "user/team-b/bob", ActionGet) {
+		t.Error("Allowed() on another namespace = true")
+	}
+}
+
+func TestGrants(t *testing.T) {
+	held := []kimv1.Rule{
+		{Resource: "user/team-a/*", Actions: []string{"*"}, Effect: kimv1.EffectAllow},
+		{Resource: "user/team-a/root", Actions: []string{ActionImpersonate}, Effect: kimv1.EffectDeny},
+		{Resource: "client/jobs/reporter", Actions: []string{ActionGet}, Effect: kimv1.EffectAllow},
+	}
+	for _, tt := range []struct {
+		rule kimv1.Rule
+		want bool
+	}{
+		{kimv1.Rule{Resource: "user/team-a/*", Actions: []string{ActionGet}, Effect: kimv1.EffectAllow}, true},
+		{kimv1.Rule{Resource: "user/team-a/alice", Actions: []string{ActionImpersonate}, Effect: kimv1.EffectAllow}, true},
+		{kimv1.Rule{Resource: "user/team-a/ops-*", Actions: []string{"*"}, Effect: kimv1.EffectAllow}, true},
+		{kimv1.Rule{Resource: "client/jobs/reporter", Actions: []string{ActionGet}, Effect: kimv1.EffectAllow}, true},
+		{kimv1.Rule{Resource: "*", Actions: []string{"*"}, Effect: kimv1.EffectDeny}, true},
+		// the Deny rule of the caller overlaps
+		{kimv1.Rule{Resource: "user/team-a/*", Actions: []string{ActionImpersonate}, Effect: kimv1.EffectAllow}, false},
+		{kimv1.Rule{Resource: "user/team-a/*", Actions: []string{"*"}, Effect: kimv1.EffectAllow}, false},
+		{kimv1.Rule{Resource: "user/*", Actions: []string{ActionGet}, Effect: kimv1.EffectAllow}, false},
+		{kimv1.Rule{Resource: "client/jobs/*", Actions: []string{ActionGet}, Effect: kimv1.EffectAllow}, false},
+		{kimv1.Rule{Resource: "client/jobs/reporter", Actions: []string{"*"}, Effect: kimv1.EffectAllow}, false},
+	} {
+		if got := Grants(held, tt.rule); got != tt.want {
+			t.Errorf("Grants(%s %v) = %v, want %v", tt.rule.Resource, tt.rule.Actions, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	spec := &kimv1.PolicySpec{
+		Statement: `{"version": 1`,
+		Rules: []kimv1.Rule{
+			{Resource: "user/*", Actions: []string{"get"}, Effect: kimv1.EffectAllow},
+			{Resource: "", Actions: nil, Effect: "allow"},
+			{Resource: "user/*", Actions: []string{"get"}},
+		},
+	}
+	var fields []string
+	for _, err := range Validate(spec, field.NewPath("spec")) {
+		fields = append(fields, err.Field)
+	}
+	want := []string{"spec.statement", "spec.rules[1].resource", "spec.rules[1].actions", "spec.rules[1].effect",
+		"spec.rules[2].effect"}
+	if !slices.Equal(fields, want) {
+		t.Errorf("Validate() = errors of %v, want %v", fields, want)
+	}
+	spec.Statement, spec.Rules = "", spec.Rules[:1]
+	if errs := Validate(spec, field.NewPath("spec")); len(errs) > 0 {
+		t.Errorf("Validate() = %v, want no errors", errs)
+	}
+}
@@ -0,0 +1,39 @@
+package policy
+
+import (
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+// Validate returns the errors of the spec of a Policy: the statement must be JSON if it is set and every rule
+// needs a resource, its actions and an effect of Allow or Deny
+func Validate(spec *kimv1.PolicySpec, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if spec.Statement != "" && !json.Valid([]byte(spec.Statement)) {
+		errs = append(errs, field.Invalid(path.Child("statement"), spec.Statement, "must be JSON"))
+	}
+	for i, rule := range spec.Rules {
+		rulePath := path.Child("rules").Index(i)
+		if rule.Resource == "" {
+			errs = append(errs, field.Required(rulePath.Child("resource"), ""))
+		}
+		if len(rule.Actions) == 0 {
+			errs = append(errs, field.Required(rulePath.Child("actions"), "at least one action"))
+		}
+		for j, action := range rule.Actions {
+			if action == "" {
+				errs = append(errs, field.Invalid(rulePath.Child("actions").Index(j), action, "must not be empty"))
+			}
+		}
+		if rule.Effect == "" {
+			errs = append(errs, field.Required(rulePath.Child("effect"), "Allow or Deny"))
+		} else if rule.Effect != kimv1.EffectAllow && rule.Effect != kimv1.EffectDeny {
+			errs = append(errs, field.NotSupported(rulePath.Child("effect"), rule.Effect,
+				[]string{kimv1.EffectAllow, kimv1.EffectDeny}))
+		}
+	}
+	return errs
+}
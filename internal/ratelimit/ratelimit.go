@@ -0,0 +1,311 @@
+// Package ratelimit limits the requests of the OIDC endpoints with token buckets per source address,
+// client and device code, so that a misbehaving client can not exhaust the server.
+// The buckets are kept per replica, the configured rates apply to each replica of the server.
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+	"golang.org/x/time/rate"
+
+	"github.com/crochee/kim/internal/clientip"
+	"github.com/crochee/kim/internal/metrics"
+)
+
+// Kind is what the requests of a rule are counted by
+type Kind string
+
+const (
+	// KindIP counts the requests per source address
+	KindIP Kind = "ip"
+	// KindClient counts the requests per client_id, taken from the form or the basic auth. The requests not
+	// authenticating the client are counted per client_id and source address, so that no one can exhaust
+	// the bucket of another client by sending its client_id
+	KindClient Kind = "client"
+	// KindDeviceCode counts the polls of the token endpoint per device code, exceeding it is answered with slow_down
+	KindDeviceCode Kind = "device_code"
+)
+
+const (
+	// idleTimeout removes the buckets that were not used for the period, a full bucket limits nothing anyway
+	idleTimeout = 10 * time.Minute
+	// maxBuckets bounds the buckets of the client ids, device codes and addresses,
+	// a full limiter evicts the least recently used bucket
+	maxBuckets = 100000
+)
+
+// Authenticator authenticates the clients of the requests of an issuer
+type Authenticator interface {
+	// AuthenticateClient reports whether the secret authenticates the client
+	AuthenticateClient(ctx context.Context, clientID, secret string) bool
+}
+
+// Rule limits the requests of the path by the kind
+type Rule struct {
+	// Path is the path of the requests relative to the issuer, a path ending with /* matches the paths below it
+	Path string
+	Kind Kind
+	// ClientID restricts a client rule to the client, it takes precedence over the rule without a client of the path
+	ClientID string
+	// Rate is the number of requests per second
+	Rate rate.Limit
+	// Burst is the number of requests allowed at once
+	Burst int
+}
+
+// ParseRule parses a rule of the form <path>:<kind>[:<client_id>]=<rate>/<burst>,
+// e.g. /oauth/token:client:web=5/10 allows the client web 5 requests per second with bursts of 10
+func ParseRule(s string) (Rule, error) {
+	var rule Rule
+	spec, limit, ok := strings.Cut(s, "=")
+	if !ok {
+		return rule, fmt.Errorf("rate limit %q: missing =<rate>/<burst>", s)
+	}
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return rule, fmt.Errorf("rate limit %q: expected <path>:<kind>[:<client_id>]", s)
+	}
+	rule.Path = parts[0]
+	rule.Kind = Kind(parts[1])
+	switch rule.Kind {
+	case KindIP, KindClient, KindDeviceCode:
+	default:
+		return rule, fmt.Errorf("rate limit %q: unknown kind %q", s, rule.Kind)
+	}
+	if len(parts) == 3 {
+		if rule.Kind != KindClient {
+			return rule, fmt.Errorf("rate limit %q: only client rules can name a client", s)
+		}
+		rule.ClientID = parts[2]
+	}
+	rateValue, burstValue, ok := strings.Cut(limit, "/")
+	if !ok {
+		return rule, fmt.Errorf("rate limit %q: expected <rate>/<burst>", s)
+	}
+	r, err := strconv.ParseFloat(rateValue, 64)
+	if err != nil || r <= 0 {
+		return rule, fmt.Errorf("rate limit %q: invalid rate %q", s, rateValue)
+	}
+	rule.Rate = rate.Limit(r)
+	if rule.Burst, err = strconv.Atoi(burstValue); err != nil || rule.Burst <= 0 {
+		return rule, fmt.Errorf("rate limit %q: invalid burst %q", s, burstValue)
+	}
+	return rule, nil
+}
+
+type bucket struct {
+	key      string
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter enforces the rules on the requests
+type Limiter struct {
+	rules map[string][]Rule
+	// prefixes are the rules of the paths ending with /*
+	prefixes []Rule
+
+	lock    sync.Mutex
+	buckets map[string]*list.Element
+	// recent orders the buckets by their last use, the least recently used one is at the back
+	recent *list.List
+	limit  int
+}
+
+func New(rules []Rule) *Limiter {
+	l := &Limiter{
+		rules:   make(map[string][]Rule),
+		buckets: make(map[string]*list.Element),
+		recent:  list.New(),
+		limit:   maxBuckets,
+	}
+	for _, rule := range rules {
+		if strings.HasSuffix(rule.Path, "/*") {
+			l.prefixes = append(l.prefixes, rule)
+			continue
+		}
+		l.rules[rule.Path] = append(l.rules[rule.Path], rule)
+	}
+	return l
+}
+
+// rulesOf returns the rules of the path
+func (l *Limiter) rulesOf(path string) []Rule {
+	rules := l.rules[path]
+	for _, rule := range l.prefixes {
+		if strings.HasPrefix(path, strings.TrimSuffix(rule.Path, "*")) {
+			rules = append(rules[:len(rules):len(rules)], rule)
+		}
+	}
+	return rules
+}
+
+// Middleware rejects the requests exceeding a rule of their path with 429 Too Many Requests,
+// see Scope for the requests of an issuer served below a path
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return l.Scope("", nil)(next)
+}
+
+// Scope returns the middleware of an issuer, the paths of the requests must be relative to the issuer,
+// e.g. stripped by the realm registry, and the issuers do not share their buckets. The clients are
+// authenticated by the clients of the issuer, no request authenticates its client if it is nil.
+// The device polling of the token endpoint is answered with the slow_down error instead of 429 Too Many Requests.
+// It must run after the clientip middleware.
+func (l *Limiter) Scope(scope string, clients Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return l.handler(scope, clients, next)
+	}
+}
+
+func (l *Limiter) handler(scope string, clients Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rules := l.rulesOf(r.URL.Path)
+		if len(rules) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// the form is parsed for the client and device code, the OP reads the parsed form again
+		_ = r.ParseForm()
+		clientID, secret := clientCredentials(r)
+		authenticated := clientID != "" && secret != "" && clients != nil && hasKind(rules, KindClient) &&
+			clients.AuthenticateClient(r.Context(), clientID, secret)
+		for _, rule := range rules {
+			key := l.key(r, rule, clientID, authenticated, rules)
+			if key == "" {
+				continue
+			}
+			delay, ok := l.allow(rule, scope+key)
+			if ok {
+				metrics.RateLimitDecisions.WithLabelValues(rule.Path, string(rule.Kind), metrics.RateLimitAllowed).Inc()
+				continue
+			}
+			metrics.RateLimitDecisions.WithLabelValues(rule.Path, string(rule.Kind), metrics.RateLimitLimited).Inc()
+			reject(w, r, delay)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// key returns the bucket key of the request by the rule, or an empty key if the rule does not apply
+func (l *Limiter) key(r *http.Request, rule Rule, clientID string, authenticated bool, rules []Rule) string {
+	var value string
+	switch rule.Kind {
+	case KindIP:
+		value = clientip.FromContext(r.Context())
+	case KindClient:
+		if clientID == "" || (rule.ClientID != "" && rule.ClientID != clientID) {
+			return ""
+		}
+		if rule.ClientID == "" && hasClientRule(rules, clientID) {
+			return ""
+		}
+		value = clientID
+		if !authenticated {
+			value += ":" + clientip.FromContext(r.Context())
+		}
+	case KindDeviceCode:
+		if r.PostForm.Get("grant_type") == string(oidc.GrantTypeDeviceCode) {
+			value = r.PostForm.Get("device_code")
+		}
+	}
+	if value == "" {
+		return ""
+	}
+	return rule.Path + ":" + string(rule.Kind) + ":" + value
+}
+
+// allow takes a token of the bucket of the key, otherwise it returns the time until the next token
+func (l *Limiter) allow(rule Rule, key string) (time.Duration, bool) {
+	now := time.Now()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.sweep(now)
+	var b *bucket
+	if e, ok := l.buckets[key]; ok {
+		b = e.Value.(*bucket)
+		l.recent.MoveToFront(e)
+	} else {
+		if l.recent.Len() >= l.limit {
+			l.remove(l.recent.Back())
+		}
+		b = &bucket{key: key, limiter: rate.NewLimiter(rule.Rate, rule.Burst)}
+		l.buckets[key] = l.recent.PushFront(b)
+	}
+	b.lastSeen = now
+	if b.limiter.AllowN(now, 1) {
+		return 0, true
+	}
+	return time.Duration(math.Ceil((1 - b.limiter.TokensAt(now)) / float64(rule.Rate) * float64(time.Second))), false
+}
+
+// sweep removes the idle buckets from the back of the recently used ones, the lock must be held
+func (l *Limiter) sweep(now time.Time) {
+	for e := l.recent.Back(); e != nil && now.Sub(e.Value.(*bucket).lastSeen) > idleTimeout; e = l.recent.Back() {
+		l.remove(e)
+	}
+}
+
+// remove removes the bucket of the element, the lock must be held
+func (l *Limiter) remove(e *list.Element) {
+	l.recent.Remove(e)
+	delete(l.buckets, e.Value.(*bucket).key)
+}
+
+func hasKind(rules []Rule, kind Kind) bool {
+	for _, rule := range rules {
+		if rule.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func hasClientRule(rules []Rule, clientID string) bool {
+	for _, rule := range rules {
+		if rule.Kind == KindClient && rule.ClientID == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// clientCredentials returns the client_id and the client_secret of the basic auth or the form of the request
+func clientCredentials(r *http.Request) (string, string) {
+	if username, password, ok := r.BasicAuth(); ok {
+		// the client credentials are form encoded in the basic auth (RFC 6749 section 2.3.1)
+		clientID, err := url.QueryUnescape(username)
+		if err != nil {
+			return "", ""
+		}
+		secret, err := url.QueryUnescape(password)
+		if err != nil {
+			return clientID, ""
+		}
+		return clientID, secret
+	}
+	return r.Form.Get("client_id"), r.Form.Get("client_secret")
+}
+
+func reject(w http.ResponseWriter, r *http.Request, delay time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+	if r.PostForm.Get("grant_type") == string(oidc.GrantTypeDeviceCode) {
+		// devices polling too fast must increase their interval (RFC 8628 section 3.5)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		body, _ := oidc.ErrSlowDown().WithDescription("polling too fast").MarshalJSON()
+		_, _ = w.Write(body)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
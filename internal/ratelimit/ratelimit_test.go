@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/crochee/kim/internal/clientip"
+)
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("/oauth/token:client:web=0.5/10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Rule{Path: "/oauth/token", Kind: KindClient, ClientID: "web", Rate: rate.Limit(0.5), Burst: 10}
+	if rule != want {
+		t.Fatalf("ParseRule() = %+v, want %+v", rule, want)
+	}
+	for _, invalid := range []string{"/oauth/token:ip", "/oauth/token=1/1", "/oauth/token:ip:web=1/1", "/oauth/token:user=1/1", "/oauth/token:ip=0/1"} {
+		if _, err = ParseRule(invalid); err == nil {
+			t.Errorf("ParseRule(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	l := New([]Rule{
+		{Path: "/oauth/token", Kind: KindClient, Rate: 1, Burst: 1},
+		{Path: "/oauth/token", Kind: KindClient, ClientID: "busy", Rate: 1, Burst: 2},
+		{Path: "/oauth/token", Kind: KindDeviceCode, Rate: 1, Burst: 1},
+	})
+	handler := clientip.Middleware(l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	do := func(form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if code := do(url.Values{"client_id": {"web"}}).Code; code != http.StatusOK {
+		t.Fatalf("first request: %d", code)
+	}
+	if code := do(url.Values{"client_id": {"web"}}).Code; code != http.StatusTooManyRequests {
+		t.Fatalf("second request: %d, want 429", code)
+	}
+	for i := 0; i < 2; i++ {
+		if code := do(url.Values{"client_id": {"busy"}}).Code; code != http.StatusOK {
+			t.Fatalf("request %d of the busy client: %d", i, code)
+		}
+	}
+
+	poll := url.Values{"client_id": {"device"}, "grant_type": {"urn:ietf:params:oauth:grant-type:device_code"}, "device_code": {"abc"}}
+	do(poll)
+	w := do(poll)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "slow_down") {
+		t.Fatalf("fast polling: %d %s, want slow_down", w.Code, w.Body)
+	}
+}
+
+func TestScope(t *testing.T) {
+	l := New([]Rule{{Path: "/recovery/*", Kind: KindIP, Rate: 1, Burst: 1}})
+	realm := clientip.Middleware(http.StripPrefix("/realms/a", l.Scope("a:", nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))))
+	other := clientip.Middleware(l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	do := func(handler http.Handler, path string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		return w.Code
+	}
+
+	if code := do(realm, "/realms/a/recovery/password"); code != http.StatusOK {
+		t.Fatalf("first request of the realm: %d", code)
+	}
+	if code := do(realm, "/realms/a/recovery/email"); code != http.StatusTooManyRequests {
+		t.Fatalf("second request of the realm: %d, want 429", code)
+	}
+	if code := do(other, "/recovery/password"); code != http.StatusOK {
+		t.Fatalf("request of the other issuer: %d, the issuers must not share the buckets", code)
+	}
+	if code := do(other, "/login/username"); code != http.StatusOK {
+		t.Fatalf("request without a rule: %d", code)
+	}
+}
+
+type authenticator map[string]string
+
+func (a authenticator) AuthenticateClient(_ context.Context, clientID, secret string) bool {
+	return a[clientID] == secret
+}
+
+func TestClientAuthentication(t *testing.T) {
+	l := New([]Rule{{Path: "/oauth/token", Kind: KindClient, Rate: 1, Burst: 1}})
+	handler := clientip.Middleware(l.Scope("", authenticator{"web": "secret"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	do := func(peer string, form url.Values) int {
+		r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.RemoteAddr = peer
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// the requests without the secret do not count against the bucket of the client
+	for _, peer := range []string{"192.0.2.1:4711", "192.0.2.2:4711"} {
+		if code := do(peer, url.Values{"client_id": {"web"}, "client_secret": {"wrong"}}); code != http.StatusOK {
+			t.Fatalf("first unauthenticated request of %s: %d", peer, code)
+		}
+	}
+	if code := do("192.0.2.1:4711", url.Values{"client_id": {"web"}}); code != http.StatusTooManyRequests {
+		t.Fatalf("second unauthenticated request: %d, want 429", code)
+	}
+	if code := do("192.0.2.3:4711", url.Values{"client_id": {"web"}, "client_secret": {"secret"}}); code != http.StatusOK {
+		t.Fatalf("first authenticated request: %d", code)
+	}
+	if code := do("192.0.2.4:4711", url.Values{"client_id": {"web"}, "client_secret": {"secret"}}); code != http.StatusTooManyRequests {
+		t.Fatalf("second authenticated request: %d, want 429, the client is limited across its addresses", code)
+	}
+}
+
+func TestAllowEvicts(t *testing.T) {
+	rule := Rule{Path: "/oauth/token", Kind: KindClient, Rate: 1, Burst: 1}
+	l := New([]Rule{rule})
+	l.limit = 2
+	for _, key := range []string{"a", "b"} {
+		if _, ok := l.allow(rule, key); !ok {
+			t.Fatalf("the first request of %s was limited", key)
+		}
+	}
+	if _, ok := l.allow(rule, "a"); ok {
+		t.Fatal("the second request of a was allowed")
+	}
+	// b is the least recently used bucket
+	if _, ok := l.allow(rule, "c"); !ok {
+		t.Fatal("the first request of c was limited")
+	}
+	if _, ok := l.buckets["b"]; ok || len(l.buckets) != 2 || l.recent.Len() != 2 {
+		t.Fatalf("buckets = %v, want a and c", l.buckets)
+	}
+	if _, ok := l.allow(rule, "a"); ok {
+		t.Fatal("the bucket of a was evicted instead of the least recently used one")
+	}
+
+	// the idle buckets are removed
+	l.buckets["a"].Value.(*bucket).lastSeen = time.Now().Add(-2 * idleTimeout)
+	l.recent.MoveToBack(l.buckets["a"])
+	if _, ok := l.allow(rule, "c"); ok {
+		t.Fatal("the second request of c was allowed")
+	}
+	if _, ok := l.buckets["a"]; ok {
+		t.Fatal("the idle bucket of a was not removed")
+	}
+}
@@ -0,0 +1,228 @@
+// Package realm serves the issuers of the Realms next to the issuer of the server.
+//
+// Every realm is served by an OpenID Provider of its own, with its own storage, signing key, clients and session
+// cookie, so that nothing is shared between them. The Registry routes the requests to the realm of the host and
+// the path of its issuer and falls back to the issuer of the server, below which the realms are served at /realms/.
+package realm
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/clientip"
+)
+
+// PathPrefix is the path below the issuer of the server the realms of its host are served at,
+// so that they can not shadow the endpoints of the server
+const PathPrefix = "/realms/"
+
+// Client is a client of the realm with its resolved secret
+type Client struct {
+	kimv1.RealmClient
+	Secret string
+}
+
+// Config is the resolved configuration of a realm
+type Config struct {
+	Key    types.NamespacedName
+	Issuer string
+	// SigningKey signs the tokens, a random key is used if nil
+	SigningKey   *rsa.PrivateKey
+	SigningKeyID string
+	Namespaces   []string
+	Clients      []Client
+	Theme        string
+	// Client reads the users of the realm
+	Client client.Client
+}
+
+// BasePath returns the path of the issuer without the trailing slash, the prefix of all requests of the realm
+func (c *Config) BasePath() string {
+	u, err := url.Parse(c.Issuer)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// equal reports whether the realm would be served the same, the client is not compared
+func (c *Config) equal(other *Config) bool {
+	a, b := *c, *other
+	a.Client, b.Client = nil, nil
+	return reflect.DeepEqual(a, b)
+}
+
+// BuildFunc returns the handler of the realm, the paths of the requests are relative to the base path
+type BuildFunc func(ctx context.Context, config *Config) (http.Handler, error)
+
+// ConflictError is returned for a realm with the issuer of another realm or overlapping the issuer of the server
+type ConflictError struct {
+	Issuer string
+	Realm  types.NamespacedName
+	// Below is the prefix the issuer must have if it overlaps the issuer of the server
+	Below string
+}
+
+func (e *ConflictError) Error() string {
+	if e.Below != "" {
+		return fmt.Sprintf("issuer %s overlaps the issuer of the server, it must be served at a host of its own or below %s",
+			e.Issuer, e.Below)
+	}
+	return fmt.Sprintf("issuer %s is already served by realm %s", e.Issuer, e.Realm)
+}
+
+type served struct {
+	config  *Config
+	host    string
+	path    string
+	handler http.Handler
+}
+
+// Registry routes the requests to the served realms
+type Registry struct {
+	build    BuildFunc
+	fallback http.Handler
+	// issuer is the issuer of the server served by fallback, host and path are parsed from it
+	issuer, host, path string
+	// trusted are the proxies whose X-Forwarded-Host header selects the realm
+	trusted []netip.Prefix
+
+	mu     sync.RWMutex
+	realms map[types.NamespacedName]*served
+}
+
+// NewRegistry returns a registry building the handlers of the realms by build,
+// requests not matching any realm are served by fallback
+func NewRegistry(build BuildFunc, fallback http.Handler) *Registry {
+	return &Registry{
+		build:    build,
+		fallback: fallback,
+		realms:   make(map[types.NamespacedName]*served),
+	}
+}
+
+// WithServerIssuer reserves the host and path of the issuer of the server, the realms of its host
+// are only served below PathPrefix. Without it the issuer of the server is served at the root of every host,
+// the realms are served at the root of a host of their own or below PathPrefix.
+func (r *Registry) WithServerIssuer(issuer string) (*Registry, error) {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return nil, err
+	}
+	r.issuer, r.host, r.path = issuer, strings.ToLower(u.Host), strings.TrimSuffix(u.Path, "/")
+	return r, nil
+}
+
+// WithTrustedProxies honors the X-Forwarded-Host header of the requests of the trusted proxies,
+// the header of other peers is ignored, otherwise anyone could select the realm of their request
+func (r *Registry) WithTrustedProxies(trusted []netip.Prefix) *Registry {
+	r.trusted = trusted
+	return r
+}
+
+// overlaps reports whether the issuer of the realm overlaps the endpoints of the issuer of the server
+func (r *Registry) overlaps(host, path string) bool {
+	if r.host == "" {
+		return path != "" && !strings.HasPrefix(path, PathPrefix)
+	}
+	return host == r.host && !strings.HasPrefix(path, r.path+PathPrefix)
+}
+
+// Serve starts serving the realm, or restarts it if its configuration changed. A restart drops the sessions
+// and tokens of the realm, as they are kept in memory.
+func (r *Registry) Serve(ctx context.Context, config *Config) error {
+	u, err := url.Parse(config.Issuer)
+	if err != nil {
+		return err
+	}
+	host, path := strings.ToLower(u.Host), strings.TrimSuffix(u.Path, "/")
+	if r.overlaps(host, path) {
+		return &ConflictError{Issuer: config.Issuer, Below: strings.TrimSuffix(r.issuer, "/") + PathPrefix}
+	}
+
+	r.mu.RLock()
+	current, ok := r.realms[config.Key]
+	for key, other := range r.realms {
+		if key != config.Key && other.host == host && other.path == path {
+			r.mu.RUnlock()
+			return &ConflictError{Issuer: config.Issuer, Realm: key}
+		}
+	}
+	r.mu.RUnlock()
+	if ok && current.config.equal(config) {
+		return nil
+	}
+
+	// the handler is built outside the lock, so that the other realms keep being served
+	handler, err := r.build(ctx, config)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.realms[config.Key] = &served{
+		config:  config,
+		host:    host,
+		path:    path,
+		handler: handler,
+	}
+	logf.FromContext(ctx).Info("serving realm", "realm", config.Key, "issuer", config.Issuer)
+	return nil
+}
+
+// Stop stops serving the realm
+func (r *Registry) Stop(ctx context.Context, key types.NamespacedName) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.realms[key]; ok {
+		delete(r.realms, key)
+		logf.FromContext(ctx).Info("stopped serving realm", "realm", key)
+	}
+}
+
+// ServeHTTP passes the request to the realm of the longest issuer path matching the host and path of the request
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if realm := r.match(req); realm != nil {
+		if realm.path == "" {
+			realm.handler.ServeHTTP(w, req)
+			return
+		}
+		http.StripPrefix(realm.path, realm.handler).ServeHTTP(w, req)
+		return
+	}
+	r.fallback.ServeHTTP(w, req)
+}
+
+func (r *Registry) match(req *http.Request) *served {
+	host := strings.ToLower(req.Host)
+	if forwarded := req.Header.Get("X-Forwarded-Host"); forwarded != "" && clientip.IsTrusted(r.trusted, clientip.FromRequest(req)) {
+		host = strings.ToLower(forwarded)
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var match *served
+	for _, realm := range r.realms {
+		if realm.host != host {
+			continue
+		}
+		if realm.path != "" && req.URL.Path != realm.path && !strings.HasPrefix(req.URL.Path, realm.path+"/") {
+			continue
+		}
+		if match == nil || len(realm.path) > len(match.path) {
+			match = realm
+		}
+	}
+	return match
+}
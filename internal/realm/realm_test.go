@@ -0,0 +1,123 @@
+package realm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// echo answers with the name of the handler and the path it got
+func echo(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, name+" "+r.URL.Path)
+	})
+}
+
+func get(t *testing.T, h http.Handler, target string) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w.Body.String()
+}
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	builds := 0
+	r := NewRegistry(func(_ context.Context, config *Config) (http.Handler, error) {
+		builds++
+		return echo(config.Key.Name), nil
+	}, echo("fallback"))
+
+	a := &Config{Key: types.NamespacedName{Namespace: "ns", Name: "a"}, Issuer: "https://kim.example.com/realms/a/"}
+	b := &Config{Key: types.NamespacedName{Namespace: "ns", Name: "b"}, Issuer: "https://login.example.com"}
+	for _, config := range []*Config{a, b} {
+		if err := r.Serve(ctx, config); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for target, want := range map[string]string{
+		"https://kim.example.com/realms/a/.well-known/openid-configuration": "a /.well-known/openid-configuration",
+		"https://kim.example.com/realms/ab/login":                           "fallback /realms/ab/login",
+		"https://login.example.com/login/username":                          "b /login/username",
+		"https://other.example.com/login/username":                          "fallback /login/username",
+	} {
+		if got := get(t, r, target); got != want {
+			t.Errorf("GET %s = %q, want %q", target, got, want)
+		}
+	}
+
+	// the same configuration is not built again
+	if err := r.Serve(ctx, &Config{Key: a.Key, Issuer: a.Issuer}); err != nil || builds != 2 {
+		t.Errorf("Serve() unchanged = %v, builds = %d, want 2", err, builds)
+	}
+
+	var conflict *ConflictError
+	err := r.Serve(ctx, &Config{Key: types.NamespacedName{Namespace: "other", Name: "c"}, Issuer: "https://LOGIN.example.com/"})
+	if !errors.As(err, &conflict) || conflict.Realm != b.Key {
+		t.Errorf("Serve() with the issuer of b = %v, want a conflict with b", err)
+	}
+
+	r.Stop(ctx, b.Key)
+	if got := get(t, r, "https://login.example.com/login/username"); got != "fallback /login/username" {
+		t.Errorf("GET after Stop = %q", got)
+	}
+}
+
+func TestRegistryServerIssuer(t *testing.T) {
+	ctx := context.Background()
+	build := func(_ context.Context, config *Config) (http.Handler, error) {
+		return echo(config.Key.Name), nil
+	}
+	unset := NewRegistry(build, echo("fallback"))
+	r, err := NewRegistry(build, echo("fallback")).WithServerIssuer("https://kim.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		registry *Registry
+		issuer   string
+		overlaps bool
+	}{
+		{r, "https://kim.example.com/realms/a", false},
+		{r, "https://kim.example.com/", true},
+		{r, "https://kim.example.com/oauth", true},
+		{r, "https://KIM.example.com/realms", true},
+		{r, "https://login.example.com/oauth", false},
+		{unset, "https://login.example.com/", false},
+		{unset, "https://login.example.com/realms/a", false},
+		{unset, "https://login.example.com/login", true},
+	} {
+		var conflict *ConflictError
+		err := tc.registry.Serve(ctx, &Config{Key: types.NamespacedName{Namespace: "ns", Name: "a"}, Issuer: tc.issuer})
+		if overlaps := errors.As(err, &conflict); overlaps != tc.overlaps {
+			t.Errorf("Serve(%s) = %v, want overlap %t", tc.issuer, err, tc.overlaps)
+		}
+	}
+}
+
+func TestRegistryForwardedHost(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry(func(_ context.Context, config *Config) (http.Handler, error) {
+		return echo(config.Key.Name), nil
+	}, echo("fallback")).WithTrustedProxies([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+	if err := r.Serve(ctx, &Config{Key: types.NamespacedName{Namespace: "ns", Name: "a"}, Issuer: "https://login.example.com/"}); err != nil {
+		t.Fatal(err)
+	}
+	for peer, want := range map[string]string{"10.1.2.3:4711": "a /login", "192.0.2.1:4711": "fallback /login"} {
+		req := httptest.NewRequest(http.MethodGet, "https://kim.example.com/login", nil)
+		req.RemoteAddr = peer
+		req.Header.Set("X-Forwarded-Host", "login.example.com")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if got := w.Body.String(); got != want {
+			t.Errorf("GET from %s = %q, want %q", peer, got, want)
+		}
+	}
+}
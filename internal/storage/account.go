@@ -0,0 +1,312 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"k8s.io/utils/ptr"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/audit"
+	"github.com/crochee/kim/internal/lockout"
+)
+
+// AccountClientID is the client of the account portal, which signs in the users by the OP itself
+const AccountClientID = "kim-account"
+
+var (
+	errNotSignedIn      = errors.New("not signed in")
+	errSessionNotFound  = errors.New("session not found")
+	errInvalidOTPSecret = errors.New("the one-time code does not match the new secret")
+	errTOTPEnrolled     = errors.New("an authenticator app is already added, remove it first")
+)
+
+// claimFields are the string fields of the Claim by their json name, which the users may edit in the account portal
+var claimFields = map[string]func(*kimv1.Claim) **string{
+	"givenName":         func(c *kimv1.Claim) **string { return &c.GivenName },
+	"familyName":        func(c *kimv1.Claim) **string { return &c.FamilyName },
+	"middleName":        func(c *kimv1.Claim) **string { return &c.MiddleName },
+	"nickName":          func(c *kimv1.Claim) **string { return &c.NickName },
+	"preferredUsername": func(c *kimv1.Claim) **string { return &c.PreferredUsername },
+	"profile":           func(c *kimv1.Claim) **string { return &c.Profile },
+	"picture":           func(c *kimv1.Claim) **string { return &c.Picture },
+	"website":           func(c *kimv1.Claim) **string { return &c.Website },
+	"gender":            func(c *kimv1.Claim) **string { return &c.Gender },
+	"birthdate":         func(c *kimv1.Claim) **string { return &c.Birthdate },
+	"zoneinfo":          func(c *kimv1.Claim) **string { return &c.Zoneinfo },
+	"locale":            func(c *kimv1.Claim) **string { return &c.Locale },
+	"phoneNumber":       func(c *kimv1.Claim) **string { return &c.PhoneNumber },
+	"address":           func(c *kimv1.Claim) **string { return &c.Address },
+}
+
+// AccountClient returns the client of the account portal, the authorization code is consumed by AccountLogin,
+// so the client never uses the token endpoint and gets a random secret
+func AccountClient(callbackURI string) *Client {
+	return WebClient(AccountClientID, uuid.NewString(), callbackURI)
+}
+
+// ValidateClaimFields checks that the fields are editable Claim fields
+func ValidateClaimFields(fields []string) error {
+	for _, field := range fields {
+		if _, ok := claimFields[field]; !ok {
+			return fmt.Errorf("unknown claim field %q", field)
+		}
+	}
+	return nil
+}
+
+// ClaimValue returns the value of the Claim field of the user
+func ClaimValue(user *kimv1.User, field string) string {
+	get, ok := claimFields[field]
+	if !ok {
+		return ""
+	}
+	return ptr.Deref(*get(&user.Spec.Claim), "")
+}
+
+// setClaims sets the Claim fields to the values, empty values remove the field
+func setClaims(claim *kimv1.Claim, values map[string]string) error {
+	for field, value := range values {
+		get, ok := claimFields[field]
+		if !ok {
+			return fmt.Errorf("unknown claim field %q", field)
+		}
+		if value == "" {
+			*get(claim) = nil
+			continue
+		}
+		*get(claim) = ptr.To(value)
+	}
+	return nil
+}
+
+// AccountLogin implements the `account` interface of the account portal
+// it consumes the authorization code the OP redirected the browser with to the portal and
+// returns the single sign-on session it was issued for
+func (s *Storage) AccountLogin(ctx context.Context, code string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	id, ok := s.codes[code]
+	if !ok {
+		return "", errNotSignedIn
+	}
+	request, ok := s.authRequests[id]
+	delete(s.codes, code)
+	delete(s.authRequests, id)
+	if !ok || !request.done || request.ApplicationID != AccountClientID {
+		return "", errNotSignedIn
+	}
+	return request.SessionID, nil
+}
+
+// AccountUser implements the `account` interface of the account portal
+// it returns the user of the single sign-on session
+func (s *Storage) AccountUser(ctx context.Context, sessionID string) (*kimv1.User, error) {
+	s.lock.Lock()
+	session := s.session(sessionID)
+	s.lock.Unlock()
+	if session == nil {
+		return nil, errNotSignedIn
+	}
+	return s.userStore.GetUserByID(ctx, session.UserID)
+}
+
+// UpdateProfile implements the `account` interface of the account portal
+// it writes the Claim fields back to the User, the portal only passes the fields the users may edit
+func (s *Storage) UpdateProfile(ctx context.Context, user *kimv1.User, values map[string]string) error {
+	err := s.userStore.UpdateClaims(ctx, user, values)
+	audit.Record(ctx, audit.Event{
+		Type:    audit.UserChanged,
+		Outcome: audit.OutcomeOf(err),
+		Actor:   audit.Actor{Subject: UserSubject(user)},
+		Target:  userTarget(user),
+		Details: map[string]string{"source": "account"},
+	})
+	return err
+}
+
+// ChangePassword implements the `account` interface of the account portal
+// the current password is required, wrong passwords count towards the lockout of the user.
+// The other sessions of the user and the tokens not issued in the session of the portal are ended,
+// as they may have been gained by the old password
+func (s *Storage) ChangePassword(ctx context.Context, user *kimv1.User, sessionID, current, password string) error {
+	if err := s.verifyCurrentPassword(ctx, user, current); err != nil {
+		return err
+	}
+	if len(password) < MinPasswordLength {
+		return errPasswordTooShort
+	}
+	err := s.userStore.SetPassword(ctx, user, "", password)
+	audit.Record(ctx, audit.Event{
+		Type:    audit.PasswordChanged,
+		Outcome: audit.OutcomeOf(err),
+		Actor:   audit.Actor{Subject: UserSubject(user)},
+		Target:  userTarget(user),
+	})
+	if err != nil {
+		return err
+	}
+	s.endOtherSessions(ctx, user, sessionID)
+	return nil
+}
+
+// endOtherSessions ends the sessions of the user but the one of the id and removes the tokens of the user
+// not issued in it
+func (s *Storage) endOtherSessions(ctx context.Context, user *kimv1.User, sessionID string) {
+	subject := UserSubject(user)
+	s.lock.Lock()
+	for id, session := range s.sessions {
+		if id != sessionID && session.UserID == subject {
+			s.endSession(ctx, session, AccountClientID)
+		}
+	}
+	s.terminateTokens(func(token *Token) bool {
+		return token.SessionID != sessionID && s.userSubject(token.Subject) == subject
+	})
+	for id, token := range s.refreshTokens {
+		if token.SessionID != sessionID && s.userSubject(token.UserID) == subject {
+			delete(s.refreshTokens, id)
+		}
+	}
+	s.lock.Unlock()
+	s.auditRevocation(ctx, subject, AccountClientID, "all")
+}
+
+// TOTPEnrolled implements the `account` interface of the account portal
+func (s *Storage) TOTPEnrolled(ctx context.Context, user *kimv1.User) (bool, error) {
+	return s.requiresOTP(ctx, user)
+}
+
+// EnrollTOTP implements the `account` interface of the account portal
+// the secret is only stored once the user proved to have added it to an authenticator app by a valid code.
+// An enrolled factor is not replaced, it must be removed by the password first
+func (s *Storage) EnrollTOTP(ctx context.Context, user *kimv1.User, secret, code string) error {
+	enrolled, err := s.requiresOTP(ctx, user)
+	if err != nil {
+		return err
+	}
+	if enrolled {
+		return errTOTPEnrolled
+	}
+	if _, ok := validateTOTP(secret, code, time.Now()); !ok {
+		return errInvalidOTPSecret
+	}
+	err = s.userStore.SetTOTPSecret(ctx, user, secret)
+	audit.Record(ctx, audit.Event{
+		Type:    audit.MFAEnrolled,
+		Outcome: audit.OutcomeOf(err),
+		Actor:   audit.Actor{Subject: UserSubject(user)},
+		Target:  userTarget(user),
+		Details: map[string]string{"factor": "totp"},
+	})
+	return err
+}
+
+// RemoveTOTP implements the `account` interface of the account portal
+// the current password is required to remove the second factor
+func (s *Storage) RemoveTOTP(ctx context.Context, user *kimv1.User, password string) error {
+	if err := s.verifyCurrentPassword(ctx, user, password); err != nil {
+		return err
+	}
+	err := s.userStore.SetTOTPSecret(ctx, user, "")
+	audit.Record(ctx, audit.Event{
+		Type:    audit.MFARemoved,
+		Outcome: audit.OutcomeOf(err),
+		Actor:   audit.Actor{Subject: UserSubject(user)},
+		Target:  userTarget(user),
+		Details: map[string]string{"factor": "totp"},
+	})
+	return err
+}
+
+// UserSessions implements the `account` interface of the account portal
+// it returns copies of the active sessions of the user, the latest first
+func (s *Storage) UserSessions(ctx context.Context, user *kimv1.User) []Session {
+	subject := UserSubject(user)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var sessions []Session
+	for id := range s.sessions {
+		if session := s.session(id); session != nil && session.UserID == subject {
+			copied := *session
+			copied.Clients = slices.Clone(session.Clients)
+			sessions = append(sessions, copied)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].AuthTime.After(sessions[j].AuthTime)
+	})
+	return sessions
+}
+
+// RevokeUserSession implements the `account` interface of the account portal
+// it ends the session of the user like a logout, the clients are notified by back-channel logout
+func (s *Storage) RevokeUserSession(ctx context.Context, user *kimv1.User, sessionID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	session := s.session(sessionID)
+	if session == nil || session.UserID != UserSubject(user) {
+		return errSessionNotFound
+	}
+	s.endSession(ctx, session, AccountClientID)
+	return nil
+}
+
+// AuthorizedClients implements the `account` interface of the account portal
+// it returns the clients holding tokens of the user
+func (s *Storage) AuthorizedClients(ctx context.Context, user *kimv1.User) []string {
+	subject := UserSubject(user)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var clientIDs []string
+	for _, token := range s.tokens {
+		if s.userSubject(token.Subject) == subject && !slices.Contains(clientIDs, token.ApplicationID) {
+			clientIDs = append(clientIDs, token.ApplicationID)
+		}
+	}
+	for _, token := range s.refreshTokens {
+		if s.userSubject(token.UserID) == subject && !slices.Contains(clientIDs, token.ApplicationID) {
+			clientIDs = append(clientIDs, token.ApplicationID)
+		}
+	}
+	sort.Strings(clientIDs)
+	return clientIDs
+}
+
+// RevokeUserClient implements the `account` interface of the account portal
+// it removes all access and refresh tokens of the user issued to the client
+func (s *Storage) RevokeUserClient(ctx context.Context, user *kimv1.User, clientID string) error {
+	subject := UserSubject(user)
+	s.lock.Lock()
+	s.terminateTokens(func(token *Token) bool {
+		return token.ApplicationID == clientID && s.userSubject(token.Subject) == subject
+	})
+	for id, token := range s.refreshTokens {
+		if token.ApplicationID == clientID && s.userSubject(token.UserID) == subject {
+			delete(s.refreshTokens, id)
+		}
+	}
+	// the target of the audit event is looked up, which must not block the other requests
+	s.lock.Unlock()
+	s.auditRevocation(ctx, subject, clientID, "all")
+	return nil
+}
+
+// verifyCurrentPassword confirms a sensitive change by the password of the user
+func (s *Storage) verifyCurrentPassword(ctx context.Context, user *kimv1.User, password string) error {
+	ipKey, userKey := sourceKey(ctx), lockout.UserKey(user.Namespace, user.Name)
+	if err := s.reserveLogin(ctx, ipKey, userKey); err != nil {
+		return err
+	}
+	if err := s.userStore.VerifyPassword(ctx, user, password); err != nil {
+		s.loginFailed(ctx, ipKey, userKey, user)
+		return errInvalidCredentials
+	}
+	s.releaseLogin(ctx, ipKey, userKey)
+	return nil
+}
@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+// credentialStore keeps the password and the TOTP secret of a single user in memory
+type credentialStore struct {
+	UserStore
+	user     *kimv1.User
+	password string
+	totp     string
+}
+
+func (s *credentialStore) GetUserByID(context.Context, string) (*kimv1.User, error) {
+	return s.user, nil
+}
+
+func (s *credentialStore) VerifyPassword(_ context.Context, _ *kimv1.User, password string) error {
+	if password != s.password {
+		return errors.New("wrong password")
+	}
+	return nil
+}
+
+func (s *credentialStore) SetPassword(_ context.Context, _ *kimv1.User, _, password string) error {
+	s.password = password
+	return nil
+}
+
+func (s *credentialStore) TOTPSecret(context.Context, *kimv1.User) (string, error) {
+	return s.totp, nil
+}
+
+func (s *credentialStore) SetTOTPSecret(_ context.Context, _ *kimv1.User, secret string) error {
+	s.totp = secret
+	return nil
+}
+
+func accountUser(name string) *kimv1.User {
+	return &kimv1.User{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: name, UID: types.UID("uid-" + name)}}
+}
+
+// currentTOTP returns the code of the secret at the time
+func currentTOTP(t *testing.T, secret string, now time.Time) string {
+	t.Helper()
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return totpCode(key, uint64(now.Unix()/totpPeriod))
+}
+
+func TestAccountLogin(t *testing.T) {
+	ctx := context.Background()
+	s := NewStorageWithClients(nil, map[string]*Client{})
+	for id, request := range map[string]*AuthRequest{
+		"account": {ApplicationID: AccountClientID, SessionID: "sid", done: true},
+		"pending": {ApplicationID: AccountClientID, SessionID: "sid"},
+		"web":     {ApplicationID: "web", SessionID: "sid", done: true},
+	} {
+		request.ID = id
+		s.authRequests[id] = request
+		s.codes["code-"+id] = id
+	}
+
+	if sessionID, err := s.AccountLogin(ctx, "code-account"); err != nil || sessionID != "sid" {
+		t.Fatalf("AccountLogin() = %q, %v, want the session", sessionID, err)
+	}
+	for _, code := range []string{"code-account", "code-pending", "code-web", "unknown"} {
+		if _, err := s.AccountLogin(ctx, code); !errors.Is(err, errNotSignedIn) {
+			t.Errorf("AccountLogin(%s) = %v, want %v", code, err, errNotSignedIn)
+		}
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	ctx := context.Background()
+	alice := accountUser("alice")
+	store := &credentialStore{user: alice, password: "old-password"}
+	s := NewStorageWithClients(store, map[string]*Client{})
+	expiration := time.Now().Add(time.Hour)
+	for _, session := range []*Session{
+		{ID: "current", UserID: "uid-alice", Expiration: expiration},
+		{ID: "other", UserID: "uid-alice", Expiration: expiration},
+		{ID: "bob", UserID: "uid-bob", Expiration: expiration},
+	} {
+		s.sessions[session.ID] = session
+	}
+	for _, token := range []*Token{
+		{ID: "current", Subject: "uid-alice", SessionID: "current", RefreshTokenID: "current"},
+		{ID: "other", Subject: "uid-alice", SessionID: "other", RefreshTokenID: "other"},
+		{ID: "sessionless", Subject: "uid-alice"},
+		{ID: "bob", Subject: "uid-bob", SessionID: "bob", RefreshTokenID: "bob"},
+	} {
+		s.tokens[token.ID] = token
+	}
+	for _, token := range []*RefreshToken{
+		{ID: "current", UserID: "uid-alice", SessionID: "current"},
+		{ID: "other", UserID: "uid-alice", SessionID: "other"},
+		{ID: "orphan", UserID: "uid-alice"},
+		{ID: "bob", UserID: "uid-bob", SessionID: "bob"},
+	} {
+		s.refreshTokens[token.ID] = token
+	}
+
+	if err := s.ChangePassword(ctx, alice, "current", "wrong", "new-password"); !errors.Is(err, errInvalidCredentials) {
+		t.Fatalf("ChangePassword() with a wrong password = %v, want %v", err, errInvalidCredentials)
+	}
+	if len(s.sessions) != 3 || len(s.tokens) != 4 {
+		t.Fatal("a failed password change ended sessions")
+	}
+	if err := s.ChangePassword(ctx, alice, "current", "old-password", "new-password"); err != nil {
+		t.Fatal(err)
+	}
+	if store.password != "new-password" {
+		t.Fatal("the password was not changed")
+	}
+	for _, kept := range []string{"current", "bob"} {
+		if s.sessions[kept] == nil || s.tokens[kept] == nil || s.refreshTokens[kept] == nil {
+			t.Errorf("the session and tokens of %s were ended", kept)
+		}
+	}
+	if s.sessions["other"] != nil || s.tokens["other"] != nil || s.tokens["sessionless"] != nil ||
+		s.refreshTokens["other"] != nil || s.refreshTokens["orphan"] != nil {
+		t.Error("the other sessions and tokens of the user were not ended")
+	}
+}
+
+func TestEnrollTOTP(t *testing.T) {
+	ctx := context.Background()
+	alice := accountUser("alice")
+	store := &credentialStore{user: alice, password: "password"}
+	s := NewStorageWithClients(store, map[string]*Client{})
+	secret := NewTOTPSecret()
+
+	if err := s.EnrollTOTP(ctx, alice, secret, "abcdef"); !errors.Is(err, errInvalidOTPSecret) {
+		t.Fatalf("EnrollTOTP() with a wrong code = %v, want %v", err, errInvalidOTPSecret)
+	}
+	if err := s.EnrollTOTP(ctx, alice, secret, currentTOTP(t, secret, time.Now())); err != nil {
+		t.Fatal(err)
+	}
+	if store.totp != secret {
+		t.Fatal("the secret was not stored")
+	}
+	// without the password, a hijacked session must not take over the second factor
+	replacement := NewTOTPSecret()
+	if err := s.EnrollTOTP(ctx, alice, replacement, currentTOTP(t, replacement, time.Now())); !errors.Is(err, errTOTPEnrolled) {
+		t.Fatalf("EnrollTOTP() of an enrolled user = %v, want %v", err, errTOTPEnrolled)
+	}
+	if store.totp != secret {
+		t.Fatal("the enrolled secret was replaced")
+	}
+	if err := s.RemoveTOTP(ctx, alice, "wrong"); !errors.Is(err, errInvalidCredentials) {
+		t.Fatalf("RemoveTOTP() with a wrong password = %v, want %v", err, errInvalidCredentials)
+	}
+	if err := s.RemoveTOTP(ctx, alice, "password"); err != nil || store.totp != "" {
+		t.Fatalf("RemoveTOTP() = %v, secret %q", err, store.totp)
+	}
+}
+
+func TestCheckOTPReuse(t *testing.T) {
+	ctx := context.Background()
+	alice := accountUser("alice")
+	secret := NewTOTPSecret()
+	s := NewStorageWithClients(&credentialStore{user: alice, totp: secret}, map[string]*Client{})
+	code := currentTOTP(t, secret, time.Now())
+
+	if err := s.checkOTP(ctx, "login", "web", alice, code); err != nil {
+		t.Fatalf("checkOTP() = %v", err)
+	}
+	if err := s.checkOTP(ctx, "login", "web", alice, code); !errors.Is(err, errInvalidOTP) {
+		t.Fatalf("checkOTP() of a used code = %v, want %v", err, errInvalidOTP)
+	}
+}
+
+func TestRevokeUserSession(t *testing.T) {
+	ctx := context.Background()
+	alice, bob := accountUser("alice"), accountUser("bob")
+	s := NewStorageWithClients(&credentialStore{user: alice}, map[string]*Client{})
+	s.sessions["sid"] = &Session{ID: "sid", UserID: "uid-alice", Expiration: time.Now().Add(time.Hour)}
+
+	if err := s.RevokeUserSession(ctx, bob, "sid"); !errors.Is(err, errSessionNotFound) {
+		t.Fatalf("RevokeUserSession() of another user = %v, want %v", err, errSessionNotFound)
+	}
+	if s.sessions["sid"] == nil {
+		t.Fatal("the session was ended by another user")
+	}
+	if err := s.RevokeUserSession(ctx, alice, "sid"); err != nil {
+		t.Fatal(err)
+	}
+	if s.sessions["sid"] != nil {
+		t.Fatal("the session was not ended")
+	}
+}
+
+func TestRevokeUserClient(t *testing.T) {
+	ctx := context.Background()
+	alice := accountUser("alice")
+	s := NewStorageWithClients(&credentialStore{user: alice}, map[string]*Client{})
+	s.tokens["alice"] = &Token{ID: "alice", ApplicationID: "web", Subject: "uid-alice", RefreshTokenID: "alice"}
+	s.tokens["bob"] = &Token{ID: "bob", ApplicationID: "web", Subject: "uid-bob", RefreshTokenID: "bob"}
+	s.tokens["api"] = &Token{ID: "api", ApplicationID: "api", Subject: "uid-alice"}
+	s.refreshTokens["alice"] = &RefreshToken{ID: "alice", ApplicationID: "web", UserID: "uid-alice"}
+	s.refreshTokens["bob"] = &RefreshToken{ID: "bob", ApplicationID: "web", UserID: "uid-bob"}
+
+	if err := s.RevokeUserClient(ctx, alice, "web"); err != nil {
+		t.Fatal(err)
+	}
+	if s.tokens["alice"] != nil || s.refreshTokens["alice"] != nil {
+		t.Error("the tokens of the user were not revoked")
+	}
+	if s.tokens["bob"] == nil || s.refreshTokens["bob"] == nil {
+		t.Error("the tokens of another user were revoked")
+	}
+	if s.tokens["api"] == nil {
+		t.Error("the tokens of another client were revoked")
+	}
+}
@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+
+	jose "github.com/go-jose/go-jose/v4"
+	"github.com/google/uuid"
+	"github.com/zitadel/oidc/v3/pkg/op"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+// retiredKeyLifetime is how long the public key of a rotated signing key is still published,
+// the tokens signed by it expire before
+const retiredKeyLifetime = time.Hour
+
+var errTokenNotFound = errors.New("token not found")
+
+// Principal is the subject of an active access token with the permissions of its Policies
+type Principal struct {
+	Subject  string
+	ClientID string
+	Audience []string
+	// Resource is the policy resource of the user or the machine client of the subject
+	Resource string
+	Rules    []kimv1.Rule
+}
+
+// TokenInfo describes an active access token, it does not carry the token itself
+type TokenInfo struct {
+	ID              string    `json:"id"`
+	Subject         string    `json:"subject"`
+	ClientID        string    `json:"clientId"`
+	Scopes          []string  `json:"scopes,omitempty"`
+	Audience        []string  `json:"audience,omitempty"`
+	SessionID       string    `json:"sessionId,omitempty"`
+	Expiration      time.Time `json:"expiration"`
+	HasRefreshToken bool      `json:"hasRefreshToken"`
+	// Actor is the subject of the actor of a delegated or impersonated token
+	Actor string `json:"actor,omitempty"`
+}
+
+// retiredKey is the public key of a rotated signing key, published until it expires
+type retiredKey struct {
+	publicKey
+	expiration time.Time
+}
+
+// TokenPrincipal returns the principal of the active access token of the id and the subject,
+// which are encrypted in the opaque tokens and the claims of the JWTs
+func (s *Storage) TokenPrincipal(ctx context.Context, tokenID, subject string) (*Principal, error) {
+	s.lock.Lock()
+	token, ok := s.tokens[tokenID]
+	s.lock.Unlock()
+	if !ok || token.Subject != subject || token.Expiration.Before(time.Now()) {
+		return nil, errTokenNotFound
+	}
+	rules, err := s.subjectPermissions(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	resource, err := s.subjectResource(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{
+		Subject:  subject,
+		ClientID: token.ApplicationID,
+		Audience: slices.Clone(token.Audience),
+		Resource: resource,
+		Rules:    rules,
+	}, nil
+}
+
+// SubjectResource returns the policy resource of the user or the machine client of the subject
+func (s *Storage) SubjectResource(ctx context.Context, subject string) (string, error) {
+	return s.subjectResource(ctx, subject)
+}
+
+// Sessions returns copies of all active sessions, the latest first
+func (s *Storage) Sessions(ctx context.Context) []Session {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sessions := make([]Session, 0, len(s.sessions))
+	for id := range s.sessions {
+		if session := s.session(id); session != nil {
+			copied := *session
+			copied.Clients = slices.Clone(session.Clients)
+			sessions = append(sessions, copied)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].AuthTime.After(sessions[j].AuthTime)
+	})
+	return sessions
+}
+
+// RevokeSession ends the session like a logout on behalf of the client, the clients are notified by
+// back-channel logout
+func (s *Storage) RevokeSession(ctx context.Context, sessionID, clientID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	session := s.session(sessionID)
+	if session == nil {
+		return errSessionNotFound
+	}
+	s.endSession(ctx, session, clientID)
+	return nil
+}
+
+// FindSession returns a copy of the active session of the id
+func (s *Storage) FindSession(ctx context.Context, sessionID string) (Session, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	session := s.session(sessionID)
+	if session == nil {
+		return Session{}, errSessionNotFound
+	}
+	copied := *session
+	copied.Clients = slices.Clone(session.Clients)
+	return copied, nil
+}
+
+// Tokens returns the active access tokens, the ones expiring first first
+func (s *Storage) Tokens(ctx context.Context) []TokenInfo {
+	now := time.Now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	tokens := make([]TokenInfo, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		if !token.Expiration.Before(now) {
+			tokens = append(tokens, tokenInfo(token))
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Expiration.Before(tokens[j].Expiration)
+	})
+	return tokens
+}
+
+// FindToken returns the active access token of the id
+func (s *Storage) FindToken(ctx context.Context, tokenID string) (TokenInfo, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	token, ok := s.tokens[tokenID]
+	if !ok || token.Expiration.Before(time.Now()) {
+		return TokenInfo{}, errTokenNotFound
+	}
+	return tokenInfo(token), nil
+}
+
+func tokenInfo(token *Token) TokenInfo {
+	info := TokenInfo{
+		ID:              token.ID,
+		Subject:         token.Subject,
+		ClientID:        token.ApplicationID,
+		Scopes:          slices.Clone(token.Scopes),
+		Audience:        slices.Clone(token.Audience),
+		SessionID:       token.SessionID,
+		Expiration:      token.Expiration,
+		HasRefreshToken: token.RefreshTokenID != "",
+	}
+	if token.Actor != nil {
+		info.Actor = token.Actor.Subject
+	}
+	return info
+}
+
+// RevokeTokenByID removes the access token of the id and its refresh token
+func (s *Storage) RevokeTokenByID(ctx context.Context, tokenID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	token, ok := s.tokens[tokenID]
+	if !ok {
+		return errTokenNotFound
+	}
+	s.terminateTokens(func(t *Token) bool {
+		return t.ID == tokenID
+	})
+	s.auditRevocation(ctx, token.Subject, token.ApplicationID, "access_token")
+	return nil
+}
+
+// RevokeTokens removes the access and refresh tokens of the subject, the client or both, and returns how many
+// access tokens were revoked
+func (s *Storage) RevokeTokens(ctx context.Context, subject, clientID string) int {
+	match := func(tokenSubject, tokenClientID string) bool {
+		return (subject == "" || s.userSubject(tokenSubject) == s.userSubject(subject)) &&
+			(clientID == "" || tokenClientID == clientID)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	revoked := 0
+	s.terminateTokens(func(token *Token) bool {
+		if match(token.Subject, token.ApplicationID) {
+			revoked++
+			return true
+		}
+		return false
+	})
+	for id, token := range s.refreshTokens {
+		if match(token.UserID, token.ApplicationID) {
+			delete(s.refreshTokens, id)
+		}
+	}
+	s.auditRevocation(ctx, subject, clientID, "all")
+	return revoked
+}
+
+// RotateSigningKey signs the new tokens by a new random key and returns its id, the public key of the
+// previous key stays published until the tokens signed by it expired. The key is not shared with other
+// replicas, only the replica serving the rotation signs by the new key; the issuers signing by a key of
+// a Secret, e.g. the realms, rotate it by the Secret for all replicas.
+func (s *Storage) RotateSigningKey(ctx context.Context) (string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	s.retiredKeys = slices.DeleteFunc(s.retiredKeys, func(k retiredKey) bool {
+		return k.expiration.Before(now)
+	})
+	s.retiredKeys = append(s.retiredKeys, retiredKey{
+		publicKey:  publicKey{s.signingKey},
+		expiration: now.Add(retiredKeyLifetime),
+	})
+	s.signingKey = signingKey{
+		id:        uuid.NewString(),
+		algorithm: jose.RS256,
+		key:       key,
+	}
+	return s.signingKey.id, nil
+}
+
+// publicKeys returns the public keys of the current and the retired signing keys
+// the caller must hold the lock
+func (s *Storage) publicKeys() []op.Key {
+	now := time.Now()
+	keys := []op.Key{&publicKey{s.signingKey}}
+	for i := range s.retiredKeys {
+		if s.retiredKeys[i].expiration.After(now) {
+			keys = append(keys, &s.retiredKeys[i].publicKey)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRotateSigningKey(t *testing.T) {
+	s := NewStorageWithClients(nil, map[string]*Client{})
+	ctx := context.Background()
+	previous, err := s.SigningKey(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := s.RotateSigningKey(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := s.SigningKey(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.ID() != id || id == previous.ID() {
+		t.Errorf("SigningKey() = %s after the rotation to %s from %s", current.ID(), id, previous.ID())
+	}
+	keys, err := s.KeySet(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	published := map[string]bool{}
+	for _, key := range keys {
+		published[key.ID()] = true
+	}
+	if len(keys) != 2 || !published[id] || !published[previous.ID()] {
+		t.Errorf("KeySet() publishes %v, want %s and %s", published, id, previous.ID())
+	}
+}
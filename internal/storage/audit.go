@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/zitadel/oidc/v3/pkg/op"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/audit"
+)
+
+// userTarget returns the audit target of the user
+func userTarget(user *kimv1.User) *audit.Target {
+	return &audit.Target{
+		Kind:      "User",
+		Namespace: user.Namespace,
+		Name:      user.Name,
+	}
+}
+
+// subjectTarget returns the audit target of the user identified by the subject (see UserSubject) or
+// by a pairwise subject, or nil if the subject is no user, e.g. a service user of the client credentials grant
+func (s *Storage) subjectTarget(ctx context.Context, subject string) *audit.Target {
+	user, err := s.userStore.GetUserByID(ctx, s.userSubject(subject))
+	if err != nil {
+		return nil
+	}
+	return userTarget(user)
+}
+
+// auditToken records the issuance of a token for the request
+// it must not be called while holding the lock, as the grant type lookup acquires it
+func (s *Storage) auditToken(ctx context.Context, eventType audit.Type, request op.TokenRequest, clientID string, err error) {
+	event := audit.Event{
+		Type:    eventType,
+		Outcome: audit.OutcomeOf(err),
+		Actor: audit.Actor{
+			Subject:  request.GetSubject(),
+			ClientID: clientID,
+		},
+		Target: s.subjectTarget(ctx, request.GetSubject()),
+		Details: map[string]string{
+			"grant_type": string(s.grantTypeFromRequest(request)),
+			"scope":      strings.Join(request.GetScopes(), " "),
+		},
+	}
+	if sessionID := sessionFromRequest(request); sessionID != "" {
+		event.Details["sid"] = sessionID
+	}
+	if err != nil {
+		event.Reason = err.Error()
+	}
+	audit.Record(ctx, event)
+}
+
+// auditRevocation records the revocation of a token of the subject by the client
+func (s *Storage) auditRevocation(ctx context.Context, subject, clientID, tokenType string) {
+	audit.Record(ctx, audit.Event{
+		Type:    audit.TokenRevoked,
+		Outcome: audit.Success,
+		Actor: audit.Actor{
+			Subject:  subject,
+			ClientID: clientID,
+		},
+		Target:  s.subjectTarget(ctx, subject),
+		Details: map[string]string{"token_type": tokenType},
+	})
+}
+
+// auditSession records the resumption or end of a single sign-on session, the target is the user resolved at the
+// login, so that the sessions can be audited while holding the lock
+func (s *Storage) auditSession(ctx context.Context, eventType audit.Type, session *Session, clientID string) {
+	audit.Record(ctx, audit.Event{
+		Type:    eventType,
+		Outcome: audit.Success,
+		Actor: audit.Actor{
+			Subject:  session.UserID,
+			Username: session.Username,
+			ClientID: clientID,
+		},
+		Target:  session.target,
+		Details: map[string]string{"sid": session.ID},
+	})
+}
+
+// auditConsent records the scopes granted to the client by the completed auth request; there is no consent page,
+// the user consents by signing in to the client
+func (s *Storage) auditConsent(ctx context.Context, request *AuthRequest, target *audit.Target) {
+	audit.Record(ctx, audit.Event{
+		Type:    audit.ConsentGranted,
+		Outcome: audit.Success,
+		Actor: audit.Actor{
+			Subject:  request.UserID,
+			Username: request.username,
+			ClientID: request.ApplicationID,
+		},
+		Target:  target,
+		Details: map[string]string{"scope": strings.Join(request.Scopes, " ")},
+	})
+}
@@ -13,6 +13,11 @@ var (
 		return "/login/username?authRequestID=" + id
 	}
 
+	// the logout page renders the front-channel logout iframes of the ended session (identified by the id)
+	defaultLogoutURL = func(id string) string {
+		return "/logout?logoutID=" + id
+	}
+
 	// clients to be used by the storage interface
 	clients = map[string]*Client{}
 )
@@ -34,6 +39,12 @@ type Client struct {
 	clockSkew                      time.Duration
 	postLogoutRedirectURIGlobs     []string
 	redirectURIGlobs               []string
+	postLogoutRedirectURIs         []string
+	frontChannelLogoutURI          string
+	backChannelLogoutURI           string
+	theme                          string
+	// sector of the pairwise subjects, empty for public subjects
+	sector string
 }
 
 // GetID must return the client_id
@@ -48,7 +59,17 @@ func (c *Client) RedirectURIs() []string {
 
 // PostLogoutRedirectURIs must return the registered post_logout_redirect_uris for sign-outs
 func (c *Client) PostLogoutRedirectURIs() []string {
-	return []string{}
+	return c.postLogoutRedirectURIs
+}
+
+// FrontChannelLogoutURI is loaded in an iframe by the logout page when the user signs out of the session
+func (c *Client) FrontChannelLogoutURI() string {
+	return c.frontChannelLogoutURI
+}
+
+// BackChannelLogoutURI receives the logout token when the user signs out of the session
+func (c *Client) BackChannelLogoutURI() string {
+	return c.backChannelLogoutURI
 }
 
 // ApplicationType must return the type of the client (app, native, user agent)
@@ -78,6 +99,11 @@ func (c *Client) LoginURL(id string) string {
 	return c.loginURL(id)
 }
 
+// Theme returns the theme of the login pages of the client, the default theme if empty
+func (c *Client) Theme() string {
+	return c.theme
+}
+
 // AccessTokenType must return the type of access token the client uses (Bearer (opaque) or JWT)
 func (c *Client) AccessTokenType() op.AccessTokenType {
 	return c.accessTokenType
@@ -193,7 +219,8 @@ func WebClient(id, secret string, redirectURIs ...string) *Client {
 	}
 }
 
-// DeviceClient creates a device client with Basic authentication.
+// DeviceClient creates a device client with Basic authentication, its tokens may be refreshed, e.g. by
+// command line tools signed in on a device without a browser
 func DeviceClient(id, secret string) *Client {
 	return &Client{
 		id:                             id,
@@ -203,7 +230,7 @@ func DeviceClient(id, secret string) *Client {
 		authMethod:                     oidc.AuthMethodBasic,
 		loginURL:                       defaultLoginURL,
 		responseTypes:                  []oidc.ResponseType{oidc.ResponseTypeCode},
-		grantTypes:                     []oidc.GrantType{oidc.GrantTypeDeviceCode},
+		grantTypes:                     []oidc.GrantType{oidc.GrantTypeDeviceCode, oidc.GrantTypeRefreshToken},
 		accessTokenType:                op.AccessTokenTypeBearer,
 		devMode:                        false,
 		idTokenUserinfoClaimsAssertion: false,
@@ -211,6 +238,28 @@ func DeviceClient(id, secret string) *Client {
 	}
 }
 
+// WithLogout registers the post_logout_redirect_uris and the front- and back-channel logout endpoints of the client
+func (c *Client) WithLogout(postLogoutRedirectURIs []string, frontChannelLogoutURI, backChannelLogoutURI string) *Client {
+	c.postLogoutRedirectURIs = postLogoutRedirectURIs
+	c.frontChannelLogoutURI = frontChannelLogoutURI
+	c.backChannelLogoutURI = backChannelLogoutURI
+	return c
+}
+
+// WithBasePath prefixes the login UI of the client with the path of its issuer
+func (c *Client) WithBasePath(base string) *Client {
+	c.loginURL = func(id string) string {
+		return base + defaultLoginURL(id)
+	}
+	return c
+}
+
+// WithTheme selects the theme of the login pages shown to the users of the client
+func (c *Client) WithTheme(theme string) *Client {
+	c.theme = theme
+	return c
+}
+
 type hasRedirectGlobs struct {
 	*Client
 }
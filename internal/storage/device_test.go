@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+// lockCheckingStore fails the test if a user is looked up while the lock of the storage is held
+type lockCheckingStore struct {
+	UserStore
+	t       *testing.T
+	storage *Storage
+}
+
+func (s *lockCheckingStore) GetUserByID(context.Context, string) (*kimv1.User, error) {
+	if !s.storage.lock.TryLock() {
+		s.t.Error("the user is looked up while holding the lock")
+		return nil, errors.New("locked")
+	}
+	s.storage.lock.Unlock()
+	return &kimv1.User{}, nil
+}
+
+func TestCompleteDeviceAuthorization(t *testing.T) {
+	ctx := context.Background()
+	s := NewStorageWithClients(nil, map[string]*Client{"device": DeviceClient("device", "secret")})
+	s.userStore = &lockCheckingStore{t: t, storage: s}
+	if err := s.StoreDeviceAuthorization(ctx, "device", "device-code", "USER-CODE", time.Now().Add(time.Minute),
+		[]string{"openid"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.CompleteDeviceAuthorization(ctx, "USER-CODE", "uid-alice"); err != nil {
+		t.Fatal(err)
+	}
+	state, err := s.GetDeviceAuthorizatonState(ctx, "device", "device-code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Done || state.Subject != "uid-alice" {
+		t.Errorf("the device authorization is %+v, want done for uid-alice", state)
+	}
+	if err = s.CompleteDeviceAuthorization(ctx, "UNKNOWN", "uid-alice"); err == nil {
+		t.Error("CompleteDeviceAuthorization() of an unknown user code succeeded")
+	}
+}
@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+	"github.com/zitadel/oidc/v3/pkg/op"
+
+	"github.com/crochee/kim/internal/audit"
+	"github.com/crochee/kim/internal/policy"
+	"github.com/crochee/kim/internal/tracing"
+)
+
+// DefaultMaxDelegationDepth is the default number of actors a token may be delegated to or impersonated by
+const DefaultMaxDelegationDepth = 2
+
+// WithMaxDelegationDepth limits the length of the act claim chains of the exchanged tokens
+func (s *Storage) WithMaxDelegationDepth(depth int) *Storage {
+	s.maxDelegationDepth = depth
+	return s
+}
+
+// ValidateTokenExchangeRequest implements the op.TokenExchangeStorage interface
+// it will be called to validate parsed Token Exchange Grant request. The delegation to the actor of the
+// actor_token needs the delegate action on the subject and the impersonation of the subject of the
+// impersonate scope the impersonate action, both granted by the Policies of the actor.
+func (s *Storage) ValidateTokenExchangeRequest(ctx context.Context, request op.TokenExchangeRequest) (err error) {
+	defer func() {
+		if err != nil {
+			s.auditExchange(ctx, request, err)
+		}
+	}()
+	var target string
+	scopes := make([]string, 0, len(request.GetScopes()))
+	for _, scope := range request.GetScopes() {
+		if strings.HasPrefix(scope, CustomScopeImpersonatePrefix) {
+			target = strings.TrimPrefix(scope, CustomScopeImpersonatePrefix)
+			continue
+		}
+		scopes = append(scopes, scope)
+	}
+
+	switch {
+	case request.GetExchangeActor() != "" && target != "":
+		return oidc.ErrInvalidRequest().WithDescription("a token can not be delegated and impersonated at once")
+	case request.GetExchangeActor() != "":
+		err = s.authorizeExchange(ctx, request.GetExchangeActor(), policy.ActionDelegate, request.GetExchangeSubject())
+	case target != "":
+		err = s.authorizeExchange(ctx, request.GetExchangeSubject(), policy.ActionImpersonate, target)
+		request.SetSubject(target)
+	}
+	if err != nil {
+		return err
+	}
+
+	actor := s.exchangeActor(request)
+	if request.GetRequestedTokenType() == "" {
+		if actor != nil {
+			request.SetRequestedTokenType(oidc.AccessTokenType)
+		} else {
+			request.SetRequestedTokenType(oidc.RefreshTokenType)
+		}
+	}
+	if request.GetRequestedTokenType() == oidc.RefreshTokenType {
+		switch {
+		case request.GetExchangeSubjectTokenType() == oidc.IDTokenType:
+			return oidc.ErrInvalidRequest().WithDescription("exchanging id_token to refresh_token is not supported")
+		case actor != nil:
+			// a refreshed token would lose its act claim
+			return oidc.ErrInvalidRequest().WithDescription("delegated and impersonated tokens can not be refreshed")
+		}
+	}
+	if depth := actorDepth(actor); depth > s.maxDelegationDepth {
+		return oidc.ErrAccessDenied().WithDescription("the token would have %d actors, at most %d are allowed",
+			depth, s.maxDelegationDepth)
+	}
+
+	request.SetCurrentScopes(scopes)
+	return nil
+}
+
+// authorizeExchange checks that the Policies of the principal allow the action on the subject
+func (s *Storage) authorizeExchange(ctx context.Context, principal, action, subject string) error {
+	rules, err := s.subjectPermissions(ctx, principal)
+	if err != nil {
+		return oidc.ErrAccessDenied().WithDescription("%s has no permissions", principal).WithParent(err)
+	}
+	resource, err := s.subjectResource(ctx, subject)
+	if err != nil {
+		return oidc.ErrInvalidTarget().WithDescription("unknown subject %s", subject).WithParent(err)
+	}
+	if !policy.Allowed(rules, resource, action) {
+		return oidc.ErrAccessDenied().WithDescription("%s is not allowed to %s %s", principal, action, resource)
+	}
+	return nil
+}
+
+// exchangeActor returns the act claim of the token exchanged for, it nests the actors of the subject_token:
+// the actor of the actor_token for a delegation, the subject of the subject_token for an impersonation,
+// or else the unchanged actors of the subject_token
+func (s *Storage) exchangeActor(request op.TokenExchangeRequest) *oidc.ActorClaims {
+	var prior *oidc.ActorClaims
+	func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if token, ok := s.tokens[request.GetExchangeSubjectTokenIDOrToken()]; ok {
+			prior = token.Actor
+		}
+	}()
+	switch {
+	case request.GetExchangeActor() != "":
+		return &oidc.ActorClaims{Subject: request.GetExchangeActor(), Actor: prior}
+	case request.GetSubject() != request.GetExchangeSubject():
+		return &oidc.ActorClaims{Subject: request.GetExchangeSubject(), Actor: prior}
+	default:
+		return prior
+	}
+}
+
+// exchangeSession returns the single sign-on session of the subject_token, so that the logout of the session
+// terminates the exchanged tokens as well
+func (s *Storage) exchangeSession(request op.TokenExchangeRequest) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	id := request.GetExchangeSubjectTokenIDOrToken()
+	if token, ok := s.tokens[id]; ok {
+		return token.SessionID
+	}
+	if token, ok := s.refreshTokens[id]; ok {
+		return token.SessionID
+	}
+	return ""
+}
+
+// actorDepth returns the number of actors of the act claim chain
+func actorDepth(actor *oidc.ActorClaims) int {
+	depth := 0
+	for ; actor != nil; actor = actor.Actor {
+		depth++
+	}
+	return depth
+}
+
+// CreateTokenExchangeRequest implements the op.TokenExchangeStorage interface
+// it will be called once the request is validated, every exchange is recorded in the audit log
+func (s *Storage) CreateTokenExchangeRequest(ctx context.Context, request op.TokenExchangeRequest) error {
+	s.auditExchange(ctx, request, nil)
+	return nil
+}
+
+// auditExchange records the exchange of a token, the actor of the event is who acts on behalf of the subject
+func (s *Storage) auditExchange(ctx context.Context, request op.TokenExchangeRequest, err error) {
+	acting := request.GetExchangeActor()
+	if acting == "" {
+		acting = request.GetExchangeSubject()
+	}
+	event := audit.Event{
+		Type:    audit.TokenExchanged,
+		Outcome: audit.OutcomeOf(err),
+		Actor: audit.Actor{
+			Subject:  acting,
+			ClientID: request.GetClientID(),
+		},
+		Target: s.subjectTarget(ctx, request.GetSubject()),
+		Details: map[string]string{
+			"subject":              request.GetSubject(),
+			"subject_token_type":   string(request.GetExchangeSubjectTokenType()),
+			"requested_token_type": string(request.GetRequestedTokenType()),
+			"scope":                strings.Join(request.GetScopes(), " "),
+		},
+	}
+	if actor := s.exchangeActor(request); actor != nil {
+		event.Details["act_depth"] = strconv.Itoa(actorDepth(actor))
+	}
+	if err != nil {
+		event.Reason = err.Error()
+	}
+	audit.Record(ctx, event)
+}
+
+// GetPrivateClaimsFromTokenExchangeRequest implements the op.TokenExchangeStorage interface
+// it will be called for the creation of an exchanged JWT access token to assert claims for custom scopes
+// plus the act claim of the delegation or impersonation
+func (s *Storage) GetPrivateClaimsFromTokenExchangeRequest(ctx context.Context, request op.TokenExchangeRequest) (claims map[string]any, err error) {
+	claims, err = s.getPrivateClaimsFromScopes(ctx, "", request.GetClientID(), request.GetScopes())
+	if err != nil {
+		return nil, err
+	}
+	if actor := s.exchangeActor(request); actor != nil {
+		claims = appendClaim(claims, "act", actor)
+	}
+	return claims, nil
+}
+
+// SetUserinfoFromTokenExchangeRequest implements the op.TokenExchangeStorage interface
+// it will be called for the creation of an id_token - we are using the same private function as for other flows,
+// plus the act claim of the delegation or impersonation
+func (s *Storage) SetUserinfoFromTokenExchangeRequest(ctx context.Context, userinfo *oidc.UserInfo, request op.TokenExchangeRequest) error {
+	err := s.setUserinfo(ctx, userinfo, request.GetSubject(), request.GetClientID(), request.GetScopes())
+	if err != nil {
+		return err
+	}
+	if actor := s.exchangeActor(request); actor != nil {
+		userinfo.AppendClaims("act", actor)
+	}
+	return nil
+}
+
+// externalJWTRequest is the op.TokenRequest of a JWT the OP did not issue, verified by a TokenReview or a
+// WorkloadTrust, its subject is the MachineClient or the WorkloadTrust the token is issued for
+type externalJWTRequest struct {
+	oidc.JWTTokenRequest
+	grantType oidc.GrantType
+}
+
+// JWTExchangeTokenRequest implements the handle.JWTExchange interface
+// it will be called for the token exchange of a JWT subject token, which the OP does not verify as it only knows
+// its own tokens: the JWTs of the issuers of the WorkloadTrusts are verified by their keys and any other JWT
+// as a ServiceAccount token by a TokenReview
+func (s *Storage) JWTExchangeTokenRequest(ctx context.Context, token string, scopes []string) (op.TokenRequest, op.AccessTokenClient, op.AccessTokenType, error) {
+	return s.externalJWTTokenRequest(ctx, oidc.GrantTypeTokenExchange, token, scopes)
+}
+
+// JWTBearerTokenRequest implements the handle.JWTExchange interface
+// it will be called for the jwt-bearer grant of an assertion of the issuer of a WorkloadTrust
+func (s *Storage) JWTBearerTokenRequest(ctx context.Context, assertion string, scopes []string) (op.TokenRequest, op.AccessTokenClient, op.AccessTokenType, error) {
+	return s.externalJWTTokenRequest(ctx, oidc.GrantTypeBearer, assertion, scopes)
+}
+
+func (s *Storage) externalJWTTokenRequest(ctx context.Context, grantType oidc.GrantType, token string, scopes []string) (_ op.TokenRequest, _ op.AccessTokenClient, _ op.AccessTokenType, err error) {
+	ctx, span := tracing.Start(ctx, "Storage.externalJWTTokenRequest", tracing.GrantTypeKey.String(string(grantType)))
+	var external string
+	defer func() {
+		_ = tracing.Error(span, err)
+		span.End()
+		if err != nil {
+			s.auditExternalJWT(ctx, grantType, external, scopes, err)
+		}
+	}()
+	trusted, err := s.TrustedIssuer(ctx, jwtIssuer(token))
+	if err != nil {
+		return nil, nil, op.AccessTokenTypeBearer, err
+	}
+	var (
+		request *externalJWTRequest
+		client  *Client
+	)
+	switch {
+	case trusted:
+		external, request, client, err = s.workloadTokenRequest(ctx, grantType, token, scopes)
+	case grantType == oidc.GrantTypeTokenExchange && s.serviceAccounts != nil:
+		external, request, client, err = s.serviceAccountTokenRequest(ctx, grantType, token, scopes)
+	default:
+		err = oidc.ErrInvalidGrant().WithDescription("the issuer of the jwt is not trusted")
+	}
+	if err != nil {
+		return nil, nil, op.AccessTokenTypeBearer, err
+	}
+	return request, client, client.AccessTokenType(), nil
+}
+
+// auditExternalJWT records a rejected JWT the OP did not issue, the issued tokens are recorded as any other token
+func (s *Storage) auditExternalJWT(ctx context.Context, grantType oidc.GrantType, external string, scopes []string, err error) {
+	audit.Record(ctx, audit.Event{
+		Type:    audit.TokenExchanged,
+		Outcome: audit.OutcomeOf(err),
+		Actor:   audit.Actor{Subject: external},
+		Details: map[string]string{
+			"grant_type": string(grantType),
+			"scope":      strings.Join(scopes, " "),
+		},
+		Reason: err.Error(),
+	})
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+	"github.com/zitadel/oidc/v3/pkg/op"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/policy"
+)
+
+// exchangeRequest is the part of an op.TokenExchangeRequest the exchange is validated and its act claim built from
+type exchangeRequest struct {
+	op.TokenExchangeRequest
+	subject, exchangeSubject, exchangeActor, subjectToken string
+	scopes                                                []string
+	requestedTokenType                                    oidc.TokenType
+}
+
+func (r *exchangeRequest) GetSubject() string                          { return r.subject }
+func (r *exchangeRequest) GetExchangeSubject() string                  { return r.exchangeSubject }
+func (r *exchangeRequest) GetExchangeActor() string                    { return r.exchangeActor }
+func (r *exchangeRequest) GetExchangeSubjectTokenIDOrToken() string    { return r.subjectToken }
+func (r *exchangeRequest) GetExchangeSubjectTokenType() oidc.TokenType { return oidc.AccessTokenType }
+func (r *exchangeRequest) GetClientID() string                         { return "web" }
+func (r *exchangeRequest) GetScopes() []string                         { return r.scopes }
+func (r *exchangeRequest) SetCurrentScopes(scopes []string)            { r.scopes = scopes }
+func (r *exchangeRequest) GetRequestedTokenType() oidc.TokenType       { return r.requestedTokenType }
+func (r *exchangeRequest) SetRequestedTokenType(tokenType oidc.TokenType) {
+	r.requestedTokenType = tokenType
+}
+func (r *exchangeRequest) SetSubject(subject string) { r.subject = subject }
+
+func TestExchangeActor(t *testing.T) {
+	s := &Storage{tokens: map[string]*Token{
+		"plain":     {ID: "plain", Subject: "alice"},
+		"delegated": {ID: "delegated", Subject: "alice", Actor: &oidc.ActorClaims{Subject: "bob"}},
+	}}
+	tests := []struct {
+		name    string
+		request *exchangeRequest
+		want    []string
+	}{
+		{"exchange", &exchangeRequest{subject: "alice", exchangeSubject: "alice", subjectToken: "plain"}, nil},
+		{"delegation", &exchangeRequest{subject: "alice", exchangeSubject: "alice", exchangeActor: "carol",
+			subjectToken: "plain"}, []string{"carol"}},
+		{"impersonation", &exchangeRequest{subject: "dave", exchangeSubject: "alice", subjectToken: "plain"},
+			[]string{"alice"}},
+		{"nested delegation", &exchangeRequest{subject: "alice", exchangeSubject: "alice", exchangeActor: "carol",
+			subjectToken: "delegated"}, []string{"carol", "bob"}},
+		{"delegated exchange", &exchangeRequest{subject: "alice", exchangeSubject: "alice",
+			subjectToken: "delegated"}, []string{"bob"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actor := s.exchangeActor(tt.request)
+			if depth := actorDepth(actor); depth != len(tt.want) {
+				t.Fatalf("actorDepth() = %d, want %d", depth, len(tt.want))
+			}
+			for _, want := range tt.want {
+				if actor.Subject != want {
+					t.Errorf("actor = %s, want %s", actor.Subject, want)
+				}
+				actor = actor.Actor
+			}
+		})
+	}
+}
+
+func TestExchangeSession(t *testing.T) {
+	s := &Storage{
+		tokens:        map[string]*Token{"access": {ID: "access", Subject: "alice", SessionID: "sid-1"}},
+		refreshTokens: map[string]*RefreshToken{"refresh": {ID: "refresh", UserID: "alice", SessionID: "sid-2"}},
+	}
+	for subjectToken, want := range map[string]string{"access": "sid-1", "refresh": "sid-2", "unknown": ""} {
+		request := &exchangeRequest{subject: "alice", exchangeSubject: "alice", subjectToken: subjectToken}
+		if got := s.exchangeSession(request); got != want {
+			t.Errorf("exchangeSession(%s) = %q, want %q", subjectToken, got, want)
+		}
+	}
+}
+
+func TestValidateTokenExchangeRequest(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := kimv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	user := func(namespace, name string, policies ...string) *kimv1.User {
+		return &kimv1.User{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: types.UID("uid-" + name)},
+			Spec:       kimv1.UserSpec{Policies: policies},
+		}
+	}
+	support := &kimv1.Policy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "support"},
+		Spec: kimv1.PolicySpec{Rules: []kimv1.Rule{
+			{Resource: "user/team-a/*", Actions: []string{policy.ActionDelegate, policy.ActionImpersonate},
+				Effect: kimv1.EffectAllow},
+			{Resource: "user/team-a/bob", Actions: []string{policy.ActionImpersonate}, Effect: kimv1.EffectDeny},
+			// not confined to team-a, it grants nothing
+			{Resource: "user/*", Actions: []string{policy.ActionDelegate}, Effect: kimv1.EffectAllow},
+		}},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithIndex(&kimv1.User{}, IndexUserSubject, func(obj client.Object) []string {
+			return []string{UserSubject(obj.(*kimv1.User))}
+		}).
+		WithObjects(user("team-a", "alice", "support"), user("team-a", "bob"), user("team-a", "dave"),
+			user("team-b", "carol"), support).
+		Build()
+	s := NewStorageWithClients(UserStoreFromClient(c, DefaultUserLookup), nil).
+		WithMaxDelegationDepth(DefaultMaxDelegationDepth)
+	s.tokens["plain"] = &Token{ID: "plain", Subject: "uid-bob"}
+	s.tokens["delegated"] = &Token{ID: "delegated", Subject: "uid-bob",
+		Actor: &oidc.ActorClaims{Subject: "uid-dave", Actor: &oidc.ActorClaims{Subject: "uid-carol"}}}
+
+	tests := []struct {
+		name    string
+		request *exchangeRequest
+		want    *oidc.Error
+	}{
+		{"delegation", &exchangeRequest{subject: "uid-bob", exchangeSubject: "uid-bob", exchangeActor: "uid-alice",
+			subjectToken: "plain"}, nil},
+		{"impersonation", &exchangeRequest{subject: "uid-alice", exchangeSubject: "uid-alice", subjectToken: "plain",
+			scopes: []string{CustomScopeImpersonatePrefix + "uid-dave"}}, nil},
+		{"denied impersonation", &exchangeRequest{subject: "uid-alice", exchangeSubject: "uid-alice",
+			subjectToken: "plain", scopes: []string{CustomScopeImpersonatePrefix + "uid-bob"}}, oidc.ErrAccessDenied()},
+		{"other namespace", &exchangeRequest{subject: "uid-carol", exchangeSubject: "uid-carol",
+			exchangeActor: "uid-alice", subjectToken: "plain"}, oidc.ErrAccessDenied()},
+		{"no policies", &exchangeRequest{subject: "uid-alice", exchangeSubject: "uid-alice", exchangeActor: "uid-bob",
+			subjectToken: "plain"}, oidc.ErrAccessDenied()},
+		{"max delegation depth", &exchangeRequest{subject: "uid-bob", exchangeSubject: "uid-bob",
+			exchangeActor: "uid-alice", subjectToken: "delegated"}, oidc.ErrAccessDenied()},
+		{"refresh token", &exchangeRequest{subject: "uid-bob", exchangeSubject: "uid-bob", exchangeActor: "uid-alice",
+			subjectToken: "plain", requestedTokenType: oidc.RefreshTokenType}, oidc.ErrInvalidRequest()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.ValidateTokenExchangeRequest(context.Background(), tt.request)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("ValidateTokenExchangeRequest() = %v", err)
+				}
+				return
+			}
+			var oidcErr *oidc.Error
+			if !errors.As(err, &oidcErr) || oidcErr.ErrorType != tt.want.ErrorType {
+				t.Errorf("ValidateTokenExchangeRequest() = %v, want %s", err, tt.want.ErrorType)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/zitadel/oidc/v3/pkg/op"
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/audit"
+	"github.com/crochee/kim/internal/clientip"
+	"github.com/crochee/kim/internal/lockout"
+)
+
+var errUserCodeLocked = errors.New("too many failed attempts, the device authorization was denied")
+
+// lockoutGuards protect the password and user code entry against brute-force attacks,
+// nil guards disable the protection
+type lockoutGuards struct {
+	// users tracks the failed logins per user (or unknown login name)
+	users *lockout.Guard
+	// ips tracks the failed logins and unknown user codes per source address
+	ips *lockout.Guard
+	// userCodes tracks the failed logins per device user code, exceeding them denies the device authorization
+	userCodes *lockout.Guard
+}
+
+// WithLockout enables the brute-force protection of the logins, the guards should share a store
+// across all replicas of the server
+func (s *Storage) WithLockout(users, ips, userCodes *lockout.Guard) *Storage {
+	s.lockout = lockoutGuards{
+		users:     users,
+		ips:       ips,
+		userCodes: userCodes,
+	}
+	return s
+}
+
+// UnlockUser lifts the lockout of the user before it expires
+func (s *Storage) UnlockUser(ctx context.Context, user *kimv1.User) error {
+	return s.lockout.users.Reset(ctx, lockout.UserKey(user.Namespace, user.Name))
+}
+
+// CheckDeviceCredentials implements the `DeviceAuthenticate` interface of the device login
+// it checks the user code and the credentials (password and one-time code) of the user; wrong user codes count
+// as failed attempts of the source address, and the device authorization is denied after too many failed logins
+// with its user code
+func (s *Storage) CheckDeviceCredentials(ctx context.Context, userCode, username, password, otp string) (*op.DeviceAuthorizationState, error) {
+	ipKey := sourceKey(ctx)
+	if err := s.lockout.ips.Reserve(ctx, ipKey); err != nil {
+		return nil, err
+	}
+	state, err := s.GetDeviceAuthorizationByUserCode(ctx, userCode)
+	if err != nil {
+		if _, ferr := s.lockout.ips.Fail(ctx, ipKey); ferr != nil {
+			slog.Error("could not record failed user code", "error", ferr)
+		}
+		return nil, err
+	}
+	// the login reserves its own attempt of the source address
+	s.releaseLogin(ctx, ipKey, "")
+
+	codeKey := lockout.UserCodeKey(userCode)
+	if err = s.checkDeviceCredentials(ctx, state.ClientID, username, password, otp); err != nil {
+		codeState, ferr := s.lockout.userCodes.Fail(ctx, codeKey)
+		if ferr != nil {
+			slog.Error("could not record failed device login", "error", ferr)
+			return nil, err
+		}
+		if s.lockout.userCodes.Exceeded(codeState) {
+			// the user code might have leaked, so the device must start over
+			if derr := s.DenyDeviceAuthorization(ctx, userCode); derr != nil {
+				slog.Error("could not deny device authorization", "error", derr)
+			}
+			_ = s.lockout.userCodes.Reset(ctx, codeKey)
+			return nil, errUserCodeLocked
+		}
+		return nil, err
+	}
+	if err = s.lockout.userCodes.Reset(ctx, codeKey); err != nil {
+		slog.Error("could not reset failed device logins", "error", err)
+	}
+	return state, nil
+}
+
+// checkDeviceCredentials checks the password and, if the user enrolled a second factor, the one-time code
+func (s *Storage) checkDeviceCredentials(ctx context.Context, clientID, username, password, otp string) error {
+	user, err := s.checkCredentials(ctx, loginFlowDevice, clientID, username, password)
+	if err != nil {
+		return err
+	}
+	required, err := s.requiresOTP(ctx, user)
+	if err != nil || !required {
+		return err
+	}
+	if otp == "" {
+		return errOTPRequired
+	}
+	return s.checkOTP(ctx, loginFlowDevice, clientID, user, otp)
+}
+
+// sourceKey returns the lockout key of the source address of the request, or an empty key outside of requests
+func sourceKey(ctx context.Context) string {
+	ip := clientip.FromContext(ctx)
+	if ip == "" {
+		return ""
+	}
+	return lockout.IPKey(ip)
+}
+
+// reserveLogin reserves an attempt of the source address and of the user, see lockout.Guard.Reserve
+func (s *Storage) reserveLogin(ctx context.Context, ipKey, userKey string) error {
+	if err := s.lockout.ips.Reserve(ctx, ipKey); err != nil {
+		return err
+	}
+	if err := s.lockout.users.Reserve(ctx, userKey); err != nil {
+		s.releaseLogin(ctx, ipKey, "")
+		return err
+	}
+	return nil
+}
+
+// releaseLogin ends the reserved attempts of the source address and the user, which neither failed nor
+// reset the failures of the key; empty keys are ignored
+func (s *Storage) releaseLogin(ctx context.Context, ipKey, userKey string) {
+	if err := s.lockout.ips.Release(ctx, ipKey); err != nil {
+		slog.Error("could not release login attempt", "key", ipKey, "error", err)
+	}
+	if err := s.lockout.users.Release(ctx, userKey); err != nil {
+		slog.Error("could not release login attempt", "key", userKey, "error", err)
+	}
+}
+
+// loginFailed records the failed login of the source address and the user, which ends their reserved attempts;
+// a new lockout of a known user is reflected in its status
+func (s *Storage) loginFailed(ctx context.Context, ipKey, userKey string, user *kimv1.User) {
+	if _, err := s.lockout.ips.Fail(ctx, ipKey); err != nil {
+		slog.Error("could not record failed login", "key", ipKey, "error", err)
+	}
+	state, err := s.lockout.users.Fail(ctx, userKey)
+	if err != nil {
+		slog.Error("could not record failed login", "key", userKey, "error", err)
+		return
+	}
+	if user == nil || !state.Locked(time.Now()) {
+		return
+	}
+	audit.Record(ctx, audit.Event{
+		Type:    audit.UserLocked,
+		Outcome: audit.Success,
+		Target:  userTarget(user),
+		Details: map[string]string{"locked_until": state.LockedUntil.UTC().Format(time.RFC3339)},
+	})
+	if err = s.userStore.SetLocked(ctx, user, state.LockedUntil); err != nil {
+		slog.Error("could not set locked condition", "user", user.Name, "namespace", user.Namespace, "error", err)
+	}
+}
+
+// loginSucceeded forgets the failed logins and the reserved attempts of the user
+func (s *Storage) loginSucceeded(ctx context.Context, userKey string, user *kimv1.User) {
+	if err := s.lockout.users.Reset(ctx, userKey); err != nil {
+		slog.Error("could not reset failed logins", "key", userKey, "error", err)
+	}
+	if meta.IsStatusConditionTrue(user.Status.Conditions, kimv1.UserConditionLocked) {
+		if err := s.userStore.SetLocked(ctx, user, time.Time{}); err != nil {
+			slog.Error("could not clear locked condition", "user", user.Name, "namespace", user.Namespace, "error", err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/lockout"
+)
+
+// lookupStore fails every lookup of a user by the error
+type lookupStore struct {
+	UserStore
+	err error
+}
+
+func (s *lookupStore) GetUserByUsername(context.Context, string) (*kimv1.User, error) {
+	return nil, s.err
+}
+
+func (s *lookupStore) GetUserByID(context.Context, string) (*kimv1.User, error) {
+	return nil, s.err
+}
+
+func TestCheckCredentialsLookupFailure(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name     string
+		err      error
+		failures int
+	}{
+		{name: "unknown user", err: apierrors.NewNotFound(kimv1.Resource("users"), "mallory"), failures: 1},
+		{name: "unreachable api server", err: errors.New("connection refused"), failures: 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			states := lockout.NewMemoryStore()
+			guard := lockout.NewGuard(states, lockout.Policy{MaxFailures: 5, BaseDelay: time.Minute, MaxDelay: time.Hour})
+			s := NewStorageWithClients(&lookupStore{err: tc.err}, map[string]*Client{}).WithLockout(guard, nil, nil)
+
+			_, err := s.checkCredentials(ctx, loginFlowBrowser, "web", "mallory", "secret")
+			if tc.failures > 0 && !errors.Is(err, errInvalidCredentials) {
+				t.Errorf("checkCredentials() = %v, want invalid credentials", err)
+			}
+			if tc.failures == 0 && !errors.Is(err, tc.err) {
+				t.Errorf("checkCredentials() = %v, want the lookup error", err)
+			}
+			state, err := states.Get(ctx, lockout.UsernameKey("mallory"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state.Failures != tc.failures {
+				t.Errorf("failures = %d, want %d", state.Failures, tc.failures)
+			}
+		})
+	}
+}
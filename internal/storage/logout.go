@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zitadel/oidc/v3/pkg/crypto"
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+	"github.com/zitadel/oidc/v3/pkg/op"
+
+	"github.com/crochee/kim/internal/audit"
+)
+
+const (
+	logoutTokenLifetime = 2 * time.Minute
+	// logoutPageLifetime is how long the logout page of an ended session can be rendered
+	logoutPageLifetime = 5 * time.Minute
+	// backChannelLogoutAttempts is the number of deliveries of a logout token before giving up
+	backChannelLogoutAttempts = 3
+)
+
+var logoutHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// frontChannelLogout is the state of the logout page after a session was ended
+type frontChannelLogout struct {
+	uris        []string
+	redirectURI string
+	expiration  time.Time
+}
+
+// TerminateSessionFromRequest implements the op.CanTerminateSessionFromRequest interface
+// it will be called by the end_session endpoint instead of TerminateSession
+//
+// the single sign-on session is identified by the sid claim of the id_token_hint or the session cookie,
+// all tokens of the session are removed and the clients signed in with it are notified
+// by front-channel (iframes of the logout page) and back-channel (logout token) logout
+func (s *Storage) TerminateSessionFromRequest(ctx context.Context, endSessionRequest *op.EndSessionRequest) (string, error) {
+	sessionID := sessionIDFromContext(ctx)
+	if endSessionRequest.IDTokenHintClaims != nil && endSessionRequest.IDTokenHintClaims.SessionID != "" {
+		sessionID = endSessionRequest.IDTokenHintClaims.SessionID
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	session := s.session(sessionID)
+	// the id_token_hint carries the subject of the client, which is pairwise for the clients opting in
+	if session == nil || (endSessionRequest.UserID != "" && s.userSubject(endSessionRequest.UserID) != session.UserID) {
+		// without a session only the tokens of the client can be removed
+		s.terminateTokens(func(token *Token) bool {
+			return token.ApplicationID == endSessionRequest.ClientID && token.Subject == endSessionRequest.UserID
+		})
+		return endSessionRequest.RedirectURI, nil
+	}
+	logout := s.endSession(ctx, session, endSessionRequest.ClientID)
+	logout.redirectURI = endSessionRequest.RedirectURI
+	logout.expiration = time.Now().Add(logoutPageLifetime)
+	s.sweep(time.Now())
+	id := uuid.NewString()
+	s.logouts[id] = logout
+	return defaultLogoutURL(id), nil
+}
+
+// endSession removes the session and its tokens, notifies the clients signed in with it by back-channel logout
+// and returns the front-channel logout of the clients
+// the caller must hold the lock
+func (s *Storage) endSession(ctx context.Context, session *Session, clientID string) *frontChannelLogout {
+	delete(s.sessions, session.ID)
+	s.auditSession(ctx, audit.SessionEnded, session, clientID)
+	s.terminateTokens(func(token *Token) bool {
+		return token.SessionID == session.ID
+	})
+
+	issuer := op.IssuerFromContext(ctx)
+	logout := &frontChannelLogout{}
+	for _, id := range session.Clients {
+		client, ok := s.clients[id]
+		if !ok {
+			continue
+		}
+		if client.frontChannelLogoutURI != "" {
+			logout.uris = append(logout.uris, frontChannelLogoutURI(client.frontChannelLogoutURI, issuer, session.ID))
+		}
+		if client.backChannelLogoutURI != "" {
+			// the key is copied under the lock, a rotation replaces it while the logout is delivered
+			key := s.signingKey
+			go backChannelLogout(issuer, s.clientSubject(client.id, session.UserID), &key, session, client)
+		}
+	}
+	return logout
+}
+
+// FrontChannelLogout returns the front-channel logout uris of the ended session and the uri to redirect
+// the user agent to afterwards; the state is removed, so the logout page can only be rendered once
+func (s *Storage) FrontChannelLogout(ctx context.Context, id string) ([]string, string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	logout, ok := s.logouts[id]
+	if !ok || logout.expiration.Before(time.Now()) {
+		return nil, "", errors.New("logout not found")
+	}
+	delete(s.logouts, id)
+	return logout.uris, logout.redirectURI, nil
+}
+
+// terminateTokens removes the matching access tokens and their refresh tokens
+// the caller must hold the lock
+func (s *Storage) terminateTokens(match func(*Token) bool) {
+	for _, token := range s.tokens {
+		if match(token) {
+			delete(s.tokens, token.ID)
+			delete(s.refreshTokens, token.RefreshTokenID)
+		}
+	}
+}
+
+func frontChannelLogoutURI(uri, issuer, sessionID string) string {
+	values := url.Values{}
+	values.Set("iss", issuer)
+	values.Set("sid", sessionID)
+	if strings.Contains(uri, "?") {
+		return uri + "&" + values.Encode()
+	}
+	return uri + "?" + values.Encode()
+}
+
+// backChannelLogout posts a logout token of the subject signed by the key to the back-channel logout uri of
+// the client, failed deliveries are retried with an exponential backoff
+func backChannelLogout(issuer, subject string, key *signingKey, session *Session, client *Client) {
+	logger := slog.With("client_id", client.id, "sid", session.ID)
+	claims := oidc.NewLogoutTokenClaims(issuer, subject, oidc.Audience{client.id},
+		time.Now().Add(logoutTokenLifetime), uuid.NewString(), session.ID, client.clockSkew)
+	signer, err := op.SignerFromKey(key)
+	if err != nil {
+		logger.Error("could not create logout token signer", "error", err)
+		return
+	}
+	token, err := crypto.Sign(claims, signer)
+	if err != nil {
+		logger.Error("could not sign logout token", "error", err)
+		return
+	}
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		if err = postLogoutToken(client.backChannelLogoutURI, token); err == nil {
+			return
+		}
+		if attempt == backChannelLogoutAttempts {
+			logger.Error("giving up back-channel logout", "error", err)
+			return
+		}
+		logger.Warn("back-channel logout failed", "attempt", attempt, "error", err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func postLogoutToken(uri, token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), logoutHTTPClient.Timeout)
+	defer cancel()
+	body := url.Values{"logout_token": {token}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := logoutHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	jose "github.com/go-jose/go-jose/v4"
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+	"github.com/zitadel/oidc/v3/pkg/op"
+)
+
+func TestTerminateSessionFromRequest(t *testing.T) {
+	logoutTokens := make(chan string, 1)
+	backChannel := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logoutTokens <- r.PostFormValue("logout_token")
+	}))
+	defer backChannel.Close()
+
+	const issuer = "https://kim.test/"
+	ctx := op.ContextWithIssuer(context.Background(), issuer)
+	s := NewStorageWithClients(nil, map[string]*Client{
+		"web": WebClient("web", "secret", "https://web.test/callback").
+			WithLogout(nil, "https://web.test/logout?tenant=a", ""),
+		"api":   WebClient("api", "secret", "https://api.test/callback").WithLogout(nil, "", backChannel.URL),
+		"other": WebClient("other", "secret", "https://other.test/callback").WithLogout(nil, "https://other.test/logout", ""),
+	})
+	s.sessions["sid"] = &Session{ID: "sid", UserID: "uid-alice", Expiration: time.Now().Add(time.Hour),
+		Clients: []string{"web", "api"}}
+	s.tokens["token"] = &Token{ID: "token", SessionID: "sid", Subject: "uid-alice"}
+
+	redirect, err := s.TerminateSessionFromRequest(ContextWithSessionID(ctx, "sid"), &op.EndSessionRequest{
+		ClientID:    "web",
+		RedirectURI: "https://web.test/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.sessions["sid"]; ok {
+		t.Error("the session was not ended")
+	}
+	if _, ok := s.tokens["token"]; ok {
+		t.Error("the tokens of the session were not removed")
+	}
+
+	// the logout page loads the front-channel logout uris of the clients signed in with the session
+	u, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, redirectURI, err := s.FrontChannelLogout(ctx, u.Query().Get("logoutID"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "https://web.test/logout?tenant=a&iss=" + url.QueryEscape(issuer) + "&sid=sid"
+	if len(frames) != 1 || frames[0] != want || redirectURI != "https://web.test/" {
+		t.Errorf("FrontChannelLogout() = %v, %s, want [%s]", frames, redirectURI, want)
+	}
+	if _, _, err = s.FrontChannelLogout(ctx, u.Query().Get("logoutID")); err == nil {
+		t.Error("the logout page was rendered twice")
+	}
+
+	// the back-channel logout uri receives a logout token of the session signed by the issuer
+	var token string
+	select {
+	case token = <-logoutTokens:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no logout token was delivered")
+	}
+	signed, err := jose.ParseSigned(token, []jose.SignatureAlgorithm{jose.RS256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := signed.Verify(&s.signingKey.key.PublicKey)
+	if err != nil {
+		t.Fatalf("the logout token is not signed by the issuer: %v", err)
+	}
+	var claims oidc.LogoutTokenClaims
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Issuer != issuer || claims.SessionID != "sid" || claims.Subject != "uid-alice" ||
+		len(claims.Audience) != 1 || claims.Audience[0] != "api" {
+		t.Errorf("logout token claims = %+v", claims)
+	}
+	if _, ok := claims.Events["http://schemas.openid.net/event/backchannel-logout"]; !ok {
+		t.Errorf("logout token events = %v, want the back-channel logout event", claims.Events)
+	}
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+// LoginIdentifier is a field of the User its login name is compared with
+type LoginIdentifier string
+
+const (
+	// LoginName is the name of the User as name/namespace, or the bare name in the default namespace
+	LoginName LoginIdentifier = "name"
+	// LoginEmail is the email claim of the User
+	LoginEmail LoginIdentifier = "email"
+	// LoginPreferredUsername is the preferred_username claim of the User
+	LoginPreferredUsername LoginIdentifier = "preferredUsername"
+)
+
+// the field indexes of the claims the users log in with, the values are lower case
+const (
+	IndexUserEmail             = "spec.email"
+	IndexUserPreferredUsername = "spec.preferredUsername"
+)
+
+// IndexUserSubject is the field index of the subject of the users (see UserSubject)
+const IndexUserSubject = "subject"
+
+// UserLookup configures how the login name of a user is resolved to the User
+type UserLookup struct {
+	// Identifiers are tried in order, the first one matching a user wins
+	Identifiers []LoginIdentifier
+	// DefaultNamespace is the namespace of the login names without a namespace
+	DefaultNamespace string
+	// LegacySubjects accepts the hex encoded name/namespace subjects of the tokens issued before the subjects
+	// were derived from the UID, until they expired
+	LegacySubjects bool
+}
+
+// DefaultUserLookup only accepts the namespaced name of the User
+var DefaultUserLookup = UserLookup{Identifiers: []LoginIdentifier{LoginName}}
+
+// ParseLoginIdentifiers parses the login identifiers of the configuration
+func ParseLoginIdentifiers(values []string) ([]LoginIdentifier, error) {
+	identifiers := make([]LoginIdentifier, 0, len(values))
+	for _, value := range values {
+		switch id := LoginIdentifier(value); id {
+		case LoginName, LoginEmail, LoginPreferredUsername:
+			identifiers = append(identifiers, id)
+		default:
+			return nil, fmt.Errorf("unknown login identifier %q, expected one of name, email, preferredUsername", value)
+		}
+	}
+	return identifiers, nil
+}
+
+// Index returns the field index of the identifier, or an empty string for the name which needs none
+func (id LoginIdentifier) Index() string {
+	switch id {
+	case LoginEmail:
+		return IndexUserEmail
+	case LoginPreferredUsername:
+		return IndexUserPreferredUsername
+	default:
+		return ""
+	}
+}
+
+// Value returns the indexed value of the identifier of the user, empty if the user has none
+func (id LoginIdentifier) Value(user *kimv1.User) string {
+	switch id {
+	case LoginEmail:
+		return normalizeLogin(ptr.Deref(user.Spec.Email, ""))
+	case LoginPreferredUsername:
+		return normalizeLogin(ptr.Deref(user.Spec.PreferredUsername, ""))
+	default:
+		return ""
+	}
+}
+
+// normalizeLogin makes the comparison of the login names case insensitive
+func normalizeLogin(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// UserSubject returns the subject (sub claim) of the user: the subject of its status or else the UID, which
+// neither reveals the namespace nor changes with the login name. The status is not written by the owners
+// of the User, so that they can not take the subject of another user.
+func UserSubject(user *kimv1.User) string {
+	if user.Status.Subject != "" {
+		return user.Status.Subject
+	}
+	return string(user.UID)
+}
+
+// IndexUsers registers the field indexes of the subjects and the claims the users log in with, the store of
+// the users needs a client reading from the cache of the indexer
+func IndexUsers(ctx context.Context, indexer client.FieldIndexer) error {
+	err := indexer.IndexField(ctx, &kimv1.User{}, IndexUserSubject, func(obj client.Object) []string {
+		if subject := UserSubject(obj.(*kimv1.User)); subject != "" {
+			return []string{subject}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range []LoginIdentifier{LoginEmail, LoginPreferredUsername} {
+		err := indexer.IndexField(ctx, &kimv1.User{}, id.Index(), func(obj client.Object) []string {
+			if value := id.Value(obj.(*kimv1.User)); value != "" {
+				return []string{value}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// namespacedName resolves a login name of the LoginName identifier
+func (l UserLookup) namespacedName(username string) (types.NamespacedName, bool) {
+	return namespacedName(username, l.DefaultNamespace)
+}
+
+// namespacedName resolves name/namespace, or a bare name in the default namespace
+func namespacedName(value, defaultNamespace string) (types.NamespacedName, bool) {
+	name, namespace, found := strings.Cut(value, "/")
+	if !found {
+		namespace = defaultNamespace
+	}
+	if name == "" || namespace == "" || strings.Contains(namespace, "/") {
+		return types.NamespacedName{}, false
+	}
+	return types.NamespacedName{Name: name, Namespace: namespace}, true
+}
+
+// lookup returns the user of the login name by the identifier
+func (us *userStore) lookup(ctx context.Context, id LoginIdentifier, username string) (*kimv1.User, error) {
+	if id == LoginName {
+		key, ok := us.lookupConfig.namespacedName(username)
+		if !ok {
+			return nil, apierrors.NewNotFound(kimv1.Resource("users"), username)
+		}
+		return us.getUser(ctx, key)
+	}
+	return us.lookupIndex(ctx, id.Index(), normalizeLogin(username))
+}
+
+// lookupIndex returns the only user with the value in the field index
+func (us *userStore) lookupIndex(ctx context.Context, index, value string) (*kimv1.User, error) {
+	users := &kimv1.UserList{}
+	if err := us.List(ctx, users, client.MatchingFields{index: value}); err != nil {
+		return nil, err
+	}
+	switch len(users.Items) {
+	case 0:
+		return nil, apierrors.NewNotFound(kimv1.Resource("users"), value)
+	case 1:
+		return &users.Items[0], nil
+	default:
+		// the webhook keeps the values unique, a duplicate must not sign in any of the users
+		return nil, fmt.Errorf("%d users have the %s %q", len(users.Items), index, value)
+	}
+}
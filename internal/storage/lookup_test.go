@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+func TestGetUserByUsername(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := kimv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	builder := fake.NewClientBuilder().WithScheme(scheme).
+		WithIndex(&kimv1.User{}, IndexUserSubject, func(obj client.Object) []string {
+			return []string{UserSubject(obj.(*kimv1.User))}
+		})
+	for _, id := range []LoginIdentifier{LoginEmail, LoginPreferredUsername} {
+		builder = builder.WithIndex(&kimv1.User{}, id.Index(), func(obj client.Object) []string {
+			if value := id.Value(obj.(*kimv1.User)); value != "" {
+				return []string{value}
+			}
+			return nil
+		})
+	}
+	alice := &kimv1.User{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "alice", UID: "8c6f5b3e-uid"}}
+	alice.Spec.Email = ptr.To("Alice@example.com")
+	alice.Spec.PreferredUsername = ptr.To("ali")
+	c := builder.WithObjects(alice).Build()
+	ctx := context.Background()
+
+	store := UserStoreFromClient(c, UserLookup{
+		Identifiers:      []LoginIdentifier{LoginName, LoginEmail, LoginPreferredUsername},
+		DefaultNamespace: "team-a",
+	})
+	for _, username := range []string{"alice/team-a", "alice", "alice@example.com", " ALI "} {
+		user, err := store.GetUserByUsername(ctx, username)
+		if err != nil || user.Name != "alice" {
+			t.Errorf("GetUserByUsername(%q) = %v, %v, want alice", username, user, err)
+		}
+	}
+	for _, username := range []string{"", "/", "alice/", "alice/team-b", "bob", "alice/team-a/x"} {
+		if _, err := store.GetUserByUsername(ctx, username); !apierrors.IsNotFound(err) {
+			t.Errorf("GetUserByUsername(%q) = %v, want not found", username, err)
+		}
+	}
+
+	// only the configured identifiers are resolved
+	store = UserStoreFromClient(c, DefaultUserLookup)
+	for _, username := range []string{"alice", "alice@example.com"} {
+		if _, err := store.GetUserByUsername(ctx, username); !apierrors.IsNotFound(err) {
+			t.Errorf("GetUserByUsername(%q) without default namespace = %v, want not found", username, err)
+		}
+	}
+}
+
+func TestGetUserByID(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := kimv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	alice := &kimv1.User{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "alice", UID: "8c6f5b3e-uid"}}
+	bob := &kimv1.User{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "bob", UID: "1d2e-uid"},
+		Status: kimv1.UserStatus{Subject: "former-bob"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithIndex(&kimv1.User{}, IndexUserSubject, func(obj client.Object) []string {
+			return []string{UserSubject(obj.(*kimv1.User))}
+		}).
+		WithObjects(alice, bob).
+		Build()
+	ctx := context.Background()
+	// the subject of the tokens issued before the subjects were derived from the UID
+	legacy := hex.EncodeToString([]byte("alice/team-a"))
+
+	store := UserStoreFromClient(c, DefaultUserLookup)
+	for subject, want := range map[string]string{"8c6f5b3e-uid": "alice", "former-bob": "bob"} {
+		if user, err := store.GetUserByID(ctx, subject); err != nil || user.Name != want {
+			t.Errorf("GetUserByID(%q) = %v, %v, want %s", subject, user, err, want)
+		}
+	}
+	for _, subject := range []string{"1d2e-uid", legacy, "unknown"} {
+		if _, err := store.GetUserByID(ctx, subject); !apierrors.IsNotFound(err) {
+			t.Errorf("GetUserByID(%q) = %v, want not found", subject, err)
+		}
+	}
+
+	store = UserStoreFromClient(c, UserLookup{Identifiers: []LoginIdentifier{LoginName}, LegacySubjects: true})
+	if user, err := store.GetUserByID(ctx, legacy); err != nil || user.Name != "alice" {
+		t.Errorf("GetUserByID(legacy) = %v, %v, want alice", user, err)
+	}
+}
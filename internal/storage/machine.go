@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+	"github.com/zitadel/oidc/v3/pkg/op"
+	"golang.org/x/crypto/bcrypt"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/policy"
+	"github.com/crochee/kim/internal/tracing"
+)
+
+// PermissionsClaim is the claim of the access tokens of the machine clients listing the rules of their Policies
+const PermissionsClaim = "permissions"
+
+var errInvalidClientCredentials = errors.New("wrong client id or secret")
+
+// +kubebuilder:rbac:groups=kim.kim.io,resources=machineclients,verbs=get;list;watch
+// +kubebuilder:rbac:groups=kim.kim.io,resources=policies,verbs=get;list;watch
+
+// MachineClientStore reads the MachineClients, their secrets and the Policies bound to them
+type MachineClientStore struct {
+	reader           client.Reader
+	defaultNamespace string
+	// namespaces restricts the clients to these namespaces, any namespace if empty
+	namespaces []string
+	jwks       *jwksCache
+}
+
+// NewMachineClientStore returns the store of the MachineClients read by the reader, the client_ids without a
+// namespace belong to the default namespace
+func NewMachineClientStore(reader client.Reader, defaultNamespace string, namespaces ...string) *MachineClientStore {
+	return &MachineClientStore{
+		reader:           reader,
+		defaultNamespace: defaultNamespace,
+		namespaces:       namespaces,
+		jwks:             newJWKSCache(),
+	}
+}
+
+// MachineClientID returns the canonical client_id of the client, the subject of its tokens
+func MachineClientID(obj *kimv1.MachineClient) string {
+	return obj.Name + "/" + obj.Namespace
+}
+
+// ParseMachineClientID returns the MachineClient of the client_id, ok is false if it is malformed
+func ParseMachineClientID(clientID, defaultNamespace string) (key types.NamespacedName, ok bool) {
+	return namespacedName(clientID, defaultNamespace)
+}
+
+// get returns the enabled client of the client_id
+func (m *MachineClientStore) get(ctx context.Context, clientID string) (*kimv1.MachineClient, error) {
+	key, ok := ParseMachineClientID(clientID, m.defaultNamespace)
+	if !ok || len(m.namespaces) > 0 && !slices.Contains(m.namespaces, key.Namespace) {
+		return nil, apierrors.NewNotFound(kimv1.Resource("machineclients"), clientID)
+	}
+	obj := &kimv1.MachineClient{}
+	if err := m.reader.Get(ctx, key, obj); err != nil {
+		return nil, err
+	}
+	if obj.Spec.Disabled {
+		return nil, apierrors.NewNotFound(kimv1.Resource("machineclients"), clientID)
+	}
+	return obj, nil
+}
+
+// authenticate returns the client if the secret matches any of the hashes in its Secret
+func (m *MachineClientStore) authenticate(ctx context.Context, clientID, secret string) (*kimv1.MachineClient, error) {
+	obj, err := m.get(ctx, clientID)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, errInvalidClientCredentials
+		}
+		return nil, err
+	}
+	if obj.Spec.SecretName == "" {
+		return nil, errInvalidClientCredentials
+	}
+	hashes := &corev1.Secret{}
+	err = m.reader.Get(ctx, types.NamespacedName{Namespace: obj.Namespace, Name: obj.Spec.SecretName}, hashes)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, errInvalidClientCredentials
+		}
+		return nil, err
+	}
+	for _, hash := range hashes.Data {
+		if bcrypt.CompareHashAndPassword(hash, []byte(secret)) == nil {
+			return obj, nil
+		}
+	}
+	return nil, errInvalidClientCredentials
+}
+
+// permissions returns the rules of the Policies bound to the client
+func (m *MachineClientStore) permissions(ctx context.Context, obj *kimv1.MachineClient) ([]kimv1.Rule, error) {
+	return policyRules(ctx, m.reader, obj.Namespace, obj.Spec.Policies)
+}
+
+// clientCredentialsRequest is the op.TokenRequest of the client credentials grant, the client is its subject
+type clientCredentialsRequest struct {
+	oidc.JWTTokenRequest
+}
+
+// WithMachineClients lets the MachineClients of the store use the client credentials grant
+func (s *Storage) WithMachineClients(store *MachineClientStore) *Storage {
+	s.machineClients = store
+	return s
+}
+
+// ClientCredentials implements the op.ClientCredentialsStorage interface
+// it authenticates the MachineClient by any of its secrets
+func (s *Storage) ClientCredentials(ctx context.Context, clientID, clientSecret string) (_ op.Client, err error) {
+	ctx, span := tracing.Start(ctx, "Storage.ClientCredentials", tracing.ClientIDKey.String(clientID))
+	defer func() {
+		_ = tracing.Error(span, err)
+		span.End()
+	}()
+	if s.machineClients == nil {
+		return nil, errInvalidClientCredentials
+	}
+	obj, err := s.machineClients.authenticate(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	return machineClient(obj, oidc.GrantTypeClientCredentials), nil
+}
+
+// machineClient returns the op.Client of the MachineClient using the grant
+func machineClient(obj *kimv1.MachineClient, grantType oidc.GrantType) *Client {
+	accessTokenType := op.AccessTokenTypeBearer
+	if obj.Spec.AccessTokenType == kimv1.MachineClientTokenJWT {
+		accessTokenType = op.AccessTokenTypeJWT
+	}
+	return &Client{
+		id:              MachineClientID(obj),
+		grantTypes:      []oidc.GrantType{grantType},
+		accessTokenType: accessTokenType,
+	}
+}
+
+// ClientCredentialsTokenRequest implements the op.ClientCredentialsStorage interface
+// the scopes must be allowed to the client, the tokens are issued for its audiences
+func (s *Storage) ClientCredentialsTokenRequest(ctx context.Context, clientID string, scopes []string) (op.TokenRequest, error) {
+	if s.machineClients == nil {
+		return nil, oidc.ErrInvalidClient()
+	}
+	obj, err := s.machineClients.get(ctx, clientID)
+	if err != nil {
+		return nil, oidc.ErrInvalidClient().WithParent(err)
+	}
+	request, err := machineTokenRequest(obj, scopes)
+	if err != nil {
+		return nil, err
+	}
+	return &clientCredentialsRequest{JWTTokenRequest: request}, nil
+}
+
+// machineTokenRequest returns the request of the tokens of the MachineClient,
+// the scopes must be allowed to the client and the tokens are issued for its audiences
+func machineTokenRequest(obj *kimv1.MachineClient, scopes []string) (oidc.JWTTokenRequest, error) {
+	for _, scope := range scopes {
+		if !slices.Contains(obj.Spec.Scopes, scope) {
+			return oidc.JWTTokenRequest{}, oidc.ErrInvalidScope().WithDescription("the scope %s is not allowed", scope)
+		}
+	}
+	id := MachineClientID(obj)
+	audience := obj.Spec.Audiences
+	if len(audience) == 0 {
+		audience = []string{id}
+	}
+	return oidc.JWTTokenRequest{
+		Subject:  id,
+		Audience: audience,
+		Scopes:   scopes,
+	}, nil
+}
+
+// machinePermissions returns the permissions of the MachineClient or the WorkloadTrust of the client_id,
+// ok is false if it is neither
+func (s *Storage) machinePermissions(ctx context.Context, clientID string) (rules []kimv1.Rule, ok bool, err error) {
+	if strings.HasPrefix(clientID, workloadTrustPrefix) {
+		return s.workloadPermissions(ctx, clientID)
+	}
+	if s.machineClients == nil {
+		return nil, false, nil
+	}
+	obj, err := s.machineClients.get(ctx, clientID)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	rules, err = s.machineClients.permissions(ctx, obj)
+	if err != nil {
+		return nil, false, err
+	}
+	return policy.Confine(rules, obj.Namespace, s.adminNamespace), true, nil
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+	"github.com/zitadel/oidc/v3/pkg/op"
+	"golang.org/x/crypto/bcrypt"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+func TestClientCredentials(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := kimv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	hash := func(secret string) []byte {
+		h, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	reporter := &kimv1.MachineClient{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "jobs", Name: "reporter"},
+		Spec: kimv1.MachineClientSpec{
+			SecretName:      "reporter-secrets",
+			Scopes:          []string{"reports.read"},
+			Audiences:       []string{"https://reports.example.com"},
+			Policies:        []string{"reports-reader", "missing"},
+			AccessTokenType: kimv1.MachineClientTokenJWT,
+		},
+	}
+	disabled := &kimv1.MachineClient{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "jobs", Name: "disabled"},
+		Spec:       kimv1.MachineClientSpec{SecretName: "reporter-secrets", Disabled: true},
+	}
+	// the old and the new secret are both valid while the secret is rotated
+	secrets := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "jobs", Name: "reporter-secrets"},
+		Data:       map[string][]byte{"2025-01": hash("old"), "2025-06": hash("new")},
+	}
+	rule := kimv1.Rule{Resource: "reports/*", Actions: []string{"get"}, Effect: "Allow"}
+	policy := &kimv1.Policy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "jobs", Name: "reports-reader"},
+		Spec:       kimv1.PolicySpec{Rules: []kimv1.Rule{rule}},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(reporter, disabled, secrets, policy).Build()
+	s := (&Storage{}).WithMachineClients(NewMachineClientStore(c, "jobs"))
+	ctx := context.Background()
+
+	for _, clientID := range []string{"reporter/jobs", "reporter"} {
+		for _, secret := range []string{"old", "new"} {
+			client, err := s.ClientCredentials(ctx, clientID, secret)
+			if err != nil {
+				t.Fatalf("ClientCredentials(%s, %s) = %v", clientID, secret, err)
+			}
+			if client.GetID() != "reporter/jobs" || client.AccessTokenType() != op.AccessTokenTypeJWT {
+				t.Errorf("ClientCredentials(%s) = %s, %v", clientID, client.GetID(), client.AccessTokenType())
+			}
+		}
+	}
+	for _, tt := range []struct{ clientID, secret string }{
+		{"reporter/jobs", "wrong"},
+		{"reporter/other", "new"},
+		{"disabled/jobs", "new"},
+		{"unknown/jobs", "new"},
+	} {
+		if _, err := s.ClientCredentials(ctx, tt.clientID, tt.secret); !errors.Is(err, errInvalidClientCredentials) {
+			t.Errorf("ClientCredentials(%s, %s) = %v, want invalid credentials", tt.clientID, tt.secret, err)
+		}
+	}
+
+	request, err := s.ClientCredentialsTokenRequest(ctx, "reporter", []string{"reports.read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.GetSubject() != "reporter/jobs" || request.GetAudience()[0] != "https://reports.example.com" {
+		t.Errorf("ClientCredentialsTokenRequest() = %s %v", request.GetSubject(), request.GetAudience())
+	}
+	if grantType := s.grantTypeFromRequest(request); grantType != oidc.GrantTypeClientCredentials {
+		t.Errorf("grant type = %s", grantType)
+	}
+	if _, err := s.ClientCredentialsTokenRequest(ctx, "reporter", []string{"reports.write"}); err == nil {
+		t.Error("ClientCredentialsTokenRequest() with a scope not allowed succeeded")
+	}
+
+	claims, err := s.getPrivateClaimsFromScopes(ctx, "reporter/jobs", "reporter/jobs", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	permissions, ok := claims[PermissionsClaim].([]kimv1.Rule)
+	if !ok || len(permissions) != 1 || permissions[0].Resource != rule.Resource {
+		t.Errorf("permissions = %v, want the rules of reports-reader", claims[PermissionsClaim])
+	}
+}
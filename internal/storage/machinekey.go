@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	jose "github.com/go-jose/go-jose/v4"
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+	"github.com/zitadel/oidc/v3/pkg/op"
+	"golang.org/x/sync/singleflight"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+const (
+	// jwksTTL is how long a fetched JWKS document is used
+	jwksTTL = 5 * time.Minute
+	// jwksMinRefresh limits the refetches of a JWKS document for unknown kids
+	jwksMinRefresh = 30 * time.Second
+	// maxDocumentSize limits the fetched JWKS and discovery documents
+	maxDocumentSize = 1 << 20
+)
+
+// ParsePublicKey parses a PEM encoded PKIX or PKCS#1 public key
+func ParsePublicKey(data []byte) (any, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM encoded key found")
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// machineKey returns the usable key of the kid registered in the client
+func machineKey(obj *kimv1.MachineClient, keyID string, now time.Time) (*jose.JSONWebKey, bool, error) {
+	for _, key := range obj.Spec.Keys {
+		if key.KeyID != keyID {
+			continue
+		}
+		switch {
+		case key.Revoked:
+			return nil, true, fmt.Errorf("key %s is revoked", keyID)
+		case key.ExpirationTime != nil && !now.Before(key.ExpirationTime.Time):
+			return nil, true, fmt.Errorf("key %s expired", keyID)
+		}
+		public, err := ParsePublicKey([]byte(key.PublicKey))
+		if err != nil {
+			return nil, true, fmt.Errorf("key %s: %w", keyID, err)
+		}
+		return &jose.JSONWebKey{KeyID: keyID, Use: "sig", Key: public}, true, nil
+	}
+	return nil, false, nil
+}
+
+// jwksDocument is a fetched JWKS document
+type jwksDocument struct {
+	keys    jose.JSONWebKeySet
+	fetched time.Time
+}
+
+// jwksCache fetches the JWKS documents of the clients and keeps them for the jwksTTL
+type jwksCache struct {
+	client *http.Client
+	// fetches shares the concurrent fetches of a document, they are made without holding mu
+	// so that a slow document does not hold up the keys of the others
+	fetches singleflight.Group
+
+	mu        sync.Mutex
+	documents map[string]*jwksDocument
+	// discovered are the jwks_uris of the discovery documents of the external issuers
+	discovered map[string]*discoveryDocument
+}
+
+func newJWKSCache() *jwksCache {
+	return &jwksCache{
+		client:     &http.Client{Timeout: 10 * time.Second},
+		documents:  make(map[string]*jwksDocument),
+		discovered: make(map[string]*discoveryDocument),
+	}
+}
+
+// key returns the key of the kid in the document, which is fetched again once it is outdated
+// or does not know the kid, as the key might be new
+func (c *jwksCache) key(ctx context.Context, uri, keyID string) (*jose.JSONWebKey, error) {
+	now := time.Now()
+	c.mu.Lock()
+	document := c.documents[uri]
+	c.mu.Unlock()
+	if document == nil || now.Sub(document.fetched) > jwksTTL ||
+		len(document.keys.Key(keyID)) == 0 && now.Sub(document.fetched) > jwksMinRefresh {
+		// the callers share the fetch, so it must not end with the request of the first one
+		fetched, err, _ := c.fetches.Do(uri, func() (any, error) {
+			keys, err := c.fetch(context.WithoutCancel(ctx), uri)
+			if err != nil {
+				return nil, err
+			}
+			document := &jwksDocument{keys: keys, fetched: time.Now()}
+			c.mu.Lock()
+			c.documents[uri] = document
+			c.mu.Unlock()
+			return document, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		document = fetched.(*jwksDocument)
+	}
+	for _, key := range document.keys.Key(keyID) {
+		if key.Use == "" || key.Use == "sig" {
+			return &key, nil
+		}
+	}
+	return nil, fmt.Errorf("key %s not found in %s", keyID, uri)
+}
+
+func (c *jwksCache) fetch(ctx context.Context, uri string) (jose.JSONWebKeySet, error) {
+	var keys jose.JSONWebKeySet
+	if err := c.get(ctx, uri, &keys); err != nil {
+		return keys, fmt.Errorf("invalid JWKS document %s: %w", uri, err)
+	}
+	return keys, nil
+}
+
+// get decodes the JSON document of the uri into v, only https documents of at most maxDocumentSize are fetched
+func (c *jwksCache) get(ctx context.Context, uri string, v any) error {
+	if u, err := url.Parse(uri); err != nil || u.Scheme != "https" {
+		return fmt.Errorf("fetching %s: the url must be https", uri)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: %s", uri, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(v)
+}
+
+// GetKeyByIDAndClientID implements the op.Storage interface
+// it will be called to validate the signatures of a JWT (JWT Profile Grant and Authentication)
+// by the keys registered in the MachineClient or its JWKS document
+func (s *Storage) GetKeyByIDAndClientID(ctx context.Context, keyID, clientID string) (*jose.JSONWebKey, error) {
+	if s.machineClients == nil {
+		return nil, errors.New("clientID not found")
+	}
+	obj, err := s.machineClients.get(ctx, clientID)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, errors.New("clientID not found")
+		}
+		return nil, err
+	}
+	key, ok, err := machineKey(obj, keyID, time.Now())
+	if ok || err != nil {
+		return key, err
+	}
+	if obj.Spec.JWKSURI == "" {
+		return nil, errors.New("key not found")
+	}
+	return s.machineClients.jwks.key(ctx, obj.Spec.JWKSURI, keyID)
+}
+
+// ValidateJWTProfileScopes implements the op.Storage interface
+// it will be called to validate the scopes of a JWT Profile Authorization Grant request,
+// the MachineClient only gets the scopes allowed to it
+func (s *Storage) ValidateJWTProfileScopes(ctx context.Context, userID string, scopes []string) ([]string, error) {
+	if s.machineClients == nil {
+		return nil, oidc.ErrInvalidClient()
+	}
+	obj, err := s.machineClients.get(ctx, userID)
+	if err != nil {
+		return nil, oidc.ErrInvalidClient().WithParent(err)
+	}
+	allowedScopes := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if scope == oidc.ScopeOpenID || slices.Contains(obj.Spec.Scopes, scope) {
+			allowedScopes = append(allowedScopes, scope)
+		}
+	}
+	return allowedScopes, nil
+}
+
+// JWTProfileTokenType implements the op.JWTProfileTokenStorage interface
+// the access tokens of the JWT profile grant have the type configured for the MachineClient
+func (s *Storage) JWTProfileTokenType(ctx context.Context, request op.TokenRequest) (op.AccessTokenType, error) {
+	if s.machineClients == nil {
+		return op.AccessTokenTypeBearer, nil
+	}
+	obj, err := s.machineClients.get(ctx, request.GetSubject())
+	if err != nil {
+		return op.AccessTokenTypeBearer, oidc.ErrInvalidClient().WithParent(err)
+	}
+	if obj.Spec.AccessTokenType == kimv1.MachineClientTokenJWT {
+		return op.AccessTokenTypeJWT, nil
+	}
+	return op.AccessTokenTypeBearer, nil
+}
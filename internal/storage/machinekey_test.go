@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jose "github.com/go-jose/go-jose/v4"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+func TestGetKeyByIDAndClientID(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := kimv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	fetches := 0
+	jwks := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{KeyID: "remote", Use: "sig", Key: &key.PublicKey},
+		}})
+	}))
+	defer jwks.Close()
+
+	reporter := &kimv1.MachineClient{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "jobs", Name: "reporter"},
+		Spec: kimv1.MachineClientSpec{
+			Keys: []kimv1.MachineClientKey{
+				{KeyID: "current", PublicKey: public},
+				{KeyID: "revoked", PublicKey: public, Revoked: true},
+				{KeyID: "expired", PublicKey: public, ExpirationTime: &metav1.Time{Time: time.Now().Add(-time.Minute)}},
+			},
+			JWKSURI: jwks.URL,
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(reporter).Build()
+	store := NewMachineClientStore(c, "jobs")
+	store.jwks.client = jwks.Client()
+	s := (&Storage{}).WithMachineClients(store)
+	ctx := context.Background()
+
+	for _, keyID := range []string{"current", "remote", "remote"} {
+		got, err := s.GetKeyByIDAndClientID(ctx, keyID, "reporter/jobs")
+		if err != nil || got.KeyID != keyID {
+			t.Errorf("GetKeyByIDAndClientID(%s) = %v, %v", keyID, got, err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("the JWKS document was fetched %d times, want 1", fetches)
+	}
+	for _, tt := range []struct{ keyID, clientID string }{
+		{"revoked", "reporter/jobs"},
+		{"expired", "reporter/jobs"},
+		{"current", "other/jobs"},
+	} {
+		if _, err := s.GetKeyByIDAndClientID(ctx, tt.keyID, tt.clientID); err == nil {
+			t.Errorf("GetKeyByIDAndClientID(%s, %s) succeeded", tt.keyID, tt.clientID)
+		}
+	}
+}
+
+func TestJWKSCacheConcurrentFetches(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	serve := func(block bool) *httptest.Server {
+		return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fetches.Add(1)
+			if block {
+				<-release
+			}
+			_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{KeyID: "k", Key: &key.PublicKey}}})
+		}))
+	}
+	slow, fast := serve(true), serve(false)
+	defer slow.Close()
+	defer fast.Close()
+	c := newJWKSCache()
+	// the test servers share their certificate
+	c.client = slow.Client()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.key(ctx, slow.URL, "k"); err != nil {
+				t.Errorf("key() of the slow document = %v", err)
+			}
+		}()
+	}
+	// the other documents are not held up by the slow one
+	done := make(chan error)
+	go func() {
+		_, err := c.key(ctx, fast.URL, "k")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the fetch of a document waited for the slow one")
+	}
+	close(release)
+	wg.Wait()
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("fetches = %d, want one per document", n)
+	}
+}
+
+func TestJWKSCacheGet(t *testing.T) {
+	document := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"keys":[`))
+		_, _ = w.Write(bytes.Repeat([]byte(`{"kty":"oct","k":"AA"},`), maxDocumentSize/16))
+		_, _ = w.Write([]byte(`{"kty":"oct","k":"AA"}]}`))
+	}))
+	defer document.Close()
+	c := newJWKSCache()
+	c.client = document.Client()
+	ctx := context.Background()
+
+	var keys jose.JSONWebKeySet
+	if err := c.get(ctx, document.URL, &keys); err == nil {
+		t.Errorf("get() of a document over %d bytes succeeded", maxDocumentSize)
+	}
+	if err := c.get(ctx, "http"+strings.TrimPrefix(document.URL, "https"), &keys); err == nil {
+		t.Error("get() of an http url succeeded")
+	}
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	s := NewStorageWithClients(&lookupStore{err: apierrors.NewNotFound(kimv1.Resource("users"), "mallory")},
+		map[string]*Client{})
+
+	failed := metrics.Logins.WithLabelValues(loginFlowBrowser, metrics.ResultFailure, "unknown_user")
+	before := testutil.ToFloat64(failed)
+	if _, err := s.checkCredentials(ctx, loginFlowBrowser, "web", "mallory", "secret"); err == nil {
+		t.Fatal("checkCredentials() of an unknown user succeeded")
+	}
+	if got := testutil.ToFloat64(failed) - before; got != 1 {
+		t.Errorf("failed logins increased by %v, want 1", got)
+	}
+
+	// the subjects of the JWT grants are no label
+	issued := metrics.TokensIssued.WithLabelValues(string(oidc.GrantTypeBearer), metrics.JWTGrantClient)
+	before = testutil.ToFloat64(issued)
+	if _, _, err := s.CreateAccessToken(ctx, &oidc.JWTTokenRequest{Subject: "ci-job-4711"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(issued) - before; got != 1 {
+		t.Errorf("issued tokens increased by %v, want 1", got)
+	}
+	bySubject := metrics.TokensIssued.WithLabelValues(string(oidc.GrantTypeBearer), "ci-job-4711")
+	if got := testutil.ToFloat64(bySubject); got != 0 {
+		t.Errorf("issued tokens labeled by the subject = %v, want 0", got)
+	}
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/audit"
+	"github.com/crochee/kim/internal/lockout"
+	"github.com/crochee/kim/internal/metrics"
+)
+
+// TOTPKey is the key of the base32 encoded secret of the time-based one-time passwords (RFC 6238)
+// in the credential Secret of the user, the second factor is required at login if it is set
+const TOTPKey = "totp"
+
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew accepts the codes of the adjacent periods, as the clocks of the devices drift
+	totpSkew = 1
+)
+
+var (
+	errInvalidOTP  = errors.New("one-time code wrong")
+	errOTPRequired = errors.New("one-time code required")
+	totpEncoding   = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// NewTOTPSecret returns a random secret for the enrollment of an authenticator app
+func NewTOTPSecret() string {
+	secret := make([]byte, 20)
+	_, _ = rand.Read(secret)
+	return totpEncoding.EncodeToString(secret)
+}
+
+// TOTPURI returns the otpauth uri of the secret, which authenticator apps read from a QR code
+func TOTPURI(issuer, account, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("period", fmt.Sprint(totpPeriod))
+	values.Set("digits", fmt.Sprint(totpDigits))
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + values.Encode()
+}
+
+// validateTOTP returns the counter of the period of the code, if it is valid for the secret at the time
+func validateTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for counter := current - totpSkew; counter <= current+totpSkew; counter++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, uint64(counter))), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode is the HOTP value (RFC 4226) of the counter
+func totpCode(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// CheckOTP implements the `authenticate` interface of the login
+// it will be called with the one-time code of the users with a second factor, after their password was checked
+func (s *Storage) CheckOTP(ctx context.Context, code, id string) error {
+	s.lock.Lock()
+	request, ok := s.authRequests[id]
+	if !ok || !request.otpPending {
+		s.lock.Unlock()
+		return errors.New("request not found")
+	}
+	userID, clientID := request.UserID, request.ApplicationID
+	s.lock.Unlock()
+
+	user, err := s.userStore.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err = s.checkOTP(ctx, loginFlowBrowser, clientID, user, code); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	request.otpPending = false
+	request.mfa = true
+	request.done = true
+	request.authTime = time.Now()
+	s.auditConsent(ctx, request, userTarget(user))
+	return nil
+}
+
+// checkOTP verifies the one-time code of the user, failures count towards the lockout of the user
+// and a code can only be used once
+func (s *Storage) checkOTP(ctx context.Context, flow, clientID string, user *kimv1.User, code string) error {
+	ipKey, userKey := sourceKey(ctx), lockout.UserKey(user.Namespace, user.Name)
+	if err := s.reserveLogin(ctx, ipKey, userKey); err != nil {
+		return err
+	}
+	secret, err := s.userStore.TOTPSecret(ctx, user)
+	if err != nil {
+		s.releaseLogin(ctx, ipKey, userKey)
+		return err
+	}
+	counter, ok := validateTOTP(secret, code, time.Now())
+	if ok {
+		s.lock.Lock()
+		subject := UserSubject(user)
+		// a code seen before might have been observed by an attacker
+		ok = counter > s.otpCounters[subject]
+		if ok {
+			s.otpCounters[subject] = counter
+		}
+		s.lock.Unlock()
+	}
+	if !ok {
+		s.loginFailed(ctx, ipKey, userKey, user)
+		metrics.Logins.WithLabelValues(flow, metrics.ResultFailure, "invalid_otp").Inc()
+		audit.Record(ctx, audit.Event{
+			Type:    audit.LoginFailed,
+			Outcome: audit.Failure,
+			Reason:  "invalid_otp",
+			Actor: audit.Actor{
+				Subject:  UserSubject(user),
+				ClientID: clientID,
+			},
+			Target:  userTarget(user),
+			Details: map[string]string{"flow": flow},
+		})
+		return errInvalidOTP
+	}
+	s.releaseLogin(ctx, ipKey, userKey)
+	return nil
+}
+
+// requiresOTP reports whether the user enrolled a second factor
+func (s *Storage) requiresOTP(ctx context.Context, user *kimv1.User) (bool, error) {
+	secret, err := s.userStore.TOTPSecret(ctx, user)
+	return secret != "", err
+}
@@ -8,6 +8,8 @@ import (
 
 	"github.com/zitadel/oidc/v3/pkg/oidc"
 	"github.com/zitadel/oidc/v3/pkg/op"
+
+	"github.com/crochee/kim/internal/audit"
 )
 
 const (
@@ -18,7 +20,7 @@ const (
 	// CustomClaim is an example for how to return custom claims with this library
 	CustomClaim = "custom_claim"
 
-	// CustomScopeImpersonatePrefix is an example scope prefix for passing user id to impersonate using token exchange
+	// CustomScopeImpersonatePrefix is the scope prefix passing the subject to impersonate with a token exchange
 	CustomScopeImpersonatePrefix = "custom_scope:impersonate:"
 )
 
@@ -38,9 +40,20 @@ type AuthRequest struct {
 	ResponseMode  oidc.ResponseMode
 	Nonce         string
 	CodeChallenge *OIDCCodeChallenge
+	SessionID     string
 
 	done     bool
 	authTime time.Time
+	username string
+	// otpPending is set after the password of a user with a second factor was checked
+	otpPending bool
+	// mfa is set once the one-time code was checked as well
+	mfa bool
+	// subject is the subject of the user as seen by the client (see Storage.clientSubject)
+	subject string
+	// target is the audit target of the user, it is resolved at the login so that the sessions
+	// are audited without a lookup of the user under the lock
+	target *audit.Target
 }
 
 // LogValue allows you to define which fields will be logged.
@@ -65,11 +78,14 @@ func (a *AuthRequest) GetACR() string {
 }
 
 func (a *AuthRequest) GetAMR() []string {
-	// this example only uses password for authentication
-	if a.done {
-		return []string{"pwd"}
+	// the users authenticate by password and optionally a one-time code
+	if !a.done {
+		return nil
 	}
-	return nil
+	if a.mfa {
+		return []string{"pwd", "otp", "mfa"}
+	}
+	return []string{"pwd"}
 }
 
 func (a *AuthRequest) GetAudience() []string {
@@ -88,6 +104,15 @@ func (a *AuthRequest) GetCodeChallenge() *oidc.CodeChallenge {
 	return CodeChallengeToOIDC(a.CodeChallenge)
 }
 
+func (a *AuthRequest) GetLoginHint() string {
+	return a.LoginHint
+}
+
+// GetUILocales returns the languages the client prefers for the login pages
+func (a *AuthRequest) GetUILocales() []language.Tag {
+	return a.UiLocales
+}
+
 func (a *AuthRequest) GetNonce() string {
 	return a.Nonce
 }
@@ -112,7 +137,11 @@ func (a *AuthRequest) GetState() string {
 	return a.TransferState
 }
 
+// GetSubject returns the subject of the tokens, which is pairwise for the clients opting in
 func (a *AuthRequest) GetSubject() string {
+	if a.subject != "" {
+		return a.subject
+	}
 	return a.UserID
 }
 
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+)
+
+const (
+	// SubjectTypePublic gives all clients the same subject of a user
+	SubjectTypePublic = "public"
+	// SubjectTypePairwise gives the clients of each sector a subject of a user of their own
+	SubjectTypePairwise = "pairwise"
+)
+
+// SectorDocuments are the local copies of the documents at the sector_identifier_uris: the redirect uris
+// they list by the uri. The documents are not fetched, so that a changed document takes effect deliberately.
+type SectorDocuments map[string][]string
+
+// LoadSectorDocuments reads the documents from a JSON file mapping the sector_identifier_uris to their redirect uris
+func LoadSectorDocuments(path string) (SectorDocuments, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	documents := SectorDocuments{}
+	if err = json.Unmarshal(data, &documents); err != nil {
+		return nil, fmt.Errorf("invalid sector identifier documents %s: %w", path, err)
+	}
+	return documents, nil
+}
+
+// WithPairwiseSubject makes the subjects of the client pairwise. The sector is the host of the
+// sector_identifier_uri, whose document must list all redirect uris of the client; without a
+// sector_identifier_uri the redirect uris must share their host, which is the sector.
+func (c *Client) WithPairwiseSubject(sectorIdentifierURI string, documents SectorDocuments) error {
+	if sectorIdentifierURI == "" {
+		var host string
+		for _, redirectURI := range c.redirectURIs {
+			u, err := url.Parse(redirectURI)
+			if err != nil {
+				return fmt.Errorf("client %s: %w", c.id, err)
+			}
+			if host != "" && u.Host != host {
+				return fmt.Errorf("client %s: the redirect uris have several hosts, a sector_identifier_uri is required", c.id)
+			}
+			host = u.Host
+		}
+		if host == "" {
+			return fmt.Errorf("client %s: a sector_identifier_uri is required without redirect uris", c.id)
+		}
+		c.sector = host
+		return nil
+	}
+	u, err := url.Parse(sectorIdentifierURI)
+	if err != nil {
+		return fmt.Errorf("client %s: %w", c.id, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("client %s: the sector_identifier_uri %s must be an https url", c.id, sectorIdentifierURI)
+	}
+	document, ok := documents[sectorIdentifierURI]
+	if !ok {
+		return fmt.Errorf("client %s: no document of the sector_identifier_uri %s", c.id, sectorIdentifierURI)
+	}
+	for _, redirectURI := range c.redirectURIs {
+		if !slices.Contains(document, redirectURI) {
+			return fmt.Errorf("client %s: the redirect uri %s is not listed by the sector_identifier_uri %s",
+				c.id, redirectURI, sectorIdentifierURI)
+		}
+	}
+	c.sector = u.Host
+	return nil
+}
+
+// SubjectType returns the subject_type of the client
+func (c *Client) SubjectType() string {
+	if c.sector != "" {
+		return SubjectTypePairwise
+	}
+	return SubjectTypePublic
+}
+
+// pairwiseSubjects computes the pairwise subjects and remembers the user of each of them
+type pairwiseSubjects struct {
+	salt []byte
+
+	mu sync.RWMutex
+	// users are the subjects of the users by their pairwise subjects
+	users map[string]string
+}
+
+// WithPairwiseSubjects enables the pairwise subjects of the clients opting in, they are derived from the salt
+// which must not change and must be shared by all replicas, or the subjects would change
+func (s *Storage) WithPairwiseSubjects(salt []byte) *Storage {
+	s.pairwise = &pairwiseSubjects{salt: salt, users: make(map[string]string)}
+	return s
+}
+
+// clientSubject returns the subject of the user (see UserSubject) as seen by the client, the tokens carry it.
+// The user of a pairwise subject is remembered, the tokens are kept in memory just as well.
+func (s *Storage) clientSubject(clientID, subject string) string {
+	// the clients are not changed after the start, so they are read without the lock
+	client, ok := s.clients[clientID]
+	if !ok || client.sector == "" || s.pairwise == nil || subject == "" {
+		return subject
+	}
+	mac := hmac.New(sha256.New, s.pairwise.salt)
+	mac.Write([]byte(client.sector))
+	mac.Write([]byte{0})
+	mac.Write([]byte(subject))
+	pairwise := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	s.pairwise.mu.Lock()
+	defer s.pairwise.mu.Unlock()
+	s.pairwise.users[pairwise] = subject
+	return pairwise
+}
+
+// userSubject returns the subject of the user of a subject seen by a client, the counterpart of clientSubject
+func (s *Storage) userSubject(subject string) string {
+	if s.pairwise == nil {
+		return subject
+	}
+	s.pairwise.mu.RLock()
+	defer s.pairwise.mu.RUnlock()
+	if user, ok := s.pairwise.users[subject]; ok {
+		return user
+	}
+	return subject
+}
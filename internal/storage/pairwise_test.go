@@ -0,0 +1,72 @@
+package storage
+
+import "testing"
+
+func TestWithPairwiseSubject(t *testing.T) {
+	documents := SectorDocuments{
+		"https://partner.example.com/sector.json": {"https://a.partner.example.com/cb", "https://b.partner.example.com/cb"},
+	}
+	for _, tc := range []struct {
+		name                string
+		redirectURIs        []string
+		sectorIdentifierURI string
+		wantSector          string
+		wantErr             bool
+	}{
+		{name: "host of the redirect uris", redirectURIs: []string{"https://app.example.com/cb", "https://app.example.com/cb2"}, wantSector: "app.example.com"},
+		{name: "several hosts", redirectURIs: []string{"https://a.example.com/cb", "https://b.example.com/cb"}, wantErr: true},
+		{name: "sector identifier", redirectURIs: []string{"https://a.partner.example.com/cb"}, sectorIdentifierURI: "https://partner.example.com/sector.json", wantSector: "partner.example.com"},
+		{name: "unlisted redirect uri", redirectURIs: []string{"https://c.partner.example.com/cb"}, sectorIdentifierURI: "https://partner.example.com/sector.json", wantErr: true},
+		{name: "unknown document", redirectURIs: []string{"https://a.partner.example.com/cb"}, sectorIdentifierURI: "https://other.example.com/sector.json", wantErr: true},
+		{name: "http sector identifier", redirectURIs: []string{"https://a.partner.example.com/cb"}, sectorIdentifierURI: "http://partner.example.com/sector.json", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := WebClient("web", "secret", tc.redirectURIs...)
+			err := client.WithPairwiseSubject(tc.sectorIdentifierURI, documents)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("WithPairwiseSubject() = %v, want error %t", err, tc.wantErr)
+			}
+			if client.sector != tc.wantSector {
+				t.Errorf("sector = %q, want %q", client.sector, tc.wantSector)
+			}
+		})
+	}
+}
+
+func TestClientSubject(t *testing.T) {
+	pairwise := func(id, redirectURI string) *Client {
+		client := WebClient(id, "secret", redirectURI)
+		if err := client.WithPairwiseSubject("", nil); err != nil {
+			t.Fatal(err)
+		}
+		return client
+	}
+	s := (&Storage{clients: map[string]*Client{
+		"public": WebClient("public", "secret", "https://public.example.com/cb"),
+		"a1":     pairwise("a1", "https://a.example.com/cb"),
+		"a2":     pairwise("a2", "https://a.example.com/cb2"),
+		"b":      pairwise("b", "https://b.example.com/cb"),
+	}}).WithPairwiseSubjects([]byte("salt"))
+
+	if got := s.clientSubject("public", "uid-1"); got != "uid-1" {
+		t.Errorf("clientSubject(public) = %q, want the subject of the user", got)
+	}
+	a1, a2, b := s.clientSubject("a1", "uid-1"), s.clientSubject("a2", "uid-1"), s.clientSubject("b", "uid-1")
+	if a1 == "uid-1" || a1 != a2 || a1 == b {
+		t.Errorf("clientSubject() = %q, %q, %q, want the same subject within a sector only", a1, a2, b)
+	}
+	if other := s.clientSubject("a1", "uid-2"); other == a1 {
+		t.Errorf("clientSubject() of another user = %q, want another subject", other)
+	}
+	for _, subject := range []string{a1, b, "uid-1"} {
+		if got := s.userSubject(subject); got != "uid-1" {
+			t.Errorf("userSubject(%q) = %q, want uid-1", subject, got)
+		}
+	}
+
+	// the subjects only depend on the salt, sector and user
+	again := (&Storage{clients: s.clients}).WithPairwiseSubjects([]byte("salt"))
+	if got := again.clientSubject("a2", "uid-1"); got != a1 {
+		t.Errorf("clientSubject() after a restart = %q, want %q", got, a1)
+	}
+}
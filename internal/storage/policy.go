@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/policy"
+)
+
+// policyRules returns the rules of the Policies of the namespace, a missing Policy grants nothing
+func policyRules(ctx context.Context, reader client.Reader, namespace string, names []string) ([]kimv1.Rule, error) {
+	rules := make([]kimv1.Rule, 0)
+	for _, name := range names {
+		obj := &kimv1.Policy{}
+		if err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, obj); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		rules = append(rules, obj.Spec.Rules...)
+	}
+	return rules, nil
+}
+
+func (us *userStore) Permissions(ctx context.Context, user *kimv1.User) ([]kimv1.Rule, error) {
+	return policyRules(ctx, us.Client, user.Namespace, user.Spec.Policies)
+}
+
+// WithAdminNamespace lets the Policies of the namespace grant the resources of all namespaces,
+// the Policies of the other namespaces only grant the resources of their own (see policy.Confine)
+func (s *Storage) WithAdminNamespace(namespace string) *Storage {
+	s.adminNamespace = namespace
+	return s
+}
+
+// subjectPermissions returns the rules of the Policies bound to the machine client or the user of the subject
+func (s *Storage) subjectPermissions(ctx context.Context, subject string) ([]kimv1.Rule, error) {
+	rules, ok, err := s.machinePermissions(ctx, subject)
+	if ok || err != nil {
+		return rules, err
+	}
+	user, err := s.userStore.GetUserByID(ctx, s.userSubject(subject))
+	if err != nil {
+		return nil, err
+	}
+	rules, err = s.userStore.Permissions(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return policy.Confine(rules, user.Namespace, s.adminNamespace), nil
+}
+
+// subjectResource returns the policy resource of the machine client or the user of the subject
+func (s *Storage) subjectResource(ctx context.Context, subject string) (string, error) {
+	if s.machineClients != nil {
+		obj, err := s.machineClients.get(ctx, subject)
+		if err == nil {
+			return policy.MachineClientResource(obj), nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return "", err
+		}
+	}
+	user, err := s.userStore.GetUserByID(ctx, s.userSubject(subject))
+	if err != nil {
+		return "", err
+	}
+	return policy.UserResource(user), nil
+}
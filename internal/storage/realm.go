@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"slices"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+// UserStoreFromClient returns the store of the User objects read by the client, which must read from
+// a cache with the indexes of IndexUsers if the lookup resolves claims
+func UserStoreFromClient(c client.Client, lookup UserLookup) UserStore {
+	return &userStore{Client: c, lookupConfig: lookup}
+}
+
+// namespacedUserStore only knows the users of its namespaces, so that a realm can not sign in the users of another
+type namespacedUserStore struct {
+	UserStore
+	namespaces []string
+}
+
+// NewNamespacedUserStore restricts the store to the users of the namespaces
+func NewNamespacedUserStore(store UserStore, namespaces []string) UserStore {
+	return &namespacedUserStore{UserStore: store, namespaces: namespaces}
+}
+
+func (s *namespacedUserStore) GetUserByID(ctx context.Context, userID string) (*kimv1.User, error) {
+	user, err := s.UserStore.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.filter(user)
+}
+
+func (s *namespacedUserStore) GetUserByUsername(ctx context.Context, name string) (*kimv1.User, error) {
+	user, err := s.UserStore.GetUserByUsername(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.filter(user)
+}
+
+// filter hides the users of other namespaces as if they did not exist
+func (s *namespacedUserStore) filter(user *kimv1.User) (*kimv1.User, error) {
+	if !slices.Contains(s.namespaces, user.Namespace) {
+		return nil, apierrors.NewNotFound(kimv1.Resource("users"), user.Name)
+	}
+	return user, nil
+}
@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"k8s.io/utils/ptr"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/audit"
+	"github.com/crochee/kim/internal/i18n"
+	"github.com/crochee/kim/internal/lockout"
+	"github.com/crochee/kim/internal/mail"
+)
+
+// MinPasswordLength is the minimum length of the passwords chosen by the users
+const MinPasswordLength = 8
+
+const (
+	purposePasswordReset     = "password_reset"
+	purposeEmailVerification = "email_verification"
+
+	// PathPasswordReset and PathVerifyEmail are the pages of the links sent to the users, relative to the issuer
+	PathPasswordReset = "/recovery/password/reset"
+	PathVerifyEmail   = "/recovery/email/verify"
+)
+
+var (
+	errRecoveryDisabled = errors.New("self-service recovery is not enabled")
+	errInvalidLink      = errors.New("the link is invalid, expired or was already used")
+	errPasswordTooShort = fmt.Errorf("the password must have at least %d characters", MinPasswordLength)
+)
+
+// sendTimeout bounds the delivery of a link sent after the response
+const sendTimeout = time.Minute
+
+// recovery sends the signed links of the self-service flows
+type recovery struct {
+	mailer mail.Mailer
+	codec  *securecookie.SecureCookie
+	ttl    time.Duration
+	// issuer is the URL the links point to, it is configured rather than taken from the Host of the request,
+	// which the requester controls
+	issuer string
+	// sending are the links still being sent after the response
+	sending sync.WaitGroup
+}
+
+// linkClaims are signed into the links; the version binds a link to the state it was sent for,
+// so that it can only be used once without keeping track of the used links
+type linkClaims struct {
+	Subject string `json:"sub"`
+	Version string `json:"v"`
+}
+
+// WithRecovery enables the self-service password reset and email verification,
+// the links to the pages below the issuer are signed with a key derived from secret and expire after ttl.
+// All replicas serving the same issuer must share the secret.
+func (s *Storage) WithRecovery(mailer mail.Mailer, issuer string, secret []byte, ttl time.Duration) *Storage {
+	if len(secret) == 0 {
+		secret = securecookie.GenerateRandomKey(64)
+	}
+	// the key differs from the one of the session cookie derived from the same secret
+	key := sha512.Sum512(append([]byte("kim-recovery:"), secret...))
+	codec := securecookie.New(key[:], nil)
+	codec.MaxAge(int(ttl.Seconds()))
+	codec.SetSerializer(securecookie.JSONEncoder{})
+	s.recovery = &recovery{
+		mailer: mailer,
+		codec:  codec,
+		ttl:    ttl,
+		issuer: strings.TrimSuffix(issuer, "/"),
+	}
+	return s
+}
+
+// RequestPasswordReset sends a link to reset the password to the email address of the user,
+// unknown users and users without an email address are silently ignored so that they can not be probed.
+// The link is sent after the response, so that its delivery time does not tell the user exists either
+func (s *Storage) RequestPasswordReset(ctx context.Context, username string) error {
+	if s.recovery == nil {
+		return errRecoveryDisabled
+	}
+	user, err := s.userStore.GetUserByUsername(ctx, username)
+	if err != nil || ptr.Deref(user.Spec.Email, "") == "" {
+		return nil
+	}
+	s.recovery.sending.Add(1)
+	go func() {
+		defer s.recovery.sending.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sendTimeout)
+		defer cancel()
+		version, err := s.userStore.CredentialVersion(ctx, user)
+		if err == nil {
+			err = s.recovery.send(ctx, user, purposePasswordReset, PathPasswordReset, version, "mail.reset")
+		}
+		audit.Record(ctx, audit.Event{
+			Type:    audit.PasswordResetRequested,
+			Outcome: audit.OutcomeOf(err),
+			Actor:   audit.Actor{Username: username},
+			Target:  userTarget(user),
+		})
+		sendFailed(ctx, user, err)
+	}()
+	return nil
+}
+
+// ResetPassword sets the password of the user of the reset link
+func (s *Storage) ResetPassword(ctx context.Context, token, password string) error {
+	if s.recovery == nil {
+		return errRecoveryDisabled
+	}
+	if len(password) < MinPasswordLength {
+		return errPasswordTooShort
+	}
+	user, claims, err := s.recovery.verify(ctx, s.userStore, purposePasswordReset, token)
+	if err != nil {
+		return err
+	}
+	// the password is only set if the credentials are still of the version the link was sent for,
+	// so that the link can not be used twice, not even concurrently
+	err = s.userStore.SetPassword(ctx, user, claims.Version, password)
+	if errors.Is(err, errCredentialsChanged) {
+		return errInvalidLink
+	}
+	audit.Record(ctx, audit.Event{
+		Type:    audit.PasswordReset,
+		Outcome: audit.OutcomeOf(err),
+		Actor:   audit.Actor{Subject: UserSubject(user)},
+		Target:  userTarget(user),
+	})
+	if err != nil {
+		return err
+	}
+	// the owner of the mailbox proved to be the user, the failed logins of the attacker do not count any longer
+	s.loginSucceeded(ctx, lockout.UserKey(user.Namespace, user.Name), user)
+	return nil
+}
+
+// RequestEmailVerification sends a link to verify the email address of the user to the address,
+// unknown users and users without or with an already verified address are silently ignored
+func (s *Storage) RequestEmailVerification(ctx context.Context, username string) error {
+	if s.recovery == nil {
+		return errRecoveryDisabled
+	}
+	user, err := s.userStore.GetUserByUsername(ctx, username)
+	if err != nil || ptr.Deref(user.Spec.Email, "") == "" || ptr.Deref(user.Spec.EmailVerified, false) {
+		return nil
+	}
+	err = s.recovery.send(ctx, user, purposeEmailVerification, PathVerifyEmail, emailVersion(*user.Spec.Email), "mail.verify")
+	audit.Record(ctx, audit.Event{
+		Type:    audit.EmailVerificationRequested,
+		Outcome: audit.OutcomeOf(err),
+		Actor:   audit.Actor{Username: username},
+		Target:  userTarget(user),
+	})
+	sendFailed(ctx, user, err)
+	return nil
+}
+
+// sendFailed logs the failure to send a link, the requester gets the answer of the unknown users
+// so that the errors do not tell which users exist
+func sendFailed(ctx context.Context, user *kimv1.User, err error) {
+	if err != nil {
+		slog.ErrorContext(ctx, "could not send the link", "user", user.Namespace+"/"+user.Name, "error", err)
+	}
+}
+
+// VerifyEmail marks the email address of the user of the verification link as verified
+func (s *Storage) VerifyEmail(ctx context.Context, token string) error {
+	if s.recovery == nil {
+		return errRecoveryDisabled
+	}
+	user, claims, err := s.recovery.verify(ctx, s.userStore, purposeEmailVerification, token)
+	if err != nil {
+		return err
+	}
+	if ptr.Deref(user.Spec.EmailVerified, false) || claims.Version != emailVersion(ptr.Deref(user.Spec.Email, "")) {
+		return errInvalidLink
+	}
+	err = s.userStore.SetEmailVerified(ctx, user)
+	audit.Record(ctx, audit.Event{
+		Type:    audit.EmailVerified,
+		Outcome: audit.OutcomeOf(err),
+		Actor:   audit.Actor{Subject: UserSubject(user)},
+		Target:  userTarget(user),
+	})
+	if errors.Is(err, errEmailChanged) {
+		return errInvalidLink
+	}
+	return err
+}
+
+// send mails the signed link to the page of the issuer to the user, the subject and body of the mail
+// are the messages of the key
+func (r *recovery) send(ctx context.Context, user *kimv1.User, purpose, path, version, key string) error {
+	link, err := r.link(purpose, path, user, version)
+	if err != nil {
+		return err
+	}
+	l := userLocalizer(user)
+	return r.mailer.Send(ctx, &mail.Message{
+		To:      *user.Spec.Email,
+		Subject: l.T(key + ".subject"),
+		Body:    l.T(key+".body", user.Name, r.ttl, link),
+	})
+}
+
+// link returns the signed link to the page of the issuer for the user
+func (r *recovery) link(purpose, path string, user *kimv1.User, version string) (string, error) {
+	token, err := r.codec.Encode(purpose, &linkClaims{
+		Subject: UserSubject(user),
+		Version: version,
+	})
+	if err != nil {
+		return "", err
+	}
+	return r.issuer + path + "?token=" + url.QueryEscape(token), nil
+}
+
+// verify checks the signature and expiry of the token and returns the user it was sent to
+func (r *recovery) verify(ctx context.Context, users UserStore, purpose, token string) (*kimv1.User, *linkClaims, error) {
+	claims := &linkClaims{}
+	if err := r.codec.Decode(purpose, token, claims); err != nil {
+		return nil, nil, errInvalidLink
+	}
+	user, err := users.GetUserByID(ctx, claims.Subject)
+	if err != nil {
+		return nil, nil, errInvalidLink
+	}
+	return user, claims, nil
+}
+
+// userLocalizer returns the localizer of the mails sent to the user, in the language of the locale claim
+func userLocalizer(user *kimv1.User) *i18n.Localizer {
+	return i18n.Match(nil, ClaimValue(user, "locale"), "")
+}
+
+// emailVersion binds a verification link to the address it was sent to
+func emailVersion(email string) string {
+	sum := sha256.Sum256([]byte(email))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/mail"
+)
+
+// failingMailer fails to send every message
+type failingMailer struct{}
+
+func (failingMailer) Send(context.Context, *mail.Message) error {
+	return errors.New("connection refused")
+}
+
+// blockingMailer sends the messages once released
+type blockingMailer struct {
+	release chan struct{}
+}
+
+func (m blockingMailer) Send(context.Context, *mail.Message) error {
+	<-m.release
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`token=(\S+)`)
+
+func TestRecovery(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := kimv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	alice := &kimv1.User{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "alice", UID: "8c6f5b3e-uid"}}
+	alice.Spec.Email = ptr.To("alice@example.com")
+	alice.Spec.SecretName = "alice-credentials"
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "alice-credentials"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithIndex(&kimv1.User{}, IndexUserSubject, func(obj client.Object) []string {
+			return []string{UserSubject(obj.(*kimv1.User))}
+		}).
+		WithObjects(alice, secret).
+		Build()
+	ctx := context.Background()
+	users := UserStoreFromClient(c, DefaultUserLookup)
+
+	s := NewStorageWithClients(users, map[string]*Client{}).
+		WithRecovery(failingMailer{}, "https://id.example.com/", []byte("secret"), time.Hour)
+	if err := s.RequestPasswordReset(ctx, "alice/team-a"); err != nil {
+		t.Fatalf("RequestPasswordReset() = %v, the failures must not tell the user exists", err)
+	}
+	s.recovery.sending.Wait()
+
+	// the response must not wait for the delivery, its duration would tell the user exists
+	blocking := blockingMailer{release: make(chan struct{})}
+	s = NewStorageWithClients(users, map[string]*Client{}).
+		WithRecovery(blocking, "https://id.example.com/", []byte("secret"), time.Hour)
+	if err := s.RequestPasswordReset(ctx, "alice/team-a"); err != nil {
+		t.Fatal(err)
+	}
+	close(blocking.release)
+	s.recovery.sending.Wait()
+
+	mailer := mail.NewMemoryMailer()
+	s = NewStorageWithClients(users, map[string]*Client{}).
+		WithRecovery(mailer, "https://id.example.com/", []byte("secret"), time.Hour)
+	if err := s.RequestPasswordReset(ctx, "alice/team-a"); err != nil {
+		t.Fatal(err)
+	}
+	s.recovery.sending.Wait()
+	messages := mailer.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("messages = %d, want 1", len(messages))
+	}
+	if !strings.Contains(messages[0].Body, "https://id.example.com"+PathPasswordReset+"?token=") {
+		t.Fatalf("the link does not point to the configured issuer: %s", messages[0].Body)
+	}
+	match := linkToken.FindStringSubmatch(messages[0].Body)
+	if match == nil {
+		t.Fatalf("no token in %s", messages[0].Body)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.ResetPassword(ctx, token, "new-password"); err != nil {
+		t.Fatalf("ResetPassword() = %v", err)
+	}
+	if err = s.ResetPassword(ctx, token, "other-password"); !errors.Is(err, errInvalidLink) {
+		t.Fatalf("second ResetPassword() = %v, want the link to be used up", err)
+	}
+	if err = users.VerifyPassword(ctx, alice, "new-password"); err != nil {
+		t.Fatalf("VerifyPassword() = %v", err)
+	}
+}
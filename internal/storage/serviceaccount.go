@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+// serviceAccountPrefix is the prefix of the user names of the ServiceAccounts in the TokenReviews
+const serviceAccountPrefix = "system:serviceaccount:"
+
+var errInvalidServiceAccountToken = errors.New("invalid service account token")
+
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+// +kubebuilder:rbac:groups=kim.kim.io,resources=serviceaccountbindings,verbs=get;list;watch
+
+// ServiceAccountStore verifies the ServiceAccount tokens by TokenReviews of the apiserver and finds the
+// MachineClients the ServiceAccounts are bound to
+type ServiceAccountStore struct {
+	client client.Client
+	// audiences the tokens must be issued for, the audiences of the apiserver if empty
+	audiences []string
+	// namespaces restricts the ServiceAccounts to these namespaces, any namespace if empty
+	namespaces []string
+}
+
+// NewServiceAccountStore returns the store verifying the ServiceAccount tokens of the audiences by the client
+func NewServiceAccountStore(c client.Client, audiences []string, namespaces ...string) *ServiceAccountStore {
+	return &ServiceAccountStore{
+		client:     c,
+		audiences:  audiences,
+		namespaces: namespaces,
+	}
+}
+
+// ParseServiceAccountUsername returns the ServiceAccount of the user name system:serviceaccount:namespace:name,
+// ok is false if it is no ServiceAccount
+func ParseServiceAccountUsername(username string) (key types.NamespacedName, ok bool) {
+	value, ok := strings.CutPrefix(username, serviceAccountPrefix)
+	if !ok {
+		return key, false
+	}
+	key.Namespace, key.Name, ok = strings.Cut(value, ":")
+	return key, ok && key.Namespace != "" && key.Name != "" && !strings.Contains(key.Name, ":")
+}
+
+// review returns the ServiceAccount the token was issued to
+func (a *ServiceAccountStore) review(ctx context.Context, token string) (types.NamespacedName, error) {
+	review := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{
+		Token:     token,
+		Audiences: a.audiences,
+	}}
+	if err := a.client.Create(ctx, review); err != nil {
+		return types.NamespacedName{}, err
+	}
+	if !review.Status.Authenticated {
+		if review.Status.Error != "" {
+			return types.NamespacedName{}, fmt.Errorf("%w: %s", errInvalidServiceAccountToken, review.Status.Error)
+		}
+		return types.NamespacedName{}, errInvalidServiceAccountToken
+	}
+	key, ok := ParseServiceAccountUsername(review.Status.User.Username)
+	if !ok {
+		return key, fmt.Errorf("%w: %s is no service account", errInvalidServiceAccountToken, review.Status.User.Username)
+	}
+	return key, nil
+}
+
+// machineClient returns the enabled MachineClient the ServiceAccount is bound to by exactly one binding
+func (a *ServiceAccountStore) machineClient(ctx context.Context, key types.NamespacedName) (*kimv1.MachineClient, error) {
+	if len(a.namespaces) > 0 && !slices.Contains(a.namespaces, key.Namespace) {
+		return nil, apierrors.NewNotFound(kimv1.Resource("serviceaccountbindings"), key.String())
+	}
+	bindings := &kimv1.ServiceAccountBindingList{}
+	if err := a.client.List(ctx, bindings, client.InNamespace(key.Namespace)); err != nil {
+		return nil, err
+	}
+	var bound []string
+	for _, binding := range bindings.Items {
+		if binding.Spec.ServiceAccountName == key.Name {
+			bound = append(bound, binding.Spec.MachineClientName)
+		}
+	}
+	switch len(bound) {
+	case 0:
+		return nil, apierrors.NewNotFound(kimv1.Resource("serviceaccountbindings"), key.String())
+	case 1:
+	default:
+		return nil, fmt.Errorf("service account %s is bound to the machine clients %s", key, strings.Join(bound, ", "))
+	}
+	obj := &kimv1.MachineClient{}
+	if err := a.client.Get(ctx, types.NamespacedName{Namespace: key.Namespace, Name: bound[0]}, obj); err != nil {
+		return nil, err
+	}
+	if obj.Spec.Disabled {
+		return nil, apierrors.NewNotFound(kimv1.Resource("machineclients"), MachineClientID(obj))
+	}
+	return obj, nil
+}
+
+// WithServiceAccounts lets the ServiceAccounts of the store exchange their tokens for the tokens of the
+// MachineClients they are bound to
+func (s *Storage) WithServiceAccounts(store *ServiceAccountStore) *Storage {
+	s.serviceAccounts = store
+	return s
+}
+
+// serviceAccountTokenRequest verifies the ServiceAccount token and returns the request of the access token of the
+// MachineClient the ServiceAccount is bound to, external is the user name of the ServiceAccount
+func (s *Storage) serviceAccountTokenRequest(ctx context.Context, grantType oidc.GrantType, token string, scopes []string) (external string, _ *externalJWTRequest, _ *Client, _ error) {
+	serviceAccount, err := s.serviceAccounts.review(ctx, token)
+	if err != nil {
+		return "", nil, nil, oidc.ErrInvalidGrant().WithDescription("subject_token is invalid").WithParent(err)
+	}
+	external = serviceAccountPrefix + serviceAccount.Namespace + ":" + serviceAccount.Name
+	obj, err := s.serviceAccounts.machineClient(ctx, serviceAccount)
+	if err != nil {
+		return external, nil, nil, oidc.ErrAccessDenied().WithDescription("service account %s is not bound to a machine client",
+			serviceAccount).WithParent(err)
+	}
+	request, err := machineTokenRequest(obj, scopes)
+	if err != nil {
+		return external, nil, nil, err
+	}
+	return external, &externalJWTRequest{JWTTokenRequest: request, grantType: grantType}, machineClient(obj, grantType), nil
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+func TestParseServiceAccountUsername(t *testing.T) {
+	for username, want := range map[string]bool{
+		"system:serviceaccount:jobs:reporter":  true,
+		"system:serviceaccount:jobs":           false,
+		"system:serviceaccount::reporter":      false,
+		"system:serviceaccount:jobs:report:er": false,
+		"system:node:worker-1":                 false,
+		"alice":                                false,
+	} {
+		if _, ok := ParseServiceAccountUsername(username); ok != want {
+			t.Errorf("ParseServiceAccountUsername(%s) = %v, want %v", username, ok, want)
+		}
+	}
+}
+
+// TestJWTExchangeTokenRequest verifies the ServiceAccount tokens by TokenReviews of an envtest apiserver,
+// it needs the binaries of `make setup-envtest`
+func TestJWTExchangeTokenRequest(t *testing.T) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set")
+	}
+	env := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd", "bases")},
+		ErrorIfCRDPathMissing: true,
+	}
+	cfg, err := env.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.Stop() }()
+	scheme := runtime.NewScheme()
+	if err = clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err = kimv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, obj := range []client.Object{
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "reporter"}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "unbound"}},
+		&kimv1.MachineClient{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "reports"},
+			Spec:       kimv1.MachineClientSpec{Scopes: []string{"reports.read"}},
+		},
+		&kimv1.ServiceAccountBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "reporter"},
+			Spec:       kimv1.ServiceAccountBindingSpec{ServiceAccountName: "reporter", MachineClientName: "reports"},
+		},
+	} {
+		if err = c.Create(ctx, obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token := func(name string, audiences ...string) string {
+		request := &authenticationv1.TokenRequest{Spec: authenticationv1.TokenRequestSpec{Audiences: audiences}}
+		sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+		if err := c.SubResource("token").Create(ctx, sa, request); err != nil {
+			t.Fatal(err)
+		}
+		return request.Status.Token
+	}
+	s := (&Storage{}).WithServiceAccounts(NewServiceAccountStore(c, []string{"kim"}))
+
+	request, machine, _, err := s.JWTExchangeTokenRequest(ctx, token("reporter", "kim"), []string{"reports.read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.GetSubject() != "reports/default" || machine.GetID() != "reports/default" {
+		t.Errorf("JWTExchangeTokenRequest() = %s, %s, want reports/default", request.GetSubject(), machine.GetID())
+	}
+	for name, tt := range map[string]struct {
+		token  string
+		scopes []string
+	}{
+		"other audience":    {token("reporter", "other"), nil},
+		"unbound":           {token("unbound", "kim"), nil},
+		"not allowed scope": {token("reporter", "kim"), []string{"reports.write"}},
+		"invalid":           {"invalid", nil},
+	} {
+		if _, _, _, err := s.JWTExchangeTokenRequest(ctx, tt.token, tt.scopes); err == nil {
+			t.Errorf("%s: JWTExchangeTokenRequest() succeeded", name)
+		}
+	}
+}
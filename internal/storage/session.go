@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+
+	"github.com/crochee/kim/internal/audit"
+)
+
+const (
+	// SessionLifetime is how long a single sign-on session stays valid after the last
+	// successful authentication of the user.
+	SessionLifetime = 8 * time.Hour
+
+	// sweepInterval is how often the expired sessions and logouts are removed, abandoned ones are never looked up
+	sweepInterval = 10 * time.Minute
+)
+
+// Session represents a browser single sign-on session
+// it is created by a successful login and referenced by the session cookie of the login UI
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"userId"`
+	Username   string    `json:"username"`
+	AuthTime   time.Time `json:"authTime"`
+	AMR        []string  `json:"amr,omitempty"`
+	Expiration time.Time `json:"expiration"`
+	// Clients lists the ids of the clients the user signed in to with this session
+	Clients []string `json:"clients,omitempty"`
+
+	// target is the audit target of the user
+	target *audit.Target
+}
+
+type sessionIDKey struct{}
+
+// ContextWithSessionID returns a context carrying the id of the single sign-on session of the browser,
+// it is used by the end_session endpoint which does not have access to the session cookie
+func ContextWithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionIDKey{}, sessionID)
+}
+
+func sessionIDFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(sessionIDKey{}).(string)
+	return sessionID
+}
+
+func (s *Session) addClient(clientID string) {
+	if !slices.Contains(s.Clients, clientID) {
+		s.Clients = append(s.Clients, clientID)
+	}
+}
+
+func (s *Session) expired() bool {
+	return s.Expiration.Before(time.Now())
+}
+
+// acceptsSession reports whether the auth request can be completed by the session
+// without asking the user for credentials again
+func (a *AuthRequest) acceptsSession(session *Session) bool {
+	// prompt=login forces a new authentication even if the user is already signed in
+	if slices.Contains(a.Prompt, oidc.PromptLogin) {
+		return false
+	}
+	// max_age requires the last authentication to be recent enough
+	if a.MaxAuthAge != nil && session.AuthTime.Add(*a.MaxAuthAge).Before(time.Now()) {
+		return false
+	}
+	// the user was already determined by the id_token_hint
+	if a.UserID != "" && a.UserID != session.UserID {
+		return false
+	}
+	if a.LoginHint != "" && a.LoginHint != session.Username {
+		return false
+	}
+	return true
+}
+
+func (a *AuthRequest) promptNone() bool {
+	return slices.Contains(a.Prompt, oidc.PromptNone)
+}
+
+// ResumeSession implements the `authenticate` interface of the login
+// it tries to complete the auth request from the single sign-on session identified by sessionID
+// and reports whether the request is done, so the user does not have to enter the credentials again
+//
+// if the session can't be used and the client requested prompt=none, oidc.ErrLoginRequired is returned
+func (s *Storage) ResumeSession(ctx context.Context, sessionID, id string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	request, ok := s.authRequests[id]
+	if !ok {
+		return false, errors.New("request not found")
+	}
+	if request.done {
+		return true, nil
+	}
+	session := s.session(sessionID)
+	if session == nil || !request.acceptsSession(session) {
+		if request.promptNone() {
+			return false, oidc.ErrLoginRequired()
+		}
+		return false, nil
+	}
+	request.UserID = session.UserID
+	request.SessionID = session.ID
+	request.authTime = session.AuthTime
+	request.target = session.target
+	request.done = true
+	session.addClient(request.ApplicationID)
+	s.auditSession(ctx, audit.SessionResumed, session, request.ApplicationID)
+	s.auditConsent(ctx, request, session.target)
+	return true, nil
+}
+
+// BindSession implements the `authenticate` interface of the login
+// it will be called after the user authenticated the auth request identified by id
+//
+// if the session identified by sessionID belongs to the same user, its auth_time is refreshed (re-authentication),
+// otherwise a new session is started; the id of the resulting session is returned
+func (s *Storage) BindSession(ctx context.Context, sessionID, id string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	request, ok := s.authRequests[id]
+	if !ok || !request.done {
+		return "", errors.New("request not authenticated")
+	}
+	session := s.session(sessionID)
+	if session == nil || session.UserID != request.UserID {
+		s.sweep(time.Now())
+		session = &Session{
+			ID:     uuid.NewString(),
+			UserID: request.UserID,
+		}
+		s.sessions[session.ID] = session
+	}
+	session.Username = request.username
+	session.target = request.target
+	session.AuthTime = request.authTime
+	session.AMR = request.GetAMR()
+	session.Expiration = time.Now().Add(SessionLifetime)
+	session.addClient(request.ApplicationID)
+	request.SessionID = session.ID
+	return session.ID, nil
+}
+
+// session returns the valid session by id, expired sessions are removed
+// the caller must hold the lock
+func (s *Storage) session(id string) *Session {
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil
+	}
+	if session.expired() {
+		delete(s.sessions, id)
+		return nil
+	}
+	return session
+}
+
+// sweep removes the expired sessions and logouts at most once per sweepInterval, it is called when they are added
+// as the abandoned ones would never be looked up again
+// the caller must hold the lock
+func (s *Storage) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for id, session := range s.sessions {
+		if session.Expiration.Before(now) {
+			delete(s.sessions, id)
+		}
+	}
+	for id, logout := range s.logouts {
+		if logout.expiration.Before(now) {
+			delete(s.logouts, id)
+		}
+	}
+}
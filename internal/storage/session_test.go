@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+)
+
+func TestAcceptsSession(t *testing.T) {
+	session := &Session{ID: "sid", UserID: "uid-alice", Username: "alice", AuthTime: time.Now().Add(-time.Hour)}
+	minute, day := time.Minute, 24*time.Hour
+	tests := []struct {
+		name    string
+		request *AuthRequest
+		want    bool
+	}{
+		{"plain", &AuthRequest{}, true},
+		{"prompt=login", &AuthRequest{Prompt: []string{oidc.PromptLogin}}, false},
+		{"max_age exceeded", &AuthRequest{MaxAuthAge: &minute}, false},
+		{"max_age", &AuthRequest{MaxAuthAge: &day}, true},
+		{"id_token_hint of another user", &AuthRequest{UserID: "uid-bob"}, false},
+		{"id_token_hint", &AuthRequest{UserID: "uid-alice"}, true},
+		{"login_hint of another user", &AuthRequest{LoginHint: "bob"}, false},
+		{"login_hint", &AuthRequest{LoginHint: "alice"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.request.acceptsSession(session); got != tt.want {
+				t.Errorf("acceptsSession() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResumeSession(t *testing.T) {
+	ctx := context.Background()
+	minute := time.Minute
+	s := NewStorageWithClients(nil, map[string]*Client{})
+	s.sessions["sid"] = &Session{ID: "sid", UserID: "uid-alice", Username: "alice",
+		AuthTime: time.Now().Add(-time.Hour), Expiration: time.Now().Add(time.Hour), Clients: []string{"web"}}
+	s.sessions["expired"] = &Session{ID: "expired", UserID: "uid-alice", Username: "alice",
+		AuthTime: time.Now().Add(-9 * time.Hour), Expiration: time.Now().Add(-time.Hour)}
+
+	tests := []struct {
+		name      string
+		sessionID string
+		request   *AuthRequest
+		want      bool
+		wantErr   error
+	}{
+		{"session", "sid", &AuthRequest{ApplicationID: "api"}, true, nil},
+		{"no session", "", &AuthRequest{ApplicationID: "api"}, false, nil},
+		{"expired session", "expired", &AuthRequest{ApplicationID: "api"}, false, nil},
+		{"prompt=none without a session", "", &AuthRequest{ApplicationID: "api", Prompt: []string{oidc.PromptNone}},
+			false, oidc.ErrLoginRequired()},
+		{"prompt=none", "sid", &AuthRequest{ApplicationID: "api", Prompt: []string{oidc.PromptNone}}, true, nil},
+		{"max_age re-authentication", "sid", &AuthRequest{ApplicationID: "api", MaxAuthAge: &minute}, false, nil},
+		{"max_age with prompt=none", "sid",
+			&AuthRequest{ApplicationID: "api", MaxAuthAge: &minute, Prompt: []string{oidc.PromptNone}},
+			false, oidc.ErrLoginRequired()},
+		{"login_hint of another user", "sid", &AuthRequest{ApplicationID: "api", LoginHint: "bob"}, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.request.ID = tt.name
+			s.authRequests[tt.request.ID] = tt.request
+			done, err := s.ResumeSession(ctx, tt.sessionID, tt.request.ID)
+			if tt.wantErr != nil {
+				var oidcErr *oidc.Error
+				if !errors.As(err, &oidcErr) || oidcErr.ErrorType != tt.wantErr.(*oidc.Error).ErrorType {
+					t.Fatalf("ResumeSession() = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("ResumeSession() = %v", err)
+			}
+			if done != tt.want || tt.request.done != tt.want {
+				t.Fatalf("ResumeSession() = %v, want %v", done, tt.want)
+			}
+			if !tt.want {
+				return
+			}
+			if tt.request.UserID != "uid-alice" || tt.request.SessionID != "sid" {
+				t.Errorf("the request was completed for %s in %s", tt.request.UserID, tt.request.SessionID)
+			}
+			if clients := s.sessions["sid"].Clients; !slices.Contains(clients, "api") {
+				t.Errorf("the session lists the clients %v, want api", clients)
+			}
+		})
+	}
+	if _, err := s.ResumeSession(ctx, "sid", "unknown"); err == nil {
+		t.Error("ResumeSession() of an unknown request succeeded")
+	}
+}
+
+func TestSweep(t *testing.T) {
+	s := NewStorageWithClients(nil, map[string]*Client{})
+	now := time.Now()
+	s.sessions["active"] = &Session{ID: "active", Expiration: now.Add(time.Hour)}
+	s.sessions["abandoned"] = &Session{ID: "abandoned", Expiration: now.Add(-time.Hour)}
+	s.logouts["rendered"] = &frontChannelLogout{expiration: now.Add(time.Minute)}
+	s.logouts["abandoned"] = &frontChannelLogout{expiration: now.Add(-time.Minute)}
+
+	s.sweep(now)
+	if _, ok := s.sessions["abandoned"]; ok {
+		t.Error("sweep() kept the expired session")
+	}
+	if _, ok := s.logouts["abandoned"]; ok {
+		t.Error("sweep() kept the expired logout")
+	}
+	if len(s.sessions) != 1 || len(s.logouts) != 1 {
+		t.Errorf("sweep() left %d sessions and %d logouts, want 1 each", len(s.sessions), len(s.logouts))
+	}
+
+	// the maps are not walked for every new session
+	s.sessions["abandoned"] = &Session{ID: "abandoned", Expiration: now.Add(-time.Hour)}
+	s.sweep(now.Add(time.Minute))
+	if _, ok := s.sessions["abandoned"]; !ok {
+		t.Error("sweep() ran again within the interval")
+	}
+	s.sweep(now.Add(sweepInterval))
+	if _, ok := s.sessions["abandoned"]; ok {
+		t.Error("sweep() did not run after the interval")
+	}
+}
@@ -6,31 +6,37 @@ import (
 	"crypto/rsa"
 	"errors"
 	"fmt"
-	"math/big"
 	"strings"
 	"sync"
 	"time"
 
 	jose "github.com/go-jose/go-jose/v4"
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/text/language"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/utils/ptr"
 
 	"github.com/zitadel/oidc/v3/pkg/oidc"
 	"github.com/zitadel/oidc/v3/pkg/op"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/audit"
+	"github.com/crochee/kim/internal/lockout"
+	"github.com/crochee/kim/internal/metrics"
+	"github.com/crochee/kim/internal/tracing"
 )
 
-// serviceKey1 is a public key which will be used for the JWT Profile Authorization Grant
-// the corresponding private key is in the service-key1.json (for demonstration purposes)
-var serviceKey1 = &rsa.PublicKey{
-	N: func() *big.Int {
-		n, _ := new(big.Int).SetString("00f6d44fb5f34ac2033a75e73cb65ff24e6181edc58845e75a560ac21378284977bb055b1a75b714874e2a2641806205681c09abec76efd52cf40984edcf4c8ca09717355d11ac338f280d3e4c905b00543bdb8ee5a417496cb50cb0e29afc5a0d0471fd5a2fa625bd5281f61e6b02067d4fe7a5349eeae6d6a4300bcd86eef331", 16)
-		return n
-	}(),
-	E: 65537,
-}
+const (
+	loginFlowBrowser = "browser"
+	loginFlowDevice  = "device"
+)
 
 var (
-	_ op.Storage                  = &Storage{}
-	_ op.ClientCredentialsStorage = &Storage{}
+	_ op.Storage                        = &Storage{}
+	_ op.ClientCredentialsStorage       = &Storage{}
+	_ op.CanTerminateSessionFromRequest = &Storage{}
+	_ op.JWTProfileTokenStorage         = &Storage{}
 )
 
 // storage implements the op.Storage interface
@@ -43,12 +49,32 @@ type Storage struct {
 	tokens        map[string]*Token
 	clients       map[string]*Client
 	userStore     UserStore
-	services      map[string]Service
 	refreshTokens map[string]*RefreshToken
 	signingKey    signingKey
 	deviceCodes   map[string]deviceAuthorizationEntry
 	userCodes     map[string]string
-	serviceUsers  map[string]*Client
+	// sessions are kept in the memory of this replica only, like the tokens
+	sessions map[string]*Session
+	logouts  map[string]*frontChannelLogout
+	// lastSweep is the time the expired sessions and logouts were last removed
+	lastSweep time.Time
+	lockout   lockoutGuards
+	recovery  *recovery
+	// otpCounters remembers the period of the last one-time code of each user, so that codes can not be replayed
+	otpCounters map[string]int64
+	pairwise    *pairwiseSubjects
+	// machineClients are the clients of the client credentials grant, which is not supported if nil
+	machineClients *MachineClientStore
+	// serviceAccounts verifies the ServiceAccount tokens exchanged, which is not supported if nil
+	serviceAccounts *ServiceAccountStore
+	// workloadTrusts verifies the JWTs of the trusted external issuers, which are not trusted if nil
+	workloadTrusts *WorkloadTrustStore
+	// maxDelegationDepth is the maximum number of actors of an exchanged token
+	maxDelegationDepth int
+	// adminNamespace is the namespace of the Policies granting the resources of all namespaces
+	adminNamespace string
+	// retiredKeys are the public keys of the rotated signing keys
+	retiredKeys []retiredKey
 }
 
 type signingKey struct {
@@ -102,87 +128,178 @@ func NewStorageWithClients(userStore UserStore, clients map[string]*Client) *Sto
 		refreshTokens: make(map[string]*RefreshToken),
 		clients:       clients,
 		userStore:     userStore,
-		services: map[string]Service{
-			userStore.ExampleClientID(): {
-				keys: map[string]*rsa.PublicKey{
-					"key1": serviceKey1,
-				},
-			},
-		},
 		signingKey: signingKey{
 			id:        uuid.NewString(),
 			algorithm: jose.RS256,
 			key:       key,
 		},
-		deviceCodes: make(map[string]deviceAuthorizationEntry),
-		userCodes:   make(map[string]string),
-		serviceUsers: map[string]*Client{
-			"sid1": {
-				id:     "sid1",
-				secret: "verysecret",
-				grantTypes: []oidc.GrantType{
-					oidc.GrantTypeClientCredentials,
-				},
-				accessTokenType: op.AccessTokenTypeBearer,
-			},
-		},
+		deviceCodes:        make(map[string]deviceAuthorizationEntry),
+		userCodes:          make(map[string]string),
+		sessions:           make(map[string]*Session),
+		logouts:            make(map[string]*frontChannelLogout),
+		otpCounters:        make(map[string]int64),
+		maxDelegationDepth: DefaultMaxDelegationDepth,
 	}
 }
 
+// WithSigningKey replaces the random signing key of the tokens, all replicas serving the same issuer must share it
+func (s *Storage) WithSigningKey(id string, key *rsa.PrivateKey) *Storage {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.signingKey = signingKey{
+		id:        id,
+		algorithm: jose.RS256,
+		key:       key,
+	}
+	return s
+}
+
 // CheckUsernamePassword implements the `authenticate` interface of the login
-func (s *Storage) CheckUsernamePassword(username, password, id string) error {
+func (s *Storage) CheckUsernamePassword(ctx context.Context, username, password, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "Storage.CheckUsernamePassword")
+	defer func() {
+		_ = tracing.Error(span, err)
+		span.End()
+	}()
+	authReq, err := s.AuthRequestByID(ctx, id)
+	if err != nil {
+		metrics.Logins.WithLabelValues(loginFlowBrowser, metrics.ResultFailure, "request_not_found").Inc()
+		return err
+	}
+	span.SetAttributes(tracing.ClientIDKey.String(authReq.GetClientID()))
+	// the user store lookups hit the api server, so they must not be done while holding the lock
+	user, err := s.checkCredentials(ctx, loginFlowBrowser, authReq.GetClientID(), username, password)
+	if err != nil {
+		return err
+	}
+	otp, err := s.requiresOTP(ctx, user)
+	if err != nil {
+		return err
+	}
+
 	s.lock.Lock()
 	defer s.lock.Unlock()
 	request, ok := s.authRequests[id]
 	if !ok {
 		return fmt.Errorf("request not found")
 	}
-
-	// for demonstration purposes we'll check we'll have a simple user store and
-	// a plain text password.  For real world scenarios, be sure to have the password
-	// hashed and salted (e.g. using bcrypt)
-	user := s.userStore.GetUserByUsername(username)
-	if user != nil && user.Password == password {
-		// be sure to set user id into the auth request after the user was checked,
-		// so that you'll be able to get more information about the user after the login
-		request.UserID = user.ID
-
-		// you will have to change some state on the request to guide the user through possible multiple steps of the login process
-		// in this example we'll simply check the username / password and set a boolean to true
-		// therefore we will also just check this boolean if the request / login has been finished
-		request.done = true
-
-		request.authTime = time.Now()
-
-		return nil
+	// be sure to set user id into the auth request after the user was checked,
+	// so that you'll be able to get more information about the user after the login
+	request.UserID = UserSubject(user)
+	request.username = username
+	request.target = userTarget(user)
+
+	// you will have to change some state on the request to guide the user through possible multiple steps of the login process
+	// in this example we'll simply check the username / password and set a boolean to true
+	// therefore we will also just check this boolean if the request / login has been finished
+	// users with a second factor must also enter a one-time code (see CheckOTP)
+	request.otpPending = otp
+	request.done = !otp
+
+	request.authTime = time.Now()
+	if request.done {
+		s.auditConsent(ctx, request, request.target)
 	}
-	return fmt.Errorf("username or password wrong")
+
+	return nil
 }
 
-func (s *Storage) CheckUsernamePasswordSimple(username, password string) error {
-	s.lock.Lock()
-	defer s.lock.Unlock()
+func (s *Storage) CheckUsernamePasswordSimple(ctx context.Context, username, password string) error {
+	_, err := s.checkCredentials(ctx, loginFlowDevice, "", username, password)
+	return err
+}
 
-	user := s.userStore.GetUserByUsername(username)
-	if user != nil && user.Password == password {
-		return nil
+// checkCredentials looks up the user and verifies the password against the hash in the user's secret
+// the login attempt of the flow (browser, device) is recorded in the metrics and the audit log
+func (s *Storage) checkCredentials(ctx context.Context, flow, clientID, username, password string) (*kimv1.User, error) {
+	event := audit.Event{
+		Type:    audit.LoginFailed,
+		Outcome: audit.Failure,
+		Actor: audit.Actor{
+			Username: username,
+			ClientID: clientID,
+		},
+		Details: map[string]string{"flow": flow},
+	}
+	// locked out source addresses are rejected before the lookup, so they can not probe for users; the attempts
+	// are reserved before the password is verified, so that parallel guesses can not exceed the lockout policy
+	ipKey := sourceKey(ctx)
+	if err := s.lockout.ips.Reserve(ctx, ipKey); err != nil {
+		metrics.Logins.WithLabelValues(flow, metrics.ResultFailure, "locked").Inc()
+		event.Reason = "ip_locked"
+		audit.Record(ctx, event)
+		return nil, err
+	}
+	user, err := s.userStore.GetUserByUsername(ctx, username)
+	if err != nil && !apierrors.IsNotFound(err) {
+		// a failed lookup is no failed login, it must neither lock the user nor the source address
+		s.releaseLogin(ctx, ipKey, "")
+		metrics.Logins.WithLabelValues(flow, metrics.ResultFailure, "lookup_failed").Inc()
+		event.Reason = "lookup_failed"
+		audit.Record(ctx, event)
+		return nil, err
+	}
+	if err != nil {
+		// unknown login names are locked just like users, otherwise the lockout would reveal the existing users
+		userKey := lockout.UsernameKey(username)
+		if err = s.lockout.users.Reserve(ctx, userKey); err != nil {
+			s.releaseLogin(ctx, ipKey, "")
+			metrics.Logins.WithLabelValues(flow, metrics.ResultFailure, "locked").Inc()
+			event.Reason = "user_locked"
+			audit.Record(ctx, event)
+			return nil, err
+		}
+		s.loginFailed(ctx, ipKey, userKey, nil)
+		metrics.Logins.WithLabelValues(flow, metrics.ResultFailure, "unknown_user").Inc()
+		event.Reason = "unknown_user"
+		audit.Record(ctx, event)
+		return nil, errInvalidCredentials
+	}
+	event.Actor.Subject = UserSubject(user)
+	event.Target = userTarget(user)
+	userKey := lockout.UserKey(user.Namespace, user.Name)
+	if err = s.lockout.users.Reserve(ctx, userKey); err != nil {
+		s.releaseLogin(ctx, ipKey, "")
+		metrics.Logins.WithLabelValues(flow, metrics.ResultFailure, "locked").Inc()
+		event.Reason = "user_locked"
+		audit.Record(ctx, event)
+		return nil, err
+	}
+	if err = s.userStore.VerifyPassword(ctx, user, password); err != nil {
+		// a user without a password hash can not log in either, but an unreachable api server is no failed login
+		if !errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) && !errors.Is(err, bcrypt.ErrHashTooShort) &&
+			!apierrors.IsNotFound(err) {
+			s.releaseLogin(ctx, ipKey, userKey)
+			metrics.Logins.WithLabelValues(flow, metrics.ResultFailure, "lookup_failed").Inc()
+			event.Reason = "lookup_failed"
+			audit.Record(ctx, event)
+			return nil, err
+		}
+		s.loginFailed(ctx, ipKey, userKey, user)
+		metrics.Logins.WithLabelValues(flow, metrics.ResultFailure, "invalid_password").Inc()
+		event.Reason = "invalid_password"
+		audit.Record(ctx, event)
+		return nil, errInvalidCredentials
 	}
-	return fmt.Errorf("username or password wrong")
+	s.releaseLogin(ctx, ipKey, "")
+	s.loginSucceeded(ctx, userKey, user)
+	metrics.Logins.WithLabelValues(flow, metrics.ResultSuccess, "").Inc()
+	event.Type = audit.LoginSucceeded
+	event.Outcome = audit.Success
+	audit.Record(ctx, event)
+	return user, nil
 }
 
 // CreateAuthRequest implements the op.Storage interface
 // it will be called after parsing and validation of the authentication request
 func (s *Storage) CreateAuthRequest(ctx context.Context, authReq *oidc.AuthRequest, userID string) (op.AuthRequest, error) {
+	_, span := tracing.Start(ctx, "Storage.CreateAuthRequest", tracing.ClientIDKey.String(authReq.ClientID))
+	defer span.End()
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	if len(authReq.Prompt) == 1 && authReq.Prompt[0] == "none" {
-		// With prompt=none, there is no way for the user to log in
-		// so return error right away.
-		return nil, oidc.ErrLoginRequired()
-	}
-
 	// typically, you'll fill your storage / storage model with the information of the passed object
+	// prompt, max_age and login_hint are evaluated by the login UI against the single sign-on session (see ResumeSession)
 	request := authRequestToInternal(authReq, userID)
 
 	// you'll also have to create a unique id for the request (this might be done by your database; we'll use a uuid)
@@ -204,12 +321,17 @@ func (s *Storage) AuthRequestByID(ctx context.Context, id string) (op.AuthReques
 	if !ok {
 		return nil, fmt.Errorf("request not found")
 	}
+	if request.UserID != "" {
+		request.subject = s.clientSubject(request.ApplicationID, request.UserID)
+	}
 	return request, nil
 }
 
 // AuthRequestByCode implements the op.Storage interface
 // it will be called after parsing and validation of the token request (in an authorization code flow)
 func (s *Storage) AuthRequestByCode(ctx context.Context, code string) (op.AuthRequest, error) {
+	ctx, span := tracing.Start(ctx, "Storage.AuthRequestByCode")
+	defer span.End()
 	// for this example we read the id by code and then get the request by id
 	requestID, ok := func() (string, bool) {
 		s.lock.Lock()
@@ -255,6 +377,8 @@ func (s *Storage) DeleteAuthRequest(ctx context.Context, id string) error {
 // CreateAccessToken implements the op.Storage interface
 // it will be called for all requests able to return an access token (Authorization Code Flow, Implicit Flow, JWT Profile, ...)
 func (s *Storage) CreateAccessToken(ctx context.Context, request op.TokenRequest) (string, time.Time, error) {
+	ctx, span := tracing.Start(ctx, "Storage.CreateAccessToken")
+	defer span.End()
 	var applicationID string
 	switch req := request.(type) {
 	case *AuthRequest:
@@ -262,30 +386,69 @@ func (s *Storage) CreateAccessToken(ctx context.Context, request op.TokenRequest
 		applicationID = req.ApplicationID
 	case op.TokenExchangeRequest:
 		applicationID = req.GetClientID()
+	case *op.DeviceAuthorizationState:
+		applicationID = req.ClientID
+	case *clientCredentialsRequest:
+		// the machine client is the subject of its tokens
+		applicationID = req.Subject
+	case *externalJWTRequest:
+		applicationID = req.Subject
+	case *oidc.JWTTokenRequest:
+		applicationID = req.Subject
 	}
 
-	token, err := s.accessToken(applicationID, "", request.GetSubject(), request.GetAudience(), request.GetScopes())
+	var actor *oidc.ActorClaims
+	sessionID := sessionFromRequest(request)
+	if req, ok := request.(op.TokenExchangeRequest); ok {
+		actor = s.exchangeActor(req)
+		sessionID = s.exchangeSession(req)
+	}
+
+	grantType := s.grantTypeFromRequest(request)
+	span.SetAttributes(tracing.ClientIDKey.String(applicationID), tracing.GrantTypeKey.String(string(grantType)))
+
+	token, err := s.accessToken(applicationID, "", sessionID, request.GetSubject(), request.GetAudience(), request.GetScopes(), actor)
 	if err != nil {
-		return "", time.Time{}, err
+		return "", time.Time{}, tracing.Error(span, err)
 	}
+	metrics.TokensIssued.WithLabelValues(string(grantType), clientLabel(request, applicationID)).Inc()
+	s.auditToken(ctx, audit.TokenIssued, request, applicationID, nil)
 	return token.ID, token.Expiration, nil
 }
 
+// clientLabel returns the client_id label of the metrics of the tokens issued for the request
+func clientLabel(request op.TokenRequest, applicationID string) string {
+	switch request.(type) {
+	case *externalJWTRequest, *oidc.JWTTokenRequest:
+		return metrics.JWTGrantClient
+	}
+	return applicationID
+}
+
 // CreateAccessAndRefreshTokens implements the op.Storage interface
 // it will be called for all requests able to return an access and refresh token (Authorization Code Flow, Refresh Token Request)
 func (s *Storage) CreateAccessAndRefreshTokens(ctx context.Context, request op.TokenRequest, currentRefreshToken string) (accessTokenID string, newRefreshToken string, expiration time.Time, err error) {
+	ctx, span := tracing.Start(ctx, "Storage.CreateAccessAndRefreshTokens",
+		tracing.GrantTypeKey.String(string(s.grantTypeFromRequest(request))))
+	defer func() {
+		_ = tracing.Error(span, err)
+		span.End()
+	}()
+
 	// generate tokens via token exchange flow if request is relevant
 	if teReq, ok := request.(op.TokenExchangeRequest); ok {
+		span.SetAttributes(tracing.ClientIDKey.String(teReq.GetClientID()))
 		return s.exchangeRefreshToken(ctx, teReq)
 	}
 
 	// get the information depending on the request type / implementation
 	applicationID, authTime, amr := getInfoFromRequest(request)
+	span.SetAttributes(tracing.ClientIDKey.String(applicationID))
 
 	// if currentRefreshToken is empty (Code Flow) we will have to create a new refresh token
 	if currentRefreshToken == "" {
 		refreshTokenID := uuid.NewString()
-		accessToken, err := s.accessToken(applicationID, refreshTokenID, request.GetSubject(), request.GetAudience(), request.GetScopes())
+		accessToken, err := s.accessToken(applicationID, refreshTokenID, sessionFromRequest(request), request.GetSubject(), request.GetAudience(), request.GetScopes(), nil)
 		if err != nil {
 			return "", "", time.Time{}, err
 		}
@@ -293,6 +456,8 @@ func (s *Storage) CreateAccessAndRefreshTokens(ctx context.Context, request op.T
 		if err != nil {
 			return "", "", time.Time{}, err
 		}
+		metrics.TokensIssued.WithLabelValues(string(s.grantTypeFromRequest(request)), clientLabel(request, applicationID)).Inc()
+		s.auditToken(ctx, audit.TokenIssued, request, applicationID, nil)
 		return accessToken.ID, refreshToken, accessToken.Expiration, nil
 	}
 
@@ -301,14 +466,19 @@ func (s *Storage) CreateAccessAndRefreshTokens(ctx context.Context, request op.T
 
 	newRefreshToken = uuid.NewString()
 
-	accessToken, err := s.accessToken(applicationID, newRefreshToken, request.GetSubject(), request.GetAudience(), request.GetScopes())
+	accessToken, err := s.accessToken(applicationID, newRefreshToken, sessionFromRequest(request), request.GetSubject(), request.GetAudience(), request.GetScopes(), nil)
 	if err != nil {
 		return "", "", time.Time{}, err
 	}
 
 	if err := s.renewRefreshToken(currentRefreshToken, newRefreshToken, accessToken.ID); err != nil {
+		metrics.RefreshTokenRotations.WithLabelValues(applicationID, metrics.ResultFailure).Inc()
+		s.auditToken(ctx, audit.TokenRefreshed, request, applicationID, err)
 		return "", "", time.Time{}, err
 	}
+	metrics.RefreshTokenRotations.WithLabelValues(applicationID, metrics.ResultSuccess).Inc()
+	metrics.TokensIssued.WithLabelValues(string(s.grantTypeFromRequest(request)), clientLabel(request, applicationID)).Inc()
+	s.auditToken(ctx, audit.TokenRefreshed, request, applicationID, nil)
 
 	return accessToken.ID, newRefreshToken, accessToken.Expiration, nil
 }
@@ -318,7 +488,8 @@ func (s *Storage) exchangeRefreshToken(ctx context.Context, request op.TokenExch
 	authTime := request.GetAuthTime()
 
 	refreshTokenID := uuid.NewString()
-	accessToken, err := s.accessToken(applicationID, refreshTokenID, request.GetSubject(), request.GetAudience(), request.GetScopes())
+	accessToken, err := s.accessToken(applicationID, refreshTokenID, s.exchangeSession(request), request.GetSubject(),
+		request.GetAudience(), request.GetScopes(), s.exchangeActor(request))
 	if err != nil {
 		return "", "", time.Time{}, err
 	}
@@ -327,6 +498,8 @@ func (s *Storage) exchangeRefreshToken(ctx context.Context, request op.TokenExch
 	if err != nil {
 		return "", "", time.Time{}, err
 	}
+	metrics.TokensIssued.WithLabelValues(string(oidc.GrantTypeTokenExchange), applicationID).Inc()
+	s.auditToken(ctx, audit.TokenIssued, request, applicationID, nil)
 
 	return accessToken.ID, refreshToken, accessToken.Expiration, nil
 }
@@ -334,6 +507,8 @@ func (s *Storage) exchangeRefreshToken(ctx context.Context, request op.TokenExch
 // TokenRequestByRefreshToken implements the op.Storage interface
 // it will be called after parsing and validation of the refresh token request
 func (s *Storage) TokenRequestByRefreshToken(ctx context.Context, refreshToken string) (op.RefreshTokenRequest, error) {
+	_, span := tracing.Start(ctx, "Storage.TokenRequestByRefreshToken")
+	defer span.End()
 	s.lock.Lock()
 	defer s.lock.Unlock()
 	token, ok := s.refreshTokens[refreshToken]
@@ -348,12 +523,9 @@ func (s *Storage) TokenRequestByRefreshToken(ctx context.Context, refreshToken s
 func (s *Storage) TerminateSession(ctx context.Context, userID string, clientID string) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
-	for _, token := range s.tokens {
-		if token.ApplicationID == clientID && token.Subject == userID {
-			delete(s.tokens, token.ID)
-			delete(s.refreshTokens, token.RefreshTokenID)
-		}
-	}
+	s.terminateTokens(func(token *Token) bool {
+		return token.ApplicationID == clientID && token.Subject == userID
+	})
 	return nil
 }
 
@@ -370,6 +542,8 @@ func (s *Storage) GetRefreshTokenInfo(ctx context.Context, clientID string, toke
 // RevokeToken implements the op.Storage interface
 // it will be called after parsing and validation of the token revocation request
 func (s *Storage) RevokeToken(ctx context.Context, tokenIDOrToken string, userID string, clientID string) *oidc.Error {
+	ctx, span := tracing.Start(ctx, "Storage.RevokeToken", tracing.ClientIDKey.String(clientID))
+	defer span.End()
 	// a single token was requested to be removed
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -381,6 +555,8 @@ func (s *Storage) RevokeToken(ctx context.Context, tokenIDOrToken string, userID
 		// if it is an access token, just remove it
 		// you could also remove the corresponding refresh token if really necessary
 		delete(s.tokens, accessToken.ID)
+		metrics.Revocations.WithLabelValues(clientID, "access_token").Inc()
+		s.auditRevocation(ctx, accessToken.Subject, clientID, "access_token")
 		return nil
 	}
 	refreshToken, ok := s.refreshTokens[tokenIDOrToken] // token
@@ -395,15 +571,19 @@ func (s *Storage) RevokeToken(ctx context.Context, tokenIDOrToken string, userID
 	delete(s.refreshTokens, refreshToken.ID)
 	// if it is a refresh token, you will have to remove the access token as well
 	delete(s.tokens, refreshToken.AccessToken)
+	metrics.Revocations.WithLabelValues(clientID, "refresh_token").Inc()
+	s.auditRevocation(ctx, refreshToken.UserID, clientID, "refresh_token")
 	return nil
 }
 
 // SigningKey implements the op.Storage interface
 // it will be called when creating the OpenID Provider
 func (s *Storage) SigningKey(ctx context.Context) (op.SigningKey, error) {
-	// in this example the signing key is a static rsa.PrivateKey and the algorithm used is RS256
-	// you would obviously have a more complex implementation and store / retrieve the key from your database as well
-	return &s.signingKey, nil
+	// the key is copied, it may be replaced by RotateSigningKey while the token is signed
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := s.signingKey
+	return &key, nil
 }
 
 // SignatureAlgorithms implements the op.Storage interface
@@ -415,12 +595,10 @@ func (s *Storage) SignatureAlgorithms(context.Context) ([]jose.SignatureAlgorith
 // KeySet implements the op.Storage interface
 // it will be called to get the current (public) keys, among others for the keys_endpoint or for validating access_tokens on the userinfo_endpoint, ...
 func (s *Storage) KeySet(ctx context.Context) ([]op.Key, error) {
-	// as mentioned above, this example only has a single signing key without key rotation,
-	// so it will directly use its public key
-	//
-	// when using key rotation you typically would store the public keys alongside the private keys in your database
-	// and give both of them an expiration date, with the public key having a longer lifetime
-	return []op.Key{&publicKey{s.signingKey}}, nil
+	// the public keys of the rotated signing keys are published until the tokens signed by them expired
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.publicKeys(), nil
 }
 
 // GetClientByClientID implements the op.Storage interface
@@ -452,6 +630,22 @@ func (s *Storage) AuthorizeClientIDSecret(ctx context.Context, clientID, clientS
 	return nil
 }
 
+// AuthenticateClient implements the ratelimit.Authenticator interface, the secret authenticates
+// a registered client or a MachineClient
+func (s *Storage) AuthenticateClient(ctx context.Context, clientID, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	if s.AuthorizeClientIDSecret(ctx, clientID, secret) == nil {
+		return true
+	}
+	if s.machineClients == nil {
+		return false
+	}
+	_, err := s.machineClients.authenticate(ctx, clientID, secret)
+	return err == nil
+}
+
 // SetUserinfoFromScopes implements the op.Storage interface.
 // Provide an empty implementation and use SetUserinfoFromRequest instead.
 func (s *Storage) SetUserinfoFromScopes(ctx context.Context, userinfo *oidc.UserInfo, userID, clientID string, scopes []string) error {
@@ -462,12 +656,23 @@ func (s *Storage) SetUserinfoFromScopes(ctx context.Context, userinfo *oidc.User
 // next major release, it will be required for op.Storage.
 // It will be called for the creation of an id_token, so we'll just pass it to the private function without any further check
 func (s *Storage) SetUserinfoFromRequest(ctx context.Context, userinfo *oidc.UserInfo, token op.IDTokenRequest, scopes []string) error {
-	return s.setUserinfo(ctx, userinfo, token.GetSubject(), token.GetClientID(), scopes)
+	if err := s.setUserinfo(ctx, userinfo, token.GetSubject(), token.GetClientID(), scopes); err != nil {
+		return err
+	}
+	// the sid claim allows the client to match front- and back-channel logout requests to its session
+	if tokenRequest, ok := token.(op.TokenRequest); ok {
+		if sessionID := sessionFromRequest(tokenRequest); sessionID != "" {
+			userinfo.AppendClaims("sid", sessionID)
+		}
+	}
+	return nil
 }
 
 // SetUserinfoFromToken implements the op.Storage interface
 // it will be called for the userinfo endpoint, so we read the token and pass the information from that to the private function
 func (s *Storage) SetUserinfoFromToken(ctx context.Context, userinfo *oidc.UserInfo, tokenID, subject, origin string) error {
+	ctx, span := tracing.Start(ctx, "Storage.SetUserinfoFromToken")
+	defer span.End()
 	token, ok := func() (*Token, bool) {
 		s.lock.Lock()
 		defer s.lock.Unlock()
@@ -499,6 +704,8 @@ func (s *Storage) SetUserinfoFromToken(ctx context.Context, userinfo *oidc.UserI
 // SetIntrospectionFromToken implements the op.Storage interface
 // it will be called for the introspection endpoint, so we read the token and pass the information from that to the private function
 func (s *Storage) SetIntrospectionFromToken(ctx context.Context, introspection *oidc.IntrospectionResponse, tokenID, subject, clientID string) error {
+	ctx, span := tracing.Start(ctx, "Storage.SetIntrospectionFromToken", tracing.ClientIDKey.String(clientID))
+	defer span.End()
 	token, ok := func() (*Token, bool) {
 		s.lock.Lock()
 		defer s.lock.Unlock()
@@ -506,6 +713,7 @@ func (s *Storage) SetIntrospectionFromToken(ctx context.Context, introspection *
 		return token, ok
 	}()
 	if !ok {
+		metrics.Introspections.WithLabelValues(clientID, "false").Inc()
 		return fmt.Errorf("token is invalid or has expired")
 	}
 	// check if the client is part of the requested audience
@@ -516,19 +724,40 @@ func (s *Storage) SetIntrospectionFromToken(ctx context.Context, introspection *
 			// you can also return further information about the user / associated token
 			// e.g. the userinfo (equivalent to userinfo endpoint)
 
-			userInfo := new(oidc.UserInfo)
-			err := s.setUserinfo(ctx, userInfo, subject, clientID, token.Scopes)
-			if err != nil {
-				return err
+			var (
+				permissions []kimv1.Rule
+				machine     bool
+				err         error
+			)
+			if token.Subject == token.ApplicationID {
+				permissions, machine, err = s.machinePermissions(ctx, token.ApplicationID)
+				if err != nil {
+					return err
+				}
+			}
+			if machine {
+				// a machine client has no userinfo but the current permissions of its Policies
+				introspection.Subject = token.Subject
+				introspection.Claims = map[string]any{PermissionsClaim: permissions}
+			} else {
+				userInfo := new(oidc.UserInfo)
+				err = s.setUserinfo(ctx, userInfo, subject, clientID, token.Scopes)
+				if err != nil {
+					return err
+				}
+				introspection.SetUserInfo(userInfo)
 			}
-			introspection.SetUserInfo(userInfo)
 			//...and also the requested scopes...
 			introspection.Scope = token.Scopes
 			//...and the client the token was issued to
 			introspection.ClientID = token.ApplicationID
+			//...and whoever acts on behalf of the subject
+			introspection.Actor = token.Actor
+			metrics.Introspections.WithLabelValues(clientID, "true").Inc()
 			return nil
 		}
 	}
+	metrics.Introspections.WithLabelValues(clientID, "false").Inc()
 	return fmt.Errorf("token is not valid for this client")
 }
 
@@ -545,39 +774,17 @@ func (s *Storage) getPrivateClaimsFromScopes(ctx context.Context, userID, client
 			claims = appendClaim(claims, CustomClaim, customClaim(clientID))
 		}
 	}
-	return claims, nil
-}
-
-// GetKeyByIDAndClientID implements the op.Storage interface
-// it will be called to validate the signatures of a JWT (JWT Profile Grant and Authentication)
-func (s *Storage) GetKeyByIDAndClientID(ctx context.Context, keyID, clientID string) (*jose.JSONWebKey, error) {
-	s.lock.Lock()
-	defer s.lock.Unlock()
-	service, ok := s.services[clientID]
-	if !ok {
-		return nil, fmt.Errorf("clientID not found")
-	}
-	key, ok := service.keys[keyID]
-	if !ok {
-		return nil, fmt.Errorf("key not found")
-	}
-	return &jose.JSONWebKey{
-		KeyID: keyID,
-		Use:   "sig",
-		Key:   key,
-	}, nil
-}
-
-// ValidateJWTProfileScopes implements the op.Storage interface
-// it will be called to validate the scopes of a JWT Profile Authorization Grant request
-func (s *Storage) ValidateJWTProfileScopes(ctx context.Context, userID string, scopes []string) ([]string, error) {
-	allowedScopes := make([]string, 0)
-	for _, scope := range scopes {
-		if scope == oidc.ScopeOpenID {
-			allowedScopes = append(allowedScopes, scope)
+	// a machine client is the subject of its tokens, which carry its permissions
+	if userID == clientID {
+		permissions, ok, err := s.machinePermissions(ctx, clientID)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			claims = appendClaim(claims, PermissionsClaim, permissions)
 		}
 	}
-	return allowedScopes, nil
+	return claims, nil
 }
 
 // Health implements the op.Storage interface
@@ -600,6 +807,7 @@ func (s *Storage) createRefreshToken(accessToken *Token, amr []string, authTime
 		Expiration:    time.Now().Add(5 * time.Hour),
 		Scopes:        accessToken.Scopes,
 		AccessToken:   accessToken.ID,
+		SessionID:     accessToken.SessionID,
 	}
 	s.refreshTokens[token.ID] = token
 	return token.Token, nil
@@ -636,8 +844,9 @@ func (s *Storage) renewRefreshToken(currentRefreshToken, newRefreshToken, newAcc
 	return nil
 }
 
-// accessToken will store an access_token in-memory based on the provided information
-func (s *Storage) accessToken(applicationID, refreshTokenID, subject string, audience, scopes []string) (*Token, error) {
+// accessToken will store an access_token in-memory based on the provided information,
+// the actor is the act claim of a token exchanged for another subject
+func (s *Storage) accessToken(applicationID, refreshTokenID, sessionID, subject string, audience, scopes []string, actor *oidc.ActorClaims) (*Token, error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 	token := &Token{
@@ -648,6 +857,8 @@ func (s *Storage) accessToken(applicationID, refreshTokenID, subject string, aud
 		Audience:       audience,
 		Expiration:     time.Now().Add(5 * time.Minute),
 		Scopes:         scopes,
+		SessionID:      sessionID,
+		Actor:          actor,
 	}
 	s.tokens[token.ID] = token
 	return token, nil
@@ -655,28 +866,42 @@ func (s *Storage) accessToken(applicationID, refreshTokenID, subject string, aud
 
 // setUserinfo sets the info based on the user, scopes and if necessary the clientID
 func (s *Storage) setUserinfo(ctx context.Context, userInfo *oidc.UserInfo, userID, clientID string, scopes []string) (err error) {
-	s.lock.Lock()
-	defer s.lock.Unlock()
-	user := s.userStore.GetUserByID(userID)
-	if user == nil {
-		return fmt.Errorf("user not found")
+	// the subject of the token might be the pairwise subject of the client
+	user, err := s.userStore.GetUserByID(ctx, s.userSubject(userID))
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
 	}
+	claim := user.Spec.Claim
 	for _, scope := range scopes {
 		switch scope {
 		case oidc.ScopeOpenID:
-			userInfo.Subject = user.ID
+			userInfo.Subject = userID
 		case oidc.ScopeEmail:
-			userInfo.Email = user.Email
-			userInfo.EmailVerified = oidc.Bool(user.EmailVerified)
+			userInfo.Email = ptr.Deref(claim.Email, "")
+			userInfo.EmailVerified = oidc.Bool(ptr.Deref(claim.EmailVerified, false))
 		case oidc.ScopeProfile:
-			userInfo.PreferredUsername = user.Username
-			userInfo.Name = user.FirstName + " " + user.LastName
-			userInfo.FamilyName = user.LastName
-			userInfo.GivenName = user.FirstName
-			userInfo.Locale = oidc.NewLocale(user.PreferredLanguage)
+			userInfo.PreferredUsername = ptr.Deref(claim.PreferredUsername, "")
+			userInfo.Name = strings.TrimSpace(ptr.Deref(claim.GivenName, "") + " " + ptr.Deref(claim.FamilyName, ""))
+			userInfo.FamilyName = ptr.Deref(claim.FamilyName, "")
+			userInfo.GivenName = ptr.Deref(claim.GivenName, "")
+			userInfo.MiddleName = ptr.Deref(claim.MiddleName, "")
+			userInfo.Nickname = ptr.Deref(claim.NickName, "")
+			userInfo.Profile = ptr.Deref(claim.Profile, "")
+			userInfo.Picture = ptr.Deref(claim.Picture, "")
+			userInfo.Website = ptr.Deref(claim.Website, "")
+			userInfo.Gender = oidc.Gender(ptr.Deref(claim.Gender, ""))
+			userInfo.Birthdate = ptr.Deref(claim.Birthdate, "")
+			userInfo.Zoneinfo = ptr.Deref(claim.Zoneinfo, "")
+			if locale, err := language.Parse(strings.ReplaceAll(ptr.Deref(claim.Locale, ""), "_", "-")); err == nil {
+				userInfo.Locale = oidc.NewLocale(locale)
+			}
 		case oidc.ScopePhone:
-			userInfo.PhoneNumber = user.Phone
-			userInfo.PhoneNumberVerified = user.PhoneVerified
+			userInfo.PhoneNumber = ptr.Deref(claim.PhoneNumber, "")
+			userInfo.PhoneNumberVerified = ptr.Deref(claim.PhoneNumberVerified, false)
+		case oidc.ScopeAddress:
+			if address := ptr.Deref(claim.Address, ""); address != "" {
+				userInfo.Address = &oidc.UserInfoAddress{Formatted: address}
+			}
 		case CustomScope:
 			// you can also have a custom scope and assert public or custom claims based on that
 			userInfo.AppendClaims(CustomClaim, customClaim(clientID))
@@ -685,101 +910,6 @@ func (s *Storage) setUserinfo(ctx context.Context, userInfo *oidc.UserInfo, user
 	return nil
 }
 
-// ValidateTokenExchangeRequest implements the op.TokenExchangeStorage interface
-// it will be called to validate parsed Token Exchange Grant request
-func (s *Storage) ValidateTokenExchangeRequest(ctx context.Context, request op.TokenExchangeRequest) error {
-	if request.GetRequestedTokenType() == "" {
-		request.SetRequestedTokenType(oidc.RefreshTokenType)
-	}
-
-	// Just an example, some use cases might need this use case
-	if request.GetExchangeSubjectTokenType() == oidc.IDTokenType && request.GetRequestedTokenType() == oidc.RefreshTokenType {
-		return errors.New("exchanging id_token to refresh_token is not supported")
-	}
-
-	// Check impersonation permissions
-	if request.GetExchangeActor() == "" && !s.userStore.GetUserByID(request.GetExchangeSubject()).IsAdmin {
-		return errors.New("user doesn't have impersonation permission")
-	}
-
-	allowedScopes := make([]string, 0)
-	for _, scope := range request.GetScopes() {
-		if scope == oidc.ScopeAddress {
-			continue
-		}
-
-		if strings.HasPrefix(scope, CustomScopeImpersonatePrefix) {
-			subject := strings.TrimPrefix(scope, CustomScopeImpersonatePrefix)
-			request.SetSubject(subject)
-		}
-
-		allowedScopes = append(allowedScopes, scope)
-	}
-
-	request.SetCurrentScopes(allowedScopes)
-
-	return nil
-}
-
-// ValidateTokenExchangeRequest implements the op.TokenExchangeStorage interface
-// Common use case is to store request for audit purposes. For this example we skip the storing.
-func (s *Storage) CreateTokenExchangeRequest(ctx context.Context, request op.TokenExchangeRequest) error {
-	return nil
-}
-
-// GetPrivateClaimsFromScopesForTokenExchange implements the op.TokenExchangeStorage interface
-// it will be called for the creation of an exchanged JWT access token to assert claims for custom scopes
-// plus adding token exchange specific claims related to delegation or impersonation
-func (s *Storage) GetPrivateClaimsFromTokenExchangeRequest(ctx context.Context, request op.TokenExchangeRequest) (claims map[string]any, err error) {
-	claims, err = s.getPrivateClaimsFromScopes(ctx, "", request.GetClientID(), request.GetScopes())
-	if err != nil {
-		return nil, err
-	}
-
-	for k, v := range s.getTokenExchangeClaims(ctx, request) {
-		claims = appendClaim(claims, k, v)
-	}
-
-	return claims, nil
-}
-
-// SetUserinfoFromScopesForTokenExchange implements the op.TokenExchangeStorage interface
-// it will be called for the creation of an id_token - we are using the same private function as for other flows,
-// plus adding token exchange specific claims related to delegation or impersonation
-func (s *Storage) SetUserinfoFromTokenExchangeRequest(ctx context.Context, userinfo *oidc.UserInfo, request op.TokenExchangeRequest) error {
-	err := s.setUserinfo(ctx, userinfo, request.GetSubject(), request.GetClientID(), request.GetScopes())
-	if err != nil {
-		return err
-	}
-
-	for k, v := range s.getTokenExchangeClaims(ctx, request) {
-		userinfo.AppendClaims(k, v)
-	}
-
-	return nil
-}
-
-func (s *Storage) getTokenExchangeClaims(ctx context.Context, request op.TokenExchangeRequest) (claims map[string]any) {
-	for _, scope := range request.GetScopes() {
-		switch {
-		case strings.HasPrefix(scope, CustomScopeImpersonatePrefix) && request.GetExchangeActor() == "":
-			// Set actor subject claim for impersonation flow
-			claims = appendClaim(claims, "act", map[string]any{
-				"sub": request.GetExchangeSubject(),
-			})
-		}
-	}
-
-	// Set actor subject claim for delegation flow
-	// if request.GetExchangeActor() != "" {
-	// 	claims = appendClaim(claims, "act", map[string]any{
-	// 		"sub": request.GetExchangeActor(),
-	// 	})
-	// }
-
-	return claims
-}
-
 // getInfoFromRequest returns the clientID, authTime and amr depending on the op.TokenRequest type / implementation
 func getInfoFromRequest(req op.TokenRequest) (clientID string, authTime time.Time, amr []string) {
 	authReq, ok := req.(*AuthRequest) // Code Flow (with scope offline_access)
@@ -793,6 +923,41 @@ func getInfoFromRequest(req op.TokenRequest) (clientID string, authTime time.Tim
 	return "", time.Time{}, nil
 }
 
+// grantTypeFromRequest returns the grant type the op.TokenRequest was created by
+func (s *Storage) grantTypeFromRequest(req op.TokenRequest) oidc.GrantType {
+	switch req := req.(type) {
+	case *AuthRequest:
+		if req.ResponseType == oidc.ResponseTypeCode {
+			return oidc.GrantTypeCode
+		}
+		return oidc.GrantTypeImplicit
+	case *RefreshTokenRequest:
+		return oidc.GrantTypeRefreshToken
+	case op.TokenExchangeRequest:
+		return oidc.GrantTypeTokenExchange
+	case *op.DeviceAuthorizationState:
+		return oidc.GrantTypeDeviceCode
+	case *clientCredentialsRequest:
+		return oidc.GrantTypeClientCredentials
+	case *externalJWTRequest:
+		return req.grantType
+	case *oidc.JWTTokenRequest:
+		return oidc.GrantTypeBearer
+	}
+	return ""
+}
+
+// sessionFromRequest returns the single sign-on session the op.TokenRequest was authenticated by
+func sessionFromRequest(req op.TokenRequest) string {
+	switch req := req.(type) {
+	case *AuthRequest:
+		return req.SessionID
+	case *RefreshTokenRequest:
+		return req.SessionID
+	}
+	return ""
+}
+
 // customClaim demonstrates how to return custom claims based on provided information
 func customClaim(clientID string) map[string]any {
 	return map[string]any{
@@ -838,6 +1003,7 @@ func (s *Storage) StoreDeviceAuthorization(ctx context.Context, clientID, device
 	}
 
 	s.userCodes[userCode] = deviceCode
+	metrics.DeviceAuthorizations.WithLabelValues("started").Inc()
 	return nil
 }
 
@@ -869,17 +1035,32 @@ func (s *Storage) GetDeviceAuthorizationByUserCode(ctx context.Context, userCode
 	return entry.state, nil
 }
 
+// CompleteDeviceAuthorization approves the device authorization of the user code for the subject
+// the approval is audited after releasing the lock, as the audit target is looked up
 func (s *Storage) CompleteDeviceAuthorization(ctx context.Context, userCode, subject string) error {
 	s.lock.Lock()
-	defer s.lock.Unlock()
-
 	entry, ok := s.deviceCodes[s.userCodes[userCode]]
 	if !ok {
+		s.lock.Unlock()
 		return errors.New("user code not found")
 	}
 
-	entry.state.Subject = subject
+	entry.state.Subject = s.clientSubject(entry.state.ClientID, subject)
 	entry.state.Done = true
+	clientID, scopes := entry.state.ClientID, strings.Join(entry.state.Scopes, " ")
+	s.lock.Unlock()
+
+	metrics.DeviceAuthorizations.WithLabelValues("approved").Inc()
+	audit.Record(ctx, audit.Event{
+		Type:    audit.DeviceApproved,
+		Outcome: audit.Success,
+		Actor: audit.Actor{
+			Subject:  subject,
+			ClientID: clientID,
+		},
+		Target:  s.subjectTarget(ctx, subject),
+		Details: map[string]string{"scope": scopes},
+	})
 	return nil
 }
 
@@ -887,7 +1068,15 @@ func (s *Storage) DenyDeviceAuthorization(ctx context.Context, userCode string)
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	s.deviceCodes[s.userCodes[userCode]].state.Denied = true
+	state := s.deviceCodes[s.userCodes[userCode]].state
+	state.Denied = true
+	metrics.DeviceAuthorizations.WithLabelValues("denied").Inc()
+	audit.Record(ctx, audit.Event{
+		Type:    audit.DeviceDenied,
+		Outcome: audit.Success,
+		Actor:   audit.Actor{ClientID: state.ClientID},
+		Details: map[string]string{"scope": strings.Join(state.Scopes, " ")},
+	})
 	return nil
 }
 
@@ -903,31 +1092,3 @@ func (s *Storage) AuthRequestDone(id string) error {
 
 	return errors.New("request not found")
 }
-
-func (s *Storage) ClientCredentials(ctx context.Context, clientID, clientSecret string) (op.Client, error) {
-	s.lock.Lock()
-	defer s.lock.Unlock()
-
-	client, ok := s.serviceUsers[clientID]
-	if !ok {
-		return nil, errors.New("wrong service user or password")
-	}
-	if client.secret != clientSecret {
-		return nil, errors.New("wrong service user or password")
-	}
-
-	return client, nil
-}
-
-func (s *Storage) ClientCredentialsTokenRequest(ctx context.Context, clientID string, scopes []string) (op.TokenRequest, error) {
-	client, ok := s.serviceUsers[clientID]
-	if !ok {
-		return nil, errors.New("wrong service user or password")
-	}
-
-	return &oidc.JWTTokenRequest{
-		Subject:  client.id,
-		Audience: []string{clientID},
-		Scopes:   scopes,
-	}, nil
-}
@@ -1,6 +1,10 @@
 package storage
 
-import "time"
+import (
+	"time"
+
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+)
 
 type Token struct {
 	ID             string
@@ -10,6 +14,9 @@ type Token struct {
 	Audience       []string
 	Expiration     time.Time
 	Scopes         []string
+	SessionID      string
+	// Actor is the act claim of a delegated or impersonated token
+	Actor *oidc.ActorClaims
 }
 
 type RefreshToken struct {
@@ -23,4 +30,5 @@ type RefreshToken struct {
 	Expiration    time.Time
 	Scopes        []string
 	AccessToken   string // Token.ID
+	SessionID     string
 }
@@ -2,43 +2,305 @@ package storage
 
 import (
 	"context"
-	"crypto/rsa"
 	"encoding/hex"
+	"errors"
+	"slices"
 	"strings"
+	"time"
 
+	"golang.org/x/crypto/bcrypt"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/tracing"
 )
 
-type Service struct {
-	keys map[string]*rsa.PublicKey
-}
+// PasswordKey is the key of the bcrypt password hash in the Secret referenced by UserSpec.SecretName
+const PasswordKey = "password"
+
+var (
+	errInvalidCredentials = errors.New("username or password wrong")
+	errEmailChanged       = errors.New("the email address was changed")
+	errCredentialsChanged = errors.New("the credentials were changed")
+)
 
 type UserStore interface {
 	GetUserByID(context.Context, string) (*kimv1.User, error)
 	GetUserByUsername(context.Context, string) (*kimv1.User, error)
+	// VerifyPassword checks the password against the credential Secret of the user
+	VerifyPassword(context.Context, *kimv1.User, string) error
+	// SetLocked reflects the lockout of the user in its status, a zero time unlocks the user
+	SetLocked(context.Context, *kimv1.User, time.Time) error
+	// CredentialVersion returns the version of the credential Secret of the user, it changes with the password
+	CredentialVersion(context.Context, *kimv1.User) (string, error)
+	// SetPassword stores the bcrypt hash of the password in the credential Secret of the user,
+	// it fails if the Secret is no longer of the version (see CredentialVersion), unless the version is empty
+	SetPassword(ctx context.Context, user *kimv1.User, version, password string) error
+	// SetEmailVerified marks the email address of the user as verified
+	SetEmailVerified(context.Context, *kimv1.User) error
+	// TOTPSecret returns the secret of the one-time codes of the user, or an empty string without a second factor
+	TOTPSecret(context.Context, *kimv1.User) (string, error)
+	// SetTOTPSecret stores the secret of the one-time codes in the credential Secret, an empty secret removes it
+	SetTOTPSecret(context.Context, *kimv1.User, string) error
+	// UpdateClaims sets the Claim fields (by their json name) of the user, empty values remove the field
+	UpdateClaims(context.Context, *kimv1.User, map[string]string) error
+	// Permissions returns the rules of the Policies bound to the user
+	Permissions(context.Context, *kimv1.User) ([]kimv1.Rule, error)
 }
 
+// the password reset, the password change and the TOTP enrolment write the credential Secrets of the users
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;update
+
 type userStore struct {
 	client.Client
+	lookupConfig UserLookup
 }
 
 func (us *userStore) GetUserByID(ctx context.Context, userID string) (*kimv1.User, error) {
-	decoded, err := hex.DecodeString(userID)
+	ctx, span := tracing.Start(ctx, "userStore.GetUserByID")
+	defer span.End()
+	user, err := us.lookupIndex(ctx, IndexUserSubject, userID)
+	if apierrors.IsNotFound(err) && us.lookupConfig.LegacySubjects {
+		if key, ok := legacySubject(userID); ok {
+			user, err = us.getUser(ctx, key)
+		}
+	}
 	if err != nil {
-		return nil, err
+		return nil, tracing.Error(span, err)
 	}
-	return us.GetUserByUsername(ctx, string(decoded))
+	return user, nil
+}
+
+// GetUserByUsername resolves the login name by the identifiers of the lookup in order
+func (us *userStore) GetUserByUsername(ctx context.Context, username string) (*kimv1.User, error) {
+	ctx, span := tracing.Start(ctx, "userStore.GetUserByUsername")
+	defer span.End()
+	username = strings.TrimSpace(username)
+	for _, id := range us.lookupConfig.Identifiers {
+		user, err := us.lookup(ctx, id, username)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, tracing.Error(span, err)
+		}
+		return user, nil
+	}
+	return nil, tracing.Error(span, apierrors.NewNotFound(kimv1.Resource("users"), username))
 }
 
-func (us *userStore) GetUserByUsername(ctx context.Context, name string) (*kimv1.User, error) {
-	parts := strings.SplitN(name, "/", 2)
+func (us *userStore) getUser(ctx context.Context, key types.NamespacedName) (*kimv1.User, error) {
 	user := &kimv1.User{}
-	ns := types.NamespacedName{Name: parts[0], Namespace: parts[1]}
-	if err := us.Get(ctx, ns, user); err != nil {
+	if err := us.Get(ctx, key, user); err != nil {
 		return nil, err
 	}
 	return user, nil
 }
+
+func (us *userStore) VerifyPassword(ctx context.Context, user *kimv1.User, password string) error {
+	ctx, span := tracing.Start(ctx, "userStore.VerifyPassword")
+	defer span.End()
+	secret := &corev1.Secret{}
+	ns := types.NamespacedName{Name: user.Spec.SecretName, Namespace: user.Namespace}
+	if err := us.Get(ctx, ns, secret); err != nil {
+		return tracing.Error(span, err)
+	}
+	// a wrong password is no error of the lookup, so it is not recorded on the span
+	return bcrypt.CompareHashAndPassword(secret.Data[PasswordKey], []byte(password))
+}
+
+func (us *userStore) SetLocked(ctx context.Context, user *kimv1.User, until time.Time) error {
+	ctx, span := tracing.Start(ctx, "userStore.SetLocked")
+	defer span.End()
+	reason := kimv1.UserReasonTooManyFailedLogins
+	if until.IsZero() {
+		reason = kimv1.UserReasonLoginSucceeded
+	}
+	key := client.ObjectKeyFromObject(user)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := &kimv1.User{}
+		if err := us.Get(ctx, key, latest); err != nil {
+			return err
+		}
+		latest.Status.SetLocked(until, reason)
+		return us.Status().Update(ctx, latest)
+	})
+	return tracing.Error(span, err)
+}
+
+func (us *userStore) CredentialVersion(ctx context.Context, user *kimv1.User) (string, error) {
+	ctx, span := tracing.Start(ctx, "userStore.CredentialVersion")
+	defer span.End()
+	secret := &corev1.Secret{}
+	ns := types.NamespacedName{Name: user.Spec.SecretName, Namespace: user.Namespace}
+	if err := us.Get(ctx, ns, secret); err != nil {
+		return "", tracing.Error(span, err)
+	}
+	return secret.ResourceVersion, nil
+}
+
+// HashPassword returns the bcrypt hash of the password stored under PasswordKey in the credential Secret of a user
+func HashPassword(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// ErrSecretNotOwned is returned by WritePassword for a Secret not owned by the user, i.e. not created by kim for it
+var ErrSecretNotOwned = errors.New("the secret of the user is not owned by it")
+
+// WritePassword stores the bcrypt hash of the password in the credential Secret of the user,
+// the Secret is created owned by the user if it does not exist yet. An existing Secret is only written if the user
+// owns it or if owned is false, so that the secretName of a user can not point the password at any other Secret.
+func WritePassword(ctx context.Context, c client.Client, user *kimv1.User, password string, owned bool) error {
+	if user.Spec.SecretName == "" {
+		return errors.New("the user has no secretName")
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret := &corev1.Secret{}
+		err := c.Get(ctx, types.NamespacedName{Name: user.Spec.SecretName, Namespace: user.Namespace}, secret)
+		if apierrors.IsNotFound(err) {
+			secret.Name = user.Spec.SecretName
+			secret.Namespace = user.Namespace
+			secret.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: kimv1.GroupVersion.String(),
+				Kind:       "User",
+				Name:       user.Name,
+				UID:        user.UID,
+			}}
+			secret.Type = corev1.SecretTypeOpaque
+			secret.Data = map[string][]byte{PasswordKey: hash}
+			return c.Create(ctx, secret)
+		}
+		if err != nil {
+			return err
+		}
+		if owned && !slices.ContainsFunc(secret.OwnerReferences, func(ref metav1.OwnerReference) bool {
+			return ref.Kind == "User" && ref.UID == user.UID
+		}) {
+			return ErrSecretNotOwned
+		}
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
+		secret.Data[PasswordKey] = hash
+		return c.Update(ctx, secret)
+	})
+}
+
+func (us *userStore) SetPassword(ctx context.Context, user *kimv1.User, version, password string) error {
+	ctx, span := tracing.Start(ctx, "userStore.SetPassword")
+	defer span.End()
+	hash, err := HashPassword(password)
+	if err != nil {
+		return tracing.Error(span, err)
+	}
+	ns := types.NamespacedName{Name: user.Spec.SecretName, Namespace: user.Namespace}
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret := &corev1.Secret{}
+		if err := us.Get(ctx, ns, secret); err != nil {
+			return err
+		}
+		// the update is conditional on the resourceVersion read, a concurrent change lets it conflict and fail here
+		if version != "" && secret.ResourceVersion != version {
+			return errCredentialsChanged
+		}
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
+		secret.Data[PasswordKey] = hash
+		return us.Update(ctx, secret)
+	})
+	return tracing.Error(span, err)
+}
+
+func (us *userStore) SetEmailVerified(ctx context.Context, user *kimv1.User) error {
+	ctx, span := tracing.Start(ctx, "userStore.SetEmailVerified")
+	defer span.End()
+	key := client.ObjectKeyFromObject(user)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := &kimv1.User{}
+		if err := us.Get(ctx, key, latest); err != nil {
+			return err
+		}
+		// the address might have changed since the link was sent
+		if !ptr.Equal(latest.Spec.Email, user.Spec.Email) {
+			return errEmailChanged
+		}
+		latest.Spec.EmailVerified = ptr.To(true)
+		return us.Update(ctx, latest)
+	})
+	return tracing.Error(span, err)
+}
+
+func (us *userStore) TOTPSecret(ctx context.Context, user *kimv1.User) (string, error) {
+	ctx, span := tracing.Start(ctx, "userStore.TOTPSecret")
+	defer span.End()
+	secret := &corev1.Secret{}
+	ns := types.NamespacedName{Name: user.Spec.SecretName, Namespace: user.Namespace}
+	if err := us.Get(ctx, ns, secret); err != nil {
+		return "", tracing.Error(span, err)
+	}
+	return string(secret.Data[TOTPKey]), nil
+}
+
+func (us *userStore) SetTOTPSecret(ctx context.Context, user *kimv1.User, totp string) error {
+	ctx, span := tracing.Start(ctx, "userStore.SetTOTPSecret")
+	defer span.End()
+	ns := types.NamespacedName{Name: user.Spec.SecretName, Namespace: user.Namespace}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret := &corev1.Secret{}
+		if err := us.Get(ctx, ns, secret); err != nil {
+			return err
+		}
+		if totp == "" {
+			delete(secret.Data, TOTPKey)
+		} else {
+			if secret.Data == nil {
+				secret.Data = make(map[string][]byte)
+			}
+			secret.Data[TOTPKey] = []byte(totp)
+		}
+		return us.Update(ctx, secret)
+	})
+	return tracing.Error(span, err)
+}
+
+func (us *userStore) UpdateClaims(ctx context.Context, user *kimv1.User, values map[string]string) error {
+	ctx, span := tracing.Start(ctx, "userStore.UpdateClaims")
+	defer span.End()
+	key := client.ObjectKeyFromObject(user)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := &kimv1.User{}
+		if err := us.Get(ctx, key, latest); err != nil {
+			return err
+		}
+		if err := setClaims(&latest.Spec.Claim, values); err != nil {
+			return err
+		}
+		return us.Update(ctx, latest)
+	})
+	return tracing.Error(span, err)
+}
+
+// legacySubject decodes a subject of the tokens issued before the subjects were derived from the UID,
+// which were the hex encoded name/namespace of the user
+func legacySubject(subject string) (types.NamespacedName, bool) {
+	decoded, err := hex.DecodeString(subject)
+	if err != nil {
+		return types.NamespacedName{}, false
+	}
+	name, namespace, found := strings.Cut(string(decoded), "/")
+	if !found || name == "" || namespace == "" {
+		return types.NamespacedName{}, false
+	}
+	return types.NamespacedName{Name: name, Namespace: namespace}, true
+}
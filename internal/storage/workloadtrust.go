@@ -0,0 +1,346 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	jose "github.com/go-jose/go-jose/v4"
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+	"github.com/zitadel/oidc/v3/pkg/op"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/policy"
+)
+
+// workloadTrustPrefix is the prefix of the subjects of the tokens granted by the Policies of a WorkloadTrust,
+// it tells them from the MachineClients, whose names have no colon
+const workloadTrustPrefix = "workloadtrust:"
+
+// +kubebuilder:rbac:groups=kim.kim.io,resources=workloadtrusts,verbs=get;list;watch
+
+// WorkloadTrustStore reads the WorkloadTrusts and verifies the JWTs of their issuers
+type WorkloadTrustStore struct {
+	reader client.Reader
+	// namespaces restricts the trusts to these namespaces, any namespace if empty
+	namespaces []string
+	jwks       *jwksCache
+}
+
+// NewWorkloadTrustStore returns the store of the WorkloadTrusts read by the reader
+func NewWorkloadTrustStore(reader client.Reader, namespaces ...string) *WorkloadTrustStore {
+	return &WorkloadTrustStore{
+		reader:     reader,
+		namespaces: namespaces,
+		jwks:       newJWKSCache(),
+	}
+}
+
+// WorkloadTrustID returns the subject of the tokens granted by the Policies of the trust
+func WorkloadTrustID(obj *kimv1.WorkloadTrust) string {
+	return workloadTrustPrefix + obj.Name + "/" + obj.Namespace
+}
+
+// list returns the enabled trusts of the issuer
+func (w *WorkloadTrustStore) list(ctx context.Context, issuer string) ([]kimv1.WorkloadTrust, error) {
+	namespaces := w.namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	var trusts []kimv1.WorkloadTrust
+	for _, namespace := range namespaces {
+		list := &kimv1.WorkloadTrustList{}
+		if err := w.reader.List(ctx, list, client.InNamespace(namespace)); err != nil {
+			return nil, err
+		}
+		for _, trust := range list.Items {
+			if trust.Spec.Issuer == issuer && !trust.Spec.Disabled {
+				trusts = append(trusts, trust)
+			}
+		}
+	}
+	return trusts, nil
+}
+
+// get returns the enabled trust of the subject
+func (w *WorkloadTrustStore) get(ctx context.Context, subject string) (*kimv1.WorkloadTrust, error) {
+	value, _ := strings.CutPrefix(subject, workloadTrustPrefix)
+	key, ok := namespacedName(value, "")
+	if !ok || len(w.namespaces) > 0 && !slices.Contains(w.namespaces, key.Namespace) {
+		return nil, apierrors.NewNotFound(kimv1.Resource("workloadtrusts"), subject)
+	}
+	obj := &kimv1.WorkloadTrust{}
+	if err := w.reader.Get(ctx, key, obj); err != nil {
+		return nil, err
+	}
+	if obj.Spec.Disabled {
+		return nil, apierrors.NewNotFound(kimv1.Resource("workloadtrusts"), subject)
+	}
+	return obj, nil
+}
+
+// discoveryDocument is the jwks_uri of a fetched discovery document
+type discoveryDocument struct {
+	jwksURI string
+	fetched time.Time
+}
+
+// jwksURI returns the jwks_uri of the discovery document, which is fetched again once it is outdated
+func (c *jwksCache) jwksURI(ctx context.Context, discoveryURL string) (string, error) {
+	c.mu.Lock()
+	document := c.discovered[discoveryURL]
+	c.mu.Unlock()
+	if document != nil && time.Since(document.fetched) <= jwksTTL {
+		return document.jwksURI, nil
+	}
+	// the discovery documents share the fetches with the JWKS documents, the prefix keeps their keys apart
+	fetched, err, _ := c.fetches.Do("discovery:"+discoveryURL, func() (any, error) {
+		var configuration oidc.DiscoveryConfiguration
+		if err := c.get(context.WithoutCancel(ctx), discoveryURL, &configuration); err != nil {
+			return nil, fmt.Errorf("invalid discovery document %s: %w", discoveryURL, err)
+		}
+		if configuration.JwksURI == "" {
+			return nil, fmt.Errorf("discovery document %s has no jwks_uri", discoveryURL)
+		}
+		document := &discoveryDocument{jwksURI: configuration.JwksURI, fetched: time.Now()}
+		c.mu.Lock()
+		c.discovered[discoveryURL] = document
+		c.mu.Unlock()
+		return document, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fetched.(*discoveryDocument).jwksURI, nil
+}
+
+// workloadKeySet is the oidc.KeySet of the issuer of a trust, its inline JWKS or else its discovered keys
+type workloadKeySet struct {
+	store *WorkloadTrustStore
+	trust *kimv1.WorkloadTrust
+}
+
+func (k *workloadKeySet) VerifySignature(ctx context.Context, jws *jose.JSONWebSignature) ([]byte, error) {
+	keyID, _ := oidc.GetKeyIDAndAlg(jws)
+	key, err := k.key(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	return jws.Verify(key)
+}
+
+func (k *workloadKeySet) key(ctx context.Context, keyID string) (*jose.JSONWebKey, error) {
+	spec := k.trust.Spec
+	if spec.JWKS != "" {
+		var keys jose.JSONWebKeySet
+		if err := json.Unmarshal([]byte(spec.JWKS), &keys); err != nil {
+			return nil, fmt.Errorf("invalid JWKS of the workload trust %s: %w", k.trust.Name, err)
+		}
+		for _, key := range keys.Key(keyID) {
+			if key.Use == "" || key.Use == "sig" {
+				return &key, nil
+			}
+		}
+		return nil, fmt.Errorf("key %s not found", keyID)
+	}
+	discoveryURL := spec.DiscoveryURL
+	if discoveryURL == "" {
+		discoveryURL = strings.TrimSuffix(spec.Issuer, "/") + oidc.DiscoveryEndpoint
+	}
+	uri, err := k.store.jwks.jwksURI(ctx, discoveryURL)
+	if err != nil {
+		return nil, err
+	}
+	return k.store.jwks.key(ctx, uri, keyID)
+}
+
+// jwtIssuer returns the unverified iss claim of the JWT, empty if it is no JWT
+func jwtIssuer(token string) string {
+	claims := new(oidc.TokenClaims)
+	if _, err := oidc.ParseToken(token, claims); err != nil {
+		return ""
+	}
+	return claims.Issuer
+}
+
+// verify verifies the JWT by the keys of the issuer of the trust and returns its claims
+func (w *WorkloadTrustStore) verify(ctx context.Context, trust *kimv1.WorkloadTrust, token string) (*oidc.TokenClaims, map[string]any, error) {
+	claims := new(oidc.TokenClaims)
+	payload, err := oidc.ParseToken(token, claims)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = oidc.CheckIssuer(claims, trust.Spec.Issuer); err != nil {
+		return nil, nil, err
+	}
+	if !slices.ContainsFunc(trust.Spec.Audiences, func(audience string) bool {
+		return slices.Contains(claims.GetAudience(), audience)
+	}) {
+		return nil, nil, fmt.Errorf("%w: audience must contain one of %s", oidc.ErrAudience, strings.Join(trust.Spec.Audiences, ", "))
+	}
+	if err = oidc.CheckExpiration(claims, 0); err != nil {
+		return nil, nil, err
+	}
+	if err = oidc.CheckSubject(claims); err != nil {
+		return nil, nil, err
+	}
+	if err = oidc.CheckSignature(ctx, token, payload, claims, nil, &workloadKeySet{store: w, trust: trust}); err != nil {
+		return nil, nil, err
+	}
+	values := map[string]any{}
+	if err = json.Unmarshal(payload, &values); err != nil {
+		return nil, nil, err
+	}
+	return claims, values, nil
+}
+
+// matchesTrust reports whether the subject and the claims of a verified JWT meet the conditions of the trust,
+// a trust without conditions matches no JWT rather than all of them
+func matchesTrust(trust *kimv1.WorkloadTrust, subject string, claims map[string]any) bool {
+	if !trust.Spec.Conditioned() {
+		return false
+	}
+	if trust.Spec.Subject != "" && !policy.Match(trust.Spec.Subject, subject) {
+		return false
+	}
+	for _, condition := range trust.Spec.Claims {
+		switch value := claims[condition.Name].(type) {
+		case string:
+			if !policy.Match(condition.Value, value) {
+				return false
+			}
+		case []any:
+			if !slices.ContainsFunc(value, func(v any) bool {
+				s, ok := v.(string)
+				return ok && policy.Match(condition.Value, s)
+			}) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// trusted returns the only trust of the issuer of the JWT whose conditions it meets and its verified claims
+func (w *WorkloadTrustStore) trusted(ctx context.Context, token string) (*kimv1.WorkloadTrust, *oidc.TokenClaims, error) {
+	trusts, err := w.list(ctx, jwtIssuer(token))
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		matched  []*kimv1.WorkloadTrust
+		verified *oidc.TokenClaims
+		errs     []error
+	)
+	for i := range trusts {
+		claims, values, err := w.verify(ctx, &trusts[i], token)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s/%s: %w", trusts[i].Namespace, trusts[i].Name, err))
+			continue
+		}
+		verified = claims
+		if matchesTrust(&trusts[i], claims.Subject, values) {
+			matched = append(matched, &trusts[i])
+		}
+	}
+	switch {
+	case verified == nil:
+		return nil, nil, oidc.ErrInvalidGrant().WithDescription("the jwt is invalid").WithParent(errors.Join(errs...))
+	case len(matched) == 0:
+		return nil, nil, oidc.ErrAccessDenied().WithDescription("no workload trust matches the subject %s", verified.Subject)
+	case len(matched) > 1:
+		names := make([]string, 0, len(matched))
+		for _, trust := range matched {
+			names = append(names, trust.Namespace+"/"+trust.Name)
+		}
+		return nil, nil, oidc.ErrAccessDenied().WithDescription("the subject %s matches the workload trusts %s",
+			verified.Subject, strings.Join(names, ", "))
+	}
+	return matched[0], verified, nil
+}
+
+// permissions returns the rules of the Policies granted by the trust
+func (w *WorkloadTrustStore) permissions(ctx context.Context, obj *kimv1.WorkloadTrust) ([]kimv1.Rule, error) {
+	return policyRules(ctx, w.reader, obj.Namespace, obj.Spec.Policies)
+}
+
+// workloadPermissions returns the permissions of the WorkloadTrust of the subject, ok is false if there is none
+func (s *Storage) workloadPermissions(ctx context.Context, subject string) (rules []kimv1.Rule, ok bool, err error) {
+	if s.workloadTrusts == nil {
+		return nil, false, nil
+	}
+	obj, err := s.workloadTrusts.get(ctx, subject)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	rules, err = s.workloadTrusts.permissions(ctx, obj)
+	if err != nil {
+		return nil, false, err
+	}
+	return policy.Confine(rules, obj.Namespace, s.adminNamespace), true, nil
+}
+
+// WithWorkloadTrusts lets the workloads holding the JWTs of the issuers of the trusts exchange them for tokens
+func (s *Storage) WithWorkloadTrusts(store *WorkloadTrustStore) *Storage {
+	s.workloadTrusts = store
+	return s
+}
+
+// TrustedIssuer implements the handle.JWTExchange interface
+// it reports whether the JWTs of the issuer are verified by a WorkloadTrust, rather than as the assertions of
+// the JWT profile grant of a MachineClient
+func (s *Storage) TrustedIssuer(ctx context.Context, issuer string) (bool, error) {
+	if s.workloadTrusts == nil || issuer == "" {
+		return false, nil
+	}
+	trusts, err := s.workloadTrusts.list(ctx, issuer)
+	return len(trusts) > 0, err
+}
+
+// workloadTokenRequest verifies the JWT by the WorkloadTrust it matches and returns the request of the access token
+// of the MachineClient of the trust or of the trust itself, external is the issuer and the subject of the JWT
+func (s *Storage) workloadTokenRequest(ctx context.Context, grantType oidc.GrantType, token string, scopes []string) (external string, _ *externalJWTRequest, _ *Client, _ error) {
+	trust, claims, err := s.workloadTrusts.trusted(ctx, token)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	external = claims.Issuer + "#" + claims.Subject
+	if trust.Spec.MachineClientName == "" {
+		// the tokens of the Policies are JWTs carrying the permissions of the trust
+		for _, scope := range scopes {
+			if !slices.Contains(trust.Spec.Scopes, scope) {
+				return external, nil, nil, oidc.ErrInvalidScope().WithDescription("the scope %s is not allowed", scope)
+			}
+		}
+		id := WorkloadTrustID(trust)
+		request := oidc.JWTTokenRequest{Subject: id, Audience: []string{id}, Scopes: scopes}
+		return external, &externalJWTRequest{JWTTokenRequest: request, grantType: grantType}, &Client{
+			id:              id,
+			grantTypes:      []oidc.GrantType{grantType},
+			accessTokenType: op.AccessTokenTypeJWT,
+		}, nil
+	}
+	obj := &kimv1.MachineClient{}
+	key := types.NamespacedName{Namespace: trust.Namespace, Name: trust.Spec.MachineClientName}
+	if err = s.workloadTrusts.reader.Get(ctx, key, obj); err != nil || obj.Spec.Disabled {
+		return external, nil, nil, oidc.ErrAccessDenied().WithDescription("the machine client of the workload trust %s is not available",
+			trust.Name).WithParent(err)
+	}
+	request, err := machineTokenRequest(obj, scopes)
+	if err != nil {
+		return external, nil, nil, err
+	}
+	return external, &externalJWTRequest{JWTTokenRequest: request, grantType: grantType}, machineClient(obj, grantType), nil
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jose "github.com/go-jose/go-jose/v4"
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+func TestJWTBearerTokenRequest(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := kimv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithHeader("kid", "ci"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var issuer string
+	ci := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case oidc.DiscoveryEndpoint:
+			_ = json.NewEncoder(w).Encode(&oidc.DiscoveryConfiguration{Issuer: issuer, JwksURI: issuer + "/keys"})
+		case "/keys":
+			_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+				{KeyID: "ci", Use: "sig", Key: &key.PublicKey},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ci.Close()
+	issuer = ci.URL
+	sign := func(claims map[string]any) string {
+		claims["iss"] = issuer
+		claims["exp"] = time.Now().Add(time.Minute).Unix()
+		payload, err := json.Marshal(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jws, err := signer.Sign(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := jws.CompactSerialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&kimv1.MachineClient{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "deployer"},
+			Spec:       kimv1.MachineClientSpec{Scopes: []string{"deploy"}},
+		},
+		&kimv1.WorkloadTrust{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "release"},
+			Spec: kimv1.WorkloadTrustSpec{
+				Issuer:            issuer,
+				Audiences:         []string{"kim"},
+				Subject:           "repo:example/reports:ref:refs/heads/*",
+				Claims:            []kimv1.WorkloadTrustClaim{{Name: "groups", Value: "release*"}},
+				MachineClientName: "deployer",
+			},
+		},
+		&kimv1.WorkloadTrust{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "pull-requests"},
+			Spec: kimv1.WorkloadTrustSpec{
+				Issuer:    issuer,
+				Audiences: []string{"kim"},
+				Subject:   "repo:example/reports:pull_request",
+				Policies:  []string{"preview"},
+				Scopes:    []string{"preview"},
+			},
+		},
+		// a trust without conditions, e.g. created before they were required, trusts no JWT of the issuer
+		&kimv1.WorkloadTrust{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "everything"},
+			Spec: kimv1.WorkloadTrustSpec{
+				Issuer:    issuer,
+				Audiences: []string{"kim"},
+				Subject:   "*",
+				Policies:  []string{"preview"},
+			},
+		},
+	).Build()
+	store := NewWorkloadTrustStore(c)
+	store.jwks.client = ci.Client()
+	s := (&Storage{}).WithWorkloadTrusts(store)
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		name    string
+		claims  map[string]any
+		scopes  []string
+		subject string
+	}{
+		{"machine client", map[string]any{"sub": "repo:example/reports:ref:refs/heads/main", "aud": "kim",
+			"groups": []string{"dev", "release-managers"}}, []string{"deploy"}, "deployer/ci"},
+		{"policies", map[string]any{"sub": "repo:example/reports:pull_request", "aud": []string{"other", "kim"}},
+			[]string{"preview"}, "workloadtrust:pull-requests/ci"},
+	} {
+		request, _, _, err := s.JWTBearerTokenRequest(ctx, sign(tt.claims), tt.scopes)
+		if err != nil {
+			t.Errorf("%s: JWTBearerTokenRequest() error = %v", tt.name, err)
+			continue
+		}
+		if request.GetSubject() != tt.subject {
+			t.Errorf("%s: subject = %s, want %s", tt.name, request.GetSubject(), tt.subject)
+		}
+	}
+	for name, tt := range map[string]struct {
+		claims map[string]any
+		scopes []string
+	}{
+		"other audience":    {map[string]any{"sub": "repo:example/reports:pull_request", "aud": "other"}, nil},
+		"other subject":     {map[string]any{"sub": "repo:example/other:pull_request", "aud": "kim"}, nil},
+		"missing claim":     {map[string]any{"sub": "repo:example/reports:ref:refs/heads/main", "aud": "kim"}, nil},
+		"not allowed scope": {map[string]any{"sub": "repo:example/reports:pull_request", "aud": "kim"}, []string{"deploy"}},
+	} {
+		if _, _, _, err := s.JWTBearerTokenRequest(ctx, sign(tt.claims), tt.scopes); err == nil {
+			t.Errorf("%s: JWTBearerTokenRequest() succeeded", name)
+		}
+	}
+	if trusted, err := s.TrustedIssuer(ctx, "https://untrusted.example.com"); trusted || err != nil {
+		t.Errorf("TrustedIssuer() = %v, %v, want false", trusted, err)
+	}
+}
@@ -0,0 +1,225 @@
+// Package theme loads the files overriding the embedded pages and assets of the login UI.
+//
+// A theme is a flat set of files: the *.html files are templates redefining the pages of the same name,
+// the other files are static assets. The Default theme applies to all clients, the other themes are selected
+// by the clients and build on top of it.
+package theme
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Default is the theme of all clients without a theme of their own
+	Default = "default"
+
+	// Label names the theme of the files of a ConfigMap
+	Label = "kim.kim.io/theme"
+)
+
+// Files are the templates and static assets of a theme by file name
+type Files struct {
+	Templates map[string]string
+	Static    map[string][]byte
+}
+
+func newFiles() *Files {
+	return &Files{
+		Templates: make(map[string]string),
+		Static:    make(map[string][]byte),
+	}
+}
+
+func (f *Files) add(name string, data []byte) {
+	if strings.HasSuffix(name, ".html") {
+		f.Templates[name] = string(data)
+		return
+	}
+	f.Static[name] = data
+}
+
+// Source loads the files of the themes by their name
+type Source interface {
+	Load(ctx context.Context) (map[string]*Files, error)
+}
+
+// DirSource reads every subdirectory of the directory as the theme of its name,
+// e.g. ConfigMaps mounted at <dir>/default and <dir>/<theme>
+type DirSource struct {
+	dir string
+}
+
+func NewDirSource(dir string) *DirSource {
+	return &DirSource{dir: dir}
+}
+
+func (s *DirSource) Load(ctx context.Context) (map[string]*Files, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	themes := make(map[string]*Files)
+	for _, entry := range entries {
+		// the files of mounted volumes are symlinks into hidden directories, which are skipped but followed
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		dir := filepath.Join(s.dir, entry.Name())
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		files, err := readDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		themes[entry.Name()] = files
+	}
+	return themes, nil
+}
+
+func readDir(dir string) (*Files, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := newFiles()
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files.add(entry.Name(), data)
+	}
+	return files, nil
+}
+
+// ConfigMapSource reads the ConfigMaps of the namespace labeled with the name of their theme,
+// binary data are static assets
+type ConfigMapSource struct {
+	client    client.Reader
+	namespace string
+}
+
+func NewConfigMapSource(c client.Reader, namespace string) *ConfigMapSource {
+	return &ConfigMapSource{client: c, namespace: namespace}
+}
+
+func (s *ConfigMapSource) Load(ctx context.Context) (map[string]*Files, error) {
+	list := &corev1.ConfigMapList{}
+	if err := s.client.List(ctx, list, client.InNamespace(s.namespace), client.HasLabels{Label}); err != nil {
+		return nil, err
+	}
+	themes := make(map[string]*Files)
+	for _, cm := range list.Items {
+		name := cm.Labels[Label]
+		files, ok := themes[name]
+		if !ok {
+			files = newFiles()
+			themes[name] = files
+		}
+		for key, value := range cm.Data {
+			files.add(key, []byte(value))
+		}
+		for key, value := range cm.BinaryData {
+			files.Static[key] = value
+		}
+	}
+	return themes, nil
+}
+
+// Watcher applies the themes of the source whenever they change
+type Watcher struct {
+	source   Source
+	interval time.Duration
+	apply    func(map[string]*Files) error
+	last     [sha256.Size]byte
+}
+
+// NewWatcher returns a watcher polling the source every interval, apply is only called with changed themes
+func NewWatcher(source Source, interval time.Duration, apply func(map[string]*Files) error) *Watcher {
+	return &Watcher{source: source, interval: interval, apply: apply}
+}
+
+// Reload loads the themes and applies them if they changed, the themes applied before are kept on errors
+func (w *Watcher) Reload(ctx context.Context) error {
+	themes, err := w.source.Load(ctx)
+	if err != nil {
+		return err
+	}
+	sum := fingerprint(themes)
+	if sum == w.last {
+		return nil
+	}
+	if err = w.apply(themes); err != nil {
+		return err
+	}
+	w.last = sum
+	logf.FromContext(ctx).Info("themes reloaded", "themes", len(themes))
+	return nil
+}
+
+// Run reloads the themes until the context is done
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := w.Reload(ctx); err != nil {
+				logf.FromContext(ctx).Error(err, "could not reload themes")
+			}
+		}
+	}
+}
+
+// fingerprint hashes the themes in a stable order
+func fingerprint(themes map[string]*Files) [sha256.Size]byte {
+	h := sha256.New()
+	write := func(values ...string) {
+		for _, value := range values {
+			h.Write([]byte(value))
+			h.Write([]byte{0})
+		}
+	}
+	for _, name := range sortedKeys(themes) {
+		files := themes[name]
+		write("theme", name)
+		for _, file := range sortedKeys(files.Templates) {
+			write("template", file, files.Templates[file])
+		}
+		for _, file := range sortedKeys(files.Static) {
+			write("static", file, string(files.Static[file]))
+		}
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,71 @@
+package theme
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDirSource(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, Default, "login.html"), `{{ define "login" }}login{{ end }}`)
+	writeFile(t, filepath.Join(dir, Default, "style.css"), "body {}")
+	writeFile(t, filepath.Join(dir, "dark", "..data", "ignored.html"), "")
+	writeFile(t, filepath.Join(dir, "dark", "style.css"), "body { background: black; }")
+	writeFile(t, filepath.Join(dir, "README"), "not a theme")
+
+	themes, err := NewDirSource(dir).Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(themes) != 2 {
+		t.Fatalf("Load() = %d themes, want 2", len(themes))
+	}
+	if got := themes[Default].Templates["login.html"]; got != `{{ define "login" }}login{{ end }}` {
+		t.Errorf("default login.html = %q", got)
+	}
+	if got := string(themes[Default].Static["style.css"]); got != "body {}" {
+		t.Errorf("default style.css = %q", got)
+	}
+	if len(themes["dark"].Templates) != 0 || len(themes["dark"].Static) != 1 {
+		t.Errorf("dark = %+v", themes["dark"])
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, Default, "style.css"), "a")
+
+	applied := 0
+	w := NewWatcher(NewDirSource(dir), time.Second, func(map[string]*Files) error {
+		applied++
+		return nil
+	})
+	for range 2 {
+		if err := w.Reload(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if applied != 1 {
+		t.Errorf("applied %d times without change, want 1", applied)
+	}
+	writeFile(t, filepath.Join(dir, Default, "style.css"), "b")
+	if err := w.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if applied != 2 {
+		t.Errorf("applied %d times after change, want 2", applied)
+	}
+}
@@ -0,0 +1,30 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type tracedReconciler struct {
+	name string
+	reconcile.Reconciler
+}
+
+// Reconciler 为每次调谐创建 span, 并将 trace id 注入到调谐的日志中
+func Reconciler(name string, r reconcile.Reconciler) reconcile.Reconciler {
+	return &tracedReconciler{name: name, Reconciler: r}
+}
+
+func (r *tracedReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	ctx, span := Start(ctx, r.name+".Reconcile",
+		attribute.String("k8s.namespace.name", req.Namespace),
+		attribute.String("k8s.object.name", req.Name),
+		attribute.String("reconcile.id", string(controller.ReconcileIDFromContext(ctx))),
+	)
+	defer span.End()
+	result, err := r.Reconciler.Reconcile(LogWithTrace(ctx), req)
+	return result, Error(span, err)
+}
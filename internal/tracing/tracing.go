@@ -3,9 +3,16 @@ package tracing
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
@@ -14,9 +21,39 @@ import (
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-func InitTracer(ctx context.Context, endpoint string) (*sdktrace.TracerProvider, error) {
-	// 创建 Jaeger 导出器
-	exp, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpointURL(endpoint), otlptracegrpc.WithInsecure())
+const (
+	// ProtocolGRPC exports the spans by OTLP over gRPC
+	ProtocolGRPC = "grpc"
+	// ProtocolHTTP exports the spans by OTLP over HTTP with protobuf payloads
+	ProtocolHTTP = "http/protobuf"
+
+	instrumentationName = "github.com/crochee/kim"
+)
+
+// span 的 OIDC 属性
+const (
+	ClientIDKey  = attribute.Key("oidc.client_id")
+	GrantTypeKey = attribute.Key("oidc.grant_type")
+)
+
+// Config 是 OTLP 导出器和 TracerProvider 的配置
+type Config struct {
+	// Endpoint is the url of the collector, the scheme selects the transport security:
+	// http:// exports in plain text, https:// with TLS
+	Endpoint string
+	// Protocol is one of ProtocolGRPC and ProtocolHTTP
+	Protocol string
+	// Headers are sent with every export, e.g. for the authentication at the collector
+	Headers map[string]string
+	// ServiceName is the service.name resource attribute of the spans
+	ServiceName string
+	// SampleRatio is the ratio of the root spans to sample, child spans follow their parent
+	SampleRatio float64
+}
+
+func InitTracer(ctx context.Context, cfg Config) (*sdktrace.TracerProvider, error) {
+	// 创建 OTLP 导出器
+	exp, err := newExporter(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -25,10 +62,10 @@ func InitTracer(ctx context.Context, endpoint string) (*sdktrace.TracerProvider,
 		sdktrace.WithBatcher(exp),
 		sdktrace.WithResource(resource.NewWithAttributes(
 			semconv.SchemaURL,
-			semconv.ServiceName("cloudterm-cluster-operator"),
+			semconv.ServiceName(cfg.ServiceName),
 		)),
 		sdktrace.WithSampler(sdktrace.ParentBased(
-			sdktrace.TraceIDRatioBased(0.1), // 生产环境建议降低采样率
+			sdktrace.TraceIDRatioBased(cfg.SampleRatio), // 生产环境建议降低采样率
 		)),
 	)
 
@@ -41,6 +78,23 @@ func InitTracer(ctx context.Context, endpoint string) (*sdktrace.TracerProvider,
 	return tp, nil
 }
 
+func newExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	switch cfg.Protocol {
+	case ProtocolGRPC, "":
+		return otlptracegrpc.New(ctx,
+			otlptracegrpc.WithEndpointURL(cfg.Endpoint),
+			otlptracegrpc.WithHeaders(cfg.Headers),
+		)
+	case ProtocolHTTP:
+		return otlptracehttp.New(ctx,
+			otlptracehttp.WithEndpointURL(cfg.Endpoint),
+			otlptracehttp.WithHeaders(cfg.Headers),
+		)
+	default:
+		return nil, fmt.Errorf("unsupported otlp protocol %q", cfg.Protocol)
+	}
+}
+
 func InjectTraceContext(ctx context.Context) map[string]string {
 	carrier := propagation.MapCarrier{}
 	otel.GetTextMapPropagator().Inject(ctx, carrier)
@@ -55,3 +109,30 @@ func LogWithTrace(ctx context.Context) context.Context {
 	}
 	return ctx
 }
+
+// Start 创建一个子 span, 未初始化 TracerProvider 时为空操作
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Error 将错误记录到 span 上并原样返回, 以便在 return 语句中使用
+func Error(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// Middleware 为每个请求创建 HTTP server span, span 以 chi 的路由模式命名,
+// 以免路径参数导致 span 名称过多
+func Middleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(semconv.HTTPRoute(rctx.RoutePattern()))
+		}
+	}), "http.server")
+}
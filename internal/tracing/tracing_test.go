@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// record installs a TracerProvider recording the ended spans for the test
+func record(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := record(t)
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/users/{name}", func(w http.ResponseWriter, _ *http.Request) {})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/alice", nil))
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	if name := spans[0].Name(); name != "GET /users/{name}" {
+		t.Errorf("span name = %q, want the route pattern", name)
+	}
+}
+
+func TestReconciler(t *testing.T) {
+	recorder := record(t)
+	failure := errors.New("conflict")
+	r := Reconciler("User", reconcile.Func(func(context.Context, reconcile.Request) (reconcile.Result, error) {
+		return reconcile.Result{}, failure
+	}))
+
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{}); !errors.Is(err, failure) {
+		t.Fatalf("Reconcile() = %v, want the error of the reconciler", err)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Name() != "User.Reconcile" {
+		t.Fatalf("recorded %v, want a User.Reconcile span", spans)
+	}
+	if status := spans[0].Status(); status.Code != codes.Error || status.Description != failure.Error() {
+		t.Errorf("span status = %+v, want the error", status)
+	}
+}
+
+func TestNewExporter(t *testing.T) {
+	if _, err := newExporter(context.Background(), Config{Protocol: "zipkin"}); err == nil {
+		t.Error("newExporter() accepted an unknown protocol")
+	}
+}
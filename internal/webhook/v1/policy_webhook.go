@@ -0,0 +1,82 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/policy"
+)
+
+var policylog = logf.Log.WithName("policy-resource")
+
+// SetupPolicyWebhookWithManager registers the webhook for Policy in the manager.
+func SetupPolicyWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&kimv1.Policy{}).
+		WithValidator(&PolicyCustomValidator{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-kim-kim-io-v1-policy,mutating=false,failurePolicy=fail,sideEffects=None,groups=kim.kim.io,resources=policies,verbs=create;update,versions=v1,name=vpolicy-v1.kb.io,admissionReviewVersions=v1
+
+// PolicyCustomValidator validates the Policy resource when it is created or updated, so an invalid policy is
+// rejected instead of authorizing the requests differently than intended.
+type PolicyCustomValidator struct{}
+
+var _ webhook.CustomValidator = &PolicyCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type Policy.
+func (v *PolicyCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	p, ok := obj.(*kimv1.Policy)
+	if !ok {
+		return nil, fmt.Errorf("expected a Policy object but got %T", obj)
+	}
+	policylog.Info("Validation for Policy upon creation", "name", p.GetName())
+	return nil, v.validate(p)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type Policy.
+func (v *PolicyCustomValidator) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	p, ok := newObj.(*kimv1.Policy)
+	if !ok {
+		return nil, fmt.Errorf("expected a Policy object for the newObj but got %T", newObj)
+	}
+	policylog.Info("Validation for Policy upon update", "name", p.GetName())
+	return nil, v.validate(p)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type Policy.
+func (v *PolicyCustomValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *PolicyCustomValidator) validate(p *kimv1.Policy) error {
+	if errs := policy.Validate(&p.Spec, field.NewPath("spec")); len(errs) > 0 {
+		return apierrors.NewInvalid(kimv1.GroupVersion.WithKind("Policy").GroupKind(), p.Name, errs)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package v1
+
+import (
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+func TestPolicyWebhook(t *testing.T) {
+	ctx := context.Background()
+	p := &kimv1.Policy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "admin"},
+		Spec: kimv1.PolicySpec{
+			Statement: `{"version":1}`,
+			Rules:     []kimv1.Rule{{Resource: "user/*", Actions: []string{"get"}, Effect: kimv1.EffectAllow}},
+		},
+	}
+	v := &PolicyCustomValidator{}
+	if _, err := v.ValidateCreate(ctx, p); err != nil {
+		t.Errorf("ValidateCreate() = %v", err)
+	}
+
+	for name, mutate := range map[string]func(*kimv1.PolicySpec){
+		"missing effect":    func(spec *kimv1.PolicySpec) { spec.Rules[0].Effect = "" },
+		"lower case effect": func(spec *kimv1.PolicySpec) { spec.Rules[0].Effect = "allow" },
+		"no actions":        func(spec *kimv1.PolicySpec) { spec.Rules[0].Actions = nil },
+		"empty action":      func(spec *kimv1.PolicySpec) { spec.Rules[0].Actions = []string{""} },
+		"broken statement":  func(spec *kimv1.PolicySpec) { spec.Statement = "{" },
+	} {
+		t.Run(name, func(t *testing.T) {
+			invalid := p.DeepCopy()
+			mutate(&invalid.Spec)
+			if _, err := v.ValidateUpdate(ctx, p, invalid); !apierrors.IsInvalid(err) {
+				t.Errorf("ValidateUpdate() = %v, want invalid", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+var rolelog = logf.Log.WithName("role-resource")
+
+// SetupRoleWebhookWithManager registers the webhook for Role in the manager.
+func SetupRoleWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&kimv1.Role{}).
+		WithValidator(&RoleCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-kim-kim-io-v1-role,mutating=false,failurePolicy=fail,sideEffects=None,groups=kim.kim.io,resources=roles,verbs=create;update,versions=v1,name=vrole-v1.kb.io,admissionReviewVersions=v1
+
+// RoleCustomValidator validates the Role resource when it is created or updated.
+type RoleCustomValidator struct {
+	Client client.Reader
+}
+
+var _ webhook.CustomValidator = &RoleCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type Role.
+func (v *RoleCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	role, ok := obj.(*kimv1.Role)
+	if !ok {
+		return nil, fmt.Errorf("expected a Role object but got %T", obj)
+	}
+	rolelog.Info("Validation for Role upon creation", "name", role.GetName())
+	return nil, v.validate(ctx, role, nil)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type Role.
+func (v *RoleCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	role, ok := newObj.(*kimv1.Role)
+	if !ok {
+		return nil, fmt.Errorf("expected a Role object for the newObj but got %T", newObj)
+	}
+	old, ok := oldObj.(*kimv1.Role)
+	if !ok {
+		return nil, fmt.Errorf("expected a Role object for the oldObj but got %T", oldObj)
+	}
+	rolelog.Info("Validation for Role upon update", "name", role.GetName())
+	return nil, v.validate(ctx, role, old)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type Role.
+func (v *RoleCustomValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validate checks that the permissions resolve to the Policies in the namespace of the role. The permissions the
+// old role already had are not checked again, a deleted Policy shows in the Ready condition of the role instead of
+// blocking every update of it.
+func (v *RoleCustomValidator) validate(ctx context.Context, role, old *kimv1.Role) error {
+	var errs field.ErrorList
+	known := sets.New[string]()
+	if old != nil {
+		known.Insert(old.Spec.Permissions...)
+	}
+	seen := sets.New[string]()
+	for i, name := range role.Spec.Permissions {
+		path := field.NewPath("spec", "permissions").Index(i)
+		if seen.Has(name) {
+			errs = append(errs, field.Duplicate(path, name))
+			continue
+		}
+		seen.Insert(name)
+		if known.Has(name) {
+			continue
+		}
+		err := v.Client.Get(ctx, types.NamespacedName{Namespace: role.Namespace, Name: name}, &kimv1.Policy{})
+		switch {
+		case apierrors.IsNotFound(err):
+			errs = append(errs, field.NotFound(path, name))
+		case err != nil:
+			return apierrors.NewInternalError(err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(kimv1.GroupVersion.WithKind("Role").GroupKind(), role.Name, errs)
+}
@@ -0,0 +1,59 @@
+package v1
+
+import (
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+func TestRolePermissions(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := kimv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	admin := &kimv1.Policy{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "admin"}}
+	v := &RoleCustomValidator{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(admin).Build()}
+	ctx := context.Background()
+	role := func(namespace string, permissions ...string) *kimv1.Role {
+		return &kimv1.Role{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "ops"},
+			Spec:       kimv1.RoleSpec{Permissions: permissions},
+		}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		role    *kimv1.Role
+		invalid bool
+	}{
+		{name: "existing policy", role: role("team-a", "admin")},
+		{name: "missing policy", role: role("team-a", "admin", "viewer"), invalid: true},
+		{name: "policy of another namespace", role: role("team-b", "admin"), invalid: true},
+		{name: "duplicate policy", role: role("team-a", "admin", "admin"), invalid: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := v.ValidateCreate(ctx, tc.role)
+			if tc.invalid != apierrors.IsInvalid(err) || (!tc.invalid && err != nil) {
+				t.Errorf("ValidateCreate() = %v, want invalid %t", err, tc.invalid)
+			}
+		})
+	}
+
+	// a policy deleted after the role was created does not block the updates of the role
+	old := role("team-a", "admin", "deleted")
+	updated := role("team-a", "admin", "deleted")
+	updated.Spec.Desc = "operators"
+	if _, err := v.ValidateUpdate(ctx, old, updated); err != nil {
+		t.Errorf("ValidateUpdate() = %v", err)
+	}
+	updated.Spec.Permissions = append(updated.Spec.Permissions, "viewer")
+	if _, err := v.ValidateUpdate(ctx, old, updated); !apierrors.IsInvalid(err) {
+		t.Errorf("ValidateUpdate() with a new missing policy = %v, want invalid", err)
+	}
+}
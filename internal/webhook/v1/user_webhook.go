@@ -0,0 +1,187 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1 contains the admission webhooks of the kim.kim.io/v1 resources
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/storage"
+)
+
+// log is for logging in this package.
+var userlog = logf.Log.WithName("user-resource")
+
+// SetupUserWebhookWithManager registers the webhook for User in the manager.
+// The indexes of storage.IndexUsers must be registered with the manager.
+func SetupUserWebhookWithManager(mgr ctrl.Manager, lookup storage.UserLookup) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&kimv1.User{}).
+		WithValidator(&UserCustomValidator{Client: mgr.GetClient(), Lookup: lookup}).
+		WithDefaulter(&UserCustomDefaulter{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-kim-kim-io-v1-user,mutating=true,failurePolicy=fail,sideEffects=None,groups=kim.kim.io,resources=users,verbs=create;update,versions=v1,name=muser-v1.kb.io,admissionReviewVersions=v1
+
+// UserCustomDefaulter sets the default values of the User resource when it is created or updated.
+type UserCustomDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &UserCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type User.
+// The Secret of the password defaults to NAME-credentials like in kim admin user create.
+func (d *UserCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	user, ok := obj.(*kimv1.User)
+	if !ok {
+		return fmt.Errorf("expected a User object but got %T", obj)
+	}
+	userlog.Info("Defaulting for User", "name", user.GetName())
+	if user.Spec.SecretName == "" {
+		user.Spec.SecretName = user.Name + "-credentials"
+	}
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-kim-kim-io-v1-user,mutating=false,failurePolicy=fail,sideEffects=None,groups=kim.kim.io,resources=users,verbs=create;update,versions=v1,name=vuser-v1.kb.io,admissionReviewVersions=v1
+
+// UserCustomValidator validates the User resource when it is created or updated.
+type UserCustomValidator struct {
+	Client client.Reader
+	// Lookup names the claims the users log in with, they must be unique among the users like the subjects
+	Lookup storage.UserLookup
+}
+
+var _ webhook.CustomValidator = &UserCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type User.
+func (v *UserCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	user, ok := obj.(*kimv1.User)
+	if !ok {
+		return nil, fmt.Errorf("expected a User object but got %T", obj)
+	}
+	userlog.Info("Validation for User upon creation", "name", user.GetName())
+	return v.validate(ctx, user, "")
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type User.
+func (v *UserCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	user, ok := newObj.(*kimv1.User)
+	if !ok {
+		return nil, fmt.Errorf("expected a User object for the newObj but got %T", newObj)
+	}
+	oldUser, ok := oldObj.(*kimv1.User)
+	if !ok {
+		return nil, fmt.Errorf("expected a User object for the oldObj but got %T", oldObj)
+	}
+	userlog.Info("Validation for User upon update", "name", user.GetName())
+	return v.validate(ctx, user, oldUser.Annotations[kimv1.SubjectAnnotation])
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type User.
+func (v *UserCustomValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validate validates the user, the former subject annotation of an updated user is kept as it is ignored anyway
+func (v *UserCustomValidator) validate(ctx context.Context, user *kimv1.User, formerSubject string) (admission.Warnings, error) {
+	var errs field.ErrorList
+	if user.Spec.Email != nil && *user.Spec.Email != "" {
+		// a display name like "Alice <alice@example.com>" is no address the user can log in with
+		if addr, err := mail.ParseAddress(*user.Spec.Email); err != nil || addr.Address != *user.Spec.Email {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "email"), *user.Spec.Email, "must be an email address"))
+		}
+	}
+	// the subject is kept in the status, an annotation must not make the user the subject of another user
+	if subject := user.Annotations[kimv1.SubjectAnnotation]; subject != "" && subject != formerSubject {
+		errs = append(errs, field.Forbidden(field.NewPath("metadata", "annotations").Key(kimv1.SubjectAnnotation),
+			"the subject of a user is kept in status.subject, which is set by kim admin import"))
+	}
+	for _, id := range v.Lookup.Identifiers {
+		path := loginPath(id)
+		if path == nil {
+			continue
+		}
+		value := id.Value(user)
+		if value == "" {
+			continue
+		}
+		duplicate, err := v.duplicate(ctx, user, id.Index(), value)
+		if err != nil {
+			return nil, apierrors.NewInternalError(err)
+		}
+		if duplicate {
+			errs = append(errs, field.Duplicate(path, value))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, apierrors.NewInvalid(kimv1.GroupVersion.WithKind("User").GroupKind(), user.Name, errs)
+	}
+	// the Secret may be created after the user, e.g. by kim admin user set-password, so it is only a warning
+	var warnings admission.Warnings
+	if user.Spec.SecretName != "" {
+		ns := types.NamespacedName{Namespace: user.Namespace, Name: user.Spec.SecretName}
+		err := v.Client.Get(ctx, ns, &corev1.Secret{})
+		switch {
+		case apierrors.IsNotFound(err):
+			warnings = append(warnings, fmt.Sprintf(
+				"the Secret %s does not exist, the user can not log in by a password until it is created", ns.Name))
+		case err != nil:
+			return nil, apierrors.NewInternalError(err)
+		}
+	}
+	return warnings, nil
+}
+
+// duplicate reports whether another user has the value in the field index
+func (v *UserCustomValidator) duplicate(ctx context.Context, user *kimv1.User, index, value string) (bool, error) {
+	users := &kimv1.UserList{}
+	if err := v.Client.List(ctx, users, client.MatchingFields{index: value}); err != nil {
+		return false, err
+	}
+	for _, other := range users.Items {
+		if other.Namespace != user.Namespace || other.Name != user.Name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// loginPath returns the path of the claim of the identifier, nil for the name which is unique anyway
+func loginPath(id storage.LoginIdentifier) *field.Path {
+	switch id {
+	case storage.LoginEmail:
+		return field.NewPath("spec", "email")
+	case storage.LoginPreferredUsername:
+		return field.NewPath("spec", "preferredUsername")
+	default:
+		return nil
+	}
+}
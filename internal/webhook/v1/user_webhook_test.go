@@ -0,0 +1,128 @@
+package v1
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	"github.com/crochee/kim/internal/storage"
+)
+
+func user(namespace, name, email string) *kimv1.User {
+	u := &kimv1.User{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	if email != "" {
+		u.Spec.Email = ptr.To(email)
+	}
+	return u
+}
+
+func TestUserUniqueEmail(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := kimv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	index := func(obj client.Object) []string {
+		if value := storage.LoginEmail.Value(obj.(*kimv1.User)); value != "" {
+			return []string{value}
+		}
+		return nil
+	}
+	alice := user("team-a", "alice", "Alice@example.com")
+	alice.UID = "alice-uid"
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithIndex(&kimv1.User{}, storage.IndexUserEmail, index).
+		WithIndex(&kimv1.User{}, storage.IndexUserSubject, func(obj client.Object) []string {
+			return []string{storage.UserSubject(obj.(*kimv1.User))}
+		}).
+		WithObjects(alice).
+		Build()
+	v := &UserCustomValidator{
+		Client: c,
+		Lookup: storage.UserLookup{Identifiers: []storage.LoginIdentifier{storage.LoginName, storage.LoginEmail}},
+	}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name    string
+		user    *kimv1.User
+		invalid bool
+	}{
+		{name: "same user", user: user("team-a", "alice", "alice@example.com")},
+		{name: "other address", user: user("team-b", "bob", "bob@example.com")},
+		{name: "no address", user: user("team-b", "bob", "")},
+		{name: "address of alice in another namespace", user: user("team-b", "bob", " ALICE@example.com"), invalid: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := v.ValidateCreate(ctx, tc.user)
+			if tc.invalid != apierrors.IsInvalid(err) || (!tc.invalid && err != nil) {
+				t.Errorf("ValidateCreate() = %v, want invalid %t", err, tc.invalid)
+			}
+		})
+	}
+
+	// the owners of a user can not choose its subject
+	taken := user("team-b", "bob", "")
+	taken.Annotations = map[string]string{kimv1.SubjectAnnotation: "alice-uid"}
+	if _, err := v.ValidateCreate(ctx, taken); !apierrors.IsInvalid(err) {
+		t.Errorf("ValidateCreate() with the subject annotation = %v, want invalid", err)
+	}
+	if _, err := v.ValidateUpdate(ctx, user("team-b", "bob", ""), taken); !apierrors.IsInvalid(err) {
+		t.Errorf("ValidateUpdate() adding the subject annotation = %v, want invalid", err)
+	}
+	if _, err := v.ValidateUpdate(ctx, taken, taken.DeepCopy()); err != nil {
+		t.Errorf("ValidateUpdate() keeping the subject annotation = %v", err)
+	}
+
+	// the uniqueness is only enforced for the identifiers the users log in with
+	v.Lookup = storage.DefaultUserLookup
+	if _, err := v.ValidateCreate(ctx, user("team-b", "bob", "alice@example.com")); err != nil {
+		t.Errorf("ValidateCreate() without email logins = %v", err)
+	}
+}
+
+func TestUserEmailAndSecret(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := kimv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "alice-credentials"}}
+	v := &UserCustomValidator{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(secret).Build(),
+		Lookup: storage.DefaultUserLookup,
+	}
+	ctx := context.Background()
+
+	alice := user("team-a", "alice", "alice@example.com")
+	if err := (&UserCustomDefaulter{}).Default(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+	if alice.Spec.SecretName != "alice-credentials" {
+		t.Errorf("Default() set the secretName %q, want alice-credentials", alice.Spec.SecretName)
+	}
+	if warnings, err := v.ValidateCreate(ctx, alice); err != nil || len(warnings) > 0 {
+		t.Errorf("ValidateCreate() = %v, %v", warnings, err)
+	}
+
+	// the Secret may follow the user
+	alice.Spec.SecretName = "missing"
+	if warnings, err := v.ValidateCreate(ctx, alice); err != nil || len(warnings) != 1 {
+		t.Errorf("ValidateCreate() without the Secret = %v, %v, want a warning", warnings, err)
+	}
+
+	for _, email := range []string{"alice", "Alice <alice@example.com>", "alice@example.com "} {
+		if _, err := v.ValidateCreate(ctx, user("team-a", "alice", email)); !apierrors.IsInvalid(err) {
+			t.Errorf("ValidateCreate() with the email %q = %v, want invalid", email, err)
+		}
+	}
+}
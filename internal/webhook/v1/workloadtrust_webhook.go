@@ -0,0 +1,100 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+var workloadtrustlog = logf.Log.WithName("workloadtrust-resource")
+
+// SetupWorkloadTrustWebhookWithManager registers the webhook for WorkloadTrust in the manager.
+func SetupWorkloadTrustWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&kimv1.WorkloadTrust{}).
+		WithValidator(&WorkloadTrustCustomValidator{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-kim-kim-io-v1-workloadtrust,mutating=false,failurePolicy=fail,sideEffects=None,groups=kim.kim.io,resources=workloadtrusts,verbs=create;update,versions=v1,name=vworkloadtrust-v1.kb.io,admissionReviewVersions=v1
+
+// WorkloadTrustCustomValidator validates the WorkloadTrust resource when it is created or updated, so that a trust
+// does not trust every JWT of its issuer and its keys are not fetched in the clear.
+type WorkloadTrustCustomValidator struct{}
+
+var _ webhook.CustomValidator = &WorkloadTrustCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type WorkloadTrust.
+func (v *WorkloadTrustCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	trust, ok := obj.(*kimv1.WorkloadTrust)
+	if !ok {
+		return nil, fmt.Errorf("expected a WorkloadTrust object but got %T", obj)
+	}
+	workloadtrustlog.Info("Validation for WorkloadTrust upon creation", "name", trust.GetName())
+	return nil, v.validate(trust)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type WorkloadTrust.
+func (v *WorkloadTrustCustomValidator) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	trust, ok := newObj.(*kimv1.WorkloadTrust)
+	if !ok {
+		return nil, fmt.Errorf("expected a WorkloadTrust object for the newObj but got %T", newObj)
+	}
+	workloadtrustlog.Info("Validation for WorkloadTrust upon update", "name", trust.GetName())
+	return nil, v.validate(trust)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type WorkloadTrust.
+func (v *WorkloadTrustCustomValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validate checks that the trust has a subject or a claim condition matching less than any value and that the
+// keys of its issuer are inline or discovered over https
+func (v *WorkloadTrustCustomValidator) validate(trust *kimv1.WorkloadTrust) error {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+	if !trust.Spec.Conditioned() {
+		errs = append(errs, field.Required(spec.Child("subject"),
+			"a subject or a claim condition not matching any value is required"))
+	}
+	if trust.Spec.JWKS == "" {
+		// the discovery document is the well-known openid-configuration of the issuer without a discoveryURL
+		path, value := spec.Child("discoveryURL"), trust.Spec.DiscoveryURL
+		if value == "" {
+			path, value = spec.Child("issuer"), trust.Spec.Issuer
+		}
+		if u, err := url.Parse(value); err != nil || u.Scheme != "https" || u.Host == "" {
+			errs = append(errs, field.Invalid(path, value, "the keys of the issuer are only discovered over https"))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(kimv1.GroupVersion.WithKind("WorkloadTrust").GroupKind(), trust.Name, errs)
+}
@@ -0,0 +1,64 @@
+package v1
+
+import (
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+)
+
+func TestWorkloadTrustConditions(t *testing.T) {
+	v := &WorkloadTrustCustomValidator{}
+	ctx := context.Background()
+	trust := func(mutate func(spec *kimv1.WorkloadTrustSpec)) *kimv1.WorkloadTrust {
+		obj := &kimv1.WorkloadTrust{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "release"},
+			Spec: kimv1.WorkloadTrustSpec{
+				Issuer:            "https://token.actions.example.com",
+				Audiences:         []string{"kim"},
+				Subject:           "repo:example/reports:*",
+				MachineClientName: "deployer",
+			},
+		}
+		mutate(&obj.Spec)
+		return obj
+	}
+
+	for _, tc := range []struct {
+		name    string
+		trust   *kimv1.WorkloadTrust
+		invalid bool
+	}{
+		{name: "subject", trust: trust(func(*kimv1.WorkloadTrustSpec) {})},
+		{name: "claim", trust: trust(func(spec *kimv1.WorkloadTrustSpec) {
+			spec.Subject = ""
+			spec.Claims = []kimv1.WorkloadTrustClaim{{Name: "repository", Value: "example/reports"}}
+		})},
+		{name: "no conditions", trust: trust(func(spec *kimv1.WorkloadTrustSpec) { spec.Subject = "" }), invalid: true},
+		{name: "wildcard conditions", trust: trust(func(spec *kimv1.WorkloadTrustSpec) {
+			spec.Subject = "*"
+			spec.Claims = []kimv1.WorkloadTrustClaim{{Name: "repository", Value: "**"}}
+		}), invalid: true},
+		{name: "http issuer", trust: trust(func(spec *kimv1.WorkloadTrustSpec) {
+			spec.Issuer = "http://token.actions.example.com"
+		}), invalid: true},
+		{name: "http issuer with a discovery url", trust: trust(func(spec *kimv1.WorkloadTrustSpec) {
+			spec.Issuer = "http://token.actions.example.com"
+			spec.DiscoveryURL = "https://token.actions.example.com/.well-known/openid-configuration"
+		})},
+		{name: "http issuer with inline keys", trust: trust(func(spec *kimv1.WorkloadTrustSpec) {
+			spec.Issuer = "http://token.actions.example.com"
+			spec.JWKS = `{"keys":[]}`
+		})},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := v.ValidateCreate(ctx, tc.trust)
+			if tc.invalid != apierrors.IsInvalid(err) || (!tc.invalid && err != nil) {
+				t.Errorf("ValidateCreate() = %v, want invalid %t", err, tc.invalid)
+			}
+		})
+	}
+}
@@ -37,6 +37,7 @@ type ClaimApplyConfiguration struct {
 	PhoneNumber         *string `json:"phoneNumber,omitempty"`
 	PhoneNumberVerified *bool   `json:"phoneNumberVerified,omitempty"`
 	Address             *string `json:"address,omitempty"`
+	IsAdmin             *bool   `json:"isAdmin,omitempty"`
 }
 
 // ClaimApplyConfiguration constructs a declarative configuration of the Claim type for use with
@@ -180,3 +181,11 @@ func (b *ClaimApplyConfiguration) WithAddress(value string) *ClaimApplyConfigura
 	b.Address = &value
 	return b
 }
+
+// WithIsAdmin sets the IsAdmin field in the declarative configuration to the given value
+// and returns the receiver, so that objects can be built by chaining "With" function invocations.
+// If called multiple times, the IsAdmin field is set to the value of the last call.
+func (b *ClaimApplyConfiguration) WithIsAdmin(value bool) *ClaimApplyConfiguration {
+	b.IsAdmin = &value
+	return b
+}
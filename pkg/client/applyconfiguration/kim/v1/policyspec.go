@@ -0,0 +1,61 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by applyconfiguration-gen. DO NOT EDIT.
+
+package v1
+
+// PolicySpecApplyConfiguration represents a declarative configuration of the PolicySpec type for use
+// with apply.
+type PolicySpecApplyConfiguration struct {
+	Desc      *string                  `json:"desc,omitempty"`
+	Statement *string                  `json:"statement,omitempty"`
+	Rules     []RuleApplyConfiguration `json:"rules,omitempty"`
+}
+
+// PolicySpecApplyConfiguration constructs a declarative configuration of the PolicySpec type for use with
+// apply.
+func PolicySpec() *PolicySpecApplyConfiguration {
+	return &PolicySpecApplyConfiguration{}
+}
+
+// WithDesc sets the Desc field in the declarative configuration to the given value
+// and returns the receiver, so that objects can be built by chaining "With" function invocations.
+// If called multiple times, the Desc field is set to the value of the last call.
+func (b *PolicySpecApplyConfiguration) WithDesc(value string) *PolicySpecApplyConfiguration {
+	b.Desc = &value
+	return b
+}
+
+// WithStatement sets the Statement field in the declarative configuration to the given value
+// and returns the receiver, so that objects can be built by chaining "With" function invocations.
+// If called multiple times, the Statement field is set to the value of the last call.
+func (b *PolicySpecApplyConfiguration) WithStatement(value string) *PolicySpecApplyConfiguration {
+	b.Statement = &value
+	return b
+}
+
+// WithRules adds the given value to the Rules field in the declarative configuration
+// and returns the receiver, so that objects can be build by chaining "With" function invocations.
+// If called multiple times, values provided by each call will be appended to the Rules field.
+func (b *PolicySpecApplyConfiguration) WithRules(values ...*RuleApplyConfiguration) *PolicySpecApplyConfiguration {
+	for i := range values {
+		if values[i] == nil {
+			panic("nil value passed to WithRules")
+		}
+		b.Rules = append(b.Rules, *values[i])
+	}
+	return b
+}
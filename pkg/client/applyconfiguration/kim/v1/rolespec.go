@@ -0,0 +1,49 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by applyconfiguration-gen. DO NOT EDIT.
+
+package v1
+
+// RoleSpecApplyConfiguration represents a declarative configuration of the RoleSpec type for use
+// with apply.
+type RoleSpecApplyConfiguration struct {
+	Desc        *string  `json:"desc,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// RoleSpecApplyConfiguration constructs a declarative configuration of the RoleSpec type for use with
+// apply.
+func RoleSpec() *RoleSpecApplyConfiguration {
+	return &RoleSpecApplyConfiguration{}
+}
+
+// WithDesc sets the Desc field in the declarative configuration to the given value
+// and returns the receiver, so that objects can be built by chaining "With" function invocations.
+// If called multiple times, the Desc field is set to the value of the last call.
+func (b *RoleSpecApplyConfiguration) WithDesc(value string) *RoleSpecApplyConfiguration {
+	b.Desc = &value
+	return b
+}
+
+// WithPermissions adds the given value to the Permissions field in the declarative configuration
+// and returns the receiver, so that objects can be build by chaining "With" function invocations.
+// If called multiple times, values provided by each call will be appended to the Permissions field.
+func (b *RoleSpecApplyConfiguration) WithPermissions(values ...string) *RoleSpecApplyConfiguration {
+	for i := range values {
+		b.Permissions = append(b.Permissions, values[i])
+	}
+	return b
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by applyconfiguration-gen. DO NOT EDIT.
+
+package v1
+
+// RuleApplyConfiguration represents a declarative configuration of the Rule type for use
+// with apply.
+type RuleApplyConfiguration struct {
+	Resource *string  `json:"resource,omitempty"`
+	Actions  []string `json:"actions,omitempty"`
+	Effect   *string  `json:"effect,omitempty"`
+}
+
+// RuleApplyConfiguration constructs a declarative configuration of the Rule type for use with
+// apply.
+func Rule() *RuleApplyConfiguration {
+	return &RuleApplyConfiguration{}
+}
+
+// WithResource sets the Resource field in the declarative configuration to the given value
+// and returns the receiver, so that objects can be built by chaining "With" function invocations.
+// If called multiple times, the Resource field is set to the value of the last call.
+func (b *RuleApplyConfiguration) WithResource(value string) *RuleApplyConfiguration {
+	b.Resource = &value
+	return b
+}
+
+// WithActions adds the given value to the Actions field in the declarative configuration
+// and returns the receiver, so that objects can be build by chaining "With" function invocations.
+// If called multiple times, values provided by each call will be appended to the Actions field.
+func (b *RuleApplyConfiguration) WithActions(values ...string) *RuleApplyConfiguration {
+	for i := range values {
+		b.Actions = append(b.Actions, values[i])
+	}
+	return b
+}
+
+// WithEffect sets the Effect field in the declarative configuration to the given value
+// and returns the receiver, so that objects can be built by chaining "With" function invocations.
+// If called multiple times, the Effect field is set to the value of the last call.
+func (b *RuleApplyConfiguration) WithEffect(value string) *RuleApplyConfiguration {
+	b.Effect = &value
+	return b
+}
@@ -18,7 +18,6 @@ limitations under the License.
 package v1
 
 import (
-	kimv1 "github.com/crochee/kim/api/kim/v1"
 	apismetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	types "k8s.io/apimachinery/pkg/types"
 	metav1 "k8s.io/client-go/applyconfigurations/meta/v1"
@@ -29,8 +28,8 @@ import (
 type UserApplyConfiguration struct {
 	metav1.TypeMetaApplyConfiguration    `json:",inline"`
 	*metav1.ObjectMetaApplyConfiguration `json:"metadata,omitempty"`
-	Spec                                 *UserSpecApplyConfiguration `json:"spec,omitempty"`
-	Status                               *kimv1.UserStatus           `json:"status,omitempty"`
+	Spec                                 *UserSpecApplyConfiguration   `json:"spec,omitempty"`
+	Status                               *UserStatusApplyConfiguration `json:"status,omitempty"`
 }
 
 // User constructs a declarative configuration of the User type for use with
@@ -213,8 +212,8 @@ func (b *UserApplyConfiguration) WithSpec(value *UserSpecApplyConfiguration) *Us
 // WithStatus sets the Status field in the declarative configuration to the given value
 // and returns the receiver, so that objects can be built by chaining "With" function invocations.
 // If called multiple times, the Status field is set to the value of the last call.
-func (b *UserApplyConfiguration) WithStatus(value kimv1.UserStatus) *UserApplyConfiguration {
-	b.Status = &value
+func (b *UserApplyConfiguration) WithStatus(value *UserStatusApplyConfiguration) *UserApplyConfiguration {
+	b.Status = value
 	return b
 }
 
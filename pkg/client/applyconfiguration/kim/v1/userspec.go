@@ -23,6 +23,7 @@ type UserSpecApplyConfiguration struct {
 	Desc                    *string `json:"desc,omitempty"`
 	SecretName              *string `json:"secretName,omitempty"`
 	ClaimApplyConfiguration `json:",inline"`
+	Policies                []string `json:"policies,omitempty"`
 }
 
 // UserSpecApplyConfiguration constructs a declarative configuration of the UserSpec type for use with
@@ -182,3 +183,21 @@ func (b *UserSpecApplyConfiguration) WithAddress(value string) *UserSpecApplyCon
 	b.ClaimApplyConfiguration.Address = &value
 	return b
 }
+
+// WithIsAdmin sets the IsAdmin field in the declarative configuration to the given value
+// and returns the receiver, so that objects can be built by chaining "With" function invocations.
+// If called multiple times, the IsAdmin field is set to the value of the last call.
+func (b *UserSpecApplyConfiguration) WithIsAdmin(value bool) *UserSpecApplyConfiguration {
+	b.ClaimApplyConfiguration.IsAdmin = &value
+	return b
+}
+
+// WithPolicies adds the given value to the Policies field in the declarative configuration
+// and returns the receiver, so that objects can be build by chaining "With" function invocations.
+// If called multiple times, values provided by each call will be appended to the Policies field.
+func (b *UserSpecApplyConfiguration) WithPolicies(values ...string) *UserSpecApplyConfiguration {
+	for i := range values {
+		b.Policies = append(b.Policies, values[i])
+	}
+	return b
+}
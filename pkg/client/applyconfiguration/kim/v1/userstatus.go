@@ -0,0 +1,66 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by applyconfiguration-gen. DO NOT EDIT.
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	applyconfigurationsmetav1 "k8s.io/client-go/applyconfigurations/meta/v1"
+)
+
+// UserStatusApplyConfiguration represents a declarative configuration of the UserStatus type for use
+// with apply.
+type UserStatusApplyConfiguration struct {
+	ObservedGeneration *int64                                                  `json:"observedGeneration,omitempty"`
+	LockedUntil        *metav1.Time                                            `json:"lockedUntil,omitempty"`
+	Conditions         []applyconfigurationsmetav1.ConditionApplyConfiguration `json:"conditions,omitempty"`
+}
+
+// UserStatusApplyConfiguration constructs a declarative configuration of the UserStatus type for use with
+// apply.
+func UserStatus() *UserStatusApplyConfiguration {
+	return &UserStatusApplyConfiguration{}
+}
+
+// WithObservedGeneration sets the ObservedGeneration field in the declarative configuration to the given value
+// and returns the receiver, so that objects can be built by chaining "With" function invocations.
+// If called multiple times, the ObservedGeneration field is set to the value of the last call.
+func (b *UserStatusApplyConfiguration) WithObservedGeneration(value int64) *UserStatusApplyConfiguration {
+	b.ObservedGeneration = &value
+	return b
+}
+
+// WithLockedUntil sets the LockedUntil field in the declarative configuration to the given value
+// and returns the receiver, so that objects can be built by chaining "With" function invocations.
+// If called multiple times, the LockedUntil field is set to the value of the last call.
+func (b *UserStatusApplyConfiguration) WithLockedUntil(value metav1.Time) *UserStatusApplyConfiguration {
+	b.LockedUntil = &value
+	return b
+}
+
+// WithConditions adds the given value to the Conditions field in the declarative configuration
+// and returns the receiver, so that objects can be build by chaining "With" function invocations.
+// If called multiple times, values provided by each call will be appended to the Conditions field.
+func (b *UserStatusApplyConfiguration) WithConditions(values ...*applyconfigurationsmetav1.ConditionApplyConfiguration) *UserStatusApplyConfiguration {
+	for i := range values {
+		if values[i] == nil {
+			panic("nil value passed to WithConditions")
+		}
+		b.Conditions = append(b.Conditions, *values[i])
+	}
+	return b
+}
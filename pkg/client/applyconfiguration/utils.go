@@ -33,10 +33,26 @@ func ForKind(kind schema.GroupVersionKind) interface{} {
 	// Group=kim, Version=v1
 	case v1.SchemeGroupVersion.WithKind("Claim"):
 		return &kimv1.ClaimApplyConfiguration{}
+	case v1.SchemeGroupVersion.WithKind("Policy"):
+		return &kimv1.PolicyApplyConfiguration{}
+	case v1.SchemeGroupVersion.WithKind("PolicySpec"):
+		return &kimv1.PolicySpecApplyConfiguration{}
+	case v1.SchemeGroupVersion.WithKind("PolicyStatus"):
+		return &kimv1.PolicyStatusApplyConfiguration{}
+	case v1.SchemeGroupVersion.WithKind("Role"):
+		return &kimv1.RoleApplyConfiguration{}
+	case v1.SchemeGroupVersion.WithKind("RoleSpec"):
+		return &kimv1.RoleSpecApplyConfiguration{}
+	case v1.SchemeGroupVersion.WithKind("RoleStatus"):
+		return &kimv1.RoleStatusApplyConfiguration{}
+	case v1.SchemeGroupVersion.WithKind("Rule"):
+		return &kimv1.RuleApplyConfiguration{}
 	case v1.SchemeGroupVersion.WithKind("User"):
 		return &kimv1.UserApplyConfiguration{}
 	case v1.SchemeGroupVersion.WithKind("UserSpec"):
 		return &kimv1.UserSpecApplyConfiguration{}
+	case v1.SchemeGroupVersion.WithKind("UserStatus"):
+		return &kimv1.UserStatusApplyConfiguration{}
 
 	}
 	return nil
@@ -27,6 +27,14 @@ type FakeKimV1 struct {
 	*testing.Fake
 }
 
+func (c *FakeKimV1) Policies(namespace string) v1.PolicyInterface {
+	return newFakePolicies(c, namespace)
+}
+
+func (c *FakeKimV1) Roles(namespace string) v1.RoleInterface {
+	return newFakeRoles(c, namespace)
+}
+
 func (c *FakeKimV1) Users(namespace string) v1.UserInterface {
 	return newFakeUsers(c, namespace)
 }
@@ -0,0 +1,48 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	v1 "github.com/crochee/kim/api/kim/v1"
+	kimv1 "github.com/crochee/kim/pkg/client/applyconfiguration/kim/v1"
+	typedkimv1 "github.com/crochee/kim/pkg/client/clientset/versioned/typed/kim/v1"
+	gentype "k8s.io/client-go/gentype"
+)
+
+// fakeRoles implements RoleInterface
+type fakeRoles struct {
+	*gentype.FakeClientWithListAndApply[*v1.Role, *v1.RoleList, *kimv1.RoleApplyConfiguration]
+	Fake *FakeKimV1
+}
+
+func newFakeRoles(fake *FakeKimV1, namespace string) typedkimv1.RoleInterface {
+	return &fakeRoles{
+		gentype.NewFakeClientWithListAndApply[*v1.Role, *v1.RoleList, *kimv1.RoleApplyConfiguration](
+			fake.Fake,
+			namespace,
+			v1.SchemeGroupVersion.WithResource("roles"),
+			v1.SchemeGroupVersion.WithKind("Role"),
+			func() *v1.Role { return &v1.Role{} },
+			func() *v1.RoleList { return &v1.RoleList{} },
+			func(dst, src *v1.RoleList) { dst.ListMeta = src.ListMeta },
+			func(list *v1.RoleList) []*v1.Role { return gentype.ToPointerSlice(list.Items) },
+			func(list *v1.RoleList, items []*v1.Role) { list.Items = gentype.FromPointerSlice(items) },
+		),
+		fake,
+	}
+}
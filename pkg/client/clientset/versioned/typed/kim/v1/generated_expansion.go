@@ -17,4 +17,8 @@ limitations under the License.
 
 package v1
 
+type PolicyExpansion interface{}
+
+type RoleExpansion interface{}
+
 type UserExpansion interface{}
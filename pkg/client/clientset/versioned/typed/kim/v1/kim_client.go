@@ -27,6 +27,8 @@ import (
 
 type KimV1Interface interface {
 	RESTClient() rest.Interface
+	PoliciesGetter
+	RolesGetter
 	UsersGetter
 }
 
@@ -35,6 +37,14 @@ type KimV1Client struct {
 	restClient rest.Interface
 }
 
+func (c *KimV1Client) Policies(namespace string) PolicyInterface {
+	return newPolicies(c, namespace)
+}
+
+func (c *KimV1Client) Roles(namespace string) RoleInterface {
+	return newRoles(c, namespace)
+}
+
 func (c *KimV1Client) Users(namespace string) UserInterface {
 	return newUsers(c, namespace)
 }
@@ -0,0 +1,73 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1
+
+import (
+	context "context"
+
+	kimv1 "github.com/crochee/kim/api/kim/v1"
+	applyconfigurationkimv1 "github.com/crochee/kim/pkg/client/applyconfiguration/kim/v1"
+	scheme "github.com/crochee/kim/pkg/client/clientset/versioned/scheme"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	gentype "k8s.io/client-go/gentype"
+)
+
+// RolesGetter has a method to return a RoleInterface.
+// A group's client should implement this interface.
+type RolesGetter interface {
+	Roles(namespace string) RoleInterface
+}
+
+// RoleInterface has methods to work with Role resources.
+type RoleInterface interface {
+	Create(ctx context.Context, role *kimv1.Role, opts metav1.CreateOptions) (*kimv1.Role, error)
+	Update(ctx context.Context, role *kimv1.Role, opts metav1.UpdateOptions) (*kimv1.Role, error)
+	// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+	UpdateStatus(ctx context.Context, role *kimv1.Role, opts metav1.UpdateOptions) (*kimv1.Role, error)
+	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*kimv1.Role, error)
+	List(ctx context.Context, opts metav1.ListOptions) (*kimv1.RoleList, error)
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (result *kimv1.Role, err error)
+	Apply(ctx context.Context, role *applyconfigurationkimv1.RoleApplyConfiguration, opts metav1.ApplyOptions) (result *kimv1.Role, err error)
+	// Add a +genclient:noStatus comment above the type to avoid generating ApplyStatus().
+	ApplyStatus(ctx context.Context, role *applyconfigurationkimv1.RoleApplyConfiguration, opts metav1.ApplyOptions) (result *kimv1.Role, err error)
+	RoleExpansion
+}
+
+// roles implements RoleInterface
+type roles struct {
+	*gentype.ClientWithListAndApply[*kimv1.Role, *kimv1.RoleList, *applyconfigurationkimv1.RoleApplyConfiguration]
+}
+
+// newRoles returns a Roles
+func newRoles(c *KimV1Client, namespace string) *roles {
+	return &roles{
+		gentype.NewClientWithListAndApply[*kimv1.Role, *kimv1.RoleList, *applyconfigurationkimv1.RoleApplyConfiguration](
+			"roles",
+			c.RESTClient(),
+			scheme.ParameterCodec,
+			namespace,
+			func() *kimv1.Role { return &kimv1.Role{} },
+			func() *kimv1.RoleList { return &kimv1.RoleList{} },
+		),
+	}
+}